@@ -21,6 +21,9 @@ readonly USAGE="$(basename "${BASH_SOURCE[0]}") [options]
 
 Deploy letsencrypt controller.
 
+Deprecated: the SDI observer operator issues the certificates of the routes it manages itself. Set
+\`acme\` in the route spec of the SDIObserver instead.
+
 Options:
   -h | --help    Show this message and exit.
   -w | --wait    Block until all resources are available.
@@ -17,7 +17,10 @@ limitations under the License.
 package v1alpha1
 
 import (
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
 const (
@@ -37,6 +40,26 @@ const (
 	ConditionTypeReady       = "Ready"
 	ConditionTypeDegraded    = "Degraded"
 	ConditionTypeProgressing = "Progressing"
+
+	// ConditionTypeRegistryPullSecret reports whether the SDI registry pull secrets are linked to the
+	// default service account in the SDI namespace.
+	ConditionTypeRegistryPullSecret = "RegistryPullSecretLinked"
+	// ConditionTypeTerminating reports the progress of the cleanup of a deleted SDIObserver.
+	ConditionTypeTerminating = "Terminating"
+	// ConditionTypeConfigDrift reports whether the last adjustment found and corrected objects that were
+	// changed outside of the operator.
+	ConditionTypeConfigDrift = "ConfigDrift"
+	// ConditionTypeDryRun reports whether the observer runs in DryRun mode and how many changes it planned.
+	ConditionTypeDryRun = "DryRun"
+	// ConditionTypeCertificateExpiring reports whether a certificate handled by the operator expires soon
+	// or has expired.
+	ConditionTypeCertificateExpiring = "CertificateExpiring"
+	// ConditionTypeCertificateChainMismatch reports whether the certificate served by vsystem cannot be
+	// verified with the destination CA of the vsystem route.
+	ConditionTypeCertificateChainMismatch = "CertificateChainMismatch"
+	// ConditionTypeCertificateIssued reports whether the certificate of a route has been issued by its
+	// ACME server.
+	ConditionTypeCertificateIssued = "CertificateIssued"
 )
 
 const (
@@ -46,10 +69,107 @@ const (
 	ReasonSucceeded                       = "OperatorSucceeded"
 	ReasonRouteManagementStateUnsupported = "RouteManagementStateUnsupported"
 	ReasonFailed                          = "OperatorFailed"
+	ReasonAdjustmentSkipped               = "AdjustmentSkipped"
+	ReasonDependencyFailed                = "DependencyFailed"
+	ReasonNodeConfigUnmanaged             = "NodeConfigUnmanaged"
+	ReasonNodeConfigOwnedByOther          = "NodeConfigOwnedByOtherObserver"
+	ReasonSDINamespaceOwnedByOther        = "SDINamespaceOwnedByOtherObserver"
+	ReasonSLCBRouteOwnedByOther           = "SLCBRouteOwnedByOtherObserver"
+	ReasonRouteUnmanaged                  = "RouteUnmanaged"
+	ReasonPullSecretLinked                = "PullSecretLinked"
+	ReasonPullSecretNotFound              = "PullSecretNotFound"
+	ReasonCleanupInProgress               = "CleanupInProgress"
+	ReasonCleanupFailed                   = "CleanupFailed"
+	ReasonDriftCorrected                  = "DriftCorrected"
+	ReasonNoDrift                         = "NoDriftDetected"
+	ReasonNodeConfigRendering             = "NodeConfigRendering"
+	ReasonNodesUpdating                   = "NodesUpdating"
+	ReasonNoSDINodes                      = "NoSDINodes"
+	ReasonDriftDetected                   = "DriftDetected"
+	ReasonChangesPlanned                  = "ChangesPlanned"
+	ReasonNoChangesPlanned                = "NoChangesPlanned"
+	ReasonEnforced                        = "Enforced"
+	ReasonUnsupportedSDIVersion           = "UnsupportedSDIVersion"
+	ReasonStatefulSetRecreating           = "StatefulSetRecreating"
+	ReasonInvalidRoute                    = "InvalidRoute"
+	ReasonCABundleUnmanaged               = "CABundleUnmanaged"
+	ReasonCertificatesValid               = "CertificatesValid"
+	ReasonCertificateExpiring             = "CertificateExpiring"
+	ReasonCertificateExpired              = "CertificateExpired"
+	ReasonChainVerified                   = "ChainVerified"
+	ReasonChainMismatch                   = "ChainMismatch"
+	ReasonChainUnverified                 = "ChainUnverified"
+	ReasonCertificateIssued               = "CertificateIssued"
+	ReasonIssuancePending                 = "IssuancePending"
+	ReasonIssuanceFailed                  = "IssuanceFailed"
 )
 
 type RouteManagementState string
 
+// ObserverMode tells whether the observer applies or only plans the adjustments.
+type ObserverMode string
+
+const (
+	// ObserverModeEnforce instructs the observer to apply the adjustments.
+	ObserverModeEnforce ObserverMode = "Enforce"
+	// ObserverModeDryRun instructs the observer to only plan the adjustments. The changes it would make are
+	// reported in the status and in events; nothing is modified.
+	ObserverModeDryRun ObserverMode = "DryRun"
+)
+
+// NodeLogFormat is the format of the container log files on the nodes.
+type NodeLogFormat string
+
+const (
+	// NodeLogFormatJSON configures the diagnostics fluentd pods to parse json node logs.
+	NodeLogFormatJSON NodeLogFormat = "json"
+	// NodeLogFormatText configures the diagnostics fluentd pods to parse text node logs written by CRI-O.
+	NodeLogFormatText NodeLogFormat = "text"
+	// NodeLogFormatAuto determines the node log format from the container runtime of the SDI nodes.
+	NodeLogFormatAuto NodeLogFormat = "auto"
+)
+
+const (
+	// RouteTerminationEdge terminates the TLS connections at the router.
+	RouteTerminationEdge = "edge"
+	// RouteTerminationReencrypt terminates the TLS connections at the router and opens new ones to the
+	// service, verified with the CA bundle of the service.
+	RouteTerminationReencrypt = "reencrypt"
+	// RouteTerminationPassthrough passes the TLS connections through to the service.
+	RouteTerminationPassthrough = "passthrough"
+)
+
+type RouteTermination string
+
+const (
+	// RouteDestinationCASDI verifies the service of a reencrypt route with the CA bundle of SDI.
+	RouteDestinationCASDI = "SDI"
+	// RouteDestinationCANone leaves the verification of the service of a reencrypt route to the router,
+	// e.g. for services with a certificate of the service CA.
+	RouteDestinationCANone = "None"
+)
+
+type RouteDestinationCA string
+
+const (
+	// ExposureBackendAuto selects an OpenShift Route if the cluster serves routes, a Gateway API route if a
+	// gateway is referenced and the cluster serves the Gateway API, and an Ingress otherwise.
+	ExposureBackendAuto = "Auto"
+	// ExposureBackendRoute exposes the service with an OpenShift Route.
+	ExposureBackendRoute = "Route"
+	// ExposureBackendIngress exposes the service with a networking.k8s.io/v1 Ingress. The TLS connections are
+	// terminated by the ingress controller.
+	ExposureBackendIngress = "Ingress"
+	// ExposureBackendHTTPRoute exposes the service with a Gateway API HTTPRoute. The TLS connections are
+	// terminated by the gateway.
+	ExposureBackendHTTPRoute = "HTTPRoute"
+	// ExposureBackendTLSRoute exposes the service with a Gateway API TLSRoute passing the TLS connections
+	// through to the service.
+	ExposureBackendTLSRoute = "TLSRoute"
+)
+
+type ExposureBackend string
+
 // EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
 // NOTE: json tags are required.  Any new fields you add must have json tags for the fields to be serialized.
 
@@ -58,21 +178,303 @@ type ManagedRouteSpec struct {
 	// +kubebuilder:default="Managed"
 	// +kubebuilder:validation:Enum=Managed;Unmanaged;Removed
 	ManagementState RouteManagementState `json:"managementState,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// Host of the route, e.g. on the corporate domain. If empty, the host is generated by the router
+	Host string `json:"host,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Enum=edge;reencrypt;passthrough
+	// Termination of the TLS connections. Defaults to reencrypt for vsystem and passthrough for SLC Bridge
+	Termination RouteTermination `json:"termination,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// CertificateSecretRef references a kubernetes.io/tls secret in the namespace of the route holding the certificate (tls.crt) and key (tls.key) served by the router, and optionally the CA certificate (ca.crt) of its chain. Not supported with the passthrough termination
+	CertificateSecretRef *corev1.LocalObjectReference `json:"certificateSecretRef,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// Annotations are added to the route, e.g. haproxy timeouts or cert-manager settings. They override the default annotations
+	Annotations map[string]string `json:"annotations,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Enum=None;Subdomain
+	// WildcardPolicy of the route. Defaults to None
+	WildcardPolicy string `json:"wildcardPolicy,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default:="Auto"
+	// +kubebuilder:validation:Enum=Auto;Route;Ingress;HTTPRoute;TLSRoute
+	// Backend exposing the service: an OpenShift Route, an Ingress (edge termination), a Gateway API HTTPRoute (edge termination) or TLSRoute (passthrough termination). Auto detects it from the APIs served by the cluster
+	Backend ExposureBackend `json:"backend,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// IngressClassName of the Ingress backend. Defaults to the default ingress class of the cluster
+	IngressClassName string `json:"ingressClassName,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// GatewayRef is the gateway the HTTPRoute and TLSRoute backends attach to. The certificate of the edge termination is configured on the gateway
+	GatewayRef *GatewayReference `json:"gatewayRef,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// ACME makes the operator obtain the certificate of the route from an ACME server, e.g. Let's Encrypt, and renew it. The HTTP-01 challenges are answered through a temporary route. Only supported with the Route backend and not with CertificateSecretRef or the passthrough termination
+	ACME *ACMESpec `json:"acme,omitempty"`
+}
+
+// ACMESpec configures the issuance of the certificate of a route by an ACME (RFC 8555) server.
+type ACMESpec struct {
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default:="https://acme-v02.api.letsencrypt.org/directory"
+	// DirectoryURL of the ACME server, e.g. the one of Let's Encrypt staging or of a Pebble test server
+	DirectoryURL string `json:"directoryURL,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// Email is the contact of the ACME account, notified by the ACME server about expiring certificates
+	Email string `json:"email,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// CACertificate is the PEM bundle verifying the TLS certificate of the ACME server. Defaults to the system trust store
+	CACertificate string `json:"caCertificate,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default:=30
+	// +kubebuilder:validation:Minimum=1
+	// RenewBeforeDays is the number of days before the expiry of the certificate from which it is renewed
+	RenewBeforeDays int32 `json:"renewBeforeDays,omitempty"`
+}
+
+// GatewayReference references a Gateway API gateway.
+type GatewayReference struct {
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength=1
+	// Name of the gateway
+	Name string `json:"name"`
+
+	// +kubebuilder:validation:Optional
+	// Namespace of the gateway. Defaults to the namespace of the route
+	Namespace string `json:"namespace,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// SectionName is the name of the listener of the gateway
+	SectionName string `json:"sectionName,omitempty"`
+}
+
+// RouteSpec describes an additional route exposing a service of SDI or SLC Bridge, e.g. a Kafka or an
+// OpenAPI gateway.
+type RouteSpec struct {
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:MaxLength=63
+	// Name of the route. Must not be the name of the vsystem or sap-slcbridge route
+	Name string `json:"name"`
+
+	// +kubebuilder:validation:Optional
+	// Namespace of the route and its service. Either the SDI or the SLC Bridge namespace; defaults to the SDI namespace
+	Namespace string `json:"namespace,omitempty"`
+
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength=1
+	// Service exposed by the route
+	Service string `json:"service"`
+
+	// +kubebuilder:validation:Optional
+	// Port is the name or number of the target port of the service. If empty, the route targets any port of the service
+	Port *intstr.IntOrString `json:"port,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default:="SDI"
+	// +kubebuilder:validation:Enum=SDI;None
+	// DestinationCA verifies the service of a reencrypt route with the CA bundle of SDI, or with the one of the router if None
+	DestinationCA RouteDestinationCA `json:"destinationCA,omitempty"`
+
+	// Route management and customization. The termination defaults to reencrypt
+	ManagedRouteSpec `json:",inline"`
+}
+
+// CABundleSource references a Secret or a ConfigMap holding CA certificates.
+type CABundleSource struct {
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default:="Secret"
+	// +kubebuilder:validation:Enum=Secret;ConfigMap
+	// Kind of the source
+	Kind string `json:"kind,omitempty"`
+
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength=1
+	// Name of the source
+	Name string `json:"name"`
+
+	// +kubebuilder:validation:Optional
+	// Namespace of the source. Defaults to the namespace of the observer
+	Namespace string `json:"namespace,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// Keys of the source holding the PEM certificates. Defaults to the keys cert, certificate, ca, ca-bundle, cabundle and the keys ending with .crt or .pem
+	Keys []string `json:"keys,omitempty"`
+}
+
+// CABundleSpec configures the propagation of CA certificates to the cluster image configuration and to SDI.
+type CABundleSpec struct {
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default:={{kind: Secret, namespace: openshift-ingress-operator, name: router-ca}}
+	// Sources of the CA certificates. Defaults to the CA of the OpenShift router, which signs the edge and reencrypt routes
+	Sources []CABundleSource `json:"sources,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// RegistryHostnames are the registries, e.g. the SDI registry, whose certificates the cluster trusts with the bundle. The bundle is added to the additionalTrustedCA ConfigMap of image.config.openshift.io/cluster for each of them
+	RegistryHostnames []string `json:"registryHostnames,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default:=true
+	// InjectIntoSDI writes the bundle to the cmcertificates secret trusted by the SDI connection management
+	InjectIntoSDI bool `json:"injectIntoSDI"`
+}
+
+// NodeConfigSpec tunes the configuration applied to the SDI nodes.
+type NodeConfigSpec struct {
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default:=16384
+	// +kubebuilder:validation:Minimum=1024
+	// PodPidsLimit is the maximum number of processes allowed in a pod running on the SDI nodes
+	PodPidsLimit int64 `json:"podPidsLimit,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// ExtraKernelModules are loaded on the SDI nodes in addition to the kernel modules required by SAP DI
+	ExtraKernelModules []string `json:"extraKernelModules,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// ExtraSysctls are kernel parameters set on the SDI nodes, e.g. "net.ipv4.ip_local_port_range": "32768 60999"
+	ExtraSysctls map[string]string `json:"extraSysctls,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:pruning:PreserveUnknownFields
+	// +kubebuilder:validation:Type=object
+	// KubeletTunables are additional KubeletConfiguration fields applied to the SDI nodes. The pods pids limit is set by PodPidsLimit.
+	// They are applied only if the machine-config ClusterOperator is available.
+	KubeletTunables *runtime.RawExtension `json:"kubeletTunables,omitempty"`
+}
+
+// PlannedChange describes a change of an object the observer would make in Enforce mode.
+type PlannedChange struct {
+	// Step is the adjustment step planning the change, e.g. "SDI network".
+	Step string `json:"step,omitempty"`
+	// Action is one of Create, Update, Patch or Delete.
+	Action string `json:"action"`
+	// Kind of the changed object.
+	Kind string `json:"kind"`
+	// Namespace of the changed object; empty for cluster-scoped objects.
+	Namespace string `json:"namespace,omitempty"`
+	// Name of the changed object.
+	Name string `json:"name"`
+	// Patch is the JSON merge patch of the change, truncated if too long. Empty for deletions.
+	Patch string `json:"patch,omitempty"`
 }
 
 // ManagedRouteStatus informs about status of a managed route for an SDI service.
 type ManagedRouteStatus struct {
 	Conditions []metav1.Condition `json:"conditions"`
+
+	// Backend exposing the service, e.g. Route or Ingress.
+	Backend ExposureBackend `json:"backend,omitempty"`
+
+	// ACME informs about the certificate issued by the ACME server.
+	ACME *ACMEStatus `json:"acme,omitempty"`
+}
+
+// ACMEStatus informs about the certificate of a route issued by an ACME server.
+type ACMEStatus struct {
+	// SecretName is the kubernetes.io/tls secret in the namespace of the route holding the certificate.
+	SecretName string `json:"secretName"`
+	// NotAfter is the expiry of the certificate.
+	NotAfter *metav1.Time `json:"notAfter,omitempty"`
+	// LastFailureTime is the time of the last failed issuance. The issuance is retried after a delay.
+	LastFailureTime *metav1.Time `json:"lastFailureTime,omitempty"`
+}
+
+// RouteStatus informs about status of an additional route.
+type RouteStatus struct {
+	// Name of the route.
+	Name string `json:"name"`
+	// Namespace of the route.
+	Namespace string `json:"namespace"`
+
+	ManagedRouteStatus `json:",inline"`
+}
+
+// CACertificateState informs about a certificate of the CA bundle.
+type CACertificateState struct {
+	// Source of the certificate as kind/namespace/name.
+	Source string `json:"source"`
+	// Subject of the certificate.
+	Subject string `json:"subject"`
+	// Fingerprint is the SHA-256 fingerprint of the certificate.
+	Fingerprint string `json:"fingerprint"`
+	// NotAfter is the expiry of the certificate.
+	NotAfter metav1.Time `json:"notAfter"`
+}
+
+// CABundleStatus informs about status of the CA bundle propagation.
+type CABundleStatus struct {
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// Certificates of the propagated bundle.
+	Certificates []CACertificateState `json:"certificates,omitempty"`
+}
+
+// CertificateState informs about the validity of a certificate handled by the operator.
+type CertificateState struct {
+	// Name tells where the certificate is used, e.g. the secret or the route holding it.
+	Name string `json:"name"`
+	// Subject of the certificate.
+	Subject string `json:"subject"`
+	// NotAfter is the expiry of the certificate.
+	NotAfter metav1.Time `json:"notAfter"`
+}
+
+// CertificatesStatus informs about the validity of the certificates handled by the operator.
+type CertificatesStatus struct {
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// Certificates handled by the operator: the CA bundle of vsystem, the certificates of the managed
+	// routes and the certificates of the CA bundle.
+	Certificates []CertificateState `json:"certificates,omitempty"`
 }
 
 // SDIConfigStatus informs about status of SDI patching.
 type SDIConfigStatus struct {
 	Conditions []metav1.Condition `json:"conditions"`
+
+	// DetectedVersion is the version of SDI found in the SDI namespace. Empty until SDI is installed.
+	DetectedVersion string `json:"detectedVersion,omitempty"`
+}
+
+// SDINodeState informs about the configuration of a single SDI node.
+type SDINodeState struct {
+	// Name of the node.
+	Name string `json:"name"`
+	// CurrentConfig is the rendered MachineConfig applied to the node.
+	CurrentConfig string `json:"currentConfig,omitempty"`
+	// DesiredConfig is the rendered MachineConfig the node is being updated to.
+	DesiredConfig string `json:"desiredConfig,omitempty"`
+	// State of the node configuration as reported by the machine config daemon or the node-configurator pod, e.g. Done, Working or Degraded.
+	State string `json:"state,omitempty"`
+	// Reason of a degraded state.
+	Reason string `json:"reason,omitempty"`
 }
 
 // SDINodeConfigStatus informs about status of SDI node configuration.
 type SDINodeConfigStatus struct {
 	Conditions []metav1.Condition `json:"conditions"`
+
+	// RenderedConfig is the rendered MachineConfig the SDI nodes are being updated to.
+	RenderedConfig string `json:"renderedConfig,omitempty"`
+	// MachineCount is the number of SDI nodes.
+	MachineCount int32 `json:"machineCount,omitempty"`
+	// UpdatedMachineCount is the number of SDI nodes running the current node configuration.
+	UpdatedMachineCount int32 `json:"updatedMachineCount,omitempty"`
+	// DegradedMachineCount is the number of SDI nodes which failed to apply the node configuration.
+	DegradedMachineCount int32 `json:"degradedMachineCount,omitempty"`
+	// Nodes informs about the configuration of the individual SDI nodes.
+	Nodes []SDINodeState `json:"nodes,omitempty"`
 }
 
 // SDIObserverSpec defines the desired state of SDIObserver
@@ -94,8 +496,14 @@ type SDIObserverSpec struct {
 	// SLCBNamespace is the namespace in which the SAP SLC Bridge is running
 	SLCBNamespace string `json:"slcbNamespace"`
 
+	// SDIVSystemRoute manages the preset route of the vsystem service in the SDI namespace
 	SDIVSystemRoute ManagedRouteSpec `json:"sdiVSystemRoute"`
-	SLCBRoute       ManagedRouteSpec `json:"slcbRoute"`
+	// SLCBRoute manages the preset route of the SLC Bridge service in the SLC Bridge namespace
+	SLCBRoute ManagedRouteSpec `json:"slcbRoute"`
+
+	// +kubebuilder:validation:Optional
+	// Routes are additional routes exposing services of SDI or SLC Bridge. A route dropped from the list is left as it is
+	Routes []RouteSpec `json:"routes,omitempty"`
 
 	// +kubebuilder:validation:Required
 	// +kubebuilder:default:=true
@@ -106,6 +514,38 @@ type SDIObserverSpec struct {
 	// +kubebuilder:default:="node-role.kubernetes.io/sdi="
 	// SDINodeLabel should be set to the corresponding SAP DI node label. It will be used for annotating the namespaces of SAP DI service so that the Pods will be running on the labeled SAP DI node
 	SDINodeLabel string `json:"SDINodeLabel"`
+
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default:="auto"
+	// +kubebuilder:validation:Enum=json;text;auto
+	// NodeLogFormat is the format of the container log files on the nodes. The diagnostics fluentd pods will be configured to parse it. If set to auto, the format is determined from the container runtime of the nodes.
+	NodeLogFormat NodeLogFormat `json:"nodeLogFormat,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default:={}
+	// NodeConfig tunes the SDI node configuration managed by the operator if ManageSDINodeConfig is true
+	NodeConfig NodeConfigSpec `json:"nodeConfig,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default:=30
+	// +kubebuilder:validation:Minimum=1
+	// CertificateExpiryWarningDays is the number of days before the expiry of a certificate handled by the operator from which the expiry is reported as a warning event and in the CertificateExpiring condition
+	CertificateExpiryWarningDays int32 `json:"certificateExpiryWarningDays,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default:={"vsystem-vrep"}
+	// PruneStatefulSets lists the StatefulSets in the SDI namespace whose pods stuck on an outdated revision are deleted, first gracefully and then forcefully, so that the update revision can be rolled out
+	PruneStatefulSets []string `json:"pruneStatefulSets,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// CABundle propagates CA certificates to the cluster image configuration and to SDI. Nothing is propagated if unset
+	CABundle *CABundleSpec `json:"caBundle,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default:="Enforce"
+	// +kubebuilder:validation:Enum=Enforce;DryRun
+	// Mode is Enforce to apply the adjustments or DryRun to only report the changes that would be made in status.plan and in events
+	Mode ObserverMode `json:"mode,omitempty"`
 }
 
 // SDIObserverStatus defines the observed state of SDIObserver.
@@ -118,11 +558,23 @@ type SDIObserverStatus struct {
 	// Status of the slcb route.
 	SLCBRouteStatus ManagedRouteStatus `json:"slcbRouteStatus,omitempty"`
 
+	// Status of the additional routes.
+	Routes []RouteStatus `json:"routes,omitempty"`
+
 	// Status of the SDI config.
 	SDIConfigStatus SDIConfigStatus `json:"sdiConfigStatus,omitempty"`
 
 	// Status of the SDI node config.
 	SDINodeConfigStatus SDINodeConfigStatus `json:"sdiNodeConfigStatus,omitempty"`
+
+	// Status of the CA bundle propagation.
+	CABundleStatus CABundleStatus `json:"caBundleStatus,omitempty"`
+
+	// Status of the certificates handled by the operator.
+	CertificatesStatus CertificatesStatus `json:"certificatesStatus,omitempty"`
+
+	// Plan lists the changes the last adjustment would have made in DryRun mode.
+	Plan []PlannedChange `json:"plan,omitempty"`
 }
 
 //+kubebuilder:object:root=true
@@ -2,11 +2,13 @@ package assets
 
 import (
 	"embed"
+	"fmt"
 
 	openshiftv1 "github.com/openshift/api/image/v1"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	routev1 "github.com/openshift/api/route/v1"
@@ -14,6 +16,7 @@ import (
 
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/apimachinery/pkg/runtime/serializer/yaml"
 )
 
 var (
@@ -22,179 +25,67 @@ var (
 
 	appsScheme = runtime.NewScheme()
 	appsCodecs = serializer.NewCodecFactory(appsScheme)
+
+	unstructuredDecoder = yaml.NewDecodingSerializer(unstructured.UnstructuredJSONScheme)
 )
 
 func init() {
-	if err := configv1.AddToScheme(appsScheme); err != nil {
-		panic(err)
-	}
-	if err := rbacv1.AddToScheme(appsScheme); err != nil {
-		panic(err)
-	}
-
-	if err := routev1.AddToScheme(appsScheme); err != nil {
-		panic(err)
-	}
-
-	if err := openshiftv1.AddToScheme(appsScheme); err != nil {
-		panic(err)
-	}
-
-	if err := appsv1.AddToScheme(appsScheme); err != nil {
-		panic(err)
-	}
-}
-
-func GetRouteFromFile(name string) *routev1.Route {
-	routeBytes, err := manifests.ReadFile(name)
-	if err != nil {
-		panic(err)
-	}
-
-	routeObject, err := runtime.Decode(appsCodecs.UniversalDecoder(routev1.SchemeGroupVersion), routeBytes)
-	if err != nil {
-		panic(err)
-	}
-
-	return routeObject.(*routev1.Route)
-}
-
-func GetMachineConfigFromFile(name string) func() client.Object {
-	return func() client.Object {
-		machineConfigBytes, err := manifests.ReadFile(name)
-		if err != nil {
+	for _, add := range []func(*runtime.Scheme) error{
+		configv1.AddToScheme,
+		corev1.AddToScheme,
+		rbacv1.AddToScheme,
+		routev1.AddToScheme,
+		openshiftv1.AddToScheme,
+		appsv1.AddToScheme,
+	} {
+		if err := add(appsScheme); err != nil {
 			panic(err)
 		}
-
-		machineConfigObject, err := runtime.Decode(appsCodecs.UniversalDecoder(configv1.SchemeGroupVersion), machineConfigBytes)
-		if err != nil {
-			panic(err)
-		}
-
-		return machineConfigObject.(*configv1.MachineConfig)
 	}
 }
 
-func GetContainerRuntimeConfigFromFile(name string) *configv1.ContainerRuntimeConfig {
-	containerRuntimeConfigBytes, err := manifests.ReadFile(name)
+// Load decodes the embedded manifest into a typed object of the kind declared in it.
+func Load(name string) (client.Object, error) {
+	data, err := manifests.ReadFile(name)
 	if err != nil {
-		panic(err)
+		return nil, fmt.Errorf("unable to read manifest %s: %w", name, err)
 	}
-
-	containerRuntimeConfigObject, err := runtime.Decode(appsCodecs.UniversalDecoder(configv1.SchemeGroupVersion), containerRuntimeConfigBytes)
+	obj, _, err := appsCodecs.UniversalDeserializer().Decode(data, nil, nil)
 	if err != nil {
-		panic(err)
+		return nil, fmt.Errorf("unable to decode manifest %s: %w", name, err)
 	}
-
-	return containerRuntimeConfigObject.(*configv1.ContainerRuntimeConfig)
-}
-
-func GetKubeletConfigFromFile(name string) func() client.Object {
-	return func() client.Object {
-		kubeletConfigBytes, err := manifests.ReadFile(name)
-		if err != nil {
-			panic(err)
-		}
-
-		kubeletConfigObject, err := runtime.Decode(appsCodecs.UniversalDecoder(configv1.SchemeGroupVersion), kubeletConfigBytes)
-		if err != nil {
-			panic(err)
-		}
-
-		return kubeletConfigObject.(*configv1.KubeletConfig)
+	clientObj, ok := obj.(client.Object)
+	if !ok {
+		return nil, fmt.Errorf("manifest %s does not hold a Kubernetes object", name)
 	}
+	return clientObj, nil
 }
 
-func GetMachineConfigPoolFromFile(name string) *configv1.MachineConfigPool {
-	machineConfigPoolBytes, err := manifests.ReadFile(name)
+// LoadAs decodes the embedded manifest into an object of the given type. An error is returned if the
+// manifest declares another kind.
+func LoadAs[T client.Object](name string) (T, error) {
+	var zero T
+	obj, err := Load(name)
 	if err != nil {
-		panic(err)
-	}
-
-	machineConfigPoolObject, err := runtime.Decode(appsCodecs.UniversalDecoder(configv1.SchemeGroupVersion), machineConfigPoolBytes)
-	if err != nil {
-		panic(err)
-	}
-
-	return machineConfigPoolObject.(*configv1.MachineConfigPool)
-}
-
-func GetDaemonSetFromFile(name string) func() client.Object {
-	return func() client.Object {
-		daemonSetBytes, err := manifests.ReadFile(name)
-		if err != nil {
-			panic(err)
-		}
-
-		daemonSetObject, err := runtime.Decode(appsCodecs.UniversalDecoder(appsv1.SchemeGroupVersion), daemonSetBytes)
-		if err != nil {
-			panic(err)
-		}
-
-		return daemonSetObject.(*appsv1.DaemonSet)
+		return zero, err
 	}
-}
-
-func GetImageStreamFromFile(name string) func() client.Object {
-	return func() client.Object {
-		imageStreamBytes, err := manifests.ReadFile(name)
-		if err != nil {
-			panic(err)
-		}
-
-		imageStreamObject, err := runtime.Decode(appsCodecs.UniversalDecoder(openshiftv1.SchemeGroupVersion), imageStreamBytes)
-		if err != nil {
-			panic(err)
-		}
-
-		return imageStreamObject.(*openshiftv1.ImageStream)
+	typed, ok := obj.(T)
+	if !ok {
+		return zero, fmt.Errorf("manifest %s holds a %T, not a %T", name, obj, zero)
 	}
+	return typed, nil
 }
 
-func GetServiceAccountFromFile(name string) func() client.Object {
-	return func() client.Object {
-		serviceAccountBytes, err := manifests.ReadFile(name)
-		if err != nil {
-			panic(err)
-		}
-
-		serviceAccountObject, err := runtime.Decode(appsCodecs.UniversalDecoder(corev1.SchemeGroupVersion), serviceAccountBytes)
-		if err != nil {
-			panic(err)
-		}
-
-		return serviceAccountObject.(*corev1.ServiceAccount)
-	}
-}
-
-func GetRoleFromFile(name string) func() client.Object {
-	return func() client.Object {
-		roleBytes, err := manifests.ReadFile(name)
-		if err != nil {
-			panic(err)
-		}
-
-		roleObject, err := runtime.Decode(appsCodecs.UniversalDecoder(rbacv1.SchemeGroupVersion), roleBytes)
-		if err != nil {
-			panic(err)
-		}
-
-		return roleObject.(*rbacv1.Role)
+// LoadUnstructured decodes the embedded manifest into an unstructured object holding only the fields
+// set in the manifest.
+func LoadUnstructured(name string) (*unstructured.Unstructured, error) {
+	data, err := manifests.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read manifest %s: %w", name, err)
 	}
-}
-
-func GetRoleBindingFromFile(name string) func() client.Object {
-	return func() client.Object {
-		roleBindingBytes, err := manifests.ReadFile(name)
-		if err != nil {
-			panic(err)
-		}
-
-		roleBindingObject, err := runtime.Decode(appsCodecs.UniversalDecoder(rbacv1.SchemeGroupVersion), roleBindingBytes)
-		if err != nil {
-			panic(err)
-		}
-
-		return roleBindingObject.(*rbacv1.RoleBinding)
+	obj := &unstructured.Unstructured{}
+	if _, _, err := unstructuredDecoder.Decode(data, nil, obj); err != nil {
+		return nil, fmt.Errorf("unable to decode manifest %s: %w", name, err)
 	}
+	return obj, nil
 }
@@ -18,19 +18,32 @@ package controllers
 
 import (
 	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/redhat-sap/sap-data-intelligence/observer-operator/pkg/adjuster"
 	"github.com/redhat-sap/sap-data-intelligence/observer-operator/pkg/sdiobserver"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	sdiv1alpha1 "github.com/redhat-sap/sap-data-intelligence/observer-operator/api/v1alpha1"
 )
@@ -41,6 +54,15 @@ type SDIObserverReconciler struct {
 	Scheme            *runtime.Scheme
 	ObserverNamespace string
 	Interval          time.Duration
+	Recorder          record.EventRecorder
+	// ACMEIssuer issues the certificates of the routes with ACME certificates in the background.
+	ACMEIssuer *adjuster.ACMEIssuer
+
+	// controller is watching the kinds of pendingWatches once they are served, see watchOptionalKinds.
+	controller     controller.Controller
+	mapper         meta.RESTMapper
+	watchesMu      sync.Mutex
+	pendingWatches []optionalWatch
 }
 
 //+kubebuilder:rbac:groups=sdi.sap-redhat.io,resources=sdiobservers,verbs=get;list;watch;create;update;patch;delete
@@ -49,16 +71,26 @@ type SDIObserverReconciler struct {
 //+kubebuilder:rbac:groups=route.openshift.io,resources=routes,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=route.openshift.io,resources=routes/custom-host,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=route.openshift.io,resources=routes/status,verbs=get;list;watch;create;update;patch;delete
-//+kubebuilder:rbac:groups=core,resources=services,verbs=get;list;watch
-//+kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch
+//+kubebuilder:rbac:groups=networking.k8s.io,resources=ingresses,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=gateway.networking.k8s.io,resources=httproutes;tlsroutes,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=core,resources=services,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=discovery.k8s.io,resources=endpointslices,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=core,resources=configmaps,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=core,resources=nodes,verbs=get;list;watch
+//+kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
+//+kubebuilder:rbac:groups=core,resources=namespaces,verbs=get;list;watch;update;patch
+//+kubebuilder:rbac:groups=apps,resources=statefulsets,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch;delete
 //+kubebuilder:rbac:groups=apps,resources=daemonsets,verbs=get;list;watch;create;update;patch;delete
-//+kubebuilder:rbac:groups=,resources=serviceaccounts,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=core,resources=serviceaccounts,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=rbac.authorization.k8s.io,resources=roles;rolebindings,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=image.openshift.io,resources=imagestreams,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=machineconfiguration.openshift.io,resources=kubeletconfigs;machineconfigs;machineconfigpools;containerruntimeconfigs,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=config.openshift.io,resources=clusteroperators,verbs=get;list
+//+kubebuilder:rbac:groups=config.openshift.io,resources=images,verbs=get;list;watch;update;patch
 //+kubebuilder:rbac:groups=installers.datahub.sap.com,resources=datahubs;voraclusters,verbs=get;list;watch;update;patch
+//+kubebuilder:rbac:groups=sap.com,resources=voraclusters,verbs=get;list;watch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -76,6 +108,8 @@ func (r *SDIObserverReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		"name", req.Name,
 	)
 
+	r.watchOptionalKinds(logger)
+
 	operatorCR := &sdiv1alpha1.SDIObserver{}
 	err := r.Get(ctx, req.NamespacedName, operatorCR)
 	if err != nil {
@@ -86,6 +120,16 @@ func (r *SDIObserverReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		return r.handleError(ctx, operatorCR, err, "Error getting operator resource")
 	}
 
+	if operatorCR.DeletionTimestamp != nil {
+		return r.finalize(ctx, operatorCR)
+	}
+
+	if controllerutil.AddFinalizer(operatorCR, adjuster.SDIObserverFinalizer) {
+		if err := r.Update(ctx, operatorCR); err != nil {
+			return r.handleError(ctx, operatorCR, err, "Failed to add finalizer")
+		}
+	}
+
 	updateStatus := r.ensureStatusConditions(operatorCR)
 	if updateStatus {
 		if err = r.Status().Update(ctx, operatorCR); err != nil {
@@ -104,18 +148,43 @@ func (r *SDIObserverReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		r.Scheme,
 		logger,
 	)
+	sdiAdjuster.Recorder = r.Recorder
+	sdiAdjuster.ACMEIssuer = r.ACMEIssuer
+	if operatorCR.Spec.Mode == sdiv1alpha1.ObserverModeDryRun {
+		sdiAdjuster.EnableDryRun()
+	}
+
+	// An SDI instance is observed once; a further observer of its namespace is rejected until the owner
+	// is deleted.
+	owner, err := sdiAdjuster.SDINamespaceOwner(operatorCR.Spec.SDINamespace, ctx)
+	if err != nil {
+		return r.handleError(ctx, operatorCR, err, "Failed to determine the observer of the SDI namespace")
+	}
+	if owner != nil && !adjuster.IsSameObserver(owner, operatorCR) {
+		return r.reject(ctx, operatorCR, owner)
+	}
 
-	if err := sdiAdjuster.Adjust(sdiObserver, ctx); err != nil {
-		if client.IgnoreNotFound(err) != nil {
-			return r.handleError(ctx, operatorCR, err, "Couldn't reconcile SDI observer")
+	adjustErr := sdiAdjuster.Adjust(sdiObserver, ctx)
+	r.setStepConditions(operatorCR, sdiAdjuster.Results())
+	r.setPlan(operatorCR, sdiAdjuster)
+
+	if adjustErr != nil {
+		if !adjuster.IsNotFound(adjustErr) {
+			return r.handleError(ctx, operatorCR, adjustErr, "Couldn't reconcile SDI observer")
+		}
+		logger.Info("Components missing, will continue to try in the next reconciliation (in 1 min): " + adjustErr.Error())
+		if err := r.Status().Update(ctx, operatorCR); err != nil {
+			return r.handleError(ctx, operatorCR, err, "Failed to update SDIObserver status")
 		}
-		logger.Info("Components missing, will continue to try in the next reconciliation (in 1 min): " + err.Error())
 		return ctrl.Result{RequeueAfter: r.Interval}, nil
 	}
 
+	// Keep the conditions reported by the adjustments across the re-fetch.
+	status := operatorCR.Status.DeepCopy()
 	if err := r.Get(ctx, req.NamespacedName, operatorCR); err != nil {
 		return r.handleError(ctx, operatorCR, err, "Failed to re-fetch SDIObserver")
 	}
+	operatorCR.Status = *status
 
 	meta.SetStatusCondition(&operatorCR.Status.Conditions, metav1.Condition{
 		Type:               sdiv1alpha1.ConditionTypeDegraded,
@@ -133,11 +202,63 @@ func (r *SDIObserverReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 	return ctrl.Result{RequeueAfter: r.Interval}, nil
 }
 
+// reject reports that the SDI namespace of the observer is already observed by the owner. The observer is
+// reconciled again after the interval, in case the owner is deleted meanwhile.
+func (r *SDIObserverReconciler) reject(ctx context.Context, cr *sdiv1alpha1.SDIObserver, owner *sdiv1alpha1.SDIObserver) (ctrl.Result, error) {
+	msg := fmt.Sprintf("SDI namespace %s is already observed by SDIObserver %s/%s", cr.Spec.SDINamespace, owner.Namespace, owner.Name)
+	log.FromContext(ctx).Info("Rejecting SDIObserver: " + msg)
+
+	// The rejection is reported once, not on every reconciliation.
+	degraded := meta.FindStatusCondition(cr.Status.Conditions, sdiv1alpha1.ConditionTypeDegraded)
+	if r.Recorder != nil && (degraded == nil || degraded.Reason != sdiv1alpha1.ReasonSDINamespaceOwnedByOther) {
+		r.Recorder.Event(cr, corev1.EventTypeWarning, sdiv1alpha1.ReasonSDINamespaceOwnedByOther, msg)
+	}
+	meta.SetStatusCondition(&cr.Status.Conditions, metav1.Condition{
+		Type:               sdiv1alpha1.ConditionTypeDegraded,
+		Status:             metav1.ConditionTrue,
+		Reason:             sdiv1alpha1.ReasonSDINamespaceOwnedByOther,
+		Message:            msg,
+		ObservedGeneration: cr.Generation,
+	})
+	if err := r.Status().Update(ctx, cr); err != nil {
+		return r.handleError(ctx, cr, err, "Failed to update SDIObserver status")
+	}
+	return ctrl.Result{RequeueAfter: r.Interval}, nil
+}
+
 // SetupWithManager sets up the controller with the Manager.
 func (r *SDIObserverReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
+	// The node-configurator resources are controlled by the observer managing the node configuration.
+	// Without the machine-config operator, the rollout of the node configuration is tracked on its DaemonSet.
+	b := ctrl.NewControllerManagedBy(mgr).
 		For(&sdiv1alpha1.SDIObserver{}).
-		Complete(r)
+		Owns(&appsv1.DaemonSet{}).
+		Owns(&corev1.ServiceAccount{}).
+		Owns(&rbacv1.Role{}).
+		Owns(&rbacv1.RoleBinding{})
+	// The observers are reconciled again once their certificates have been issued in the background.
+	if r.ACMEIssuer != nil {
+		issued := make(chan event.GenericEvent, 16)
+		r.ACMEIssuer.Notify = func(obs client.ObjectKey) {
+			issued <- event.GenericEvent{Object: &sdiv1alpha1.SDIObserver{
+				ObjectMeta: metav1.ObjectMeta{Name: obs.Name, Namespace: obs.Namespace},
+			}}
+		}
+		b = b.WatchesRawSource(source.Channel(issued, &handler.EnqueueRequestForObject{}))
+	}
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &sdiv1alpha1.SDIObserver{},
+		observedNamespacesIndex, observedNamespaces); err != nil {
+		return err
+	}
+	c, err := r.setupWatches(b).Build(r)
+	if err != nil {
+		return err
+	}
+	r.controller = c
+	r.mapper = mgr.GetRESTMapper()
+	r.pendingWatches = r.optionalWatches(mgr)
+	r.watchOptionalKinds(mgr.GetLogger().WithName("setup"))
+	return nil
 }
 
 func (r *SDIObserverReconciler) ensureStatusConditions(cr *sdiv1alpha1.SDIObserver) bool {
@@ -174,9 +295,206 @@ func (r *SDIObserverReconciler) ensureStatusConditions(cr *sdiv1alpha1.SDIObserv
 		setInitialCondition(&cr.Status.SDINodeConfigStatus.Conditions)
 		updateStatus = true
 	}
+	if len(cr.Status.CABundleStatus.Conditions) == 0 {
+		setInitialCondition(&cr.Status.CABundleStatus.Conditions)
+		updateStatus = true
+	}
+	if len(cr.Status.CertificatesStatus.Conditions) == 0 {
+		setInitialCondition(&cr.Status.CertificatesStatus.Conditions)
+		updateStatus = true
+	}
 	return updateStatus
 }
 
+// stepConditions returns the conditions of the sub-status corresponding to the adjustment step. Nil is
+// returned for steps without a sub-status.
+func stepConditions(cr *sdiv1alpha1.SDIObserver, step string) *[]metav1.Condition {
+	switch step {
+	case adjuster.StepNodes:
+		return &cr.Status.SDINodeConfigStatus.Conditions
+	case adjuster.StepSLCBNetwork:
+		return &cr.Status.SLCBRouteStatus.Conditions
+	case adjuster.StepSDINetwork:
+		return &cr.Status.VSystemRouteStatus.Conditions
+	case adjuster.StepCABundle:
+		return &cr.Status.CABundleStatus.Conditions
+	case adjuster.StepCertificates:
+		return &cr.Status.CertificatesStatus.Conditions
+	}
+	if slices.Contains(adjuster.SDIConfigSteps, step) {
+		return &cr.Status.SDIConfigStatus.Conditions
+	}
+	return nil
+}
+
+// outcomeSeverity orders the outcomes of the steps sharing a sub-status; the most severe one is reported.
+var outcomeSeverity = map[adjuster.Outcome]int{
+	adjuster.OutcomeSucceeded:   0,
+	adjuster.OutcomeSkipped:     1,
+	adjuster.OutcomeProgressing: 2,
+	adjuster.OutcomeUnsupported: 3,
+	adjuster.OutcomeFailed:      4,
+}
+
+// combineStepResults merges the results of the steps sharing the sub-status into the most severe one. The
+// messages of the steps with that outcome are joined.
+func combineStepResults(results []adjuster.StepResult) adjuster.StepResult {
+	combined := results[0]
+	for _, result := range results[1:] {
+		switch {
+		case outcomeSeverity[result.Outcome] > outcomeSeverity[combined.Outcome]:
+			combined = result
+		case result.Outcome == combined.Outcome && result.Outcome != adjuster.OutcomeSucceeded:
+			combined.Message += "; " + result.Message
+		}
+	}
+	if len(results) > 1 && combined.Outcome == adjuster.OutcomeSucceeded {
+		combined.Message = "Adjustment of " + strings.Join(stepNames(results), ", ") + " succeeded"
+	}
+	return combined
+}
+
+// stepNames returns the names of the steps of the results.
+func stepNames(results []adjuster.StepResult) []string {
+	names := make([]string, 0, len(results))
+	for _, result := range results {
+		names = append(names, result.Step)
+	}
+	return names
+}
+
+// setStepConditions writes the outcomes of the adjustment steps into the matching sub-statuses.
+func (r *SDIObserverReconciler) setStepConditions(cr *sdiv1alpha1.SDIObserver, results []adjuster.StepResult) {
+	// Several steps may report in the same sub-status.
+	var order []*[]metav1.Condition
+	grouped := map[*[]metav1.Condition][]adjuster.StepResult{}
+	for _, result := range results {
+		conditions := stepConditions(cr, result.Step)
+		if conditions == nil {
+			continue
+		}
+		if _, ok := grouped[conditions]; !ok {
+			order = append(order, conditions)
+		}
+		grouped[conditions] = append(grouped[conditions], result)
+	}
+
+	for _, conditions := range order {
+		result := combineStepResults(grouped[conditions])
+		ready, degraded, progressing := metav1.ConditionTrue, metav1.ConditionFalse, metav1.ConditionFalse
+		switch result.Outcome {
+		case adjuster.OutcomeFailed, adjuster.OutcomeUnsupported:
+			ready, degraded = metav1.ConditionFalse, metav1.ConditionTrue
+		case adjuster.OutcomeProgressing:
+			ready, progressing = metav1.ConditionFalse, metav1.ConditionTrue
+		}
+		meta.SetStatusCondition(conditions, metav1.Condition{
+			Type:               sdiv1alpha1.ConditionTypeReady,
+			Status:             ready,
+			Reason:             result.Reason,
+			Message:            result.Message,
+			ObservedGeneration: cr.Generation,
+		})
+		meta.SetStatusCondition(conditions, metav1.Condition{
+			Type:               sdiv1alpha1.ConditionTypeDegraded,
+			Status:             degraded,
+			Reason:             result.Reason,
+			Message:            result.Message,
+			ObservedGeneration: cr.Generation,
+		})
+		meta.SetStatusCondition(conditions, metav1.Condition{
+			Type:               sdiv1alpha1.ConditionTypeProgressing,
+			Status:             progressing,
+			Reason:             result.Reason,
+			Message:            result.Message,
+			ObservedGeneration: cr.Generation,
+		})
+	}
+}
+
+// setPlan reports the changes planned in DryRun mode in the status and as events.
+func (r *SDIObserverReconciler) setPlan(cr *sdiv1alpha1.SDIObserver, a *adjuster.Adjuster) {
+	if !a.DryRun() {
+		cr.Status.Plan = nil
+		meta.SetStatusCondition(&cr.Status.Conditions, metav1.Condition{
+			Type:               sdiv1alpha1.ConditionTypeDryRun,
+			Status:             metav1.ConditionFalse,
+			Reason:             sdiv1alpha1.ReasonEnforced,
+			Message:            "The adjustments are applied",
+			ObservedGeneration: cr.Generation,
+		})
+		return
+	}
+
+	cr.Status.Plan = a.Plan()
+	condition := metav1.Condition{
+		Type:               sdiv1alpha1.ConditionTypeDryRun,
+		Status:             metav1.ConditionTrue,
+		Reason:             sdiv1alpha1.ReasonNoChangesPlanned,
+		Message:            "No changes would be made",
+		ObservedGeneration: cr.Generation,
+	}
+	if len(cr.Status.Plan) > 0 {
+		condition.Reason = sdiv1alpha1.ReasonChangesPlanned
+		condition.Message = fmt.Sprintf("%d changes would be made, see status.plan", len(cr.Status.Plan))
+	}
+	meta.SetStatusCondition(&cr.Status.Conditions, condition)
+
+	if r.Recorder == nil {
+		return
+	}
+	for _, change := range cr.Status.Plan {
+		object := change.Name
+		if change.Namespace != "" {
+			object = change.Namespace + "/" + change.Name
+		}
+		r.Recorder.Eventf(cr, corev1.EventTypeNormal, sdiv1alpha1.ReasonChangesPlanned,
+			"%s: would %s %s %s", change.Step, strings.ToLower(change.Action), change.Kind, object)
+	}
+}
+
+// finalize reverts the changes made on behalf of the deleted SDIObserver before releasing it.
+func (r *SDIObserverReconciler) finalize(ctx context.Context, cr *sdiv1alpha1.SDIObserver) (ctrl.Result, error) {
+	if !controllerutil.ContainsFinalizer(cr, adjuster.SDIObserverFinalizer) {
+		return ctrl.Result{}, nil
+	}
+	logger := log.FromContext(ctx)
+
+	meta.SetStatusCondition(&cr.Status.Conditions, metav1.Condition{
+		Type:               sdiv1alpha1.ConditionTypeTerminating,
+		Status:             metav1.ConditionTrue,
+		Reason:             sdiv1alpha1.ReasonCleanupInProgress,
+		LastTransitionTime: metav1.Now(),
+		Message:            "Reverting the changes made by the operator",
+	})
+	if err := r.Status().Update(ctx, cr); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	sdiAdjuster := adjuster.New(cr.Name, cr.Namespace, r.Client, r.Scheme, logger)
+	if err := sdiAdjuster.Cleanup(cr, ctx); err != nil {
+		meta.SetStatusCondition(&cr.Status.Conditions, metav1.Condition{
+			Type:               sdiv1alpha1.ConditionTypeTerminating,
+			Status:             metav1.ConditionTrue,
+			Reason:             sdiv1alpha1.ReasonCleanupFailed,
+			LastTransitionTime: metav1.Now(),
+			Message:            err.Error(),
+		})
+		if updateErr := r.Status().Update(ctx, cr); updateErr != nil {
+			return ctrl.Result{}, utilerrors.NewAggregate([]error{err, updateErr})
+		}
+		logger.Error(err, "Cleanup failed, will retry", "RequeueAfter", r.Interval)
+		return ctrl.Result{RequeueAfter: r.Interval}, nil
+	}
+
+	logger.Info("Cleanup complete. Removing finalizer")
+	controllerutil.RemoveFinalizer(cr, adjuster.SDIObserverFinalizer)
+	if err := r.Update(ctx, cr); err != nil {
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{}, nil
+}
+
 func (r *SDIObserverReconciler) handleError(ctx context.Context, cr *sdiv1alpha1.SDIObserver, err error, msg string) (ctrl.Result, error) {
 	meta.SetStatusCondition(&cr.Status.Conditions, metav1.Condition{
 		Type:               sdiv1alpha1.ConditionTypeDegraded,
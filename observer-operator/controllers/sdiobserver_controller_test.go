@@ -2,13 +2,20 @@ package controllers
 
 import (
 	"context"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/go-logr/logr"
 	sdiv1alpha1 "github.com/redhat-sap/sap-data-intelligence/observer-operator/api/v1alpha1"
+	"github.com/redhat-sap/sap-data-intelligence/observer-operator/pkg/adjuster"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
@@ -102,6 +109,65 @@ func TestSDIObserverReconciler_Reconcile_Success(t *testing.T) {
 	}
 }
 
+func TestSDIObserverReconciler_Reconcile_SDINamespaceObserved(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := sdiv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatalf("Failed to add scheme: %v", err)
+	}
+
+	now := time.Now().Truncate(time.Second)
+	newObserver := func(name string, created time.Time) *sdiv1alpha1.SDIObserver {
+		return &sdiv1alpha1.SDIObserver{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				Namespace:         "test-namespace",
+				CreationTimestamp: metav1.NewTime(created),
+			},
+			Spec: sdiv1alpha1.SDIObserverSpec{SDINamespace: "sdi", SLCBNamespace: "slcb"},
+		}
+	}
+	owner, duplicate := newObserver("owner", now.Add(-time.Hour)), newObserver("duplicate", now)
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(owner, duplicate).WithStatusSubresource(owner, duplicate).Build()
+	recorder := record.NewFakeRecorder(10)
+	reconciler := &SDIObserverReconciler{
+		Client:            c,
+		Scheme:            scheme,
+		ObserverNamespace: "test-namespace",
+		Interval:          time.Minute,
+		Recorder:          recorder,
+	}
+
+	ctx := context.Background()
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Name: "duplicate", Namespace: "test-namespace"}}
+	for i := 0; i < 2; i++ {
+		result, err := reconciler.Reconcile(ctx, req)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if result.RequeueAfter != time.Minute {
+			t.Errorf("Expected the rejected observer to be requeued, got %v", result)
+		}
+	}
+
+	obs := &sdiv1alpha1.SDIObserver{}
+	if err := c.Get(ctx, req.NamespacedName, obs); err != nil {
+		t.Fatalf("Failed to get SDIObserver: %v", err)
+	}
+	degraded := meta.FindStatusCondition(obs.Status.Conditions, sdiv1alpha1.ConditionTypeDegraded)
+	if degraded == nil || degraded.Status != metav1.ConditionTrue || degraded.Reason != sdiv1alpha1.ReasonSDINamespaceOwnedByOther ||
+		!strings.Contains(degraded.Message, "test-namespace/owner") {
+		t.Errorf("Expected the observer to be rejected, got %v", degraded)
+	}
+	if len(recorder.Events) != 1 {
+		t.Errorf("Expected the rejection to be reported once, got %d events", len(recorder.Events))
+	}
+	// Nothing is adjusted on behalf of the rejected observer.
+	if ready := meta.FindStatusCondition(obs.Status.SDIConfigStatus.Conditions, sdiv1alpha1.ConditionTypeReady); ready == nil ||
+		ready.Status != metav1.ConditionUnknown {
+		t.Errorf("Expected the SDI config not to be adjusted, got %v", ready)
+	}
+}
+
 func TestSDIObserverReconciler_ensureStatusConditions(t *testing.T) {
 	scheme := runtime.NewScheme()
 	err := sdiv1alpha1.AddToScheme(scheme)
@@ -193,6 +259,158 @@ func TestSDIObserverReconciler_handleError(t *testing.T) {
 	}
 }
 
+func TestSDIObserverReconciler_setStepConditions(t *testing.T) {
+	reconciler := &SDIObserverReconciler{}
+	obs := &sdiv1alpha1.SDIObserver{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       "test-observer",
+			Namespace:  "test-namespace",
+			Generation: 3,
+		},
+	}
+
+	reconciler.setStepConditions(obs, []adjuster.StepResult{
+		{Step: adjuster.StepNodes, Outcome: adjuster.OutcomeSkipped, Reason: sdiv1alpha1.ReasonNodeConfigUnmanaged, Message: "Node config is unmanaged"},
+		{Step: adjuster.StepSLCBNetwork, Outcome: adjuster.OutcomeFailed, Reason: sdiv1alpha1.ReasonResourceNotAvailable, Message: "not found"},
+		{Step: adjuster.StepStorage, Outcome: adjuster.OutcomeSucceeded, Reason: sdiv1alpha1.ReasonSucceeded},
+	})
+
+	ready := meta.FindStatusCondition(obs.Status.SDINodeConfigStatus.Conditions, sdiv1alpha1.ConditionTypeReady)
+	if ready == nil || ready.Status != metav1.ConditionTrue || ready.Reason != sdiv1alpha1.ReasonNodeConfigUnmanaged {
+		t.Errorf("Expected node config to be ready and skipped, got %v", ready)
+	}
+	if ready != nil && ready.ObservedGeneration != 3 {
+		t.Errorf("Expected observed generation 3, got %d", ready.ObservedGeneration)
+	}
+	if !meta.IsStatusConditionTrue(obs.Status.SLCBRouteStatus.Conditions, sdiv1alpha1.ConditionTypeDegraded) {
+		t.Error("Expected SLCB route status to be degraded")
+	}
+	if len(obs.Status.SDIConfigStatus.Conditions) != 0 || len(obs.Status.VSystemRouteStatus.Conditions) != 0 {
+		t.Error("Expected sub-statuses of steps that did not run to be untouched")
+	}
+}
+
+func TestSDIObserverReconciler_setStepConditions_SDIConfig(t *testing.T) {
+	reconciler := &SDIObserverReconciler{}
+	obs := &sdiv1alpha1.SDIObserver{}
+
+	// The SDI config steps report in the same sub-status; a failure is not hidden by a later success.
+	reconciler.setStepConditions(obs, []adjuster.StepResult{
+		{Step: adjuster.StepSDIVersion, Outcome: adjuster.OutcomeSucceeded, Reason: sdiv1alpha1.ReasonSucceeded},
+		{Step: adjuster.StepSDIRbac, Outcome: adjuster.OutcomeFailed, Reason: sdiv1alpha1.ReasonOperandResourceFailed, Message: "forbidden"},
+		{Step: adjuster.StepSDIVRep, Outcome: adjuster.OutcomeProgressing, Reason: sdiv1alpha1.ReasonStatefulSetRecreating, Message: "recreating"},
+		{Step: adjuster.StepSDIPullSecret, Outcome: adjuster.OutcomeSucceeded, Reason: sdiv1alpha1.ReasonSucceeded},
+	})
+
+	conditions := obs.Status.SDIConfigStatus.Conditions
+	degraded := meta.FindStatusCondition(conditions, sdiv1alpha1.ConditionTypeDegraded)
+	if degraded == nil || degraded.Status != metav1.ConditionTrue || degraded.Message != "forbidden" {
+		t.Errorf("Expected SDI config to be degraded by the RBAC failure, got %v", degraded)
+	}
+
+	reconciler.setStepConditions(obs, []adjuster.StepResult{
+		{Step: adjuster.StepSDIVersion, Outcome: adjuster.OutcomeSucceeded, Reason: sdiv1alpha1.ReasonSucceeded},
+		{Step: adjuster.StepSDIPullSecret, Outcome: adjuster.OutcomeSucceeded, Reason: sdiv1alpha1.ReasonSucceeded},
+	})
+	ready := meta.FindStatusCondition(obs.Status.SDIConfigStatus.Conditions, sdiv1alpha1.ConditionTypeReady)
+	if ready == nil || ready.Status != metav1.ConditionTrue || ready.Message != "Adjustment of SDI version, SDI registry pull secret succeeded" {
+		t.Errorf("Expected SDI config to be ready, got %v", ready)
+	}
+}
+
+func TestSDIObserverReconciler_setStepConditions_UnsupportedSDIVersion(t *testing.T) {
+	reconciler := &SDIObserverReconciler{}
+	obs := &sdiv1alpha1.SDIObserver{}
+	a := adjuster.New("test", "sdi-observer", nil, runtime.NewScheme(), logr.Discard())
+	unsupported := func() error {
+		return adjuster.Unsupported(sdiv1alpha1.ReasonUnsupportedSDIVersion, "SDI version 2.9.0 is not supported")
+	}
+	// The version-specific steps are left out while the others still succeed.
+	if err := a.Run(
+		adjuster.Step{Name: adjuster.StepSDIVersion, Action: unsupported},
+		adjuster.Step{Name: adjuster.StepSDINamespaces, Action: func() error { return nil }},
+		adjuster.Step{Name: adjuster.StepSDIRbac, Action: unsupported, DependsOn: []string{adjuster.StepSDIVersion}},
+	); err != nil {
+		t.Fatalf("Expected an unsupported version not to fail the adjustment, got %v", err)
+	}
+	reconciler.setStepConditions(obs, a.Results())
+
+	conditions := obs.Status.SDIConfigStatus.Conditions
+	degraded := meta.FindStatusCondition(conditions, sdiv1alpha1.ConditionTypeDegraded)
+	if degraded == nil || degraded.Status != metav1.ConditionTrue || degraded.Reason != sdiv1alpha1.ReasonUnsupportedSDIVersion {
+		t.Errorf("Expected SDI config to be degraded by the unsupported version, got %v", degraded)
+	}
+	if !meta.IsStatusConditionFalse(conditions, sdiv1alpha1.ConditionTypeReady) {
+		t.Errorf("Expected SDI config not to be ready, got %v", conditions)
+	}
+}
+
+func TestSDIObserverReconciler_setStepConditions_Progressing(t *testing.T) {
+	reconciler := &SDIObserverReconciler{}
+	obs := &sdiv1alpha1.SDIObserver{}
+
+	reconciler.setStepConditions(obs, []adjuster.StepResult{
+		{Step: adjuster.StepNodes, Outcome: adjuster.OutcomeProgressing, Reason: sdiv1alpha1.ReasonNodesUpdating, Message: "1 of 2 SDI nodes updated"},
+	})
+
+	conditions := obs.Status.SDINodeConfigStatus.Conditions
+	if !meta.IsStatusConditionTrue(conditions, sdiv1alpha1.ConditionTypeProgressing) {
+		t.Error("Expected node config to be progressing")
+	}
+	if !meta.IsStatusConditionFalse(conditions, sdiv1alpha1.ConditionTypeReady) ||
+		!meta.IsStatusConditionFalse(conditions, sdiv1alpha1.ConditionTypeDegraded) {
+		t.Errorf("Expected node config to be neither ready nor degraded, got %v", conditions)
+	}
+
+	reconciler.setStepConditions(obs, []adjuster.StepResult{
+		{Step: adjuster.StepNodes, Outcome: adjuster.OutcomeSucceeded, Reason: sdiv1alpha1.ReasonSucceeded},
+	})
+	if !meta.IsStatusConditionFalse(obs.Status.SDINodeConfigStatus.Conditions, sdiv1alpha1.ConditionTypeProgressing) {
+		t.Error("Expected node config to be done progressing")
+	}
+}
+
+func TestSDIObserverReconciler_setPlan(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := corev1.AddToScheme(scheme); err != nil {
+		t.Fatalf("Failed to add scheme: %v", err)
+	}
+	recorder := record.NewFakeRecorder(10)
+	reconciler := &SDIObserverReconciler{Recorder: recorder}
+	obs := &sdiv1alpha1.SDIObserver{Spec: sdiv1alpha1.SDIObserverSpec{Mode: sdiv1alpha1.ObserverModeDryRun}}
+
+	c := fake.NewClientBuilder().WithScheme(scheme).Build()
+	a := adjuster.New("test-observer", "test-namespace", c, scheme, logr.Discard())
+	a.EnableDryRun()
+	ctx := context.Background()
+	if err := a.Run(adjuster.Step{Name: adjuster.StepSDINamespaces, Action: func() error {
+		return a.Client.Create(ctx, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "sdi"}})
+	}}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	reconciler.setPlan(obs, a)
+	if len(obs.Status.Plan) != 1 || obs.Status.Plan[0].Action != adjuster.PlannedActionCreate {
+		t.Errorf("Expected the namespace creation to be planned, got %v", obs.Status.Plan)
+	}
+	condition := meta.FindStatusCondition(obs.Status.Conditions, sdiv1alpha1.ConditionTypeDryRun)
+	if condition == nil || condition.Status != metav1.ConditionTrue || condition.Reason != sdiv1alpha1.ReasonChangesPlanned {
+		t.Errorf("Expected changes planned condition, got %v", condition)
+	}
+	if event := <-recorder.Events; !strings.Contains(event, "SDI namespaces: would create Namespace sdi") {
+		t.Errorf("Unexpected event %q", event)
+	}
+	if err := c.Get(ctx, types.NamespacedName{Name: "sdi"}, &corev1.Namespace{}); !errors.IsNotFound(err) {
+		t.Errorf("Expected the namespace not to be created, got %v", err)
+	}
+
+	// The plan is cleared once the changes are enforced.
+	reconciler.setPlan(obs, adjuster.New("test-observer", "test-namespace", c, scheme, logr.Discard()))
+	if obs.Status.Plan != nil || !meta.IsStatusConditionFalse(obs.Status.Conditions, sdiv1alpha1.ConditionTypeDryRun) {
+		t.Errorf("Expected the plan to be cleared, got %v", obs.Status)
+	}
+}
+
 // TestSDIObserverReconciler_SetupWithManager would require a more complex mock
 // manager setup, so we'll skip it for now in favor of simpler unit tests
 
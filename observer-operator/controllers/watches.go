@@ -0,0 +1,349 @@
+package controllers
+
+import (
+	"context"
+	"slices"
+
+	"github.com/go-logr/logr"
+	imagev1 "github.com/openshift/api/image/v1"
+	configv1 "github.com/openshift/machine-config-operator/pkg/apis/machineconfiguration.openshift.io/v1"
+	sdiv1alpha1 "github.com/redhat-sap/sap-data-intelligence/observer-operator/api/v1alpha1"
+	"github.com/redhat-sap/sap-data-intelligence/observer-operator/pkg/adjuster"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+// dataHubGVK is the kind of the SAP DataHub custom resource.
+var dataHubGVK = schema.GroupVersionKind{
+	Group:   adjuster.DataHubAPIGroup,
+	Version: adjuster.DataHubAPIVersion,
+	Kind:    adjuster.DataHubKind,
+}
+
+// setupWatches registers watches on the SDI objects patched by the operator so that changes made by
+// the SAP operators are reverted right away instead of at the next periodic reconciliation. The events of
+// the namespaces not used by any observer are dropped before they are mapped to the observers.
+func (r *SDIObserverReconciler) setupWatches(b *builder.Builder) *builder.Builder {
+	byNamespace := handler.EnqueueRequestsFromMapFunc(r.mapToObservers)
+	byNamespaceName := handler.EnqueueRequestsFromMapFunc(r.mapNamespaceToObservers)
+	observed := builder.WithPredicates(r.inObservedNamespace())
+
+	return b.
+		// The ownership of the objects shared by several SDI instances moves when an observer comes or goes.
+		Watches(&sdiv1alpha1.SDIObserver{}, handler.EnqueueRequestsFromMapFunc(r.mapToAllObservers),
+			builder.WithPredicates(observerAddedOrRemoved())).
+		Watches(&appsv1.StatefulSet{}, handler.EnqueueRequestsFromMapFunc(r.mapStatefulSetToObservers), observed).
+		Watches(&appsv1.DaemonSet{}, byNamespace,
+			builder.WithPredicates(hasName(adjuster.DiagnosticFluentdName), predicate.GenerationChangedPredicate{})).
+		Watches(&corev1.Service{}, handler.EnqueueRequestsFromMapFunc(r.mapServiceToObservers), observed).
+		Watches(&corev1.Secret{}, handler.EnqueueRequestsFromMapFunc(r.mapSecretToObservers), observed).
+		Watches(&corev1.ConfigMap{}, handler.EnqueueRequestsFromMapFunc(r.mapConfigMapToObservers), observed).
+		Watches(&networkingv1.Ingress{}, byNamespace, observed).
+		Watches(&corev1.Namespace{}, byNamespaceName,
+			builder.WithPredicates(nodeSelectorAnnotationChanged()))
+}
+
+// optionalWatch is a watch on a kind the cluster may not serve, e.g. the DataHub kind before SDI is
+// installed.
+type optionalWatch struct {
+	gvk    schema.GroupVersionKind
+	source func() source.Source
+}
+
+// optionalWatches returns the watches on the kinds the cluster may not serve.
+func (r *SDIObserverReconciler) optionalWatches(mgr ctrl.Manager) []optionalWatch {
+	kind := func(obj client.Object, h handler.EventHandler, predicates ...predicate.Predicate) func() source.Source {
+		return func() source.Source {
+			return source.Kind(mgr.GetCache(), obj, h, predicates...)
+		}
+	}
+	byNamespace := handler.EnqueueRequestsFromMapFunc(r.mapToObservers)
+
+	dataHub := &unstructured.Unstructured{}
+	dataHub.SetGroupVersionKind(dataHubGVK)
+	watches := []optionalWatch{
+		// The DataHub CRD exists only once SDI is installed, usually after the operator.
+		{gvk: dataHubGVK, source: kind(dataHub, byNamespace, predicate.GenerationChangedPredicate{})},
+		// The rollout of the node configuration is tracked on clusters with the machine-config operator only.
+		{
+			gvk: configv1.SchemeGroupVersion.WithKind("MachineConfigPool"),
+			source: kind(&configv1.MachineConfigPool{}, handler.EnqueueRequestsFromMapFunc(r.mapToNodeConfigObservers),
+				hasName(adjuster.SDIMachineConfigPoolName)),
+		},
+		// The node-configurator image is built with an image stream on OpenShift only.
+		{
+			gvk: imagev1.GroupVersion.WithKind("ImageStream"),
+			source: kind(&imagev1.ImageStream{}, handler.EnqueueRequestForOwner(mgr.GetScheme(), mgr.GetRESTMapper(),
+				&sdiv1alpha1.SDIObserver{}, handler.OnlyControllerOwner())),
+		},
+	}
+	// The managed routes are exposed with the backends served by the cluster.
+	for _, gvk := range []schema.GroupVersionKind{adjuster.RouteGVK, adjuster.HTTPRouteGVK, adjuster.TLSRouteGVK} {
+		watches = append(watches, optionalWatch{gvk: gvk, source: kind(r.watchedObject(gvk), byNamespace, r.inObservedNamespace())})
+	}
+	return watches
+}
+
+// watchOptionalKinds starts the pending watches on the kinds served by the cluster. The kinds missing at
+// startup are looked up again at every reconciliation, so that they are watched without a restart once
+// they are installed.
+func (r *SDIObserverReconciler) watchOptionalKinds(logger logr.Logger) {
+	r.watchesMu.Lock()
+	defer r.watchesMu.Unlock()
+	if r.controller == nil || len(r.pendingWatches) == 0 {
+		return
+	}
+
+	var pending []optionalWatch
+	for _, w := range r.pendingWatches {
+		if _, err := r.mapper.RESTMapping(w.gvk.GroupKind(), w.gvk.Version); err != nil {
+			logger.V(1).Info(w.gvk.Kind+" kind is not available; not watching "+w.gvk.Kind+" resources yet", "error", err.Error())
+			pending = append(pending, w)
+			continue
+		}
+		if err := r.controller.Watch(w.source()); err != nil {
+			logger.Error(err, "Unable to watch "+w.gvk.Kind+" resources")
+			pending = append(pending, w)
+			continue
+		}
+		logger.Info("Watching " + w.gvk.Kind + " resources")
+	}
+	r.pendingWatches = pending
+}
+
+// watchedObject returns a typed object of the kind if it is registered, an unstructured one otherwise.
+func (r *SDIObserverReconciler) watchedObject(gvk schema.GroupVersionKind) client.Object {
+	if typed, err := r.Scheme.New(gvk); err == nil {
+		if obj, ok := typed.(client.Object); ok {
+			return obj
+		}
+	}
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(gvk)
+	return obj
+}
+
+// mapToObservers maps a namespaced SDI object to the SDIObservers managing its namespace.
+func (r *SDIObserverReconciler) mapToObservers(ctx context.Context, obj client.Object) []reconcile.Request {
+	return r.observersFor(ctx, func(obs *sdiv1alpha1.SDIObserver) bool {
+		return obj.GetNamespace() == obs.Spec.SDINamespace || obj.GetNamespace() == obs.Spec.SLCBNamespace
+	})
+}
+
+// mapStatefulSetToObservers maps an SDI StatefulSet to the SDIObservers patching it or pruning its
+// outdated pods.
+func (r *SDIObserverReconciler) mapStatefulSetToObservers(ctx context.Context, obj client.Object) []reconcile.Request {
+	return r.observersFor(ctx, func(obs *sdiv1alpha1.SDIObserver) bool {
+		if obj.GetNamespace() != obs.Spec.SDINamespace {
+			return false
+		}
+		return obj.GetName() == adjuster.VSystemVrepStsName || slices.Contains(obs.Spec.PruneStatefulSets, obj.GetName())
+	})
+}
+
+// mapServiceToObservers maps the services exposed by the preset and the additional routes to the
+// SDIObservers managing the routes.
+func (r *SDIObserverReconciler) mapServiceToObservers(ctx context.Context, obj client.Object) []reconcile.Request {
+	return r.observersFor(ctx, func(obs *sdiv1alpha1.SDIObserver) bool {
+		switch {
+		case obj.GetNamespace() == obs.Spec.SDINamespace && obj.GetName() == adjuster.VSystemServiceName:
+			return true
+		case obj.GetNamespace() == obs.Spec.SLCBNamespace && obj.GetName() == adjuster.SLCBServiceName:
+			return true
+		}
+		return slices.ContainsFunc(obs.Spec.Routes, func(spec sdiv1alpha1.RouteSpec) bool {
+			return adjuster.RouteNamespace(obs, spec) == obj.GetNamespace() && spec.Service == obj.GetName()
+		})
+	})
+}
+
+// mapSecretToObservers maps the CA bundle of vsystem, the certificates of the managed routes and the CA
+// bundle sources to the SDIObservers using them.
+func (r *SDIObserverReconciler) mapSecretToObservers(ctx context.Context, obj client.Object) []reconcile.Request {
+	return r.observersFor(ctx, func(obs *sdiv1alpha1.SDIObserver) bool {
+		if usesCABundleSource(obs, "Secret", obj) {
+			return true
+		}
+		switch obj.GetNamespace() {
+		case obs.Spec.SDINamespace:
+			if obj.GetName() == adjuster.VSystemCABundleSecretName || obj.GetName() == adjuster.SDICABundleSecretName ||
+				usesCertificateSecret(obs.Spec.SDIVSystemRoute, obj.GetName()) {
+				return true
+			}
+		case obs.Spec.SLCBNamespace:
+			if usesCertificateSecret(obs.Spec.SLCBRoute, obj.GetName()) {
+				return true
+			}
+		}
+		return slices.ContainsFunc(obs.Spec.Routes, func(spec sdiv1alpha1.RouteSpec) bool {
+			return adjuster.RouteNamespace(obs, spec) == obj.GetNamespace() && usesCertificateSecret(spec.ManagedRouteSpec, obj.GetName())
+		})
+	})
+}
+
+func usesCertificateSecret(spec sdiv1alpha1.ManagedRouteSpec, name string) bool {
+	return spec.CertificateSecretRef != nil && spec.CertificateSecretRef.Name == name
+}
+
+// mapConfigMapToObservers maps the CA bundle sources and the registry CA bundles to the SDIObservers
+// propagating the CA bundle.
+func (r *SDIObserverReconciler) mapConfigMapToObservers(ctx context.Context, obj client.Object) []reconcile.Request {
+	return r.observersFor(ctx, func(obs *sdiv1alpha1.SDIObserver) bool {
+		if usesCABundleSource(obs, "ConfigMap", obj) {
+			return true
+		}
+		return obs.Spec.CABundle != nil && len(obs.Spec.CABundle.RegistryHostnames) > 0 &&
+			obj.GetNamespace() == adjuster.OpenShiftConfigNamespace
+	})
+}
+
+func usesCABundleSource(obs *sdiv1alpha1.SDIObserver, kind string, obj client.Object) bool {
+	if obs.Spec.CABundle == nil {
+		return false
+	}
+	return slices.ContainsFunc(obs.Spec.CABundle.Sources, func(src sdiv1alpha1.CABundleSource) bool {
+		ns := src.Namespace
+		if ns == "" {
+			ns = obs.Namespace
+		}
+		return src.Kind == kind && src.Name == obj.GetName() && ns == obj.GetNamespace()
+	})
+}
+
+// mapNamespaceToObservers maps a namespace to the SDIObservers annotating it with the node selector.
+func (r *SDIObserverReconciler) mapNamespaceToObservers(ctx context.Context, obj client.Object) []reconcile.Request {
+	return r.observersFor(ctx, func(obs *sdiv1alpha1.SDIObserver) bool {
+		for _, ns := range []string{obs.Namespace, obs.Spec.SDINamespace, obs.Spec.SLCBNamespace, adjuster.DataHubSystemNamespace} {
+			if obj.GetName() == ns {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// mapToNodeConfigObservers maps a node configuration object to the SDIObservers managing the SDI nodes.
+func (r *SDIObserverReconciler) mapToNodeConfigObservers(ctx context.Context, _ client.Object) []reconcile.Request {
+	return r.observersFor(ctx, func(obs *sdiv1alpha1.SDIObserver) bool {
+		return obs.Spec.ManageSDINodeConfig
+	})
+}
+
+// mapToAllObservers maps an event to all the SDIObservers.
+func (r *SDIObserverReconciler) mapToAllObservers(ctx context.Context, _ client.Object) []reconcile.Request {
+	return r.observersFor(ctx, func(*sdiv1alpha1.SDIObserver) bool {
+		return true
+	})
+}
+
+func (r *SDIObserverReconciler) observersFor(ctx context.Context, matches func(*sdiv1alpha1.SDIObserver) bool) []reconcile.Request {
+	observers := &sdiv1alpha1.SDIObserverList{}
+	if err := r.List(ctx, observers); err != nil {
+		log.FromContext(ctx).Error(err, "Unable to list SDIObservers")
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for i := range observers.Items {
+		if matches(&observers.Items[i]) {
+			requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{
+				Name:      observers.Items[i].Name,
+				Namespace: observers.Items[i].Namespace,
+			}})
+		}
+	}
+	return requests
+}
+
+// observedNamespacesIndex indexes the SDIObservers by the namespaces of the objects they adjust or read.
+const observedNamespacesIndex = "observedNamespaces"
+
+// observedNamespaces returns the namespaces of the objects adjusted or read by the SDIObserver.
+func observedNamespaces(obj client.Object) []string {
+	obs, ok := obj.(*sdiv1alpha1.SDIObserver)
+	if !ok {
+		return nil
+	}
+	namespaces := []string{obs.Namespace, obs.Spec.SDINamespace, obs.Spec.SLCBNamespace}
+	for _, spec := range obs.Spec.Routes {
+		namespaces = append(namespaces, adjuster.RouteNamespace(obs, spec))
+	}
+	if obs.Spec.CABundle != nil {
+		for _, src := range obs.Spec.CABundle.Sources {
+			if src.Namespace != "" {
+				namespaces = append(namespaces, src.Namespace)
+			}
+		}
+		if len(obs.Spec.CABundle.RegistryHostnames) > 0 {
+			namespaces = append(namespaces, adjuster.OpenShiftConfigNamespace)
+		}
+	}
+	slices.Sort(namespaces)
+	return slices.Compact(namespaces)
+}
+
+// inObservedNamespace filters the events for objects in the namespaces used by an SDIObserver. The
+// observers are looked up in the index of the cache.
+func (r *SDIObserverReconciler) inObservedNamespace() predicate.Predicate {
+	return predicate.NewPredicateFuncs(func(obj client.Object) bool {
+		observers := &sdiv1alpha1.SDIObserverList{}
+		if err := r.List(context.Background(), observers, client.MatchingFields{observedNamespacesIndex: obj.GetNamespace()}); err != nil {
+			// The map functions filter the event anyway.
+			return true
+		}
+		return len(observers.Items) > 0
+	})
+}
+
+// hasName filters the events for objects with one of the given names.
+func hasName(names ...string) predicate.Predicate {
+	return predicate.NewPredicateFuncs(func(obj client.Object) bool {
+		for _, name := range names {
+			if obj.GetName() == name {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// nodeSelectorAnnotationChanged filters namespace updates for changes of the node selector annotation.
+func nodeSelectorAnnotationChanged() predicate.Predicate {
+	return predicate.Funcs{
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			return e.ObjectOld.GetAnnotations()[adjuster.AnnotationKey] != e.ObjectNew.GetAnnotations()[adjuster.AnnotationKey]
+		},
+		DeleteFunc: func(event.DeleteEvent) bool {
+			return false
+		},
+	}
+}
+
+// observerAddedOrRemoved filters the SDIObserver events for creations, deletions and changes of the node
+// config management.
+func observerAddedOrRemoved() predicate.Predicate {
+	return predicate.Funcs{
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			oldObs, okOld := e.ObjectOld.(*sdiv1alpha1.SDIObserver)
+			newObs, okNew := e.ObjectNew.(*sdiv1alpha1.SDIObserver)
+			if !okOld || !okNew {
+				return false
+			}
+			return oldObs.Spec.ManageSDINodeConfig != newObs.Spec.ManageSDINodeConfig ||
+				(oldObs.DeletionTimestamp == nil) != (newObs.DeletionTimestamp == nil)
+		},
+	}
+}
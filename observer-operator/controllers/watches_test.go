@@ -0,0 +1,250 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	sdiv1alpha1 "github.com/redhat-sap/sap-data-intelligence/observer-operator/api/v1alpha1"
+	"github.com/redhat-sap/sap-data-intelligence/observer-operator/pkg/adjuster"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+func newWatchTestReconciler(t *testing.T) *SDIObserverReconciler {
+	t.Helper()
+	scheme := runtime.NewScheme()
+	if err := sdiv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatalf("Failed to add scheme: %v", err)
+	}
+	obs := &sdiv1alpha1.SDIObserver{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-observer", Namespace: "sdi-observer"},
+		Spec: sdiv1alpha1.SDIObserverSpec{
+			SDINamespace:      "sdi",
+			SLCBNamespace:     "sap-slcbridge",
+			PruneStatefulSets: []string{"vsystem-vrep", "hana"},
+			SLCBRoute: sdiv1alpha1.ManagedRouteSpec{
+				CertificateSecretRef: &corev1.LocalObjectReference{Name: "slcb-tls"},
+			},
+			Routes: []sdiv1alpha1.RouteSpec{{
+				Name:    "openapi",
+				Service: "openapi-gateway",
+				ManagedRouteSpec: sdiv1alpha1.ManagedRouteSpec{
+					CertificateSecretRef: &corev1.LocalObjectReference{Name: "openapi-tls"},
+				},
+			}},
+			CABundle: &sdiv1alpha1.CABundleSpec{
+				Sources: []sdiv1alpha1.CABundleSource{
+					{Kind: "Secret", Namespace: "openshift-ingress-operator", Name: "router-ca"},
+					{Kind: "ConfigMap", Name: "corporate-ca"},
+				},
+				RegistryHostnames: []string{"registry.example.com:5000"},
+			},
+		},
+	}
+	return &SDIObserverReconciler{
+		Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(obs).
+			WithIndex(&sdiv1alpha1.SDIObserver{}, observedNamespacesIndex, observedNamespaces).Build(),
+		Scheme:            scheme,
+		ObserverNamespace: "sdi-observer",
+		Interval:          1 * time.Minute,
+	}
+}
+
+func TestMapToObservers(t *testing.T) {
+	r := newWatchTestReconciler(t)
+	ctx := context.Background()
+
+	for ns, expected := range map[string]int{"sdi": 1, "sap-slcbridge": 1, "other": 0} {
+		svc := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: adjuster.VSystemServiceName, Namespace: ns}}
+		requests := r.mapToObservers(ctx, svc)
+		if len(requests) != expected {
+			t.Errorf("Expected %d requests for namespace %s, got %v", expected, ns, requests)
+		}
+		if expected > 0 && requests[0].Name != "test-observer" {
+			t.Errorf("Expected request for test-observer, got %v", requests[0])
+		}
+	}
+}
+
+func TestMapStatefulSetToObservers(t *testing.T) {
+	r := newWatchTestReconciler(t)
+	ctx := context.Background()
+
+	for _, tt := range []struct {
+		namespace, name string
+		expected        int
+	}{
+		{"sdi", adjuster.VSystemVrepStsName, 1},
+		{"sdi", "hana", 1},
+		{"sdi", "other", 0},
+		{"sap-slcbridge", "hana", 0},
+	} {
+		ss := &appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Name: tt.name, Namespace: tt.namespace}}
+		if requests := r.mapStatefulSetToObservers(ctx, ss); len(requests) != tt.expected {
+			t.Errorf("Expected %d requests for statefulset %s/%s, got %v", tt.expected, tt.namespace, tt.name, requests)
+		}
+	}
+}
+
+func TestMapServiceToObservers(t *testing.T) {
+	r := newWatchTestReconciler(t)
+	ctx := context.Background()
+
+	for _, tt := range []struct {
+		namespace, name string
+		expected        int
+	}{
+		{"sdi", adjuster.VSystemServiceName, 1},
+		{"sap-slcbridge", adjuster.SLCBServiceName, 1},
+		{"sdi", "openapi-gateway", 1},
+		{"sap-slcbridge", "openapi-gateway", 0},
+		{"sdi", "other", 0},
+	} {
+		svc := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: tt.name, Namespace: tt.namespace}}
+		if requests := r.mapServiceToObservers(ctx, svc); len(requests) != tt.expected {
+			t.Errorf("Expected %d requests for service %s/%s, got %v", tt.expected, tt.namespace, tt.name, requests)
+		}
+	}
+}
+
+func TestMapSecretToObservers(t *testing.T) {
+	r := newWatchTestReconciler(t)
+	ctx := context.Background()
+
+	for _, tt := range []struct {
+		namespace, name string
+		expected        int
+	}{
+		{"sdi", adjuster.VSystemCABundleSecretName, 1},
+		{"sap-slcbridge", "slcb-tls", 1},
+		{"sdi", "slcb-tls", 0},
+		{"sdi", "openapi-tls", 1},
+		{"sap-slcbridge", "openapi-tls", 0},
+		{"sap-slcbridge", "other", 0},
+		{"sdi", adjuster.SDICABundleSecretName, 1},
+		{"openshift-ingress-operator", "router-ca", 1},
+		{"sdi-observer", "router-ca", 0},
+		{"sdi-observer", "corporate-ca", 0},
+	} {
+		secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: tt.name, Namespace: tt.namespace}}
+		if requests := r.mapSecretToObservers(ctx, secret); len(requests) != tt.expected {
+			t.Errorf("Expected %d requests for secret %s/%s, got %v", tt.expected, tt.namespace, tt.name, requests)
+		}
+	}
+}
+
+func TestMapConfigMapToObservers(t *testing.T) {
+	r := newWatchTestReconciler(t)
+	ctx := context.Background()
+
+	for _, tt := range []struct {
+		namespace, name string
+		expected        int
+	}{
+		{"sdi-observer", "corporate-ca", 1},
+		{"sdi", "corporate-ca", 0},
+		{adjuster.OpenShiftConfigNamespace, adjuster.TrustedRegistryCABundlesName, 1},
+		{"sdi-observer", "other", 0},
+	} {
+		cm := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: tt.name, Namespace: tt.namespace}}
+		if requests := r.mapConfigMapToObservers(ctx, cm); len(requests) != tt.expected {
+			t.Errorf("Expected %d requests for configmap %s/%s, got %v", tt.expected, tt.namespace, tt.name, requests)
+		}
+	}
+}
+
+func TestMapNamespaceToObservers(t *testing.T) {
+	r := newWatchTestReconciler(t)
+	ctx := context.Background()
+
+	for ns, expected := range map[string]int{"sdi": 1, adjuster.DataHubSystemNamespace: 1, "sdi-observer": 1, "other": 0} {
+		namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: ns}}
+		if requests := r.mapNamespaceToObservers(ctx, namespace); len(requests) != expected {
+			t.Errorf("Expected %d requests for namespace %s, got %v", expected, ns, requests)
+		}
+	}
+}
+
+func TestNodeSelectorAnnotationChanged(t *testing.T) {
+	p := nodeSelectorAnnotationChanged()
+	oldNs := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Name:        "sdi",
+		Annotations: map[string]string{adjuster.AnnotationKey: "node-role.kubernetes.io/sdi="},
+	}}
+
+	unchanged := oldNs.DeepCopy()
+	unchanged.Labels = map[string]string{"foo": "bar"}
+	if p.Update(event.UpdateEvent{ObjectOld: oldNs, ObjectNew: unchanged}) {
+		t.Error("Expected no event when the node selector annotation is unchanged")
+	}
+
+	changed := oldNs.DeepCopy()
+	changed.Annotations[adjuster.AnnotationKey] = ""
+	if !p.Update(event.UpdateEvent{ObjectOld: oldNs, ObjectNew: changed}) {
+		t.Error("Expected event when the node selector annotation changes")
+	}
+}
+
+func TestInObservedNamespace(t *testing.T) {
+	r := newWatchTestReconciler(t)
+	p := r.inObservedNamespace()
+
+	for ns, expected := range map[string]bool{
+		"sdi":                             true,
+		"sap-slcbridge":                   true,
+		"sdi-observer":                    true,
+		"openshift-ingress-operator":      true,
+		adjuster.OpenShiftConfigNamespace: true,
+		"kube-system":                     false,
+	} {
+		secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "any", Namespace: ns}}
+		if got := p.Create(event.CreateEvent{Object: secret}); got != expected {
+			t.Errorf("Expected the event of namespace %s to pass %t, got %t", ns, expected, got)
+		}
+	}
+}
+
+// watchRecorder records the sources watched by the controller.
+type watchRecorder struct {
+	controller.Controller
+	sources []source.Source
+}
+
+func (w *watchRecorder) Watch(src source.Source) error {
+	w.sources = append(w.sources, src)
+	return nil
+}
+
+func TestWatchOptionalKinds(t *testing.T) {
+	r := newWatchTestReconciler(t)
+	mapper := meta.NewDefaultRESTMapper(nil)
+	recorder := &watchRecorder{}
+	r.controller, r.mapper = recorder, mapper
+	r.pendingWatches = []optionalWatch{{gvk: dataHubGVK, source: func() source.Source { return source.Func(nil) }}}
+
+	// SDI is installed after the operator.
+	r.watchOptionalKinds(logr.Discard())
+	if len(recorder.sources) != 0 || len(r.pendingWatches) != 1 {
+		t.Fatalf("Expected the DataHub watch to wait for its kind, got %d sources", len(recorder.sources))
+	}
+
+	mapper.Add(dataHubGVK, meta.RESTScopeNamespace)
+	r.watchOptionalKinds(logr.Discard())
+	if len(recorder.sources) != 1 || len(r.pendingWatches) != 0 {
+		t.Errorf("Expected the DataHub kind to be watched once it is served, got %d sources", len(recorder.sources))
+	}
+
+	r.watchOptionalKinds(logr.Discard())
+	if len(recorder.sources) != 1 {
+		t.Errorf("Expected the DataHub kind to be watched once, got %d sources", len(recorder.sources))
+	}
+}
@@ -41,6 +41,8 @@ import (
 
 	sdiv1alpha1 "github.com/redhat-sap/sap-data-intelligence/observer-operator/api/v1alpha1"
 	"github.com/redhat-sap/sap-data-intelligence/observer-operator/controllers"
+	"github.com/redhat-sap/sap-data-intelligence/observer-operator/pkg/acme"
+	"github.com/redhat-sap/sap-data-intelligence/observer-operator/pkg/adjuster"
 
 	configv1 "github.com/openshift/machine-config-operator/pkg/apis/machineconfiguration.openshift.io/v1"
 	//+kubebuilder:scaffold:imports
@@ -53,6 +55,7 @@ var (
 
 const (
 	namespaceEnvVar = "OPERATOR_NAMESPACE"
+	podIPEnvVar     = "POD_IP"
 )
 
 func init() {
@@ -104,6 +107,8 @@ type config struct {
 	EnableLeaderElection bool
 	Namespace            string
 	RequeueInterval      time.Duration
+	PodIP                string
+	ACMEHTTP01Port       int
 }
 
 func parseFlags() config {
@@ -117,6 +122,9 @@ func parseFlags() config {
 	flag.StringVar(&cfg.Namespace, "namespace", os.Getenv(namespaceEnvVar),
 		"The k8s namespace where the operator runs. "+mkOverride(namespaceEnvVar))
 	flag.DurationVar(&cfg.RequeueInterval, "requeue-interval", 1*time.Minute, "The duration until the next untriggered reconciliation run")
+	flag.StringVar(&cfg.PodIP, "pod-ip", os.Getenv(podIPEnvVar),
+		"The IP of the operator pod the ACME HTTP-01 challenges are routed to. "+mkOverride(podIPEnvVar))
+	flag.IntVar(&cfg.ACMEHTTP01Port, "acme-http01-port", 8089, "The port the ACME HTTP-01 challenges are answered on.")
 
 	opts := zap.Options{Development: true}
 	opts.BindFlags(flag.CommandLine)
@@ -146,11 +154,20 @@ func setupLogger() {
 }
 
 func setupController(mgr ctrl.Manager, cfg config) error {
+	if cfg.ACMEHTTP01Port < 1 || cfg.ACMEHTTP01Port > 65535 {
+		return fmt.Errorf("invalid ACME HTTP-01 port %d", cfg.ACMEHTTP01Port)
+	}
+	acmeServer := acme.NewHTTP01Server(cfg.PodIP, int32(cfg.ACMEHTTP01Port)) // #nosec G115 -- the port range is checked
+	if err := mgr.Add(acmeServer); err != nil {
+		return err
+	}
 	return (&controllers.SDIObserverReconciler{
 		Client:            mgr.GetClient(),
 		Scheme:            mgr.GetScheme(),
 		ObserverNamespace: cfg.Namespace,
 		Interval:          cfg.RequeueInterval,
+		Recorder:          mgr.GetEventRecorderFor("sdiobserver-controller"),
+		ACMEIssuer:        adjuster.NewACMEIssuer(acmeServer),
 	}).SetupWithManager(mgr)
 }
 
@@ -0,0 +1,179 @@
+// Package acme obtains certificates from ACME (RFC 8555) servers, like Let's Encrypt, with HTTP-01
+// challenges.
+package acme
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"golang.org/x/crypto/acme"
+)
+
+// LetsEncryptURL is the directory of the Let's Encrypt production server.
+const LetsEncryptURL = acme.LetsEncryptURL
+
+const (
+	// userAgent identifies the operator to the ACME servers.
+	userAgent = "sdi-observer-operator"
+	// challengeTypeHTTP01 is the only challenge type solved.
+	challengeTypeHTTP01 = "http-01"
+	requestTimeout      = 30 * time.Second
+)
+
+// Solver makes the response to an HTTP-01 challenge available at
+// http://<host>/.well-known/acme-challenge/<token> until it is cleaned up.
+type Solver interface {
+	Present(ctx context.Context, host, token, keyAuth string) error
+	CleanUp(ctx context.Context, host, token string) error
+}
+
+// NewClient returns a client of the ACME server at the directory URL signing its requests with the
+// account key. The TLS certificate of the server is verified with the PEM CA bundle, or with the system
+// trust store if empty.
+func NewClient(key crypto.Signer, directoryURL, caBundle string) (*acme.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if caBundle != "" {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM([]byte(caBundle)) {
+			return nil, fmt.Errorf("no CA certificate found in the CA bundle of ACME server %s", directoryURL)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	}
+	return &acme.Client{
+		Key:          key,
+		DirectoryURL: directoryURL,
+		UserAgent:    userAgent,
+		HTTPClient:   &http.Client{Transport: transport, Timeout: requestTimeout},
+	}, nil
+}
+
+// Issue registers the account of the client unless it exists and obtains a certificate for the host. The
+// HTTP-01 challenges of the host are presented by the solver and cleaned up afterwards. The certificate
+// chain and its new private key are returned PEM encoded.
+func Issue(ctx context.Context, client *acme.Client, email, host string, solver Solver) ([]byte, []byte, error) {
+	account := &acme.Account{}
+	if email != "" {
+		account.Contact = []string{"mailto:" + email}
+	}
+	if _, err := client.Register(ctx, account, acme.AcceptTOS); err != nil && !errors.Is(err, acme.ErrAccountAlreadyExists) {
+		return nil, nil, fmt.Errorf("unable to register ACME account: %w", err)
+	}
+
+	order, err := client.AuthorizeOrder(ctx, acme.DomainIDs(host))
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to order certificate for %s: %w", host, err)
+	}
+	for _, url := range order.AuthzURLs {
+		if err := authorize(ctx, client, url, solver); err != nil {
+			return nil, nil, err
+		}
+	}
+	if order, err = client.WaitOrder(ctx, order.URI); err != nil {
+		return nil, nil, fmt.Errorf("unable to complete order of certificate for %s: %w", host, err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to generate certificate key: %w", err)
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{DNSNames: []string{host}}, key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to create certificate request: %w", err)
+	}
+	chain, _, err := client.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to finalize order of certificate for %s: %w", host, err)
+	}
+
+	var certificate bytes.Buffer
+	for _, der := range chain {
+		if err := pem.Encode(&certificate, &pem.Block{Type: "CERTIFICATE", Bytes: der}); err != nil {
+			return nil, nil, err
+		}
+	}
+	keyPEM, err := EncodeKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return certificate.Bytes(), keyPEM, nil
+}
+
+// authorize solves the HTTP-01 challenge of the authorization unless it is valid already.
+func authorize(ctx context.Context, client *acme.Client, url string, solver Solver) error {
+	authz, err := client.GetAuthorization(ctx, url)
+	if err != nil {
+		return fmt.Errorf("unable to get ACME authorization: %w", err)
+	}
+	if authz.Status == acme.StatusValid {
+		return nil
+	}
+	host := authz.Identifier.Value
+	var challenge *acme.Challenge
+	for _, c := range authz.Challenges {
+		if c.Type == challengeTypeHTTP01 {
+			challenge = c
+			break
+		}
+	}
+	if challenge == nil {
+		return fmt.Errorf("ACME server offers no %s challenge for %s", challengeTypeHTTP01, host)
+	}
+
+	keyAuth, err := client.HTTP01ChallengeResponse(challenge.Token)
+	if err != nil {
+		return err
+	}
+	if err := solver.Present(ctx, host, challenge.Token, keyAuth); err != nil {
+		return fmt.Errorf("unable to present challenge for %s: %w", host, err)
+	}
+	defer func() {
+		// The challenge objects are removed even if the context is done.
+		_ = solver.CleanUp(context.WithoutCancel(ctx), host, challenge.Token)
+	}()
+
+	if _, err := client.Accept(ctx, challenge); err != nil {
+		return fmt.Errorf("unable to accept challenge for %s: %w", host, err)
+	}
+	if _, err := client.WaitAuthorization(ctx, authz.URI); err != nil {
+		return fmt.Errorf("authorization for %s failed: %w", host, err)
+	}
+	return nil
+}
+
+// GenerateKey returns a new account key.
+func GenerateKey() (crypto.Signer, error) {
+	return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+}
+
+// EncodeKey returns the PEM encoding of an ECDSA key.
+func EncodeKey(key crypto.Signer) ([]byte, error) {
+	ecKey, ok := key.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("unsupported key type %T", key)
+	}
+	der, err := x509.MarshalECPrivateKey(ecKey)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), nil
+}
+
+// ParseKey parses a PEM encoded ECDSA key.
+func ParseKey(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "EC PRIVATE KEY" {
+		return nil, fmt.Errorf("no EC private key found")
+	}
+	return x509.ParseECPrivateKey(block.Bytes)
+}
@@ -0,0 +1,156 @@
+package acme
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHTTP01Server(t *testing.T) {
+	s := NewHTTP01Server("10.128.0.10", 8089)
+	s.SetResponse("token", "token.thumbprint")
+	server := httptest.NewServer(s)
+	defer server.Close()
+
+	for _, tt := range []struct {
+		path   string
+		status int
+		body   string
+	}{
+		{path: ChallengePathPrefix + "token", status: http.StatusOK, body: "token.thumbprint"},
+		{path: ChallengePathPrefix + "other", status: http.StatusNotFound},
+		{path: "/token", status: http.StatusNotFound},
+	} {
+		resp, err := http.Get(server.URL + tt.path)
+		if err != nil {
+			t.Fatalf("Failed to get %s: %v", tt.path, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != tt.status || (tt.body != "" && string(body) != tt.body) {
+			t.Errorf("Expected %d %q for %s, got %d %q", tt.status, tt.body, tt.path, resp.StatusCode, body)
+		}
+	}
+
+	s.RemoveResponse("token")
+	resp, err := http.Get(server.URL + ChallengePathPrefix + "token")
+	if err != nil {
+		t.Fatalf("Failed to get challenge: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected the removed challenge not to be answered, got %d", resp.StatusCode)
+	}
+}
+
+func TestKeyEncoding(t *testing.T) {
+	key, err := GenerateKey()
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	data, err := EncodeKey(key)
+	if err != nil {
+		t.Fatalf("Failed to encode key: %v", err)
+	}
+	parsed, err := ParseKey(data)
+	if err != nil {
+		t.Fatalf("Failed to parse key: %v", err)
+	}
+	if !parsed.Public().(*ecdsa.PublicKey).Equal(key.Public()) {
+		t.Errorf("Expected the parsed key to equal the generated one")
+	}
+	if _, err := ParseKey([]byte("garbage")); err == nil {
+		t.Errorf("Expected an error for data without a key")
+	}
+}
+
+// serverSolver presents the challenges with an HTTP01Server listening on the port.
+type serverSolver struct {
+	server    *HTTP01Server
+	presented []string
+}
+
+func (s *serverSolver) Present(_ context.Context, host, token, keyAuth string) error {
+	s.presented = append(s.presented, host)
+	s.server.SetResponse(token, keyAuth)
+	return nil
+}
+
+func (s *serverSolver) CleanUp(_ context.Context, _, token string) error {
+	s.server.RemoveResponse(token)
+	return nil
+}
+
+// TestIssuePebble obtains a certificate from a Pebble test server, e.g. started with:
+//
+//	docker run -e PEBBLE_VA_ALWAYS_VALID=1 -p 14000:14000 ghcr.io/letsencrypt/pebble
+//	ACME_TEST_DIRECTORY_URL=https://localhost:14000/dir ACME_TEST_CA_FILE=pebble.minica.pem go test ./pkg/acme/
+//
+// Without PEBBLE_VA_ALWAYS_VALID, Pebble has to reach ACME_TEST_HOST on port 5002 to validate the
+// challenges. The test is skipped unless ACME_TEST_DIRECTORY_URL is set.
+func TestIssuePebble(t *testing.T) {
+	directoryURL := os.Getenv("ACME_TEST_DIRECTORY_URL")
+	if directoryURL == "" {
+		t.Skip("ACME_TEST_DIRECTORY_URL is not set")
+	}
+	var caBundle string
+	if file := os.Getenv("ACME_TEST_CA_FILE"); file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatalf("Failed to read CA file: %v", err)
+		}
+		caBundle = string(data)
+	}
+	host := os.Getenv("ACME_TEST_HOST")
+	if host == "" {
+		host = "sdi.example.com"
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	solver := &serverSolver{server: NewHTTP01Server("", 5002)}
+	go func() { _ = solver.server.Start(ctx) }()
+
+	key, err := GenerateKey()
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	client, err := NewClient(key, directoryURL, caBundle)
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	certificate, keyPEM, err := Issue(ctx, client, "admin@example.com", host, solver)
+	if err != nil {
+		t.Fatalf("Failed to issue certificate: %v", err)
+	}
+	if len(solver.presented) != 1 || solver.presented[0] != host {
+		t.Errorf("Expected the challenge of %s to be presented, got %v", host, solver.presented)
+	}
+	block, _ := pem.Decode(certificate)
+	if block == nil {
+		t.Fatalf("Expected a PEM certificate, got %q", certificate)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatalf("Failed to parse certificate: %v", err)
+	}
+	if err := cert.VerifyHostname(host); err != nil {
+		t.Errorf("Expected a certificate for %s: %v", host, err)
+	}
+	if !strings.Contains(string(keyPEM), "EC PRIVATE KEY") {
+		t.Errorf("Expected the certificate key, got %q", keyPEM)
+	}
+
+	// The account is reused.
+	if _, _, err := Issue(ctx, client, "admin@example.com", host, solver); err != nil {
+		t.Errorf("Failed to issue certificate with the existing account: %v", err)
+	}
+}
@@ -0,0 +1,91 @@
+package acme
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ChallengePathPrefix is the path the HTTP-01 challenges are fetched from.
+const ChallengePathPrefix = "/.well-known/acme-challenge/"
+
+// HTTP01Server answers the HTTP-01 challenges with the key authorizations of the tokens being presented.
+// It runs in the operator pod, the challenges are routed to the pod IP.
+type HTTP01Server struct {
+	// IP is the address of the pod.
+	IP string
+	// Port the server listens on.
+	Port int32
+
+	mu        sync.RWMutex
+	responses map[string]string
+}
+
+// NewHTTP01Server returns a server listening on the port of the pod IP.
+func NewHTTP01Server(ip string, port int32) *HTTP01Server {
+	return &HTTP01Server{IP: ip, Port: port, responses: map[string]string{}}
+}
+
+// SetResponse answers the challenge of the token with the key authorization.
+func (s *HTTP01Server) SetResponse(token, keyAuth string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.responses[token] = keyAuth
+}
+
+// RemoveResponse stops answering the challenge of the token.
+func (s *HTTP01Server) RemoveResponse(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.responses, token)
+}
+
+// ServeHTTP answers the challenge of the token in the path.
+func (s *HTTP01Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	token, ok := strings.CutPrefix(r.URL.Path, ChallengePathPrefix)
+	if !ok || r.Method != http.MethodGet {
+		http.NotFound(w, r)
+		return
+	}
+	s.mu.RLock()
+	keyAuth, ok := s.responses[token]
+	s.mu.RUnlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	_, _ = w.Write([]byte(keyAuth))
+}
+
+// Start serves the challenges until the context is done. It implements the manager.Runnable interface.
+func (s *HTTP01Server) Start(ctx context.Context) error {
+	server := &http.Server{
+		Addr:              fmt.Sprintf(":%d", s.Port),
+		Handler:           s,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	listener, err := net.Listen("tcp", server.Addr)
+	if err != nil {
+		return fmt.Errorf("unable to listen for ACME challenges: %w", err)
+	}
+	go func() {
+		<-ctx.Done()
+		_ = server.Close()
+	}()
+	if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// NeedLeaderElection tells the manager to run the server on every replica, so that it is up when the
+// replica becomes the leader.
+func (s *HTTP01Server) NeedLeaderElection() bool {
+	return false
+}
@@ -0,0 +1,403 @@
+package adjuster
+
+import (
+	"context"
+	"crypto"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	routev1 "github.com/openshift/api/route/v1"
+	sdiv1alpha1 "github.com/redhat-sap/sap-data-intelligence/observer-operator/api/v1alpha1"
+	"github.com/redhat-sap/sap-data-intelligence/observer-operator/pkg/acme"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// acmeSecretSuffix names the secret holding the certificate issued for a route.
+	acmeSecretSuffix = "-acme-tls"
+	// acmeChallengeSuffix names the temporary route, service and endpoints answering the challenges of a
+	// route.
+	acmeChallengeSuffix = "-acme-challenge"
+	// acmeAccountSecretPrefix names the secret holding the account key of an ACME server.
+	acmeAccountSecretPrefix = "acme-account-"
+	acmeAccountKeySecretKey = "account.key"
+	// defaultACMERenewBeforeDays applies when the spec does not set the renewal period.
+	defaultACMERenewBeforeDays = 30
+	// acmeRetryInterval delays the next issuance after a failure so that the rate limits of the ACME
+	// server are not exceeded.
+	acmeRetryInterval = 15 * time.Minute
+	// acmeAdmissionTimeout bounds the wait for the router to admit the challenge route.
+	acmeAdmissionTimeout  = time.Minute
+	acmeAdmissionInterval = 2 * time.Second
+	// acmeIssuanceTimeout bounds the issuance of a certificate.
+	acmeIssuanceTimeout = 5 * time.Minute
+)
+
+// validateACME checks that the certificate of the route can be issued by an ACME server.
+func validateACME(r managedRoute, termination routev1.TLSTerminationType, backend sdiv1alpha1.ExposureBackend) error {
+	switch {
+	case r.spec.ACME == nil:
+		return nil
+	case r.spec.CertificateSecretRef != nil:
+		return fmt.Errorf("route %s cannot have both a certificate secret and an ACME certificate", r.name)
+	case termination == routev1.TLSTerminationPassthrough:
+		return fmt.Errorf("route %s with the %s termination cannot serve an ACME certificate", r.name, termination)
+	case backend != sdiv1alpha1.ExposureBackendRoute:
+		return fmt.Errorf("ACME certificate of route %s is only supported with the %s backend", r.name, sdiv1alpha1.ExposureBackendRoute)
+	}
+	return nil
+}
+
+// adjustACMECertificate sets the certificate issued by the ACME server of the spec on the route. The
+// certificate is issued, or renewed within the renewal period, in the background by the ACMEIssuer and
+// stored in a kubernetes.io/tls secret next to the route; meanwhile the adjustment is in progress. A failed
+// issuance is retried after acmeRetryInterval and the route keeps its current certificate, if still valid.
+// The issuance needs the host of the route, thus a route whose host is generated by the router gets its
+// certificate in a later reconciliation.
+func (a *Adjuster) adjustACMECertificate(ctx context.Context, obs *sdiv1alpha1.SDIObserver, r managedRoute, route *routev1.Route) error {
+	spec := r.spec.ACME
+	if spec == nil {
+		r.status.ACME = nil
+		meta.RemoveStatusCondition(&r.status.Conditions, sdiv1alpha1.ConditionTypeCertificateIssued)
+		return nil
+	}
+	status := r.status.ACME
+	if status == nil {
+		status = &sdiv1alpha1.ACMEStatus{}
+		r.status.ACME = status
+	}
+	status.SecretName = r.name + acmeSecretSuffix
+
+	host := route.Spec.Host
+	if host == "" {
+		existing := &routev1.Route{}
+		if err := a.Client.Get(ctx, client.ObjectKeyFromObject(route), existing); client.IgnoreNotFound(err) != nil {
+			return fmt.Errorf("unable to get route %s: %w", r.name, err)
+		}
+		host = existing.Spec.Host
+	}
+	if host == "" {
+		setCertificateIssuedCondition(r.status, metav1.ConditionFalse, sdiv1alpha1.ReasonIssuancePending,
+			fmt.Sprintf("Waiting for the router to generate the host of route %s", r.name))
+		return nil
+	}
+
+	secret := &corev1.Secret{}
+	if err := a.Client.Get(ctx, client.ObjectKey{Name: status.SecretName, Namespace: r.namespace}, secret); client.IgnoreNotFound(err) != nil {
+		return fmt.Errorf("unable to get certificate secret of route %s: %w", r.name, err)
+	}
+	now := time.Now()
+
+	// The outcome of a complete issuance is collected once. The issued secret may not be in the cache yet.
+	key := r.namespace + "/" + r.name
+	issuance, found := acmeIssuance{}, false
+	if a.ACMEIssuer != nil {
+		issuance, found = a.ACMEIssuer.issuance(key)
+	}
+	if found && !issuance.finished.IsZero() {
+		a.ACMEIssuer.forget(key)
+		switch {
+		case issuance.err != nil:
+			status.LastFailureTime = &metav1.Time{Time: issuance.finished}
+			msg := fmt.Sprintf("Unable to issue certificate for %s: %v; retrying after %s", issuance.host, issuance.err,
+				issuance.finished.Add(acmeRetryInterval).UTC().Format(time.RFC3339))
+			setCertificateIssuedCondition(r.status, metav1.ConditionFalse, sdiv1alpha1.ReasonIssuanceFailed, msg)
+			if a.Recorder != nil {
+				a.Recorder.Event(obs, corev1.EventTypeWarning, sdiv1alpha1.ReasonIssuanceFailed, msg)
+			}
+		case issuance.host == host:
+			status.LastFailureTime = nil
+			secret = issuance.secret
+		}
+	}
+
+	status.NotAfter = nil
+	if notAfter, ok := acmeCertificateExpiry(secret, host, now); ok {
+		status.NotAfter = &metav1.Time{Time: notAfter}
+		setRouteCertificate(route, secret)
+	}
+
+	days := spec.RenewBeforeDays
+	if days <= 0 {
+		days = defaultACMERenewBeforeDays
+	}
+	switch {
+	case status.NotAfter != nil && now.Before(status.NotAfter.Add(-time.Duration(days)*24*time.Hour)):
+		setCertificateIssuedCondition(r.status, metav1.ConditionTrue, sdiv1alpha1.ReasonCertificateIssued,
+			fmt.Sprintf("Certificate for %s expires on %s", host, status.NotAfter.UTC().Format(time.RFC3339)))
+		return nil
+	case found && issuance.finished.IsZero():
+		msg := fmt.Sprintf("Issuing certificate for %s since %s", issuance.host, issuance.started.UTC().Format(time.RFC3339))
+		setCertificateIssuedCondition(r.status, metav1.ConditionFalse, sdiv1alpha1.ReasonIssuancePending, msg)
+		return InProgress(sdiv1alpha1.ReasonIssuancePending, msg)
+	case a.dryRun:
+		setCertificateIssuedCondition(r.status, metav1.ConditionFalse, sdiv1alpha1.ReasonIssuancePending,
+			fmt.Sprintf("Certificate for %s would be issued by %s", host, spec.DirectoryURL))
+		return nil
+	case status.LastFailureTime != nil && now.Before(status.LastFailureTime.Add(acmeRetryInterval)):
+		// The condition set when the failure was collected tells the cause and the retry time.
+		if condition := meta.FindStatusCondition(r.status.Conditions, sdiv1alpha1.ConditionTypeCertificateIssued); condition == nil ||
+			condition.Reason != sdiv1alpha1.ReasonIssuanceFailed {
+			setCertificateIssuedCondition(r.status, metav1.ConditionFalse, sdiv1alpha1.ReasonIssuanceFailed,
+				fmt.Sprintf("Issuance of the certificate for %s failed; retrying after %s",
+					host, status.LastFailureTime.Add(acmeRetryInterval).UTC().Format(time.RFC3339)))
+		}
+		return nil
+	case !a.ACMEIssuer.available():
+		setCertificateIssuedCondition(r.status, metav1.ConditionFalse, sdiv1alpha1.ReasonIssuanceFailed,
+			"The ACME challenge server of the operator is not available")
+		return fmt.Errorf("unable to issue certificate of route %s: the ACME challenge server of the operator is not available", r.name)
+	}
+
+	a.logger.Info(fmt.Sprintf("Issuing certificate for %s of route %s from %s", host, r.name, spec.DirectoryURL))
+	// The issuance runs after the reconciliation, with its own adjuster and copies of the observer and spec.
+	issuer := New(a.Name, a.Namespace, a.Client, a.Scheme, a.logger)
+	issuer.ACMEIssuer, issuer.issueCertificate = a.ACMEIssuer, a.issueCertificate
+	owner, acmeSpec, name, ns := obs.DeepCopy(), *spec.DeepCopy(), r.name, r.namespace
+	a.ACMEIssuer.start(ctx, key, host, client.ObjectKeyFromObject(obs), func(ctx context.Context) (*corev1.Secret, error) {
+		return issuer.issueACMECertificate(ctx, owner, name, ns, acmeSpec, host)
+	})
+	msg := fmt.Sprintf("Issuing certificate for %s from %s", host, spec.DirectoryURL)
+	setCertificateIssuedCondition(r.status, metav1.ConditionFalse, sdiv1alpha1.ReasonIssuancePending, msg)
+	return InProgress(sdiv1alpha1.ReasonIssuancePending, msg)
+}
+
+// acmeCertificateExpiry returns the expiry of the certificate of the secret if it is valid for the host.
+func acmeCertificateExpiry(secret *corev1.Secret, host string, now time.Time) (time.Time, bool) {
+	if len(secret.Data[corev1.TLSPrivateKeyKey]) == 0 {
+		return time.Time{}, false
+	}
+	certs, err := parseCertificates(secret.Data[corev1.TLSCertKey])
+	if err != nil || len(certs) == 0 {
+		return time.Time{}, false
+	}
+	if certs[0].VerifyHostname(host) != nil || now.After(certs[0].NotAfter) {
+		return time.Time{}, false
+	}
+	return certs[0].NotAfter, true
+}
+
+// setRouteCertificate sets the certificate and key of the kubernetes.io/tls secret on the route.
+func setRouteCertificate(route *routev1.Route, secret *corev1.Secret) {
+	route.Spec.TLS.Certificate = strings.TrimSpace(string(secret.Data[corev1.TLSCertKey]))
+	route.Spec.TLS.Key = strings.TrimSpace(string(secret.Data[corev1.TLSPrivateKeyKey]))
+	route.Spec.TLS.CACertificate = strings.TrimSpace(string(secret.Data[routeCACertificateKey]))
+}
+
+func setCertificateIssuedCondition(status *sdiv1alpha1.ManagedRouteStatus, conditionStatus metav1.ConditionStatus, reason, msg string) {
+	meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+		Type:    sdiv1alpha1.ConditionTypeCertificateIssued,
+		Status:  conditionStatus,
+		Reason:  reason,
+		Message: msg,
+	})
+}
+
+// issueACMECertificate obtains a certificate for the host of the route and stores it in the secret of the
+// route.
+func (a *Adjuster) issueACMECertificate(ctx context.Context, obs *sdiv1alpha1.SDIObserver, name, ns string, spec sdiv1alpha1.ACMESpec, host string) (*corev1.Secret, error) {
+	ctx, cancel := context.WithTimeout(ctx, acmeIssuanceTimeout)
+	defer cancel()
+	key, err := a.acmeAccountKey(ctx, obs, spec.DirectoryURL)
+	if err != nil {
+		return nil, err
+	}
+	solver := &routeChallengeSolver{a: a, obs: obs, name: name + acmeChallengeSuffix, namespace: ns}
+	certificate, certificateKey, err := a.issueCertificate(ctx, spec, key, host, solver)
+	if err != nil {
+		return nil, err
+	}
+
+	secret := &corev1.Secret{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Secret"},
+		ObjectMeta: metav1.ObjectMeta{Name: name + acmeSecretSuffix, Namespace: ns},
+		Type:       corev1.SecretTypeTLS,
+		Data: map[string][]byte{
+			corev1.TLSCertKey:       certificate,
+			corev1.TLSPrivateKeyKey: certificateKey,
+		},
+	}
+	if _, err := a.apply(ctx, obs, secret); err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
+
+// issueACMECertificateFromServer obtains a certificate for the host from the ACME server of the spec.
+func issueACMECertificateFromServer(ctx context.Context, spec sdiv1alpha1.ACMESpec, key crypto.Signer, host string, solver acme.Solver) ([]byte, []byte, error) {
+	directoryURL := spec.DirectoryURL
+	if directoryURL == "" {
+		directoryURL = acme.LetsEncryptURL
+	}
+	c, err := acme.NewClient(key, directoryURL, spec.CACertificate)
+	if err != nil {
+		return nil, nil, err
+	}
+	return acme.Issue(ctx, c, spec.Email, host, solver)
+}
+
+// acmeAccountKey returns the key of the account at the ACME server. The key is generated on first use and
+// stored in a secret of the observer namespace, one per ACME server.
+func (a *Adjuster) acmeAccountKey(ctx context.Context, obs *sdiv1alpha1.SDIObserver, directoryURL string) (crypto.Signer, error) {
+	sum := sha256.Sum256([]byte(directoryURL))
+	name := acmeAccountSecretPrefix + hex.EncodeToString(sum[:])[:10]
+	secret := &corev1.Secret{}
+	err := a.Client.Get(ctx, client.ObjectKey{Name: name, Namespace: obs.Namespace}, secret)
+	switch {
+	case err == nil:
+		key, err := acme.ParseKey(secret.Data[acmeAccountKeySecretKey])
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse ACME account key of secret %s: %w", name, err)
+		}
+		return key, nil
+	case client.IgnoreNotFound(err) != nil:
+		return nil, fmt.Errorf("unable to get ACME account key secret %s: %w", name, err)
+	}
+
+	key, err := acme.GenerateKey()
+	if err != nil {
+		return nil, fmt.Errorf("unable to generate ACME account key: %w", err)
+	}
+	data, err := acme.EncodeKey(key)
+	if err != nil {
+		return nil, err
+	}
+	secret = &corev1.Secret{
+		TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "Secret"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Namespace:   obs.Namespace,
+			Annotations: map[string]string{ACMEDirectoryURLAnnotationKey: directoryURL},
+		},
+		Type: corev1.SecretTypeOpaque,
+		Data: map[string][]byte{acmeAccountKeySecretKey: data},
+	}
+	if _, err := a.apply(ctx, obs, secret); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// routeChallengeSolver routes the HTTP-01 challenges of a host to the challenge server of the operator
+// with a temporary route to a service whose endpoint is the operator pod.
+type routeChallengeSolver struct {
+	a         *Adjuster
+	obs       *sdiv1alpha1.SDIObserver
+	name      string
+	namespace string
+}
+
+// Present creates the challenge route of the token and waits until the router admits it.
+func (s *routeChallengeSolver) Present(ctx context.Context, host, token, keyAuth string) error {
+	server := s.a.ACMEIssuer.Server
+	server.SetResponse(token, keyAuth)
+
+	objectMeta := metav1.ObjectMeta{Name: s.name, Namespace: s.namespace}
+	service := &corev1.Service{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Service"},
+		ObjectMeta: objectMeta,
+		Spec: corev1.ServiceSpec{Ports: []corev1.ServicePort{{
+			Name:       "http",
+			Port:       80,
+			TargetPort: intstr.FromInt32(server.Port),
+		}}},
+	}
+	addressType := discoveryv1.AddressTypeIPv4
+	if strings.Contains(server.IP, ":") {
+		addressType = discoveryv1.AddressTypeIPv6
+	}
+	endpoints := &discoveryv1.EndpointSlice{
+		TypeMeta: metav1.TypeMeta{APIVersion: "discovery.k8s.io/v1", Kind: "EndpointSlice"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      s.name,
+			Namespace: s.namespace,
+			Labels: map[string]string{
+				discoveryv1.LabelServiceName: s.name,
+				discoveryv1.LabelManagedBy:   FieldManager,
+			},
+		},
+		AddressType: addressType,
+		Endpoints: []discoveryv1.Endpoint{{
+			Addresses:  []string{server.IP},
+			Conditions: discoveryv1.EndpointConditions{Ready: ptr.To(true)},
+		}},
+		Ports: []discoveryv1.EndpointPort{{
+			Name:     ptr.To("http"),
+			Port:     ptr.To(server.Port),
+			Protocol: ptr.To(corev1.ProtocolTCP),
+		}},
+	}
+	route := &routev1.Route{
+		TypeMeta:   metav1.TypeMeta{APIVersion: routev1.GroupVersion.String(), Kind: "Route"},
+		ObjectMeta: objectMeta,
+		Spec: routev1.RouteSpec{
+			Host: host,
+			Path: acme.ChallengePathPrefix + token,
+			To:   routev1.RouteTargetReference{Kind: "Service", Name: s.name},
+			Port: &routev1.RoutePort{TargetPort: intstr.FromString("http")},
+		},
+	}
+	for _, obj := range []client.Object{service, endpoints, route} {
+		if _, err := s.a.apply(ctx, s.obs, obj); err != nil {
+			return err
+		}
+	}
+	return s.waitForAdmission(ctx, client.ObjectKeyFromObject(route))
+}
+
+// waitForAdmission waits until the router admits the challenge route. A route rejected by the router,
+// e.g. because another namespace claims the host, fails the challenge.
+func (s *routeChallengeSolver) waitForAdmission(ctx context.Context, key client.ObjectKey) error {
+	err := wait.PollUntilContextTimeout(ctx, acmeAdmissionInterval, acmeAdmissionTimeout, true, func(ctx context.Context) (bool, error) {
+		route := &routev1.Route{}
+		if err := s.a.Client.Get(ctx, key, route); err != nil {
+			return false, client.IgnoreNotFound(err)
+		}
+		for _, ingress := range route.Status.Ingress {
+			for _, condition := range ingress.Conditions {
+				if condition.Type != routev1.RouteAdmitted {
+					continue
+				}
+				if condition.Status == corev1.ConditionTrue {
+					return true, nil
+				}
+				if condition.Status == corev1.ConditionFalse {
+					return false, fmt.Errorf("challenge route %s rejected by router %s: %s", key.Name, ingress.RouterName, condition.Message)
+				}
+			}
+		}
+		return false, nil
+	})
+	if wait.Interrupted(err) {
+		return fmt.Errorf("challenge route %s not admitted within %s", key.Name, acmeAdmissionTimeout)
+	}
+	return err
+}
+
+// CleanUp removes the challenge route with its service and endpoints.
+func (s *routeChallengeSolver) CleanUp(ctx context.Context, _, token string) error {
+	s.a.ACMEIssuer.Server.RemoveResponse(token)
+	var errs []error
+	objectMeta := metav1.ObjectMeta{Name: s.name, Namespace: s.namespace}
+	for _, obj := range []client.Object{
+		&routev1.Route{ObjectMeta: objectMeta},
+		&discoveryv1.EndpointSlice{ObjectMeta: objectMeta},
+		&corev1.Service{ObjectMeta: objectMeta},
+	} {
+		if err := s.a.Client.Delete(ctx, obj); client.IgnoreNotFound(err) != nil {
+			errs = append(errs, fmt.Errorf("unable to delete challenge objects %s: %w", s.name, err))
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
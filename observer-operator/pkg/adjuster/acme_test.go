@@ -0,0 +1,324 @@
+package adjuster
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	routev1 "github.com/openshift/api/route/v1"
+	sdiv1alpha1 "github.com/redhat-sap/sap-data-intelligence/observer-operator/api/v1alpha1"
+	"github.com/redhat-sap/sap-data-intelligence/observer-operator/pkg/acme"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const testACMEHost = "vsystem.apps.example.com"
+
+// newACMETestAdjuster returns an adjuster whose router admits the challenge route of vsystem, or rejects it.
+func newACMETestAdjuster(t *testing.T, admitted corev1.ConditionStatus, objs ...client.Object) *Adjuster {
+	t.Helper()
+	challenge := &routev1.Route{
+		ObjectMeta: metav1.ObjectMeta{Name: VSystemRouteName + acmeChallengeSuffix, Namespace: "sdi"},
+		Status: routev1.RouteStatus{Ingress: []routev1.RouteIngress{{
+			RouterName: "default",
+			Conditions: []routev1.RouteIngressCondition{{Type: routev1.RouteAdmitted, Status: admitted, Message: "host already claimed"}},
+		}}},
+	}
+	a := newRouteTestAdjuster(t, append(objs, challenge)...)
+	a.ACMEIssuer = NewACMEIssuer(acme.NewHTTP01Server("10.128.0.10", 8089))
+	return a
+}
+
+// adjustACMERoute adjusts the vsystem route once more after the certificate issued in the background, if
+// any.
+func adjustACMERoute(a *Adjuster, obs *sdiv1alpha1.SDIObserver) error {
+	err := a.AdjustSDIVsystemRoute("sdi", obs, context.Background())
+	var progressing *ProgressingError
+	if errors.As(err, &progressing) {
+		a.ACMEIssuer.wait()
+		err = a.AdjustSDIVsystemRoute("sdi", obs, context.Background())
+	}
+	return err
+}
+
+func newACMETestObserver() *sdiv1alpha1.SDIObserver {
+	return &sdiv1alpha1.SDIObserver{
+		ObjectMeta: metav1.ObjectMeta{Name: "sdi", Namespace: "operators"},
+		Spec: sdiv1alpha1.SDIObserverSpec{SDIVSystemRoute: sdiv1alpha1.ManagedRouteSpec{
+			ManagementState: sdiv1alpha1.RouteManagementStateManaged,
+			Host:            testACMEHost,
+			Termination:     sdiv1alpha1.RouteTerminationEdge,
+			ACME: &sdiv1alpha1.ACMESpec{
+				DirectoryURL:    "https://acme.example.com/directory",
+				RenewBeforeDays: 30,
+			},
+		}},
+	}
+}
+
+// acmeTestSecret returns the secret of the vsystem route holding a certificate expiring at notAfter.
+func acmeTestSecret(t *testing.T, notAfter time.Time) *corev1.Secret {
+	certificate := issueTestCertificate(t, testACMEHost, notAfter, nil)
+	key, err := acme.EncodeKey(certificate.key)
+	if err != nil {
+		t.Fatalf("Failed to encode key: %v", err)
+	}
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: VSystemRouteName + acmeSecretSuffix, Namespace: "sdi"},
+		Type:       corev1.SecretTypeTLS,
+		Data: map[string][]byte{
+			corev1.TLSCertKey:       []byte(certificate.pem()),
+			corev1.TLSPrivateKeyKey: key,
+		},
+	}
+}
+
+func TestAdjustACMECertificate(t *testing.T) {
+	a := newACMETestAdjuster(t, corev1.ConditionTrue)
+	ctx := context.Background()
+	obs := newACMETestObserver()
+	issued := acmeTestSecret(t, time.Now().Add(90*24*time.Hour))
+
+	issuances := 0
+	a.issueCertificate = func(ctx context.Context, spec sdiv1alpha1.ACMESpec, key crypto.Signer, host string, solver acme.Solver) ([]byte, []byte, error) {
+		issuances++
+		if spec.DirectoryURL != "https://acme.example.com/directory" || host != testACMEHost || key == nil {
+			t.Errorf("Unexpected issuance for %s from %s", host, spec.DirectoryURL)
+		}
+		if err := solver.Present(ctx, host, "token", "token.thumbprint"); err != nil {
+			return nil, nil, err
+		}
+		name := client.ObjectKey{Name: VSystemRouteName + acmeChallengeSuffix, Namespace: "sdi"}
+		route := &routev1.Route{}
+		if err := a.Client.Get(ctx, name, route); err != nil {
+			return nil, nil, err
+		}
+		if route.Spec.Host != host || route.Spec.Path != acme.ChallengePathPrefix+"token" || route.Spec.To.Name != name.Name {
+			t.Errorf("Expected the challenge path of the host to be routed to the challenge service, got %v", route.Spec)
+		}
+		endpoints := &discoveryv1.EndpointSlice{}
+		if err := a.Client.Get(ctx, name, endpoints); err != nil {
+			return nil, nil, err
+		}
+		if len(endpoints.Endpoints) != 1 || endpoints.Endpoints[0].Addresses[0] != "10.128.0.10" || *endpoints.Ports[0].Port != 8089 {
+			t.Errorf("Expected the challenges to be sent to the operator pod, got %v", endpoints)
+		}
+		if err := a.Client.Get(ctx, name, &corev1.Service{}); err != nil {
+			return nil, nil, err
+		}
+		response := httptest.NewRecorder()
+		a.ACMEIssuer.Server.ServeHTTP(response, httptest.NewRequest("GET", acme.ChallengePathPrefix+"token", nil))
+		if response.Body.String() != "token.thumbprint" {
+			t.Errorf("Expected the challenge to be answered, got %q", response.Body.String())
+		}
+		if err := solver.CleanUp(ctx, host, "token"); err != nil {
+			return nil, nil, err
+		}
+		return issued.Data[corev1.TLSCertKey], issued.Data[corev1.TLSPrivateKeyKey], nil
+	}
+
+	// The certificate is issued in the background.
+	err := a.AdjustSDIVsystemRoute("sdi", obs, ctx)
+	var progressing *ProgressingError
+	if !errors.As(err, &progressing) || progressing.Reason != sdiv1alpha1.ReasonIssuancePending {
+		t.Fatalf("Expected the issuance to be in progress, got %v", err)
+	}
+	condition := meta.FindStatusCondition(obs.Status.VSystemRouteStatus.Conditions, sdiv1alpha1.ConditionTypeCertificateIssued)
+	if condition == nil || condition.Reason != sdiv1alpha1.ReasonIssuancePending {
+		t.Errorf("Expected the issuance to be reported as pending, got %v", condition)
+	}
+	a.ACMEIssuer.wait()
+	for i := 0; i < 2; i++ {
+		if err := a.AdjustSDIVsystemRoute("sdi", obs, ctx); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+	if issuances != 1 {
+		t.Errorf("Expected the certificate to be issued once, got %d issuances", issuances)
+	}
+
+	route := &routev1.Route{}
+	if err := a.Client.Get(ctx, client.ObjectKey{Name: VSystemRouteName, Namespace: "sdi"}, route); err != nil {
+		t.Fatalf("Failed to get route: %v", err)
+	}
+	if route.Spec.TLS.Certificate != strings.TrimSpace(string(issued.Data[corev1.TLSCertKey])) || route.Spec.TLS.Key == "" {
+		t.Errorf("Expected the issued certificate to be served, got %v", route.Spec.TLS)
+	}
+	secret := &corev1.Secret{}
+	if err := a.Client.Get(ctx, client.ObjectKeyFromObject(issued), secret); err != nil {
+		t.Fatalf("Failed to get certificate secret: %v", err)
+	}
+	if secret.Type != corev1.SecretTypeTLS || secret.Labels[ManagedByLabelKey] != ManagedByLabelValue {
+		t.Errorf("Expected a managed kubernetes.io/tls secret, got %v", secret.ObjectMeta)
+	}
+	accounts := &corev1.SecretList{}
+	if err := a.Client.List(ctx, accounts, client.InNamespace("operators")); err != nil || len(accounts.Items) != 1 {
+		t.Fatalf("Expected the account key to be stored, got %v: %v", accounts.Items, err)
+	}
+	if _, err := acme.ParseKey(accounts.Items[0].Data[acmeAccountKeySecretKey]); err != nil {
+		t.Errorf("Expected a valid account key: %v", err)
+	}
+	for _, obj := range []client.Object{&routev1.Route{}, &discoveryv1.EndpointSlice{}, &corev1.Service{}} {
+		if err := a.Client.Get(ctx, client.ObjectKey{Name: VSystemRouteName + acmeChallengeSuffix, Namespace: "sdi"}, obj); !apierrors.IsNotFound(err) {
+			t.Errorf("Expected the challenge %T to be removed, got %v", obj, err)
+		}
+	}
+
+	status := obs.Status.VSystemRouteStatus
+	if status.ACME == nil || status.ACME.SecretName != issued.Name || status.ACME.NotAfter == nil || status.ACME.LastFailureTime != nil {
+		t.Errorf("Expected the issued certificate in the status, got %v", status.ACME)
+	}
+	condition = meta.FindStatusCondition(status.Conditions, sdiv1alpha1.ConditionTypeCertificateIssued)
+	if condition == nil || condition.Status != metav1.ConditionTrue || condition.Reason != sdiv1alpha1.ReasonCertificateIssued {
+		t.Errorf("Expected the certificate to be reported as issued, got %v", condition)
+	}
+
+	obs.Spec.SDIVSystemRoute.ACME = nil
+	if err := a.AdjustSDIVsystemRoute("sdi", obs, ctx); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if obs.Status.VSystemRouteStatus.ACME != nil || meta.FindStatusCondition(obs.Status.VSystemRouteStatus.Conditions, sdiv1alpha1.ConditionTypeCertificateIssued) != nil {
+		t.Errorf("Expected the ACME status to be removed, got %v", obs.Status.VSystemRouteStatus)
+	}
+}
+
+func TestAdjustACMECertificate_Renewal(t *testing.T) {
+	current := acmeTestSecret(t, time.Now().Add(10*24*time.Hour))
+	a := newACMETestAdjuster(t, corev1.ConditionTrue, current)
+	renewed := acmeTestSecret(t, time.Now().Add(90*24*time.Hour))
+	a.issueCertificate = func(context.Context, sdiv1alpha1.ACMESpec, crypto.Signer, string, acme.Solver) ([]byte, []byte, error) {
+		return renewed.Data[corev1.TLSCertKey], renewed.Data[corev1.TLSPrivateKeyKey], nil
+	}
+	obs := newACMETestObserver()
+
+	if err := adjustACMERoute(a, obs); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	secret := &corev1.Secret{}
+	if err := a.Client.Get(context.Background(), client.ObjectKeyFromObject(current), secret); err != nil {
+		t.Fatalf("Failed to get certificate secret: %v", err)
+	}
+	if string(secret.Data[corev1.TLSCertKey]) != string(renewed.Data[corev1.TLSCertKey]) {
+		t.Errorf("Expected the certificate expiring within the renewal period to be renewed")
+	}
+	if notAfter := obs.Status.VSystemRouteStatus.ACME.NotAfter; notAfter == nil || notAfter.Before(&metav1.Time{Time: time.Now().Add(80 * 24 * time.Hour)}) {
+		t.Errorf("Expected the expiry of the renewed certificate, got %v", notAfter)
+	}
+}
+
+func TestAdjustACMECertificate_Failure(t *testing.T) {
+	current := acmeTestSecret(t, time.Now().Add(10*24*time.Hour))
+	a := newACMETestAdjuster(t, corev1.ConditionTrue, current)
+	recorder := record.NewFakeRecorder(10)
+	a.Recorder = recorder
+	issuances := 0
+	a.issueCertificate = func(context.Context, sdiv1alpha1.ACMESpec, crypto.Signer, string, acme.Solver) ([]byte, []byte, error) {
+		issuances++
+		return nil, nil, errors.New("rate limited")
+	}
+	ctx := context.Background()
+	obs := newACMETestObserver()
+
+	// The retry window is reported in the condition, not as an error.
+	for i := 0; i < 2; i++ {
+		if err := adjustACMERoute(a, obs); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+	if issuances != 1 {
+		t.Errorf("Expected the issuance not to be retried immediately, got %d issuances", issuances)
+	}
+	status := obs.Status.VSystemRouteStatus
+	if status.ACME == nil || status.ACME.LastFailureTime == nil {
+		t.Errorf("Expected the failure in the status, got %v", status.ACME)
+	}
+	condition := meta.FindStatusCondition(status.Conditions, sdiv1alpha1.ConditionTypeCertificateIssued)
+	if condition == nil || condition.Reason != sdiv1alpha1.ReasonIssuanceFailed || !strings.Contains(condition.Message, "rate limited") ||
+		!strings.Contains(condition.Message, "retrying after") {
+		t.Errorf("Expected the issuance failure to be reported, got %v", condition)
+	}
+	if len(recorder.Events) != 1 {
+		t.Errorf("Expected a warning event, got %d", len(recorder.Events))
+	}
+
+	// The route keeps serving the current certificate.
+	route := &routev1.Route{}
+	if err := a.Client.Get(ctx, client.ObjectKey{Name: VSystemRouteName, Namespace: "sdi"}, route); err != nil {
+		t.Fatalf("Failed to get route: %v", err)
+	}
+	if route.Spec.TLS.Certificate != strings.TrimSpace(string(current.Data[corev1.TLSCertKey])) {
+		t.Errorf("Expected the current certificate to be served, got %v", route.Spec.TLS)
+	}
+}
+
+func TestAdjustACMECertificate_RejectedChallenge(t *testing.T) {
+	a := newACMETestAdjuster(t, corev1.ConditionFalse)
+	a.issueCertificate = func(ctx context.Context, _ sdiv1alpha1.ACMESpec, _ crypto.Signer, host string, solver acme.Solver) ([]byte, []byte, error) {
+		defer func() { _ = solver.CleanUp(ctx, host, "token") }()
+		return nil, nil, solver.Present(ctx, host, "token", "token.thumbprint")
+	}
+	obs := newACMETestObserver()
+
+	if err := adjustACMERoute(a, obs); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	condition := meta.FindStatusCondition(obs.Status.VSystemRouteStatus.Conditions, sdiv1alpha1.ConditionTypeCertificateIssued)
+	if condition == nil || !strings.Contains(condition.Message, "host already claimed") {
+		t.Errorf("Expected the rejection of the challenge route, got %v", condition)
+	}
+}
+
+func TestAdjustACMECertificate_Invalid(t *testing.T) {
+	ctx := context.Background()
+	for name, customize := range map[string]func(spec *sdiv1alpha1.ManagedRouteSpec){
+		"certificate secret": func(spec *sdiv1alpha1.ManagedRouteSpec) {
+			spec.CertificateSecretRef = &corev1.LocalObjectReference{Name: "corporate-tls"}
+		},
+		"passthrough": func(spec *sdiv1alpha1.ManagedRouteSpec) {
+			spec.Termination = sdiv1alpha1.RouteTerminationPassthrough
+		},
+		"ingress backend": func(spec *sdiv1alpha1.ManagedRouteSpec) {
+			spec.Backend = sdiv1alpha1.ExposureBackendIngress
+		},
+	} {
+		a := newACMETestAdjuster(t, corev1.ConditionTrue)
+		a.issueCertificate = func(context.Context, sdiv1alpha1.ACMESpec, crypto.Signer, string, acme.Solver) ([]byte, []byte, error) {
+			t.Errorf("%s: expected no issuance", name)
+			return nil, nil, nil
+		}
+		obs := newACMETestObserver()
+		customize(&obs.Spec.SDIVSystemRoute)
+		if err := a.AdjustSDIVsystemRoute("sdi", obs, ctx); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestAcmeCertificateExpiry(t *testing.T) {
+	now := time.Now()
+	secret := acmeTestSecret(t, now.Add(time.Hour))
+	if notAfter, ok := acmeCertificateExpiry(secret, testACMEHost, now); !ok || !notAfter.After(now) {
+		t.Errorf("Expected the certificate of the host to be valid, got %v %v", notAfter, ok)
+	}
+	if _, ok := acmeCertificateExpiry(secret, "other.example.com", now); ok {
+		t.Errorf("Expected the certificate of another host to be invalid")
+	}
+	if _, ok := acmeCertificateExpiry(secret, testACMEHost, now.Add(2*time.Hour)); ok {
+		t.Errorf("Expected the expired certificate to be invalid")
+	}
+	block, _ := pem.Decode(secret.Data[corev1.TLSCertKey])
+	if cert, err := x509.ParseCertificate(block.Bytes); err != nil || cert.DNSNames[0] != testACMEHost {
+		t.Errorf("Expected a certificate for %s, got %v", testACMEHost, err)
+	}
+}
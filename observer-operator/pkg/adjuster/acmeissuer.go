@@ -0,0 +1,95 @@
+package adjuster
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/redhat-sap/sap-data-intelligence/observer-operator/pkg/acme"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ACMEIssuer issues the certificates of the managed routes in the background, so that the reconciliations
+// are not blocked by the ACME server and the challenges. It outlives the adjusters of the reconciliations
+// and keeps the outcome of an issuance until a reconciliation collects it.
+type ACMEIssuer struct {
+	// Server answers the HTTP-01 challenges of the ACME servers.
+	Server *acme.HTTP01Server
+	// Notify is called with the observer of an issuance once it is complete. Optional.
+	Notify func(obs client.ObjectKey)
+
+	mu        sync.Mutex
+	issuances map[string]*acmeIssuance
+	running   sync.WaitGroup
+}
+
+// acmeIssuance is the issuance of the certificate of a route.
+type acmeIssuance struct {
+	host     string
+	started  time.Time
+	finished time.Time
+	// secret holds the issued certificate once the issuance succeeded.
+	secret *corev1.Secret
+	err    error
+}
+
+// NewACMEIssuer returns an issuer answering the challenges with the server.
+func NewACMEIssuer(server *acme.HTTP01Server) *ACMEIssuer {
+	return &ACMEIssuer{Server: server, issuances: map[string]*acmeIssuance{}}
+}
+
+// available tells whether the challenges can be routed to the server.
+func (i *ACMEIssuer) available() bool {
+	return i != nil && i.Server != nil && i.Server.IP != ""
+}
+
+// issuance returns a copy of the issuance of the route, if any.
+func (i *ACMEIssuer) issuance(route string) (acmeIssuance, bool) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	issuance, ok := i.issuances[route]
+	if !ok {
+		return acmeIssuance{}, false
+	}
+	return *issuance, true
+}
+
+// forget drops the complete issuance of the route once its outcome has been collected.
+func (i *ACMEIssuer) forget(route string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if issuance, ok := i.issuances[route]; ok && !issuance.finished.IsZero() {
+		delete(i.issuances, route)
+	}
+}
+
+// start runs the issuance of the certificate of the route for the host unless one is running already.
+// The issuance is not canceled with the reconciliation starting it.
+func (i *ACMEIssuer) start(ctx context.Context, route, host string, obs client.ObjectKey, issue func(ctx context.Context) (*corev1.Secret, error)) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if issuance, ok := i.issuances[route]; ok && issuance.finished.IsZero() {
+		return
+	}
+	issuance := &acmeIssuance{host: host, started: time.Now()}
+	i.issuances[route] = issuance
+
+	i.running.Add(1)
+	go func() {
+		defer i.running.Done()
+		secret, err := issue(context.WithoutCancel(ctx))
+
+		i.mu.Lock()
+		issuance.secret, issuance.err, issuance.finished = secret, err, time.Now()
+		i.mu.Unlock()
+		if i.Notify != nil {
+			i.Notify(obs)
+		}
+	}()
+}
+
+// wait waits until the running issuances are complete.
+func (i *ACMEIssuer) wait() {
+	i.running.Wait()
+}
@@ -2,18 +2,133 @@ package adjuster
 
 import (
 	"context"
+	"crypto"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"strings"
 
 	"github.com/go-logr/logr"
+	sdiv1alpha1 "github.com/redhat-sap/sap-data-intelligence/observer-operator/api/v1alpha1"
+	"github.com/redhat-sap/sap-data-intelligence/observer-operator/pkg/acme"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
+// Names of the adjustment steps run by Adjust.
+const (
+	StepNodes           = "nodes"
+	StepSLCBNetwork     = "SLCB network"
+	StepStorage         = "storage"
+	StepSDIVersion      = "SDI version"
+	StepSDINamespaces   = "SDI namespaces"
+	StepSDIRbac         = "SDI RBAC"
+	StepSDIDiagnostics  = "SDI diagnostics"
+	StepSDIVRep         = "SDI vrep"
+	StepSDIStatefulSets = "SDI stateful sets"
+	StepSDIPullSecret   = "SDI registry pull secret"
+	StepSDINetwork      = "SDI network"
+	StepCABundle        = "CA bundle"
+	StepCertificates    = "certificates"
+)
+
+// SDIConfigSteps are the steps adjusting the configuration of SDI, reported together in the SDI config
+// status.
+var SDIConfigSteps = []string{
+	StepSDIVersion,
+	StepSDINamespaces,
+	StepSDIRbac,
+	StepSDIDiagnostics,
+	StepSDIVRep,
+	StepSDIStatefulSets,
+	StepSDIPullSecret,
+}
+
+// Outcome is the result of a single adjustment step.
+type Outcome string
+
+const (
+	OutcomeSucceeded   Outcome = "Succeeded"
+	OutcomeSkipped     Outcome = "Skipped"
+	OutcomeFailed      Outcome = "Failed"
+	OutcomeProgressing Outcome = "Progressing"
+	OutcomeUnsupported Outcome = "Unsupported"
+)
+
+// StepResult reports the outcome of an adjustment step.
+type StepResult struct {
+	Step    string
+	Outcome Outcome
+	Reason  string
+	Message string
+	Err     error
+}
+
+// SkippedError is returned by an Actioner step that intentionally did not adjust anything, e.g. because
+// the corresponding resource is unmanaged. It is not treated as a failure.
+type SkippedError struct {
+	Reason  string
+	Message string
+}
+
+func (e *SkippedError) Error() string {
+	return e.Message
+}
+
+// Skip returns an error marking the adjustment step as skipped.
+func Skip(reason, message string) error {
+	return &SkippedError{Reason: reason, Message: message}
+}
+
+// ProgressingError is returned by an Actioner step whose changes are still being rolled out, e.g. while the
+// nodes are rebooting. It is not treated as a failure.
+type ProgressingError struct {
+	Reason  string
+	Message string
+}
+
+func (e *ProgressingError) Error() string {
+	return e.Message
+}
+
+// InProgress returns an error marking the adjustment step as progressing.
+func InProgress(reason, message string) error {
+	return &ProgressingError{Reason: reason, Message: message}
+}
+
+// UnsupportedError is returned by an Actioner step that left the operand untouched because the operator
+// does not support its state, e.g. an unknown SDI version. Unlike a skipped step, it degrades the status.
+type UnsupportedError struct {
+	Reason  string
+	Message string
+}
+
+func (e *UnsupportedError) Error() string {
+	return e.Message
+}
+
+// Unsupported returns an error marking the adjustment step as unsupported.
+func Unsupported(reason, message string) error {
+	return &UnsupportedError{Reason: reason, Message: message}
+}
+
 type Actioner interface {
 	AdjustNodes(a *Adjuster, ctx context.Context) error
 	AdjustSDINetwork(a *Adjuster, ctx context.Context) error
 	AdjustSLCBNetwork(a *Adjuster, ctx context.Context) error
 	AdjustStorage(a *Adjuster, ctx context.Context) error
-	AdjustSDIConfig(a *Adjuster, ctx context.Context) error
+	DetectSDIVersion(a *Adjuster, ctx context.Context) error
+	AdjustSDINamespaces(a *Adjuster, ctx context.Context) error
+	AdjustSDIRbac(a *Adjuster, ctx context.Context) error
+	AdjustSDIDiagnostics(a *Adjuster, ctx context.Context) error
+	AdjustSDIVRep(a *Adjuster, ctx context.Context) error
+	PruneSDIStatefulSets(a *Adjuster, ctx context.Context) error
+	AdjustSDIPullSecret(a *Adjuster, ctx context.Context) error
+	AdjustCABundle(a *Adjuster, ctx context.Context) error
+	CheckCertificates(a *Adjuster, ctx context.Context) error
 }
 
 type Adjuster struct {
@@ -21,41 +136,191 @@ type Adjuster struct {
 	Namespace string
 	Client    client.Client
 	Scheme    *runtime.Scheme
-	logger    logr.Logger
+	// Recorder emits events on the SDIObserver. No events are emitted if nil.
+	Recorder record.EventRecorder
+	logger   logr.Logger
+	results  []StepResult
+	drifts   []string
+	// step is the name of the adjustment step being run.
+	step   string
+	dryRun bool
+	plan   []sdiv1alpha1.PlannedChange
+	// peerCertificates returns the certificate chain served at the address.
+	peerCertificates func(ctx context.Context, address string) ([]*x509.Certificate, error)
+	// ACMEIssuer issues the certificates of the routes from the ACME servers. No certificate is issued if nil.
+	ACMEIssuer *ACMEIssuer
+	// issueCertificate obtains a certificate for the host from the ACME server of the spec.
+	issueCertificate func(ctx context.Context, spec sdiv1alpha1.ACMESpec, key crypto.Signer, host string, solver acme.Solver) ([]byte, []byte, error)
 }
 
 // New creates a new Adjuster with the provided parameters.
 func New(name, namespace string, c client.Client, scheme *runtime.Scheme, logger logr.Logger) *Adjuster {
 	return &Adjuster{
-		Name:      name,
-		Namespace: namespace,
-		Client:    c,
-		Scheme:    scheme,
-		logger:    logger,
+		Name:             name,
+		Namespace:        namespace,
+		Client:           c,
+		Scheme:           scheme,
+		logger:           logger,
+		peerCertificates: servedCertificates,
+		issueCertificate: issueACMECertificateFromServer,
 	}
 }
 
-// Adjust performs a series of adjustments using the provided Actioner.
+// Step is a single adjustment run by the pipeline. A step is skipped when any of the steps it depends on
+// did not succeed.
+type Step struct {
+	Name      string
+	DependsOn []string
+	Action    func() error
+}
+
+// Adjust performs a series of adjustments using the provided Actioner. The SDI and SLC Bridge steps have
+// independent lifecycles, thus every step runs even if a preceding one failed, unless it depends on it: the
+// version-specific SDI patches need the detected SDI version, and the privileged diagnostics pods need the
+// SDI RBAC. The errors of all the failed steps are aggregated and the outcome of each step is available
+// from Results afterwards.
 func (a *Adjuster) Adjust(ac Actioner, ctx context.Context) error {
-	// List of adjustment functions with their corresponding log messages
-	adjustments := []struct {
-		name   string
-		action func() error
-	}{
-		{"nodes", func() error { return ac.AdjustNodes(a, ctx) }},
-		{"SLCB network", func() error { return ac.AdjustSLCBNetwork(a, ctx) }},
-		{"storage", func() error { return ac.AdjustStorage(a, ctx) }},
-		{"SDI config", func() error { return ac.AdjustSDIConfig(a, ctx) }},
-		{"SDI network", func() error { return ac.AdjustSDINetwork(a, ctx) }},
+	return a.Run(
+		Step{Name: StepNodes, Action: func() error { return ac.AdjustNodes(a, ctx) }},
+		Step{Name: StepSLCBNetwork, Action: func() error { return ac.AdjustSLCBNetwork(a, ctx) }},
+		Step{Name: StepStorage, Action: func() error { return ac.AdjustStorage(a, ctx) }},
+		Step{Name: StepSDIVersion, Action: func() error { return ac.DetectSDIVersion(a, ctx) }},
+		Step{Name: StepSDINamespaces, Action: func() error { return ac.AdjustSDINamespaces(a, ctx) }},
+		Step{Name: StepSDIRbac, DependsOn: []string{StepSDIVersion},
+			Action: func() error { return ac.AdjustSDIRbac(a, ctx) }},
+		Step{Name: StepSDIDiagnostics, DependsOn: []string{StepSDIVersion, StepSDIRbac},
+			Action: func() error { return ac.AdjustSDIDiagnostics(a, ctx) }},
+		Step{Name: StepSDIVRep, DependsOn: []string{StepSDIVersion},
+			Action: func() error { return ac.AdjustSDIVRep(a, ctx) }},
+		Step{Name: StepSDIStatefulSets, Action: func() error { return ac.PruneSDIStatefulSets(a, ctx) }},
+		Step{Name: StepSDIPullSecret, Action: func() error { return ac.AdjustSDIPullSecret(a, ctx) }},
+		Step{Name: StepSDINetwork, Action: func() error { return ac.AdjustSDINetwork(a, ctx) }},
+		Step{Name: StepCABundle, Action: func() error { return ac.AdjustCABundle(a, ctx) }},
+		Step{Name: StepCertificates, Action: func() error { return ac.CheckCertificates(a, ctx) }},
+	)
+}
+
+// Run runs the steps in the given order. A step may only depend on steps listed before it.
+func (a *Adjuster) Run(steps ...Step) error {
+	a.results = nil
+	a.plan = nil
+	defer func() { a.step = "" }()
+	outcomes := make(map[string]StepResult, len(steps))
+
+	var errs []error
+	for _, step := range steps {
+		if failed := unsatisfiedDependencies(step, outcomes); len(failed) > 0 {
+			a.logger.Info("Skipping adjustment due to unsatisfied dependencies", "step", step.Name, "dependencies", failed)
+			result := StepResult{
+				Step:    step.Name,
+				Outcome: OutcomeSkipped,
+				Reason:  sdiv1alpha1.ReasonDependencyFailed,
+				Message: fmt.Sprintf("Adjustment of %s skipped due to unsatisfied dependencies: %s", step.Name, strings.Join(failed, ", ")),
+			}
+			outcomes[step.Name] = result
+			a.results = append(a.results, result)
+			continue
+		}
+
+		a.step = step.Name
+		result := newStepResult(step.Name, step.Action())
+		outcomes[step.Name] = result
+		a.results = append(a.results, result)
+		if result.Outcome == OutcomeFailed {
+			a.logger.Error(result.Err, "Adjustment failed", "step", step.Name)
+			errs = append(errs, result.Err)
+		}
+	}
+
+	return utilerrors.NewAggregate(errs)
+}
+
+// unsatisfiedDependencies returns the dependencies of the step which failed or were skipped due to their
+// own dependencies. A dependency skipped on purpose (e.g. an unmanaged resource) is considered satisfied.
+func unsatisfiedDependencies(step Step, outcomes map[string]StepResult) []string {
+	var failed []string
+	for _, dep := range step.DependsOn {
+		result, ok := outcomes[dep]
+		if !ok || result.Outcome == OutcomeFailed || result.Reason == sdiv1alpha1.ReasonDependencyFailed {
+			failed = append(failed, dep)
+		}
 	}
+	return failed
+}
+
+// Results returns the outcomes of the adjustment steps run by the last call to Adjust.
+func (a *Adjuster) Results() []StepResult {
+	return a.results
+}
 
-	for _, adjustment := range adjustments {
-		if err := adjustment.action(); err != nil {
-			return err
+func newStepResult(step string, err error) StepResult {
+	var skipped *SkippedError
+	var progressing *ProgressingError
+	var unsupported *UnsupportedError
+	switch {
+	case err == nil:
+		return StepResult{
+			Step:    step,
+			Outcome: OutcomeSucceeded,
+			Reason:  sdiv1alpha1.ReasonSucceeded,
+			Message: "Adjustment of " + step + " succeeded",
+		}
+	case errors.As(err, &skipped):
+		reason := skipped.Reason
+		if reason == "" {
+			reason = sdiv1alpha1.ReasonAdjustmentSkipped
+		}
+		return StepResult{
+			Step:    step,
+			Outcome: OutcomeSkipped,
+			Reason:  reason,
+			Message: skipped.Message,
+		}
+	case errors.As(err, &unsupported):
+		return StepResult{
+			Step:    step,
+			Outcome: OutcomeUnsupported,
+			Reason:  unsupported.Reason,
+			Message: unsupported.Message,
+		}
+	case errors.As(err, &progressing):
+		return StepResult{
+			Step:    step,
+			Outcome: OutcomeProgressing,
+			Reason:  progressing.Reason,
+			Message: progressing.Message,
+		}
+	case IsNotFound(err):
+		return StepResult{
+			Step:    step,
+			Outcome: OutcomeFailed,
+			Reason:  sdiv1alpha1.ReasonResourceNotAvailable,
+			Message: err.Error(),
+			Err:     err,
+		}
+	default:
+		return StepResult{
+			Step:    step,
+			Outcome: OutcomeFailed,
+			Reason:  sdiv1alpha1.ReasonOperandResourceFailed,
+			Message: err.Error(),
+			Err:     err,
 		}
 	}
+}
 
-	return nil
+// IsNotFound returns true if the error or all the aggregated errors are caused by missing resources.
+func IsNotFound(err error) bool {
+	var agg utilerrors.Aggregate
+	if errors.As(err, &agg) {
+		for _, e := range agg.Errors() {
+			if !IsNotFound(e) {
+				return false
+			}
+		}
+		return len(agg.Errors()) > 0
+	}
+	return apierrors.IsNotFound(err)
 }
 
 // Logger returns the logger instance associated with the Adjuster.
@@ -2,20 +2,33 @@ package adjuster
 
 import (
 	"context"
+	"fmt"
 	"testing"
 
 	"github.com/go-logr/logr"
+	sdiv1alpha1 "github.com/redhat-sap/sap-data-intelligence/observer-operator/api/v1alpha1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 )
 
 // MockActioner implements the Actioner interface for testing
 type MockActioner struct {
-	AdjustNodesFunc       func(a *Adjuster, ctx context.Context) error
-	AdjustSDINetworkFunc  func(a *Adjuster, ctx context.Context) error
-	AdjustSLCBNetworkFunc func(a *Adjuster, ctx context.Context) error
-	AdjustStorageFunc     func(a *Adjuster, ctx context.Context) error
-	AdjustSDIConfigFunc   func(a *Adjuster, ctx context.Context) error
+	AdjustNodesFunc          func(a *Adjuster, ctx context.Context) error
+	AdjustSDINetworkFunc     func(a *Adjuster, ctx context.Context) error
+	AdjustSLCBNetworkFunc    func(a *Adjuster, ctx context.Context) error
+	AdjustStorageFunc        func(a *Adjuster, ctx context.Context) error
+	DetectSDIVersionFunc     func(a *Adjuster, ctx context.Context) error
+	AdjustSDINamespacesFunc  func(a *Adjuster, ctx context.Context) error
+	AdjustSDIRbacFunc        func(a *Adjuster, ctx context.Context) error
+	AdjustSDIDiagnosticsFunc func(a *Adjuster, ctx context.Context) error
+	AdjustSDIVRepFunc        func(a *Adjuster, ctx context.Context) error
+	PruneSDIStatefulSetsFunc func(a *Adjuster, ctx context.Context) error
+	AdjustSDIPullSecretFunc  func(a *Adjuster, ctx context.Context) error
+	AdjustCABundleFunc       func(a *Adjuster, ctx context.Context) error
+	CheckCertificatesFunc    func(a *Adjuster, ctx context.Context) error
 }
 
 func (m *MockActioner) AdjustNodes(a *Adjuster, ctx context.Context) error {
@@ -46,9 +59,65 @@ func (m *MockActioner) AdjustStorage(a *Adjuster, ctx context.Context) error {
 	return nil
 }
 
-func (m *MockActioner) AdjustSDIConfig(a *Adjuster, ctx context.Context) error {
-	if m.AdjustSDIConfigFunc != nil {
-		return m.AdjustSDIConfigFunc(a, ctx)
+func (m *MockActioner) DetectSDIVersion(a *Adjuster, ctx context.Context) error {
+	if m.DetectSDIVersionFunc != nil {
+		return m.DetectSDIVersionFunc(a, ctx)
+	}
+	return nil
+}
+
+func (m *MockActioner) AdjustSDINamespaces(a *Adjuster, ctx context.Context) error {
+	if m.AdjustSDINamespacesFunc != nil {
+		return m.AdjustSDINamespacesFunc(a, ctx)
+	}
+	return nil
+}
+
+func (m *MockActioner) AdjustSDIRbac(a *Adjuster, ctx context.Context) error {
+	if m.AdjustSDIRbacFunc != nil {
+		return m.AdjustSDIRbacFunc(a, ctx)
+	}
+	return nil
+}
+
+func (m *MockActioner) AdjustSDIDiagnostics(a *Adjuster, ctx context.Context) error {
+	if m.AdjustSDIDiagnosticsFunc != nil {
+		return m.AdjustSDIDiagnosticsFunc(a, ctx)
+	}
+	return nil
+}
+
+func (m *MockActioner) AdjustSDIVRep(a *Adjuster, ctx context.Context) error {
+	if m.AdjustSDIVRepFunc != nil {
+		return m.AdjustSDIVRepFunc(a, ctx)
+	}
+	return nil
+}
+
+func (m *MockActioner) PruneSDIStatefulSets(a *Adjuster, ctx context.Context) error {
+	if m.PruneSDIStatefulSetsFunc != nil {
+		return m.PruneSDIStatefulSetsFunc(a, ctx)
+	}
+	return nil
+}
+
+func (m *MockActioner) AdjustSDIPullSecret(a *Adjuster, ctx context.Context) error {
+	if m.AdjustSDIPullSecretFunc != nil {
+		return m.AdjustSDIPullSecretFunc(a, ctx)
+	}
+	return nil
+}
+
+func (m *MockActioner) AdjustCABundle(a *Adjuster, ctx context.Context) error {
+	if m.AdjustCABundleFunc != nil {
+		return m.AdjustCABundleFunc(a, ctx)
+	}
+	return nil
+}
+
+func (m *MockActioner) CheckCertificates(a *Adjuster, ctx context.Context) error {
+	if m.CheckCertificatesFunc != nil {
+		return m.CheckCertificatesFunc(a, ctx)
 	}
 	return nil
 }
@@ -118,6 +187,210 @@ func TestAdjuster_Adjust_ErrorPropagation(t *testing.T) {
 	}
 }
 
+func TestAdjuster_Adjust_Results(t *testing.T) {
+	scheme := runtime.NewScheme()
+	client := fake.NewClientBuilder().WithScheme(scheme).Build()
+	logger := logr.Discard()
+
+	adjuster := New("test-name", "test-namespace", client, scheme, logger)
+	mockActioner := &MockActioner{
+		AdjustNodesFunc: func(_ *Adjuster, _ context.Context) error {
+			return Skip("NodeConfigUnmanaged", "Node config is unmanaged")
+		},
+		AdjustSDIRbacFunc: func(_ *Adjuster, _ context.Context) error {
+			return &MockError{message: "test error"}
+		},
+	}
+
+	ctx := context.Background()
+	if err := adjuster.Adjust(mockActioner, ctx); err == nil {
+		t.Fatal("Expected error, got nil")
+	}
+
+	expected := []struct {
+		step    string
+		outcome Outcome
+	}{
+		{StepNodes, OutcomeSkipped},
+		{StepSLCBNetwork, OutcomeSucceeded},
+		{StepStorage, OutcomeSucceeded},
+		{StepSDIVersion, OutcomeSucceeded},
+		{StepSDINamespaces, OutcomeSucceeded},
+		{StepSDIRbac, OutcomeFailed},
+		{StepSDIDiagnostics, OutcomeSkipped},
+		{StepSDIVRep, OutcomeSucceeded},
+		{StepSDIStatefulSets, OutcomeSucceeded},
+		{StepSDIPullSecret, OutcomeSucceeded},
+		{StepSDINetwork, OutcomeSucceeded},
+		{StepCABundle, OutcomeSucceeded},
+		{StepCertificates, OutcomeSucceeded},
+	}
+	results := adjuster.Results()
+	if len(results) != len(expected) {
+		t.Fatalf("Expected %d results, got %d", len(expected), len(results))
+	}
+	for i, e := range expected {
+		if results[i].Step != e.step || results[i].Outcome != e.outcome {
+			t.Errorf("Expected %s to be %s, got %s %s", e.step, e.outcome, results[i].Step, results[i].Outcome)
+		}
+	}
+	if results[0].Reason != "NodeConfigUnmanaged" {
+		t.Errorf("Expected skip reason to be kept, got %s", results[0].Reason)
+	}
+	if results[5].Message != "test error" {
+		t.Errorf("Expected failure message to be kept, got %s", results[5].Message)
+	}
+}
+
+func TestAdjuster_Adjust_Progressing(t *testing.T) {
+	scheme := runtime.NewScheme()
+	client := fake.NewClientBuilder().WithScheme(scheme).Build()
+
+	adjuster := New("test-name", "test-namespace", client, scheme, logr.Discard())
+	mockActioner := &MockActioner{
+		AdjustNodesFunc: func(_ *Adjuster, _ context.Context) error {
+			return InProgress("NodesUpdating", "1 of 2 SDI nodes updated")
+		},
+	}
+
+	if err := adjuster.Adjust(mockActioner, context.Background()); err != nil {
+		t.Fatalf("Expected progressing step not to fail the adjustment, got %v", err)
+	}
+	result := adjuster.Results()[0]
+	if result.Outcome != OutcomeProgressing || result.Reason != "NodesUpdating" || result.Message != "1 of 2 SDI nodes updated" {
+		t.Errorf("Unexpected result %+v", result)
+	}
+}
+
+func TestAdjuster_Adjust_ContinueOnError(t *testing.T) {
+	scheme := runtime.NewScheme()
+	client := fake.NewClientBuilder().WithScheme(scheme).Build()
+	logger := logr.Discard()
+
+	adjuster := New("test-name", "test-namespace", client, scheme, logger)
+
+	sdiNetworkAdjusted := false
+	mockActioner := &MockActioner{
+		AdjustSLCBNetworkFunc: func(_ *Adjuster, _ context.Context) error {
+			return &MockError{message: "slcb error"}
+		},
+		AdjustSDINamespacesFunc: func(_ *Adjuster, _ context.Context) error {
+			return &MockError{message: "config error"}
+		},
+		AdjustSDINetworkFunc: func(_ *Adjuster, _ context.Context) error {
+			sdiNetworkAdjusted = true
+			return nil
+		},
+	}
+
+	ctx := context.Background()
+	err := adjuster.Adjust(mockActioner, ctx)
+	if err == nil {
+		t.Fatal("Expected error, got nil")
+	}
+	if !sdiNetworkAdjusted {
+		t.Error("Expected SDI network to be adjusted despite preceding failures")
+	}
+	if err.Error() != "[slcb error, config error]" {
+		t.Errorf("Expected aggregated errors, got '%v'", err)
+	}
+}
+
+func TestAdjuster_Run_Dependencies(t *testing.T) {
+	scheme := runtime.NewScheme()
+	client := fake.NewClientBuilder().WithScheme(scheme).Build()
+	logger := logr.Discard()
+
+	adjuster := New("test-name", "test-namespace", client, scheme, logger)
+
+	dependentRun := false
+	err := adjuster.Run(
+		Step{Name: "unmanaged", Action: func() error { return Skip("", "unmanaged") }},
+		Step{Name: "failing", Action: func() error { return &MockError{message: "test error"} }},
+		Step{Name: "dependent", DependsOn: []string{"failing"}, Action: func() error {
+			dependentRun = true
+			return nil
+		}},
+		Step{Name: "transitive", DependsOn: []string{"dependent"}, Action: func() error { return nil }},
+		Step{Name: "independent", DependsOn: []string{"unmanaged"}, Action: func() error { return nil }},
+	)
+	if err == nil || err.Error() != "test error" {
+		t.Errorf("Expected 'test error', got '%v'", err)
+	}
+	if dependentRun {
+		t.Error("Expected dependent step not to run")
+	}
+
+	expected := map[string]Outcome{
+		"unmanaged":   OutcomeSkipped,
+		"failing":     OutcomeFailed,
+		"dependent":   OutcomeSkipped,
+		"transitive":  OutcomeSkipped,
+		"independent": OutcomeSucceeded,
+	}
+	for _, result := range adjuster.Results() {
+		if result.Outcome != expected[result.Step] {
+			t.Errorf("Expected %s to be %s, got %s", result.Step, expected[result.Step], result.Outcome)
+		}
+	}
+}
+
+func TestAdjuster_Adjust_SDIConfigDependencies(t *testing.T) {
+	scheme := runtime.NewScheme()
+	client := fake.NewClientBuilder().WithScheme(scheme).Build()
+
+	adjuster := New("test-name", "test-namespace", client, scheme, logr.Discard())
+	run := map[string]bool{}
+	step := func(name string) func(*Adjuster, context.Context) error {
+		return func(_ *Adjuster, _ context.Context) error {
+			run[name] = true
+			return nil
+		}
+	}
+	mockActioner := &MockActioner{
+		DetectSDIVersionFunc: func(_ *Adjuster, _ context.Context) error {
+			return &MockError{message: "unable to list datahubs"}
+		},
+		AdjustSDINamespacesFunc:  step(StepSDINamespaces),
+		AdjustSDIRbacFunc:        step(StepSDIRbac),
+		AdjustSDIDiagnosticsFunc: step(StepSDIDiagnostics),
+		AdjustSDIVRepFunc:        step(StepSDIVRep),
+		PruneSDIStatefulSetsFunc: step(StepSDIStatefulSets),
+		AdjustSDIPullSecretFunc:  step(StepSDIPullSecret),
+		AdjustSDINetworkFunc:     step(StepSDINetwork),
+	}
+
+	if err := adjuster.Adjust(mockActioner, context.Background()); err == nil || err.Error() != "unable to list datahubs" {
+		t.Fatalf("Expected only the version detection to fail, got %v", err)
+	}
+	// The version-specific steps are skipped, the unrelated ones still run.
+	for _, name := range []string{StepSDIRbac, StepSDIDiagnostics, StepSDIVRep} {
+		if run[name] {
+			t.Errorf("Expected %s to be skipped", name)
+		}
+	}
+	for _, name := range []string{StepSDINamespaces, StepSDIStatefulSets, StepSDIPullSecret, StepSDINetwork} {
+		if !run[name] {
+			t.Errorf("Expected %s to run despite the failed version detection", name)
+		}
+	}
+	for _, result := range adjuster.Results() {
+		if result.Step == StepSDIDiagnostics && result.Reason != sdiv1alpha1.ReasonDependencyFailed {
+			t.Errorf("Expected %s to be skipped due to its dependencies, got %+v", result.Step, result)
+		}
+	}
+}
+
+func TestIsNotFound(t *testing.T) {
+	notFound := apierrors.NewNotFound(schema.GroupResource{Resource: "namespaces"}, "sap-slcbridge")
+	if !IsNotFound(utilerrors.NewAggregate([]error{notFound, fmt.Errorf("wrapped: %w", notFound)})) {
+		t.Error("Expected aggregate of not found errors to be not found")
+	}
+	if IsNotFound(utilerrors.NewAggregate([]error{notFound, &MockError{message: "test error"}})) {
+		t.Error("Expected aggregate with other errors not to be not found")
+	}
+}
+
 func TestAdjuster_Logger(t *testing.T) {
 	scheme := runtime.NewScheme()
 	client := fake.NewClientBuilder().WithScheme(scheme).Build()
@@ -0,0 +1,276 @@
+package adjuster
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	sdiv1alpha1 "github.com/redhat-sap/sap-data-intelligence/observer-operator/api/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// FieldManager is the field manager of the objects applied by the operator.
+const FieldManager = "sdi-observer-operator"
+
+// apply creates or updates the object with server-side apply and tells what happened to it. The operator
+// owns the fields set in the object; the fields set by others are left alone. Objects in the namespace of
+// the observer are controlled by it and garbage collected with it. Other objects cannot have a namespaced
+// owner and are only labeled for the uninstall.
+func (a *Adjuster) apply(ctx context.Context, obs *sdiv1alpha1.SDIObserver, obj client.Object) (controllerutil.OperationResult, error) {
+	gvk, err := apiutil.GVKForObject(obj, a.Scheme)
+	if err != nil {
+		return controllerutil.OperationResultNone, err
+	}
+	name := fmt.Sprintf("%s %s", gvk.Kind, obj.GetName())
+
+	markManaged(obj, obs)
+	if obs != nil && obj.GetNamespace() != "" && obj.GetNamespace() == obs.Namespace {
+		if err := ctrl.SetControllerReference(obs, obj, a.Scheme); err != nil {
+			return controllerutil.OperationResultNone, fmt.Errorf("unable to set owner of %s: %w", name, err)
+		}
+	}
+
+	resourceVersion, found, err := a.currentResourceVersion(ctx, gvk, obj)
+	if err != nil {
+		return controllerutil.OperationResultNone, fmt.Errorf("unable to get %s: %w", name, err)
+	}
+	config, err := applyConfiguration(obj, gvk)
+	if err != nil {
+		return controllerutil.OperationResultNone, fmt.Errorf("unable to convert %s: %w", name, err)
+	}
+	if err := a.Client.Patch(ctx, config, client.Apply, client.FieldOwner(FieldManager), client.ForceOwnership); err != nil {
+		return controllerutil.OperationResultNone, fmt.Errorf("unable to apply %s: %w", name, err)
+	}
+
+	switch {
+	case a.dryRun:
+		// The change, if any, is recorded in the plan.
+	case !found:
+		a.logger.Info(fmt.Sprintf("Created %s", name))
+		return controllerutil.OperationResultCreated, nil
+	case config.GetResourceVersion() != resourceVersion:
+		a.logger.Info(fmt.Sprintf("Updated %s", name))
+		return controllerutil.OperationResultUpdated, nil
+	}
+	return controllerutil.OperationResultNone, nil
+}
+
+// currentResourceVersion returns the resource version of the object if it exists. Typed objects are read
+// from the cache of the client.
+func (a *Adjuster) currentResourceVersion(ctx context.Context, gvk schema.GroupVersionKind, obj client.Object) (string, bool, error) {
+	var current client.Object
+	if _, ok := obj.(*unstructured.Unstructured); ok {
+		u := &unstructured.Unstructured{}
+		u.SetGroupVersionKind(gvk)
+		current = u
+	} else {
+		typed, err := a.Scheme.New(gvk)
+		if err != nil {
+			return "", false, err
+		}
+		current = typed.(client.Object)
+	}
+
+	if err := a.Client.Get(ctx, client.ObjectKeyFromObject(obj), current); err != nil {
+		if errors.IsNotFound(err) {
+			return "", false, nil
+		}
+		return "", false, err
+	}
+	return current.GetResourceVersion(), true, nil
+}
+
+// applyConfiguration converts the object into the body of an apply patch, without the fields set by the
+// server and the fields left unset in a typed object.
+func applyConfiguration(obj client.Object, gvk schema.GroupVersionKind) (*unstructured.Unstructured, error) {
+	var content map[string]interface{}
+	if u, ok := obj.(*unstructured.Unstructured); ok {
+		content = runtime.DeepCopyJSON(u.Object)
+	} else {
+		var err error
+		if content, err = runtime.DefaultUnstructuredConverter.ToUnstructured(obj); err != nil {
+			return nil, err
+		}
+		omitUnset(content, reflect.ValueOf(obj))
+	}
+
+	config := &unstructured.Unstructured{Object: content}
+	config.SetGroupVersionKind(gvk)
+	delete(config.Object, "status")
+	for _, field := range []string{"creationTimestamp", "generation", "managedFields", "resourceVersion", "uid"} {
+		unstructured.RemoveNestedField(config.Object, "metadata", field)
+	}
+	return config, nil
+}
+
+// omitUnset removes from the content converted from a typed value the fields the value leaves unset. The
+// converter writes nil pointers, maps and lists as null and zero structs like a deployment strategy as {};
+// applied with ForceOwnership, they would take the fields over from the other field managers and reset
+// them. Fields set explicitly, like an empty emptyDir volume source, are kept.
+func omitUnset(content map[string]interface{}, v reflect.Value) {
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return
+	}
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" && (field.Anonymous || strings.Contains(options, "inline")) {
+			omitUnset(content, v.Field(i))
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		value, ok := content[name]
+		if !ok {
+			continue
+		}
+		if value == nil || (v.Field(i).Kind() == reflect.Struct && v.Field(i).IsZero()) {
+			delete(content, name)
+			continue
+		}
+		omitUnsetValue(value, v.Field(i))
+	}
+}
+
+// omitUnsetValue removes the unset fields from the structs nested in the lists and maps of the content.
+func omitUnsetValue(content interface{}, v reflect.Value) {
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+	switch content := content.(type) {
+	case map[string]interface{}:
+		switch v.Kind() {
+		case reflect.Struct:
+			omitUnset(content, v)
+		case reflect.Map:
+			if v.Type().Key().Kind() != reflect.String {
+				return
+			}
+			for key, value := range content {
+				if item := v.MapIndex(reflect.ValueOf(key).Convert(v.Type().Key())); item.IsValid() {
+					omitUnsetValue(value, item)
+				}
+			}
+		}
+	case []interface{}:
+		if v.Kind() != reflect.Slice || v.Len() != len(content) {
+			return
+		}
+		for i, value := range content {
+			omitUnsetValue(value, v.Index(i))
+		}
+	}
+}
+
+// managedResource is an object applied by the operator with the function describing its drift.
+type managedResource struct {
+	desired client.Object
+	// existing receives the object found in the cluster.
+	existing client.Object
+	// drift describes how the existing object differs from the desired one.
+	drift func(existing, desired client.Object) ([]string, error)
+	// retain copies into the desired object the fields of the existing object set by others. Optional.
+	retain func(existing, desired client.Object)
+	// preserve records the original state of an existing object not created by the operator, so that it is
+	// restored instead of deleted on cleanup.
+	preserve bool
+}
+
+// ensureResource applies the desired object and records the drift corrected on the existing one.
+func (a *Adjuster) ensureResource(ctx context.Context, obs *sdiv1alpha1.SDIObserver, resource managedResource) error {
+	desired, existing := resource.desired, resource.existing
+	var drift []string
+	err := a.Client.Get(ctx, client.ObjectKeyFromObject(desired), existing)
+	switch {
+	case err == nil:
+		if resource.retain != nil {
+			resource.retain(existing, desired)
+		}
+		if resource.preserve {
+			if err := preserveOriginal(existing, desired); err != nil {
+				return err
+			}
+		}
+		if drift, err = resource.drift(existing, desired); err != nil {
+			return err
+		}
+	case !errors.IsNotFound(err):
+		return fmt.Errorf("unable to get %s: %w", desired.GetName(), err)
+	}
+
+	result, err := a.apply(ctx, obs, desired)
+	if err != nil {
+		return err
+	}
+	// In DryRun mode, nothing is updated but the drift is still reported.
+	if len(drift) > 0 && (result == controllerutil.OperationResultUpdated || a.dryRun) {
+		gvk, err := apiutil.GVKForObject(desired, a.Scheme)
+		if err != nil {
+			return err
+		}
+		a.recordDrift(obs, gvk.Kind, desired.GetName(), drift)
+	}
+	return nil
+}
+
+// originalObject is the state of an object before the operator took it over.
+type originalObject struct {
+	Labels      map[string]string      `json:"labels,omitempty"`
+	Annotations map[string]string      `json:"annotations,omitempty"`
+	Spec        map[string]interface{} `json:"spec,omitempty"`
+}
+
+// preserveOriginal records the labels, annotations and spec of the existing object in the desired one,
+// unless the operator created the existing object. The record is carried over by the later adjustments.
+func preserveOriginal(existing, desired client.Object) error {
+	record, ok := existing.GetAnnotations()[OriginalObjectAnnotationKey]
+	if !ok {
+		if existing.GetLabels()[ManagedByLabelKey] == ManagedByLabelValue {
+			return nil
+		}
+		content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(existing)
+		if err != nil {
+			return fmt.Errorf("unable to convert %s: %w", existing.GetName(), err)
+		}
+		original := originalObject{Labels: existing.GetLabels(), Annotations: existing.GetAnnotations()}
+		original.Spec, _, _ = unstructured.NestedMap(content, "spec")
+		data, err := json.Marshal(original)
+		if err != nil {
+			return fmt.Errorf("unable to record the original state of %s: %w", existing.GetName(), err)
+		}
+		record = string(data)
+	}
+
+	annotations := desired.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[OriginalObjectAnnotationKey] = record
+	desired.SetAnnotations(annotations)
+	return nil
+}
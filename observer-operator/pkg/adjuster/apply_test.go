@@ -0,0 +1,247 @@
+package adjuster
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr"
+	sdiv1alpha1 "github.com/redhat-sap/sap-data-intelligence/observer-operator/api/v1alpha1"
+	"github.com/redhat-sap/sap-data-intelligence/observer-operator/assets"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta/testrestmapper"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/applyconfigurations"
+	clienttesting "k8s.io/client-go/testing"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+func loadAsset[T client.Object](t *testing.T, name string) T {
+	t.Helper()
+	obj, err := assets.LoadAs[T](name)
+	if err != nil {
+		t.Fatalf("Failed to load %s: %v", name, err)
+	}
+	return obj
+}
+
+// withServerSideApply lets the fake client, which does not support apply patches, approximate them: the
+// applied fields are merged into the existing object and lists are replaced.
+func withServerSideApply(builder *fake.ClientBuilder) *fake.ClientBuilder {
+	return builder.WithInterceptorFuncs(interceptor.Funcs{
+		Patch: func(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+			if patch.Type() != types.ApplyPatchType {
+				return c.Patch(ctx, obj, patch, opts...)
+			}
+			if options := (&client.PatchOptions{}).ApplyOptions(opts); len(options.DryRun) > 0 {
+				return nil
+			}
+			applied := obj.(*unstructured.Unstructured)
+			current := &unstructured.Unstructured{}
+			current.SetGroupVersionKind(applied.GroupVersionKind())
+			if err := c.Get(ctx, client.ObjectKeyFromObject(applied), current); apierrors.IsNotFound(err) {
+				return c.Create(ctx, applied)
+			} else if err != nil {
+				return err
+			}
+			if equality.Semantic.DeepDerivative(applied.Object, current.Object) {
+				applied.Object = current.Object
+				return nil
+			}
+			mergeApplied(current.Object, applied.Object)
+			if err := c.Update(ctx, current); err != nil {
+				return err
+			}
+			applied.Object = current.Object
+			return nil
+		},
+	})
+}
+
+func mergeApplied(current, applied map[string]interface{}) {
+	for key, value := range applied {
+		if nested, ok := value.(map[string]interface{}); ok {
+			if currentNested, ok := current[key].(map[string]interface{}); ok {
+				mergeApplied(currentNested, nested)
+				continue
+			}
+		}
+		current[key] = value
+	}
+}
+
+// withFieldManagement lets the fake client apply patches with the field management of the API server, which
+// knows the schema of the built-in types and tracks the owners of their fields.
+func withFieldManagement(builder *fake.ClientBuilder, scheme *runtime.Scheme) *fake.ClientBuilder {
+	tracker := clienttesting.NewFieldManagedObjectTracker(
+		scheme, serializer.NewCodecFactory(scheme).UniversalDecoder(), applyconfigurations.NewTypeConverter(scheme))
+	mapper := testrestmapper.TestOnlyStaticRESTMapper(scheme)
+	return builder.WithObjectTracker(tracker).WithInterceptorFuncs(interceptor.Funcs{
+		Patch: func(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+			if patch.Type() != types.ApplyPatchType {
+				return c.Patch(ctx, obj, patch, opts...)
+			}
+			gvk := obj.GetObjectKind().GroupVersionKind()
+			mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+			if err != nil {
+				return err
+			}
+			options := (&client.PatchOptions{}).ApplyOptions(opts).AsPatchOptions()
+			if err := tracker.Apply(mapping.Resource, obj, obj.GetNamespace(), *options); err != nil {
+				return err
+			}
+			return c.Get(ctx, client.ObjectKeyFromObject(obj), obj)
+		},
+	})
+}
+
+func TestApply(t *testing.T) {
+	scheme := newNodeConfiguratorScheme(t)
+	c := withServerSideApply(fake.NewClientBuilder().WithScheme(scheme)).Build()
+	a := New("test-name", "operators", c, scheme, logr.Discard())
+	ctx := context.Background()
+	obs := &sdiv1alpha1.SDIObserver{ObjectMeta: metav1.ObjectMeta{Name: "sdi", Namespace: "operators", UID: "sdi-uid"}}
+
+	desiredRole := func(namespace string) *rbacv1.Role {
+		role := loadAsset[*rbacv1.Role](t, anyuidRoleAsset)
+		role.Name = "sdi-anyuid"
+		role.Namespace = namespace
+		return role
+	}
+
+	for _, tt := range []struct {
+		name   string
+		role   func() *rbacv1.Role
+		result controllerutil.OperationResult
+	}{
+		{name: "create", role: func() *rbacv1.Role { return desiredRole("operators") }, result: controllerutil.OperationResultCreated},
+		{name: "unchanged", role: func() *rbacv1.Role { return desiredRole("operators") }, result: controllerutil.OperationResultNone},
+		{name: "update", role: func() *rbacv1.Role {
+			role := desiredRole("operators")
+			role.Rules[0].Verbs = []string{"get"}
+			return role
+		}, result: controllerutil.OperationResultUpdated},
+	} {
+		result, err := a.apply(ctx, obs, tt.role())
+		if err != nil {
+			t.Fatalf("%s: expected no error, got %v", tt.name, err)
+		}
+		if result != tt.result {
+			t.Errorf("%s: expected result %s, got %s", tt.name, tt.result, result)
+		}
+	}
+
+	role := &rbacv1.Role{}
+	if err := c.Get(ctx, client.ObjectKey{Name: "sdi-anyuid", Namespace: "operators"}, role); err != nil {
+		t.Fatalf("Failed to get role: %v", err)
+	}
+	if !metav1.IsControlledBy(role, obs) || !isOwnedBy(role, obs) {
+		t.Errorf("Expected role to be controlled and marked by the observer, got %v", role.ObjectMeta)
+	}
+	if verbs := role.Rules[0].Verbs; len(verbs) != 1 || verbs[0] != "get" {
+		t.Errorf("Expected role rules to be updated, got %v", role.Rules)
+	}
+
+	// Objects outside of the observer namespace are only labeled.
+	if _, err := a.apply(ctx, obs, desiredRole("sdi")); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := c.Get(ctx, client.ObjectKey{Name: "sdi-anyuid", Namespace: "sdi"}, role); err != nil {
+		t.Fatalf("Failed to get role: %v", err)
+	}
+	if len(role.OwnerReferences) != 0 || role.Labels[ManagedByLabelKey] != ManagedByLabelValue {
+		t.Errorf("Expected role to be labeled without owner, got %v", role.ObjectMeta)
+	}
+}
+
+func TestApply_FieldsOfOtherManagers(t *testing.T) {
+	scheme := runtime.NewScheme()
+	for _, add := range []func(*runtime.Scheme) error{corev1.AddToScheme, appsv1.AddToScheme, sdiv1alpha1.AddToScheme} {
+		if err := add(scheme); err != nil {
+			t.Fatalf("Failed to add scheme: %v", err)
+		}
+	}
+	for _, gv := range []schema.GroupVersion{corev1.SchemeGroupVersion, appsv1.SchemeGroupVersion} {
+		if err := scheme.SetVersionPriority(gv); err != nil {
+			t.Fatalf("Failed to set version priority: %v", err)
+		}
+	}
+	c := withFieldManagement(fake.NewClientBuilder().WithScheme(scheme), scheme).Build()
+	a := New("test-name", "operators", c, scheme, logr.Discard())
+	ctx := context.Background()
+	obs := &sdiv1alpha1.SDIObserver{ObjectMeta: metav1.ObjectMeta{Name: "sdi", Namespace: "operators", UID: "sdi-uid"}}
+
+	labels := map[string]string{"app": "vsystem"}
+	newDeployment := func() *appsv1.Deployment {
+		return &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "vsystem", Namespace: "sdi"},
+			Spec: appsv1.DeploymentSpec{
+				Selector: &metav1.LabelSelector{MatchLabels: labels},
+				Template: corev1.PodTemplateSpec{
+					ObjectMeta: metav1.ObjectMeta{Labels: labels},
+					Spec: corev1.PodSpec{
+						Containers: []corev1.Container{{Name: "vsystem", Image: "vsystem:1"}},
+						Volumes:    []corev1.Volume{{Name: "tmp", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}}},
+					},
+				},
+			},
+		}
+	}
+	existing := newDeployment()
+	existing.Spec.Replicas = ptr.To[int32](3)
+	existing.Spec.Strategy = appsv1.DeploymentStrategy{Type: appsv1.RecreateDeploymentStrategyType}
+	existing.Spec.Template.Annotations = map[string]string{"kubectl.kubernetes.io/restartedAt": "now"}
+	if err := c.Create(ctx, existing, client.FieldOwner("kubectl")); err != nil {
+		t.Fatalf("Failed to create deployment: %v", err)
+	}
+
+	// The operator only sets the image; the replicas, strategy and annotations stay with kubectl.
+	desired := newDeployment()
+	desired.Spec.Template.Spec.Containers[0].Image = "vsystem:2"
+	if _, err := a.apply(ctx, obs, desired); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	got := &appsv1.Deployment{}
+	if err := c.Get(ctx, client.ObjectKeyFromObject(existing), got); err != nil {
+		t.Fatalf("Failed to get deployment: %v", err)
+	}
+	if image := got.Spec.Template.Spec.Containers[0].Image; image != "vsystem:2" {
+		t.Errorf("Expected the image to be applied, got %s", image)
+	}
+	if got.Spec.Replicas == nil || *got.Spec.Replicas != 3 {
+		t.Errorf("Expected the replicas set by kubectl to be kept, got %v", got.Spec.Replicas)
+	}
+	if got.Spec.Strategy.Type != appsv1.RecreateDeploymentStrategyType {
+		t.Errorf("Expected the strategy set by kubectl to be kept, got %v", got.Spec.Strategy)
+	}
+	if got.Spec.Template.Annotations["kubectl.kubernetes.io/restartedAt"] != "now" {
+		t.Errorf("Expected the annotations set by kubectl to be kept, got %v", got.Spec.Template.Annotations)
+	}
+	if got.Spec.Template.Spec.Volumes[0].EmptyDir == nil {
+		t.Errorf("Expected the empty emptyDir volume source to be applied, got %v", got.Spec.Template.Spec.Volumes)
+	}
+	for _, entry := range got.ManagedFields {
+		if entry.Manager != FieldManager {
+			continue
+		}
+		for _, field := range []string{`"f:replicas"`, `"f:strategy"`, `"f:resources"`} {
+			if strings.Contains(string(entry.FieldsV1.Raw), field) {
+				t.Errorf("Expected %s not to be owned by the operator, got %s", field, entry.FieldsV1.Raw)
+			}
+		}
+	}
+}
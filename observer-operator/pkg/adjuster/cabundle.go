@@ -0,0 +1,456 @@
+package adjuster
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	configv1 "github.com/openshift/api/config/v1"
+	sdiv1alpha1 "github.com/redhat-sap/sap-data-intelligence/observer-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ImageConfigGVK is the kind of the cluster image configuration.
+var ImageConfigGVK = configv1.GroupVersion.WithKind("Image")
+
+// defaultCABundleKeys matches the keys of a source holding PEM certificates when none are listed.
+var defaultCABundleKeys = regexp.MustCompile(`^(?:cert(?:ificate)?|ca(?:-?bundle)?|.*\.(?:crt|pem))$`)
+
+// sourcedCertificate is a certificate with the object it was read from, as kind/namespace/name.
+type sourcedCertificate struct {
+	source string
+	cert   *x509.Certificate
+}
+
+// AdjustCABundle propagates the CA certificates of the configured sources. The bundle is added to the
+// registry CA bundles referenced by the cluster image configuration so that the images can be pulled
+// from registries signed by the CAs, and it is written to the trust store of the SDI connection
+// management.
+func (a *Adjuster) AdjustCABundle(obs *sdiv1alpha1.SDIObserver, ctx context.Context) error {
+	if obs == nil {
+		return fmt.Errorf("SDIObserver cannot be nil")
+	}
+	status := &obs.Status.CABundleStatus
+	spec := obs.Spec.CABundle
+	if spec == nil {
+		status.Certificates = nil
+		meta.RemoveStatusCondition(&status.Conditions, sdiv1alpha1.ConditionTypeConfigDrift)
+		if err := a.adjustRegistryCABundles(ctx, obs, nil, ""); err != nil {
+			return err
+		}
+		return Skip(sdiv1alpha1.ReasonCABundleUnmanaged, "CA bundle is unmanaged")
+	}
+	defer a.setDriftCondition(&status.Conditions)
+
+	certs, err := a.caCertificates(ctx, obs, spec.Sources)
+	if err != nil {
+		return err
+	}
+	if len(certs) == 0 {
+		status.Certificates = nil
+		return fmt.Errorf("no CA certificate found in the CA bundle sources")
+	}
+	status.Certificates = make([]sdiv1alpha1.CACertificateState, 0, len(certs))
+	for _, c := range certs {
+		status.Certificates = append(status.Certificates, sdiv1alpha1.CACertificateState{
+			Source:      c.source,
+			Subject:     c.cert.Subject.String(),
+			Fingerprint: certificateFingerprint(c.cert),
+			NotAfter:    metav1.NewTime(c.cert.NotAfter),
+		})
+	}
+	bundle := encodeCABundle(certs)
+
+	if err := a.adjustRegistryCABundles(ctx, obs, spec.RegistryHostnames, bundle); err != nil {
+		return err
+	}
+	if spec.InjectIntoSDI {
+		if err := a.adjustSDICABundleSecret(ctx, obs, bundle); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// caCertificates reads the certificates of the sources. A certificate found in several sources is
+// listed once, with the first source.
+func (a *Adjuster) caCertificates(ctx context.Context, obs *sdiv1alpha1.SDIObserver, sources []sdiv1alpha1.CABundleSource) ([]sourcedCertificate, error) {
+	var set certificateSet
+	for _, src := range sources {
+		ns := src.Namespace
+		if ns == "" {
+			ns = obs.Namespace
+		}
+		data, err := a.caBundleSourceData(ctx, src.Kind, ns, src.Name)
+		if err != nil {
+			return nil, err
+		}
+		source := fmt.Sprintf("%s/%s/%s", src.Kind, ns, src.Name)
+		for _, key := range sortedKeys(data) {
+			if !selectsCABundleKey(src, key) {
+				continue
+			}
+			if err := set.add(source, data[key]); err != nil {
+				return nil, fmt.Errorf("unable to parse key %s of %s: %w", key, source, err)
+			}
+		}
+	}
+	return set.certs, nil
+}
+
+// selectsCABundleKey tells whether the key of the source holds certificates.
+func selectsCABundleKey(src sdiv1alpha1.CABundleSource, key string) bool {
+	if len(src.Keys) == 0 {
+		return defaultCABundleKeys.MatchString(key)
+	}
+	return slices.Contains(src.Keys, key)
+}
+
+// caBundleSourceData returns the contents of the Secret or ConfigMap holding CA certificates.
+func (a *Adjuster) caBundleSourceData(ctx context.Context, kind, ns, name string) (map[string][]byte, error) {
+	key := client.ObjectKey{Name: name, Namespace: ns}
+	if kind == "ConfigMap" {
+		cm := &corev1.ConfigMap{}
+		if err := a.Client.Get(ctx, key, cm); err != nil {
+			return nil, fmt.Errorf("unable to get configmap %s/%s: %w", ns, name, err)
+		}
+		data := make(map[string][]byte, len(cm.Data))
+		for k, v := range cm.Data {
+			data[k] = []byte(v)
+		}
+		return data, nil
+	}
+	secret := &corev1.Secret{}
+	if err := a.Client.Get(ctx, key, secret); err != nil {
+		return nil, fmt.Errorf("unable to get secret %s/%s: %w", ns, name, err)
+	}
+	return secret.Data, nil
+}
+
+// parseCertificates returns the certificates of the PEM data. Other PEM blocks, like keys, are ignored.
+func parseCertificates(data []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return certs, nil
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+}
+
+// certificateFingerprint returns the SHA-256 fingerprint of the certificate as colon separated hex.
+func certificateFingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	digits := strings.ToUpper(hex.EncodeToString(sum[:]))
+	pairs := make([]string, 0, len(sum))
+	for i := 0; i < len(digits); i += 2 {
+		pairs = append(pairs, digits[i:i+2])
+	}
+	return strings.Join(pairs, ":")
+}
+
+func encodeCABundle(certs []sourcedCertificate) string {
+	var buf bytes.Buffer
+	for _, c := range certs {
+		_ = pem.Encode(&buf, &pem.Block{Type: "CERTIFICATE", Bytes: c.cert.Raw})
+	}
+	return buf.String()
+}
+
+// registryCABundleKey returns the key of the registry in the additionalTrustedCA ConfigMap. The port
+// separator is not allowed in ConfigMap keys and is written as "..".
+func registryCABundleKey(hostname string) string {
+	return strings.ReplaceAll(hostname, ":", "..")
+}
+
+// adjustRegistryCABundles adds the bundle for the registries to the ConfigMap referenced by the
+// additionalTrustedCA of the cluster image configuration. A ConfigMap referenced already is reused. The
+// ConfigMap is shared with other observers and the cluster administrator, thus only the keys of the
+// registries are changed. The keys added by the observer are recorded so that they are removed once
+// their registries are dropped from the spec; the keys of the administrator are left in place.
+func (a *Adjuster) adjustRegistryCABundles(ctx context.Context, obs *sdiv1alpha1.SDIObserver, hostnames []string, bundle string) error {
+	served, err := a.serves(ImageConfigGVK)
+	if err != nil {
+		return err
+	}
+	if !served {
+		if len(hostnames) > 0 {
+			a.logger.Info("Cluster image configuration is not available; not adding the registry CA bundles")
+		}
+		return nil
+	}
+	image := &configv1.Image{}
+	if err := a.Client.Get(ctx, client.ObjectKey{Name: ImageConfigName}, image); err != nil {
+		if errors.IsNotFound(err) && len(hostnames) == 0 {
+			return nil
+		}
+		return fmt.Errorf("unable to get image config %s: %w", ImageConfigName, err)
+	}
+	name := image.Spec.AdditionalTrustedCA.Name
+	if name == "" {
+		name = TrustedRegistryCABundlesName
+	}
+
+	cm := &corev1.ConfigMap{}
+	err = a.Client.Get(ctx, client.ObjectKey{Name: name, Namespace: OpenShiftConfigNamespace}, cm)
+	switch {
+	case errors.IsNotFound(err):
+		if len(hostnames) == 0 {
+			return nil
+		}
+		cm = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: OpenShiftConfigNamespace},
+			Data:       map[string]string{},
+		}
+		if _, err := a.setRegistryCABundles(obs, cm, hostnames, bundle); err != nil {
+			return err
+		}
+		markManaged(cm, nil)
+		a.logger.Info(fmt.Sprintf("Creating registry CA bundles configmap %s", name))
+		if err := a.Client.Create(ctx, cm); err != nil {
+			return fmt.Errorf("unable to create configmap %s: %w", name, err)
+		}
+	case err != nil:
+		return fmt.Errorf("unable to get configmap %s: %w", name, err)
+	default:
+		patch := client.MergeFrom(cm.DeepCopy())
+		drift, err := a.setRegistryCABundles(obs, cm, hostnames, bundle)
+		if err != nil {
+			return err
+		}
+		if err := a.Client.Patch(ctx, cm, patch); err != nil {
+			return fmt.Errorf("unable to update configmap %s: %w", name, err)
+		}
+		if len(drift) > 0 {
+			a.recordDrift(obs, "ConfigMap", name, drift)
+		}
+	}
+
+	if len(hostnames) > 0 && image.Spec.AdditionalTrustedCA.Name == "" {
+		a.logger.Info(fmt.Sprintf("Setting additionalTrustedCA of image config %s to %s", ImageConfigName, name))
+		patch := client.MergeFrom(image.DeepCopy())
+		image.Spec.AdditionalTrustedCA.Name = name
+		if err := a.Client.Patch(ctx, image, patch); err != nil {
+			return fmt.Errorf("unable to update image config %s: %w", ImageConfigName, err)
+		}
+	}
+	return nil
+}
+
+// setRegistryCABundles writes the bundle to the keys of the registries and removes the keys the observer
+// added for registries no longer listed, unless another observer added them as well. A key is recorded
+// as added by the observer if it did not exist or was added by an observer. It returns the drift of the
+// bundles set by others.
+func (a *Adjuster) setRegistryCABundles(obs *sdiv1alpha1.SDIObserver, cm *corev1.ConfigMap, hostnames []string, bundle string) ([]string, error) {
+	record := map[string][]string{}
+	if data, ok := cm.Annotations[RegistryCABundlesAnnotationKey]; ok {
+		if err := json.Unmarshal([]byte(data), &record); err != nil {
+			return nil, fmt.Errorf("unable to read annotation %s of configmap %s: %w", RegistryCABundlesAnnotationKey, cm.Name, err)
+		}
+	}
+	observer := client.ObjectKeyFromObject(obs).String()
+	addedBy := func(key string, others bool) bool {
+		for owner, keys := range record {
+			if (owner != observer || !others) && slices.Contains(keys, key) {
+				return true
+			}
+		}
+		return false
+	}
+
+	var drift, added []string
+	if cm.Data == nil {
+		cm.Data = map[string]string{}
+	}
+	for _, hostname := range hostnames {
+		key := registryCABundleKey(hostname)
+		current, ok := cm.Data[key]
+		if !ok || addedBy(key, false) {
+			added = append(added, key)
+		}
+		if ok && current != bundle {
+			drift = append(drift, fmt.Sprintf("data %s differs", key))
+		}
+		cm.Data[key] = bundle
+	}
+	for _, key := range record[observer] {
+		if !slices.Contains(added, key) && !addedBy(key, true) {
+			a.logger.Info(fmt.Sprintf("Removing registry CA bundle %s from configmap %s", key, cm.Name))
+			delete(cm.Data, key)
+		}
+	}
+
+	if len(added) > 0 {
+		slices.Sort(added)
+		record[observer] = slices.Compact(added)
+	} else {
+		delete(record, observer)
+	}
+	annotations := cm.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	if len(record) > 0 {
+		data, err := json.Marshal(record)
+		if err != nil {
+			return nil, fmt.Errorf("unable to record the registry CA bundles of configmap %s: %w", cm.Name, err)
+		}
+		annotations[RegistryCABundlesAnnotationKey] = string(data)
+	} else {
+		delete(annotations, RegistryCABundlesAnnotationKey)
+	}
+	cm.SetAnnotations(annotations)
+	return drift, nil
+}
+
+// adjustSDICABundleSecret writes the bundle to the secret whose certificates are trusted by the SDI
+// connection management. The secret is created if it does not exist. The secret of SDI is not taken over:
+// only its key holding the certificates is patched, after its original value has been saved for the
+// cleanup.
+func (a *Adjuster) adjustSDICABundleSecret(ctx context.Context, obs *sdiv1alpha1.SDIObserver, bundle string) error {
+	existing := &corev1.Secret{}
+	err := a.Client.Get(ctx, client.ObjectKey{Name: SDICABundleSecretName, Namespace: obs.Spec.SDINamespace}, existing)
+	switch {
+	case errors.IsNotFound(err) || (err == nil && isOwnedBy(existing, obs)):
+		secret := &corev1.Secret{
+			TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "Secret"},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      SDICABundleSecretName,
+				Namespace: obs.Spec.SDINamespace,
+			},
+			Type: corev1.SecretTypeOpaque,
+			Data: map[string][]byte{SDICABundleSecretKey: []byte(bundle)},
+		}
+		return a.ensureResource(ctx, obs, managedResource{
+			desired:  secret,
+			existing: &corev1.Secret{},
+			drift: func(existing, desired client.Object) ([]string, error) {
+				return caBundleSecretDrift(existing.(*corev1.Secret), desired.(*corev1.Secret)), nil
+			},
+		})
+	case err != nil:
+		return fmt.Errorf("unable to get secret %s: %w", SDICABundleSecretName, err)
+	}
+
+	saved, err := a.saveSDICABundle(ctx, obs, existing)
+	if err != nil {
+		return err
+	}
+	if current, ok := existing.Data[SDICABundleSecretKey]; ok && string(current) == bundle {
+		return nil
+	}
+	patch := client.MergeFrom(existing.DeepCopy())
+	if existing.Data == nil {
+		existing.Data = map[string][]byte{}
+	}
+	existing.Data[SDICABundleSecretKey] = []byte(bundle)
+	a.logger.Info(fmt.Sprintf("Writing the CA bundle to key %s of secret %s", SDICABundleSecretKey, SDICABundleSecretName))
+	if err := a.Client.Patch(ctx, existing, patch); err != nil {
+		return fmt.Errorf("unable to update secret %s: %w", SDICABundleSecretName, err)
+	}
+	// The first write replaces the certificates of SDI, later ones revert the changes made by others.
+	if !saved {
+		a.recordDrift(obs, "Secret", SDICABundleSecretName, []string{fmt.Sprintf("data %s differs", SDICABundleSecretKey)})
+	}
+	return nil
+}
+
+func caBundleSecretDrift(existing, desired *corev1.Secret) []string {
+	drift := labelsDrift(existing.Labels, desired.Labels)
+	if !bytes.Equal(existing.Data[SDICABundleSecretKey], desired.Data[SDICABundleSecretKey]) {
+		drift = append(drift, fmt.Sprintf("data %s differs", SDICABundleSecretKey))
+	}
+	return drift
+}
+
+// sdiCABundleBackupName returns the name of the secret keeping the original certificates of the SDI
+// secret patched on behalf of the observer.
+func sdiCABundleBackupName(obs *sdiv1alpha1.SDIObserver) string {
+	return fmt.Sprintf("%s-%s-original", obs.Name, SDICABundleSecretName)
+}
+
+// saveSDICABundle copies the certificates of the SDI secret to a secret of the observer namespace unless
+// they have been saved already, and tells whether they have just been saved. A backup without the key
+// tells that the SDI secret had no certificates.
+func (a *Adjuster) saveSDICABundle(ctx context.Context, obs *sdiv1alpha1.SDIObserver, secret *corev1.Secret) (bool, error) {
+	name := sdiCABundleBackupName(obs)
+	err := a.Client.Get(ctx, client.ObjectKey{Name: name, Namespace: obs.Namespace}, &corev1.Secret{})
+	switch {
+	case err == nil:
+		return false, nil
+	case !errors.IsNotFound(err):
+		return false, fmt.Errorf("unable to get secret %s: %w", name, err)
+	}
+
+	backup := &corev1.Secret{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Secret"},
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: obs.Namespace},
+		Type:       corev1.SecretTypeOpaque,
+	}
+	if original, ok := secret.Data[SDICABundleSecretKey]; ok {
+		backup.Data = map[string][]byte{SDICABundleSecretKey: original}
+	}
+	if _, err := a.apply(ctx, obs, backup); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// restoreSDICABundle restores the certificates of the SDI secret patched on behalf of the observer. The
+// secret created by the operator is removed with the other managed secrets.
+func (a *Adjuster) restoreSDICABundle(obs *sdiv1alpha1.SDIObserver, ctx context.Context) error {
+	backup := &corev1.Secret{}
+	if err := a.Client.Get(ctx, client.ObjectKey{Name: sdiCABundleBackupName(obs), Namespace: obs.Namespace}, backup); err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("unable to get secret %s: %w", backup.Name, err)
+	}
+
+	secret := &corev1.Secret{}
+	err := a.Client.Get(ctx, client.ObjectKey{Name: SDICABundleSecretName, Namespace: obs.Spec.SDINamespace}, secret)
+	switch {
+	case err == nil && !isOwnedBy(secret, obs):
+		patch := client.MergeFrom(secret.DeepCopy())
+		if original, ok := backup.Data[SDICABundleSecretKey]; ok {
+			if secret.Data == nil {
+				secret.Data = map[string][]byte{}
+			}
+			secret.Data[SDICABundleSecretKey] = original
+		} else {
+			delete(secret.Data, SDICABundleSecretKey)
+		}
+		a.logger.Info(fmt.Sprintf("Restoring key %s of secret %s", SDICABundleSecretKey, SDICABundleSecretName))
+		if err := a.Client.Patch(ctx, secret, patch); err != nil {
+			return fmt.Errorf("unable to restore secret %s: %w", SDICABundleSecretName, err)
+		}
+	case err != nil && !errors.IsNotFound(err):
+		return fmt.Errorf("unable to get secret %s: %w", SDICABundleSecretName, err)
+	}
+
+	if err := a.Client.Delete(ctx, backup); client.IgnoreNotFound(err) != nil {
+		return fmt.Errorf("unable to delete secret %s: %w", backup.Name, err)
+	}
+	return nil
+}
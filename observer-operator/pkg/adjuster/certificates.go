@@ -0,0 +1,352 @@
+package adjuster
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"strings"
+	"time"
+
+	routev1 "github.com/openshift/api/route/v1"
+	"github.com/prometheus/client_golang/prometheus"
+	sdiv1alpha1 "github.com/redhat-sap/sap-data-intelligence/observer-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const (
+	// defaultCertificateExpiryWarningDays applies when the spec does not set the warning period.
+	defaultCertificateExpiryWarningDays = 30
+	// serviceDialTimeout bounds the connection to a service to read its certificate.
+	serviceDialTimeout = 10 * time.Second
+)
+
+// certificateExpiry exposes the expiry of the certificates handled by the operator so that alerts can be
+// defined on it.
+var certificateExpiry = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "sdi_observer_certificate_expiry_timestamp_seconds",
+	Help: "Expiry (notAfter) of a certificate handled by the SDI observer operator as a Unix timestamp.",
+}, []string{"observer", "certificate", "subject", "fingerprint"})
+
+func init() {
+	metrics.Registry.MustRegister(certificateExpiry)
+}
+
+// certificateSet collects parsed certificates, each one once.
+type certificateSet struct {
+	certs []sourcedCertificate
+	seen  map[string]bool
+}
+
+// add parses the PEM certificates of the source and adds the ones not collected yet.
+func (s *certificateSet) add(source string, data []byte) error {
+	parsed, err := parseCertificates(data)
+	if err != nil {
+		return err
+	}
+	for _, cert := range parsed {
+		s.insert(source, cert)
+	}
+	return nil
+}
+
+// insert adds the certificate unless it has been collected already.
+func (s *certificateSet) insert(source string, cert *x509.Certificate) {
+	if s.seen == nil {
+		s.seen = map[string]bool{}
+	}
+	fingerprint := certificateFingerprint(cert)
+	if s.seen[fingerprint] {
+		return
+	}
+	s.seen[fingerprint] = true
+	s.certs = append(s.certs, sourcedCertificate{source: source, cert: cert})
+}
+
+// CheckCertificates reports the expiry of the certificates handled by the operator: the CA bundle of
+// vsystem, the certificates of the managed routes and the certificates of the CA bundle. A certificate
+// expiring within the warning period of the spec is reported as a warning event and in the
+// CertificateExpiring condition. The certificate served by vsystem is verified with the destination CA
+// of the vsystem route.
+func (a *Adjuster) CheckCertificates(obs *sdiv1alpha1.SDIObserver, ctx context.Context) error {
+	if obs == nil {
+		return fmt.Errorf("SDIObserver cannot be nil")
+	}
+	status := &obs.Status.CertificatesStatus
+	certs, err := a.handledCertificates(ctx, obs)
+
+	now := time.Now()
+	status.Certificates = make([]sdiv1alpha1.CertificateState, 0, len(certs))
+	observer := client.ObjectKeyFromObject(obs).String()
+	certificateExpiry.DeletePartialMatch(prometheus.Labels{"observer": observer})
+	for _, c := range certs {
+		status.Certificates = append(status.Certificates, sdiv1alpha1.CertificateState{
+			Name:     c.source,
+			Subject:  c.cert.Subject.String(),
+			NotAfter: metav1.NewTime(c.cert.NotAfter),
+		})
+		certificateExpiry.WithLabelValues(observer, c.source, c.cert.Subject.String(), certificateFingerprint(c.cert)).
+			Set(float64(c.cert.NotAfter.Unix()))
+	}
+	a.setCertificateExpiringCondition(obs, certs, now)
+
+	if chainErr := a.checkVSystemChain(ctx, obs, now); chainErr != nil {
+		err = utilerrors.NewAggregate([]error{err, chainErr})
+	}
+	return err
+}
+
+// DeleteCertificateMetrics removes the certificate metrics of the observer.
+func DeleteCertificateMetrics(obs *sdiv1alpha1.SDIObserver) {
+	certificateExpiry.DeletePartialMatch(prometheus.Labels{"observer": client.ObjectKeyFromObject(obs).String()})
+}
+
+// handledCertificates returns the certificates handled by the operator. The certificates which cannot be
+// read are reported in the error, the others are returned nevertheless.
+func (a *Adjuster) handledCertificates(ctx context.Context, obs *sdiv1alpha1.SDIObserver) ([]sourcedCertificate, error) {
+	var set certificateSet
+	var errs []error
+	addSecret := func(ns, name, key string) {
+		secret := &corev1.Secret{}
+		if err := a.Client.Get(ctx, client.ObjectKey{Name: name, Namespace: ns}, secret); err != nil {
+			if !errors.IsNotFound(err) {
+				errs = append(errs, fmt.Errorf("unable to get secret %s/%s: %w", ns, name, err))
+			}
+			return
+		}
+		if err := set.add(fmt.Sprintf("Secret/%s/%s", ns, name), secret.Data[key]); err != nil {
+			errs = append(errs, fmt.Errorf("unable to parse key %s of secret %s/%s: %w", key, ns, name, err))
+		}
+	}
+
+	addSecret(obs.Spec.SDINamespace, vsystemCaBundleSecretName, vsystemCaBundleSecretKey)
+
+	routes := []managedRoute{vsystemRoute(obs), slcbRoute(obs)}
+	for _, spec := range obs.Spec.Routes {
+		routes = append(routes, additionalRoute(obs, spec, nil))
+	}
+	routeServed, err := a.serves(RouteGVK)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	for _, r := range routes {
+		if r.spec.ManagementState != sdiv1alpha1.RouteManagementStateManaged {
+			continue
+		}
+		if r.spec.CertificateSecretRef != nil {
+			addSecret(r.namespace, r.spec.CertificateSecretRef.Name, corev1.TLSCertKey)
+		}
+		if !routeServed {
+			continue
+		}
+		route := &routev1.Route{}
+		if err := a.Client.Get(ctx, client.ObjectKey{Name: r.name, Namespace: r.namespace}, route); err != nil {
+			if !errors.IsNotFound(err) {
+				errs = append(errs, fmt.Errorf("unable to get route %s/%s: %w", r.namespace, r.name, err))
+			}
+			continue
+		}
+		if route.Spec.TLS == nil || route.Spec.TLS.Certificate == "" {
+			continue
+		}
+		if err := set.add(fmt.Sprintf("Route/%s/%s", r.namespace, r.name), []byte(route.Spec.TLS.Certificate)); err != nil {
+			errs = append(errs, fmt.Errorf("unable to parse certificate of route %s/%s: %w", r.namespace, r.name, err))
+		}
+	}
+
+	// The sources which cannot be read are reported by the CA bundle step.
+	if obs.Spec.CABundle != nil {
+		if certs, err := a.caCertificates(ctx, obs, obs.Spec.CABundle.Sources); err == nil {
+			for _, c := range certs {
+				set.insert(c.source, c.cert)
+			}
+		}
+	}
+	return set.certs, utilerrors.NewAggregate(errs)
+}
+
+// setCertificateExpiringCondition reports the certificates expiring within the warning period of the
+// spec. A warning event is emitted for each of them when it is first reported in the condition.
+func (a *Adjuster) setCertificateExpiringCondition(obs *sdiv1alpha1.SDIObserver, certs []sourcedCertificate, now time.Time) {
+	days := obs.Spec.CertificateExpiryWarningDays
+	if days <= 0 {
+		days = defaultCertificateExpiryWarningDays
+	}
+	threshold := now.Add(time.Duration(days) * 24 * time.Hour)
+	var reported string
+	if previous := meta.FindStatusCondition(obs.Status.CertificatesStatus.Conditions, sdiv1alpha1.ConditionTypeCertificateExpiring); previous != nil &&
+		previous.Status == metav1.ConditionTrue {
+		reported = previous.Message
+	}
+
+	var expired, expiring []string
+	for _, c := range certs {
+		notAfter := c.cert.NotAfter.UTC().Format(time.RFC3339)
+		var msg, reason string
+		switch {
+		case now.After(c.cert.NotAfter):
+			msg = fmt.Sprintf("Certificate %q of %s expired on %s", c.cert.Subject.String(), c.source, notAfter)
+			reason = sdiv1alpha1.ReasonCertificateExpired
+			expired = append(expired, msg)
+		case threshold.After(c.cert.NotAfter):
+			msg = fmt.Sprintf("Certificate %q of %s expires on %s", c.cert.Subject.String(), c.source, notAfter)
+			reason = sdiv1alpha1.ReasonCertificateExpiring
+			expiring = append(expiring, msg)
+		default:
+			continue
+		}
+		if strings.Contains(reported, msg) {
+			continue
+		}
+		a.logger.Info(msg)
+		if a.Recorder != nil {
+			a.Recorder.Event(obs, corev1.EventTypeWarning, reason, msg)
+		}
+	}
+
+	condition := metav1.Condition{
+		Type:    sdiv1alpha1.ConditionTypeCertificateExpiring,
+		Status:  metav1.ConditionFalse,
+		Reason:  sdiv1alpha1.ReasonCertificatesValid,
+		Message: fmt.Sprintf("No certificate expires within %d days", days),
+	}
+	switch {
+	case len(expired) > 0:
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = sdiv1alpha1.ReasonCertificateExpired
+		condition.Message = strings.Join(append(expired, expiring...), "; ")
+	case len(expiring) > 0:
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = sdiv1alpha1.ReasonCertificateExpiring
+		condition.Message = strings.Join(expiring, "; ")
+	}
+	meta.SetStatusCondition(&obs.Status.CertificatesStatus.Conditions, condition)
+}
+
+// checkVSystemChain verifies the certificate served by the vsystem service with the destination CA of the
+// managed vsystem route. A mismatch makes the router reject the connections to vsystem. The outcome is
+// reported in the CertificateChainMismatch condition; the check is not done for an unmanaged route or a
+// route not re-encrypting the traffic. A warning event is emitted when a mismatch is first detected.
+func (a *Adjuster) checkVSystemChain(ctx context.Context, obs *sdiv1alpha1.SDIObserver, now time.Time) error {
+	conditions := &obs.Status.CertificatesStatus.Conditions
+	if obs.Spec.SDIVSystemRoute.ManagementState != sdiv1alpha1.RouteManagementStateManaged {
+		meta.RemoveStatusCondition(conditions, sdiv1alpha1.ConditionTypeCertificateChainMismatch)
+		return nil
+	}
+	reported := meta.IsStatusConditionTrue(*conditions, sdiv1alpha1.ConditionTypeCertificateChainMismatch)
+	condition := metav1.Condition{
+		Type:   sdiv1alpha1.ConditionTypeCertificateChainMismatch,
+		Status: metav1.ConditionUnknown,
+		Reason: sdiv1alpha1.ReasonChainUnverified,
+	}
+	defer func() { meta.SetStatusCondition(conditions, condition) }()
+
+	ns := obs.Spec.SDINamespace
+	route := &routev1.Route{}
+	served, err := a.serves(RouteGVK)
+	if err != nil {
+		condition.Message = err.Error()
+		return err
+	}
+	if !served {
+		condition.Message = "Route kind is not served; the destination CA is not used"
+		return nil
+	}
+	if err := a.Client.Get(ctx, client.ObjectKey{Name: VSystemRouteName, Namespace: ns}, route); err != nil {
+		if errors.IsNotFound(err) {
+			condition.Message = fmt.Sprintf("Route %s does not exist", VSystemRouteName)
+			return nil
+		}
+		condition.Message = err.Error()
+		return fmt.Errorf("unable to get route %s: %w", VSystemRouteName, err)
+	}
+	if route.Spec.TLS == nil || route.Spec.TLS.Termination != routev1.TLSTerminationReencrypt {
+		condition.Message = fmt.Sprintf("Route %s does not re-encrypt the traffic to vsystem", VSystemRouteName)
+		return nil
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM([]byte(route.Spec.TLS.DestinationCACertificate)) {
+		condition.Message = fmt.Sprintf("Route %s has no valid destination CA certificate", VSystemRouteName)
+		return nil
+	}
+
+	address, err := a.serviceAddress(ctx, ns, route)
+	if err != nil {
+		condition.Message = err.Error()
+		return nil
+	}
+	chain, err := a.peerCertificates(ctx, address)
+	if err != nil || len(chain) == 0 {
+		condition.Message = fmt.Sprintf("Unable to read the certificate served by %s: %v", address, err)
+		return nil
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range chain[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err = chain[0].Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   now,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	if err != nil {
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = sdiv1alpha1.ReasonChainMismatch
+		condition.Message = fmt.Sprintf("Certificate %q served by %s cannot be verified with the destination CA of route %s: %v",
+			chain[0].Subject.String(), address, VSystemRouteName, err)
+		if !reported {
+			a.logger.Info(condition.Message)
+			if a.Recorder != nil {
+				a.Recorder.Event(obs, corev1.EventTypeWarning, sdiv1alpha1.ReasonChainMismatch, condition.Message)
+			}
+		}
+		return nil
+	}
+	condition.Status = metav1.ConditionFalse
+	condition.Reason = sdiv1alpha1.ReasonChainVerified
+	condition.Message = fmt.Sprintf("Certificate served by %s is verified with the destination CA of route %s", address, VSystemRouteName)
+	return nil
+}
+
+// serviceAddress returns the in-cluster address of the service port targeted by the route.
+func (a *Adjuster) serviceAddress(ctx context.Context, ns string, route *routev1.Route) (string, error) {
+	svc := &corev1.Service{}
+	if err := a.Client.Get(ctx, client.ObjectKey{Name: route.Spec.To.Name, Namespace: ns}, svc); err != nil {
+		return "", fmt.Errorf("unable to get service %s: %w", route.Spec.To.Name, err)
+	}
+	for _, port := range svc.Spec.Ports {
+		if route.Spec.Port == nil || targetsServicePort(route.Spec.Port.TargetPort, port) {
+			return fmt.Sprintf("%s.%s.svc:%d", svc.Name, svc.Namespace, port.Port), nil
+		}
+	}
+	return "", fmt.Errorf("service %s has no port targeted by route %s", svc.Name, route.Name)
+}
+
+func targetsServicePort(target intstr.IntOrString, port corev1.ServicePort) bool {
+	if target.Type == intstr.String {
+		return port.Name == target.StrVal
+	}
+	return port.TargetPort.IntValue() == target.IntValue() || port.Port == target.IntVal
+}
+
+// servedCertificates returns the certificate chain served at the address. The chain is not verified here.
+func servedCertificates(ctx context.Context, address string) ([]*x509.Certificate, error) {
+	ctx, cancel := context.WithTimeout(ctx, serviceDialTimeout)
+	defer cancel()
+	dialer := &tls.Dialer{Config: &tls.Config{InsecureSkipVerify: true}} // #nosec G402 -- only reads the served chain
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	return conn.(*tls.Conn).ConnectionState().PeerCertificates, nil
+}
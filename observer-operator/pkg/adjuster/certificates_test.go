@@ -0,0 +1,180 @@
+package adjuster
+
+import (
+	"context"
+	"crypto/x509"
+	"strings"
+	"testing"
+	"time"
+
+	routev1 "github.com/openshift/api/route/v1"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	sdiv1alpha1 "github.com/redhat-sap/sap-data-intelligence/observer-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestCheckCertificates(t *testing.T) {
+	now := time.Now()
+	ca := issueTestCertificate(t, "vsystem-ca", now.Add(10*24*time.Hour), nil)
+	slcb := issueTestCertificate(t, "slcb", now.Add(-time.Hour), nil)
+	vsystem := issueTestCertificate(t, "vsystem", now.Add(365*24*time.Hour), nil)
+	objs := []client.Object{
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "slcb-tls", Namespace: "sap-slcbridge"},
+			Data:       map[string][]byte{corev1.TLSCertKey: []byte(slcb.pem())},
+		},
+		&routev1.Route{
+			ObjectMeta: metav1.ObjectMeta{Name: VSystemRouteName, Namespace: "sdi"},
+			Spec:       routev1.RouteSpec{TLS: &routev1.TLSConfig{Termination: routev1.TLSTerminationEdge, Certificate: vsystem.pem()}},
+		},
+	}
+	obs := &sdiv1alpha1.SDIObserver{
+		ObjectMeta: metav1.ObjectMeta{Name: "sdi", Namespace: "operators"},
+		Spec: sdiv1alpha1.SDIObserverSpec{
+			SDINamespace:    "sdi",
+			SLCBNamespace:   "sap-slcbridge",
+			SDIVSystemRoute: sdiv1alpha1.ManagedRouteSpec{ManagementState: sdiv1alpha1.RouteManagementStateManaged},
+			SLCBRoute: sdiv1alpha1.ManagedRouteSpec{
+				ManagementState:      sdiv1alpha1.RouteManagementStateManaged,
+				CertificateSecretRef: &corev1.LocalObjectReference{Name: "slcb-tls"},
+			},
+		},
+	}
+	a := newExposureTestAdjuster(t, []schema.GroupVersionKind{RouteGVK}, objs...)
+	recorder := record.NewFakeRecorder(10)
+	a.Recorder = recorder
+	ctx := context.Background()
+
+	caBundle := &corev1.Secret{}
+	if err := a.Client.Get(ctx, client.ObjectKey{Name: VSystemCABundleSecretName, Namespace: "sdi"}, caBundle); err != nil {
+		t.Fatalf("Failed to get CA bundle: %v", err)
+	}
+	caBundle.Data[vsystemCaBundleSecretKey] = []byte(ca.pem())
+	if err := a.Client.Update(ctx, caBundle); err != nil {
+		t.Fatalf("Failed to update CA bundle: %v", err)
+	}
+
+	if err := a.CheckCertificates(obs, ctx); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	var names []string
+	for _, cert := range obs.Status.CertificatesStatus.Certificates {
+		names = append(names, cert.Name)
+	}
+	expected := []string{"Secret/sdi/ca-bundle.pem", "Route/sdi/vsystem", "Secret/sap-slcbridge/slcb-tls"}
+	if strings.Join(names, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected certificates %v, got %v", expected, names)
+	}
+
+	condition := meta.FindStatusCondition(obs.Status.CertificatesStatus.Conditions, sdiv1alpha1.ConditionTypeCertificateExpiring)
+	if condition == nil || condition.Status != metav1.ConditionTrue || condition.Reason != sdiv1alpha1.ReasonCertificateExpired ||
+		!strings.Contains(condition.Message, "vsystem-ca") || strings.Contains(condition.Message, "CN=vsystem\"") {
+		t.Errorf("Expected the expired and the expiring certificates to be reported, got %v", condition)
+	}
+	if len(recorder.Events) != 2 {
+		t.Errorf("Expected a warning event per certificate, got %d", len(recorder.Events))
+	}
+	if err := a.CheckCertificates(obs, ctx); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(recorder.Events) != 2 {
+		t.Errorf("Expected the certificates reported already not to be warned about again, got %d events", len(recorder.Events))
+	}
+	gauge := certificateExpiry.WithLabelValues("operators/sdi", "Secret/sdi/ca-bundle.pem", "CN=vsystem-ca", certificateFingerprint(ca.cert))
+	if value := testutil.ToFloat64(gauge); value != float64(ca.cert.NotAfter.Unix()) {
+		t.Errorf("Expected the expiry of the CA bundle as metric, got %v", value)
+	}
+
+	obs.Spec.CertificateExpiryWarningDays = 5
+	obs.Spec.SLCBRoute.ManagementState = sdiv1alpha1.RouteManagementStateUnmanaged
+	if err := a.CheckCertificates(obs, ctx); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	condition = meta.FindStatusCondition(obs.Status.CertificatesStatus.Conditions, sdiv1alpha1.ConditionTypeCertificateExpiring)
+	if condition == nil || condition.Status != metav1.ConditionFalse {
+		t.Errorf("Expected no certificate to expire within 5 days, got %v", condition)
+	}
+
+	DeleteCertificateMetrics(obs)
+	if count := testutil.CollectAndCount(certificateExpiry); count != 0 {
+		t.Errorf("Expected the metrics of the observer to be removed, got %d", count)
+	}
+}
+
+func TestCheckVSystemChain(t *testing.T) {
+	now := time.Now()
+	ca := issueTestCertificate(t, "vsystem-ca", now.Add(time.Hour), nil)
+	other := issueTestCertificate(t, "other-ca", now.Add(time.Hour), nil)
+	leaf := issueTestCertificate(t, "vsystem", now.Add(time.Hour), &ca)
+
+	for _, tt := range []struct {
+		name          string
+		destinationCA string
+		served        []*x509.Certificate
+		status        metav1.ConditionStatus
+		reason        string
+		events        int
+	}{
+		{name: "verified", destinationCA: ca.pem(), served: []*x509.Certificate{leaf.cert}, status: metav1.ConditionFalse, reason: sdiv1alpha1.ReasonChainVerified},
+		{name: "mismatch", destinationCA: other.pem(), served: []*x509.Certificate{leaf.cert}, status: metav1.ConditionTrue, reason: sdiv1alpha1.ReasonChainMismatch, events: 1},
+		{name: "unreachable", destinationCA: ca.pem(), status: metav1.ConditionUnknown, reason: sdiv1alpha1.ReasonChainUnverified},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			route := &routev1.Route{
+				ObjectMeta: metav1.ObjectMeta{Name: VSystemRouteName, Namespace: "sdi"},
+				Spec: routev1.RouteSpec{
+					To:   routev1.RouteTargetReference{Kind: "Service", Name: VSystemServiceName},
+					Port: &routev1.RoutePort{TargetPort: intstr.FromString("vsystem")},
+					TLS:  &routev1.TLSConfig{Termination: routev1.TLSTerminationReencrypt, DestinationCACertificate: tt.destinationCA},
+				},
+			}
+			svc := &corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{Name: VSystemServiceName, Namespace: "sdi"},
+				Spec: corev1.ServiceSpec{Ports: []corev1.ServicePort{
+					{Name: "metrics", Port: 9090},
+					{Name: "vsystem", Port: 8797},
+				}},
+			}
+			a := newExposureTestAdjuster(t, []schema.GroupVersionKind{RouteGVK}, route, svc)
+			recorder := record.NewFakeRecorder(10)
+			a.Recorder = recorder
+			var dialed string
+			a.peerCertificates = func(_ context.Context, address string) ([]*x509.Certificate, error) {
+				dialed = address
+				return tt.served, nil
+			}
+			obs := &sdiv1alpha1.SDIObserver{
+				ObjectMeta: metav1.ObjectMeta{Name: "sdi", Namespace: "operators"},
+				Spec: sdiv1alpha1.SDIObserverSpec{
+					SDINamespace:    "sdi",
+					SDIVSystemRoute: sdiv1alpha1.ManagedRouteSpec{ManagementState: sdiv1alpha1.RouteManagementStateManaged},
+				},
+			}
+
+			if err := a.checkVSystemChain(context.Background(), obs, now); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if dialed != "vsystem.sdi.svc:8797" {
+				t.Errorf("Expected the vsystem port of the service to be checked, got %q", dialed)
+			}
+			condition := meta.FindStatusCondition(obs.Status.CertificatesStatus.Conditions, sdiv1alpha1.ConditionTypeCertificateChainMismatch)
+			if condition == nil || condition.Status != tt.status || condition.Reason != tt.reason {
+				t.Errorf("Expected %s %s, got %v", tt.status, tt.reason, condition)
+			}
+
+			// The mismatch is warned about once.
+			if err := a.checkVSystemChain(context.Background(), obs, now); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if len(recorder.Events) != tt.events {
+				t.Errorf("Expected %d warning events, got %d", tt.events, len(recorder.Events))
+			}
+		})
+	}
+}
@@ -0,0 +1,337 @@
+package adjuster
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	imagev1 "github.com/openshift/api/image/v1"
+	configv1 "github.com/openshift/machine-config-operator/pkg/apis/machineconfiguration.openshift.io/v1"
+	sdiv1alpha1 "github.com/redhat-sap/sap-data-intelligence/observer-operator/api/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+// markManaged labels the object as created by the operator on behalf of the observer.
+func markManaged(obj client.Object, obs *sdiv1alpha1.SDIObserver) {
+	labels := obj.GetLabels()
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	labels[ManagedByLabelKey] = ManagedByLabelValue
+	obj.SetLabels(labels)
+
+	if obs == nil {
+		return
+	}
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[OwnerAnnotationKey] = client.ObjectKeyFromObject(obs).String()
+	obj.SetAnnotations(annotations)
+}
+
+// isOwnedBy tells whether the object has been created on behalf of the observer.
+func isOwnedBy(obj client.Object, obs *sdiv1alpha1.SDIObserver) bool {
+	return obj.GetAnnotations()[OwnerAnnotationKey] == client.ObjectKeyFromObject(obs).String()
+}
+
+// Cleanup reverts the changes made on behalf of the observer being deleted. Only the objects created by
+// the operator are removed; the objects it took over are restored to their original state. The node
+// selectors of the namespaces and the pull secrets of the default service account are restored. Objects
+// shared with other observers are left in place.
+//
+// The patches of the SDI workloads are kept on purpose: the privileged diagnostics-fluentd DaemonSet and
+// its log format, and the exports mask of vsystem-vrep with the DataHub exportsMask. SDI does not run on
+// OpenShift without them and reverting them would restart the workloads of a running SDI instance.
+func (a *Adjuster) Cleanup(obs *sdiv1alpha1.SDIObserver, ctx context.Context) error {
+	if obs == nil {
+		return fmt.Errorf("SDIObserver cannot be nil")
+	}
+	owned := func(obj client.Object) bool { return isOwnedBy(obj, obs) }
+
+	var errs []error
+	for _, ns := range []string{obs.Spec.SDINamespace, obs.Spec.SLCBNamespace} {
+		for _, backend := range sortedKeys(exposureBackends) {
+			if err := a.deleteManaged(ctx, a.newExposureList(exposureBackends[backend].gvk()), owned, client.InNamespace(ns)); err != nil {
+				errs = append(errs, fmt.Errorf("unable to remove %s objects in namespace %s: %w", backend, ns, err))
+			}
+		}
+	}
+
+	for _, list := range []client.ObjectList{&rbacv1.RoleBindingList{}, &rbacv1.RoleList{}} {
+		if err := a.deleteManaged(ctx, list, owned, client.InNamespace(obs.Spec.SDINamespace)); err != nil {
+			errs = append(errs, fmt.Errorf("unable to remove SDI RBAC: %w", err))
+		}
+	}
+
+	if err := a.restoreSDICABundle(obs, ctx); err != nil {
+		errs = append(errs, err)
+	}
+
+	// Only the registry CA bundles added by the observer are removed from the ConfigMap shared with the
+	// cluster administrator.
+	if err := a.adjustRegistryCABundles(ctx, obs, nil, ""); err != nil {
+		errs = append(errs, fmt.Errorf("unable to remove registry CA bundles: %w", err))
+	}
+
+	// The services and endpoints are left over by an interrupted ACME challenge.
+	for _, ns := range []string{obs.Spec.SDINamespace, obs.Spec.SLCBNamespace} {
+		for _, list := range []client.ObjectList{&corev1.SecretList{}, &corev1.ServiceList{}, &discoveryv1.EndpointSliceList{}} {
+			if err := a.deleteManaged(ctx, list, owned, client.InNamespace(ns)); err != nil {
+				errs = append(errs, fmt.Errorf("unable to remove secrets and ACME challenges in namespace %s: %w", ns, err))
+			}
+		}
+	}
+
+	if err := a.cleanupPullSecrets(obs, ctx); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := a.cleanupNodeConfig(obs, ctx); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := a.cleanupNamespaceAnnotations(obs, ctx); err != nil {
+		errs = append(errs, err)
+	}
+	DeleteCertificateMetrics(obs)
+
+	return utilerrors.NewAggregate(errs)
+}
+
+// cleanupNodeConfig removes the node-configurator created by the observer. The cluster-scoped node
+// configuration is removed only if the observer managed it in Enforce mode and no other observer is going
+// to manage it.
+func (a *Adjuster) cleanupNodeConfig(obs *sdiv1alpha1.SDIObserver, ctx context.Context) error {
+	owned := func(obj client.Object) bool { return isOwnedBy(obj, obs) }
+
+	var errs []error
+	for _, list := range []client.ObjectList{
+		&appsv1.DaemonSetList{},
+		&rbacv1.RoleBindingList{},
+		&rbacv1.RoleList{},
+		&imagev1.ImageStreamList{},
+		&corev1.ServiceAccountList{},
+	} {
+		if err := a.deleteManaged(ctx, list, owned, client.InNamespace(obs.Namespace)); err != nil {
+			errs = append(errs, fmt.Errorf("unable to remove node-configurator resources: %w", err))
+		}
+	}
+
+	if !obs.Spec.ManageSDINodeConfig || obs.Spec.Mode == sdiv1alpha1.ObserverModeDryRun {
+		a.logger.Info("Node config is not managed by the SDIObserver; keeping it.")
+		return utilerrors.NewAggregate(errs)
+	}
+	owner, err := a.NodeConfigOwner(ctx)
+	if err != nil {
+		return utilerrors.NewAggregate(append(errs, err))
+	}
+	if owner != nil && !IsSameObserver(owner, obs) {
+		a.logger.Info("Node config is taken over by another SDIObserver; keeping it.", "owner", client.ObjectKeyFromObject(owner).String())
+		return utilerrors.NewAggregate(errs)
+	}
+
+	for _, list := range []client.ObjectList{
+		&configv1.KubeletConfigList{},
+		&configv1.MachineConfigList{},
+	} {
+		if err := a.deleteManaged(ctx, list, nil); err != nil {
+			errs = append(errs, fmt.Errorf("unable to remove node configuration: %w", err))
+		}
+	}
+
+	// The nodes of a deleted pool cannot return to the worker pool, thus the pool is kept as long as nodes
+	// carry its role label, set by the administrator. Without the SDI machine configs, it renders the
+	// worker configuration.
+	nodes, err := a.machineConfigPoolNodes(ctx)
+	if err != nil {
+		return utilerrors.NewAggregate(append(errs, err))
+	}
+	if nodes > 0 {
+		a.logger.Info(fmt.Sprintf("Keeping MachineConfigPool %s of %d labeled nodes", SDIMachineConfigPoolName, nodes))
+		return utilerrors.NewAggregate(errs)
+	}
+	if err := a.deleteManaged(ctx, &configv1.MachineConfigPoolList{}, nil); err != nil {
+		errs = append(errs, fmt.Errorf("unable to remove node configuration: %w", err))
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// machineConfigPoolNodes returns the number of nodes selected by the sdi MachineConfigPool.
+func (a *Adjuster) machineConfigPoolNodes(ctx context.Context) (int, error) {
+	pool := &configv1.MachineConfigPool{}
+	if err := a.Client.Get(ctx, client.ObjectKey{Name: SDIMachineConfigPoolName}, pool); err != nil {
+		if errors.IsNotFound(err) || meta.IsNoMatchError(err) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("unable to get MachineConfigPool %s: %w", SDIMachineConfigPoolName, err)
+	}
+	selector, err := metav1.LabelSelectorAsSelector(pool.Spec.NodeSelector)
+	if err != nil {
+		return 0, fmt.Errorf("unable to parse node selector of MachineConfigPool %s: %w", SDIMachineConfigPoolName, err)
+	}
+	nodes := &corev1.NodeList{}
+	if err := a.Client.List(ctx, nodes, client.MatchingLabelsSelector{Selector: selector}); err != nil {
+		return 0, fmt.Errorf("unable to list nodes: %w", err)
+	}
+	return len(nodes.Items), nil
+}
+
+// cleanupPullSecrets unlinks the pull secrets linked by the operator, unless another observer observes the
+// SDI namespace.
+func (a *Adjuster) cleanupPullSecrets(obs *sdiv1alpha1.SDIObserver, ctx context.Context) error {
+	owner, err := a.SDINamespaceOwner(obs.Spec.SDINamespace, ctx)
+	if err != nil {
+		return err
+	}
+	if owner != nil && !IsSameObserver(owner, obs) {
+		return nil
+	}
+	return a.UnlinkSDIRegistryPullSecrets(obs.Spec.SDINamespace, ctx)
+}
+
+// cleanupNamespaceAnnotations restores the node selectors of the namespaces not used by any other
+// observer.
+func (a *Adjuster) cleanupNamespaceAnnotations(obs *sdiv1alpha1.SDIObserver, ctx context.Context) error {
+	list := &sdiv1alpha1.SDIObserverList{}
+	if err := a.Client.List(ctx, list); err != nil {
+		return fmt.Errorf("unable to list SDIObservers: %w", err)
+	}
+	inUse := map[string]bool{}
+	for i := range list.Items {
+		other := &list.Items[i]
+		if IsSameObserver(other, obs) || other.DeletionTimestamp != nil {
+			continue
+		}
+		for _, ns := range []string{other.Namespace, other.Spec.SDINamespace, other.Spec.SLCBNamespace, DataHubSystemNamespace} {
+			inUse[ns] = true
+		}
+	}
+
+	var errs []error
+	for _, ns := range []string{obs.Namespace, obs.Spec.SDINamespace, obs.Spec.SLCBNamespace, DataHubSystemNamespace} {
+		if ns == "" || inUse[ns] {
+			continue
+		}
+		if err := a.revertNamespaceAnnotation(ns, ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+func (a *Adjuster) revertNamespaceAnnotation(ns string, ctx context.Context) error {
+	namespace := &corev1.Namespace{}
+	if err := a.Client.Get(ctx, types.NamespacedName{Name: ns}, namespace); err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("unable to get namespace %s: %w", ns, err)
+	}
+
+	annotations := namespace.Annotations
+	if _, managed := annotations[NodeSelectorManagedAnnotationKey]; !managed {
+		return nil
+	}
+
+	if original, ok := annotations[OriginalNodeSelectorAnnotationKey]; ok {
+		annotations[AnnotationKey] = original
+	} else {
+		delete(annotations, AnnotationKey)
+	}
+	delete(annotations, OriginalNodeSelectorAnnotationKey)
+	delete(annotations, NodeSelectorManagedAnnotationKey)
+
+	a.logger.Info(fmt.Sprintf("Restoring node selector of namespace %s", ns))
+	if err := a.Client.Update(ctx, namespace); err != nil {
+		return fmt.Errorf("unable to restore node selector of namespace %s: %w", ns, err)
+	}
+	return nil
+}
+
+// deleteManaged deletes the objects of the list kind created by the operator and accepted by the owned
+// filter. A nil filter accepts all of them.
+func (a *Adjuster) deleteManaged(ctx context.Context, list client.ObjectList, owned func(client.Object) bool, opts ...client.ListOption) error {
+	opts = append(opts, client.MatchingLabels{ManagedByLabelKey: ManagedByLabelValue})
+	if err := a.Client.List(ctx, list, opts...); err != nil {
+		if meta.IsNoMatchError(err) {
+			return nil
+		}
+		return err
+	}
+
+	items, err := meta.ExtractList(list)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, item := range items {
+		obj, ok := item.(client.Object)
+		if !ok || (owned != nil && !owned(obj)) {
+			continue
+		}
+		if restored, err := a.restoreOriginal(ctx, obj); err != nil || restored {
+			if err != nil {
+				errs = append(errs, err)
+			}
+			continue
+		}
+		a.logger.Info(fmt.Sprintf("Deleting %T %s", obj, client.ObjectKeyFromObject(obj)))
+		if err := a.Client.Delete(ctx, obj); client.IgnoreNotFound(err) != nil {
+			errs = append(errs, err)
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// restoreOriginal restores the labels, annotations and spec recorded by preserveOriginal on an object the
+// operator took over. It returns false if the object was created by the operator.
+func (a *Adjuster) restoreOriginal(ctx context.Context, obj client.Object) (bool, error) {
+	record, ok := obj.GetAnnotations()[OriginalObjectAnnotationKey]
+	if !ok {
+		return false, nil
+	}
+	original := originalObject{}
+	if err := json.Unmarshal([]byte(record), &original); err != nil {
+		return false, fmt.Errorf("unable to read the original state of %s: %w", obj.GetName(), err)
+	}
+	gvk, err := apiutil.GVKForObject(obj, a.Scheme)
+	if err != nil {
+		return false, err
+	}
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return false, fmt.Errorf("unable to convert %s: %w", obj.GetName(), err)
+	}
+
+	restored := &unstructured.Unstructured{Object: content}
+	restored.SetGroupVersionKind(gvk)
+	restored.SetLabels(original.Labels)
+	restored.SetAnnotations(original.Annotations)
+	if original.Spec != nil {
+		if err := unstructured.SetNestedMap(restored.Object, original.Spec, "spec"); err != nil {
+			return false, err
+		}
+	} else {
+		unstructured.RemoveNestedField(restored.Object, "spec")
+	}
+	a.logger.Info(fmt.Sprintf("Restoring %s %s", gvk.Kind, client.ObjectKeyFromObject(obj)))
+	if err := a.Client.Update(ctx, restored); client.IgnoreNotFound(err) != nil {
+		return false, fmt.Errorf("unable to restore %s %s: %w", gvk.Kind, obj.GetName(), err)
+	}
+	return true, nil
+}
@@ -0,0 +1,329 @@
+package adjuster
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	imagev1 "github.com/openshift/api/image/v1"
+	routev1 "github.com/openshift/api/route/v1"
+	configv1 "github.com/openshift/machine-config-operator/pkg/apis/machineconfiguration.openshift.io/v1"
+	sdiv1alpha1 "github.com/redhat-sap/sap-data-intelligence/observer-operator/api/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newCleanupScheme(t *testing.T) *runtime.Scheme {
+	t.Helper()
+	scheme := runtime.NewScheme()
+	for _, add := range []func(*runtime.Scheme) error{
+		corev1.AddToScheme,
+		discoveryv1.AddToScheme,
+		appsv1.AddToScheme,
+		imagev1.AddToScheme,
+		rbacv1.AddToScheme,
+		routev1.AddToScheme,
+		configv1.AddToScheme,
+		sdiv1alpha1.AddToScheme,
+	} {
+		if err := add(scheme); err != nil {
+			t.Fatalf("Failed to add scheme: %v", err)
+		}
+	}
+	return scheme
+}
+
+func TestCleanup(t *testing.T) {
+	scheme := newCleanupScheme(t)
+	obs := newObserver("prod", "sdi", time.Now(), true)
+	other := newObserver("qa", "sdi-qa", time.Now(), false)
+
+	ownedRoute := &routev1.Route{ObjectMeta: metav1.ObjectMeta{Name: "vsystem", Namespace: "sdi"}}
+	markManaged(ownedRoute, obs)
+	foreignRoute := &routev1.Route{ObjectMeta: metav1.ObjectMeta{Name: "vsystem", Namespace: "sdi-qa"}}
+	markManaged(foreignRoute, other)
+	userRoute := &routev1.Route{ObjectMeta: metav1.ObjectMeta{Name: "custom", Namespace: "sdi"}}
+	role := &rbacv1.Role{ObjectMeta: metav1.ObjectMeta{Name: "sdi-privileged", Namespace: "sdi"}}
+	markManaged(role, obs)
+	mc := &configv1.MachineConfig{ObjectMeta: metav1.ObjectMeta{Name: "75-worker-sap-data-intelligence"}}
+	markManaged(mc, obs)
+	acmeSecret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "sap-slcbridge-acme-tls", Namespace: "sap-slcbridge"}}
+	markManaged(acmeSecret, obs)
+	challengeService := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "vsystem-acme-challenge", Namespace: "sdi"}}
+	markManaged(challengeService, obs)
+
+	sdiNs := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "sdi", Annotations: map[string]string{
+		AnnotationKey:                     "node-role.kubernetes.io/sdi=",
+		OriginalNodeSelectorAnnotationKey: "",
+		NodeSelectorManagedAnnotationKey:  "true",
+	}}}
+	slcbNs := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "sap-slcbridge", Annotations: map[string]string{
+		AnnotationKey:                    "node-role.kubernetes.io/sdi=",
+		NodeSelectorManagedAnnotationKey: "true",
+	}}}
+
+	now := metav1.Now()
+	obs.DeletionTimestamp = &now
+	obs.Finalizers = []string{SDIObserverFinalizer}
+
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		obs, other, ownedRoute, foreignRoute, userRoute, role, mc, acmeSecret, challengeService, sdiNs, slcbNs,
+	).Build()
+	a := New("prod", "sdi-observer", c, scheme, logr.Discard())
+	ctx := context.Background()
+
+	if err := a.Cleanup(obs, ctx); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	for _, obj := range []client.Object{ownedRoute, role, mc, acmeSecret, challengeService} {
+		if err := c.Get(ctx, client.ObjectKeyFromObject(obj), obj); !errors.IsNotFound(err) {
+			t.Errorf("Expected %T %s to be deleted, got %v", obj, obj.GetName(), err)
+		}
+	}
+	for _, obj := range []client.Object{foreignRoute, userRoute} {
+		if err := c.Get(ctx, client.ObjectKeyFromObject(obj), obj); err != nil {
+			t.Errorf("Expected route %s/%s to be kept, got %v", obj.GetNamespace(), obj.GetName(), err)
+		}
+	}
+
+	if err := c.Get(ctx, client.ObjectKeyFromObject(sdiNs), sdiNs); err != nil {
+		t.Fatalf("Failed to get namespace: %v", err)
+	}
+	if selector, ok := sdiNs.Annotations[AnnotationKey]; !ok || selector != "" {
+		t.Errorf("Expected original empty node selector to be restored, got %q", selector)
+	}
+	if _, ok := sdiNs.Annotations[NodeSelectorManagedAnnotationKey]; ok {
+		t.Error("Expected managed marker to be removed")
+	}
+
+	// The SLCB namespace is shared with the other observer.
+	if err := c.Get(ctx, client.ObjectKeyFromObject(slcbNs), slcbNs); err != nil {
+		t.Fatalf("Failed to get namespace: %v", err)
+	}
+	if _, ok := slcbNs.Annotations[NodeSelectorManagedAnnotationKey]; !ok {
+		t.Error("Expected node selector of a namespace in use to be kept")
+	}
+}
+
+func TestCleanup_NodeConfigTakenOver(t *testing.T) {
+	scheme := newCleanupScheme(t)
+	obs := newObserver("prod", "sdi", time.Now().Add(-time.Hour), true)
+	next := newObserver("qa", "sdi-qa", time.Now(), true)
+	mc := &configv1.MachineConfig{ObjectMeta: metav1.ObjectMeta{Name: "75-worker-sap-data-intelligence"}}
+	markManaged(mc, obs)
+
+	now := metav1.Now()
+	obs.DeletionTimestamp = &now
+	obs.Finalizers = []string{SDIObserverFinalizer}
+
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(obs, next, mc).Build()
+	a := New("prod", "sdi-observer", c, scheme, logr.Discard())
+	ctx := context.Background()
+
+	if err := a.Cleanup(obs, ctx); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := c.Get(ctx, client.ObjectKeyFromObject(mc), mc); err != nil {
+		t.Errorf("Expected MachineConfig to be kept for the next owner, got %v", err)
+	}
+}
+
+func TestCleanup_NodeConfigNotManaged(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		manageNodes bool
+		mode        sdiv1alpha1.ObserverMode
+	}{
+		{name: "unmanaged", manageNodes: false, mode: sdiv1alpha1.ObserverModeEnforce},
+		{name: "dry run", manageNodes: true, mode: sdiv1alpha1.ObserverModeDryRun},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			scheme := newCleanupScheme(t)
+			obs := newObserver("prod", "sdi", time.Now(), tt.manageNodes)
+			obs.Spec.Mode = tt.mode
+			// The node config was left by an observer deleted before.
+			previous := newObserver("qa", "sdi-qa", time.Now(), true)
+			mc := &configv1.MachineConfig{ObjectMeta: metav1.ObjectMeta{Name: "75-worker-sap-data-intelligence"}}
+			markManaged(mc, previous)
+			c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(obs, mc).Build()
+			a := New("prod", "sdi-observer", c, scheme, logr.Discard())
+			ctx := context.Background()
+
+			if err := a.Cleanup(obs, ctx); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if err := c.Get(ctx, client.ObjectKeyFromObject(mc), mc); err != nil {
+				t.Errorf("Expected the node config not managed by the observer to be kept, got %v", err)
+			}
+		})
+	}
+}
+
+func TestCleanup_RestoresTakenOverObjects(t *testing.T) {
+	existing := &routev1.Route{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "vsystem",
+			Namespace:   "sdi",
+			Labels:      map[string]string{"app": "custom"},
+			Annotations: map[string]string{"haproxy.router.openshift.io/timeout": "5m"},
+		},
+		Spec: routev1.RouteSpec{
+			Host: "vsystem.example.com",
+			To:   routev1.RouteTargetReference{Kind: "Service", Name: "custom"},
+		},
+	}
+	sa := &corev1.ServiceAccount{
+		ObjectMeta:       metav1.ObjectMeta{Name: DefaultServiceAccountName, Namespace: "sdi"},
+		ImagePullSecrets: []corev1.LocalObjectReference{{Name: "other"}},
+	}
+	pullSecret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: SLPDockerRegistryPullSecretName, Namespace: "sdi"}}
+	a := newRouteTestAdjuster(t, existing, sa, pullSecret)
+	for _, add := range []func(*runtime.Scheme) error{sdiv1alpha1.AddToScheme, configv1.AddToScheme, discoveryv1.AddToScheme} {
+		if err := add(a.Scheme); err != nil {
+			t.Fatalf("Failed to add scheme: %v", err)
+		}
+	}
+	ctx := context.Background()
+	obs := newObserver("prod", "sdi", time.Now(), false)
+	obs.Spec.SDIVSystemRoute = sdiv1alpha1.ManagedRouteSpec{ManagementState: sdiv1alpha1.RouteManagementStateManaged}
+
+	// The route is taken over twice; its original state is recorded once.
+	for i := 0; i < 2; i++ {
+		if err := a.AdjustSDIVsystemRoute("sdi", obs, ctx); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+	if err := a.AdjustSDIRegistryPullSecret("sdi", obs, ctx); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	route := &routev1.Route{}
+	if err := a.Client.Get(ctx, client.ObjectKeyFromObject(existing), route); err != nil {
+		t.Fatalf("Failed to get route: %v", err)
+	}
+	if route.Spec.To.Name != "vsystem" || !isOwnedBy(route, obs) {
+		t.Fatalf("Expected the route to be taken over, got %v", route)
+	}
+
+	if err := a.Cleanup(obs, ctx); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	route = &routev1.Route{}
+	if err := a.Client.Get(ctx, client.ObjectKeyFromObject(existing), route); err != nil {
+		t.Fatalf("Expected the route to be restored, got %v", err)
+	}
+	if route.Spec.To.Name != "custom" || route.Spec.Host != "vsystem.example.com" || route.Spec.TLS != nil {
+		t.Errorf("Expected the original spec to be restored, got %v", route.Spec)
+	}
+	if len(route.Labels) != 1 || route.Labels["app"] != "custom" ||
+		len(route.Annotations) != 1 || route.Annotations["haproxy.router.openshift.io/timeout"] != "5m" {
+		t.Errorf("Expected the original labels and annotations to be restored, got %v %v", route.Labels, route.Annotations)
+	}
+
+	got := &corev1.ServiceAccount{}
+	if err := a.Client.Get(ctx, client.ObjectKeyFromObject(sa), got); err != nil {
+		t.Fatalf("Failed to get service account: %v", err)
+	}
+	if len(got.ImagePullSecrets) != 1 || got.ImagePullSecrets[0].Name != "other" {
+		t.Errorf("Expected the pull secret linked by the operator to be unlinked, got %v", got.ImagePullSecrets)
+	}
+}
+
+func TestCleanup_KeepsMachineConfigPoolOfLabeledNodes(t *testing.T) {
+	scheme := newCleanupScheme(t)
+	obs := newObserver("prod", "sdi", time.Now(), true)
+	mc := &configv1.MachineConfig{ObjectMeta: metav1.ObjectMeta{Name: "75-worker-sap-data-intelligence"}}
+	markManaged(mc, obs)
+	pool := &configv1.MachineConfigPool{
+		ObjectMeta: metav1.ObjectMeta{Name: SDIMachineConfigPoolName},
+		Spec: configv1.MachineConfigPoolSpec{NodeSelector: &metav1.LabelSelector{
+			MatchLabels: map[string]string{"node-role.kubernetes.io/sdi": ""},
+		}},
+	}
+	markManaged(pool, obs)
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "worker-0", Labels: map[string]string{"node-role.kubernetes.io/sdi": ""}}}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(obs, mc, pool, node).Build()
+	a := New("prod", "sdi-observer", c, scheme, logr.Discard())
+	ctx := context.Background()
+
+	if err := a.Cleanup(obs, ctx); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := c.Get(ctx, client.ObjectKeyFromObject(mc), mc); !errors.IsNotFound(err) {
+		t.Errorf("Expected the MachineConfig to be deleted, got %v", err)
+	}
+	if err := c.Get(ctx, client.ObjectKeyFromObject(pool), pool); err != nil {
+		t.Errorf("Expected the MachineConfigPool of the labeled nodes to be kept, got %v", err)
+	}
+
+	// Once the nodes are unlabeled, the pool is deleted.
+	node.Labels = nil
+	if err := c.Update(ctx, node); err != nil {
+		t.Fatalf("Failed to update node: %v", err)
+	}
+	if err := a.Cleanup(obs, ctx); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := c.Get(ctx, client.ObjectKeyFromObject(pool), pool); !errors.IsNotFound(err) {
+		t.Errorf("Expected the MachineConfigPool to be deleted, got %v", err)
+	}
+}
+
+func TestCleanup_KeepsSDIWorkloadPatches(t *testing.T) {
+	scheme := newCleanupScheme(t)
+	gvk := schema.GroupVersionKind{Group: DataHubAPIGroup, Version: DataHubAPIVersion, Kind: DataHubKind}
+	scheme.AddKnownTypeWithName(gvk, &unstructured.Unstructured{})
+	scheme.AddKnownTypeWithName(gvk.GroupVersion().WithKind(DataHubKind+"List"), &unstructured.UnstructuredList{})
+	obs := newObserver("prod", "sdi", time.Now(), false)
+
+	fluentd := &appsv1.DaemonSet{
+		ObjectMeta: metav1.ObjectMeta{Name: DiagnosticFluentdName, Namespace: "sdi"},
+		Spec: appsv1.DaemonSetSpec{Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{Containers: []corev1.Container{{
+			Name:            DiagnosticFluentdName,
+			SecurityContext: &corev1.SecurityContext{Privileged: ptr.To(true)},
+		}}}}},
+	}
+	vrep := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: VSystemVrepStsName, Namespace: "sdi"},
+		Spec: appsv1.StatefulSetSpec{Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+			Volumes: []corev1.Volume{{Name: VolumeName, VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}}},
+		}}},
+	}
+	dataHub := &unstructured.Unstructured{Object: map[string]interface{}{
+		"spec": map[string]interface{}{"vsystem": map[string]interface{}{"vRep": map[string]interface{}{"exportsMask": true}}},
+	}}
+	dataHub.SetGroupVersionKind(gvk)
+	dataHub.SetName("default")
+	dataHub.SetNamespace("sdi")
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(obs, fluentd, vrep, dataHub).Build()
+	a := New("prod", "sdi-observer", c, scheme, logr.Discard())
+	ctx := context.Background()
+
+	if err := a.Cleanup(obs, ctx); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := c.Get(ctx, client.ObjectKeyFromObject(fluentd), fluentd); err != nil ||
+		!*fluentd.Spec.Template.Spec.Containers[0].SecurityContext.Privileged {
+		t.Errorf("Expected the diagnostics-fluentd patch to be kept, got %v", err)
+	}
+	if err := c.Get(ctx, client.ObjectKeyFromObject(vrep), vrep); err != nil || len(vrep.Spec.Template.Spec.Volumes) != 1 {
+		t.Errorf("Expected the vsystem-vrep patch to be kept, got %v", err)
+	}
+	if err := c.Get(ctx, client.ObjectKeyFromObject(dataHub), dataHub); err != nil {
+		t.Fatalf("Failed to get DataHub: %v", err)
+	}
+	if mask, _, _ := unstructured.NestedBool(dataHub.Object, "spec", "vsystem", "vRep", "exportsMask"); !mask {
+		t.Error("Expected the DataHub exportsMask to be kept")
+	}
+}
@@ -7,13 +7,63 @@ const (
 	DiagnosticFluentdName = "diagnostics-fluentd"
 	VSystemVrepStsName    = "vsystem-vrep"
 
+	// Preset routes
+	VSystemRouteName = "vsystem"
+	SLCBRouteName    = "sap-slcbridge"
+
+	// Services exposed by routes
+	VSystemServiceName = "vsystem"
+	SLCBServiceName    = "slcbridgebase-service"
+
+	// Secret holding the CA bundle of the vsystem service
+	VSystemCABundleSecretName = "ca-bundle.pem" // #nosec G101
+
+	// Diagnostics fluentd configuration
+	DiagnosticFluentdSettingsName = "diagnostics-fluentd-settings"
+	FluentdConfigKey              = "fluent.conf"
+
 	// Volume and mount names
 	VolumeName              = "exports-mask"
 	FluentdDockerVolumeName = "varlibdockercontainers"
+	FluentdDockerHostPath   = "/var/lib/docker"
+	VRepExportsMountPath    = "/exports"
+
+	// Size of the obsolete exports volume claims of vsystem-vrep created by older SDI releases
+	VRepObsoleteExportsClaimSize = "500Mi"
+
+	// Node configuration objects
+	SDIMachineConfigName     = "75-worker-sap-data-intelligence"
+	SDIMachineConfigPoolName = "sdi"
 
 	// Annotation keys
 	AnnotationKey = "openshift.io/node-selector"
 
+	// OwnerAnnotationKey records the SDIObserver (namespace/name) that created an object.
+	OwnerAnnotationKey = "sdi.sap-redhat.io/owner"
+	// OriginalNodeSelectorAnnotationKey records the node selector of a namespace before it was changed.
+	OriginalNodeSelectorAnnotationKey = "sdi.sap-redhat.io/original-node-selector"
+	// NodeSelectorManagedAnnotationKey marks a namespace whose node selector was set by the operator.
+	NodeSelectorManagedAnnotationKey = "sdi.sap-redhat.io/node-selector-managed"
+	// OriginalObjectAnnotationKey records the labels, annotations and spec of an object which existed before
+	// the operator took it over.
+	OriginalObjectAnnotationKey = "sdi.sap-redhat.io/original-object"
+	// LinkedPullSecretsAnnotationKey records the pull secrets linked with a service account by the operator.
+	LinkedPullSecretsAnnotationKey = "sdi.sap-redhat.io/linked-pull-secrets"
+	// RegistryCABundlesAnnotationKey records the registry CA bundle keys added by each observer to the
+	// additionalTrustedCA ConfigMap.
+	RegistryCABundlesAnnotationKey = "sdi.sap-redhat.io/registry-ca-bundles"
+	// GracefulDeletionsAnnotationKey records the pods of outdated revisions of a StatefulSet deleted gracefully.
+	GracefulDeletionsAnnotationKey = "sdi.sap-redhat.io/graceful-pod-deletions"
+	// ACMEDirectoryURLAnnotationKey records the ACME server of an account key secret.
+	ACMEDirectoryURLAnnotationKey = "sdi.sap-redhat.io/acme-directory-url"
+
+	// ManagedByLabelKey marks the objects created by the operator so that they can be removed on uninstall.
+	ManagedByLabelKey   = "app.kubernetes.io/managed-by"
+	ManagedByLabelValue = "sdi-observer-operator"
+
+	// Finalizer reverting the changes made by the operator when an SDIObserver is deleted
+	SDIObserverFinalizer = "sdi.sap-redhat.io/finalizer"
+
 	// Namespace names
 	DataHubSystemNamespace = "datahub-system"
 
@@ -23,36 +73,50 @@ const (
 	DataHubKind       = "DataHub"
 	VoraClusterKind   = "VoraCluster"
 
+	// VoraCluster API group and version, the resource is optional in SDI
+	VoraClusterAPIGroup   = "sap.com"
+	VoraClusterAPIVersion = "v1"
+	VoraClusterName       = "vora"
+
+	// Gateway API group of the HTTPRoute and TLSRoute exposure backends
+	GatewayAPIGroup = "gateway.networking.k8s.io"
+
+	// CA bundle trusted by the SDI connection management
+	SDICABundleSecretName = "cmcertificates" // #nosec G101
+	SDICABundleSecretKey  = "cert"
+
+	// Registry CA bundles referenced by the additionalTrustedCA of the cluster image configuration
+	OpenShiftConfigNamespace     = "openshift-config"
+	TrustedRegistryCABundlesName = "trusted-registry-cabundles"
+	ImageConfigName              = "cluster"
+
+	// Image pull secret created in the SDI namespace by SLC Bridge
+	SLPDockerRegistryPullSecretName = "slp-docker-registry-pull-secret" // #nosec G101
+	DefaultServiceAccountName       = "default"
+
 	// Default values
 	DefaultRequeueInterval    = 1 * time.Minute
 	DefaultGracePeriodSeconds = int64(1)
 
+	// Grace period of the first deletion of a pod stuck on an outdated StatefulSet revision
+	StaleRevisionGracePeriodSeconds = int64(10)
+	// gracefulDeletionEscalationPeriod is the time after which a gracefully deleted pod still running an
+	// outdated StatefulSet revision is deleted forcefully.
+	gracefulDeletionEscalationPeriod = 1 * time.Minute
+
+	// savedStatefulSetKey is the key of the ConfigMap keeping a StatefulSet being recreated.
+	savedStatefulSetKey = "statefulset.json"
+
 	// Security context constants
 	DefaultPrivileged = true
 
 	// Label keys
 	ControllerRevisionHashLabel = "controller-revision-hash"
+	AppComponentLabel           = "datahub.sap.com/app-component"
+	AppVersionLabel             = "datahub.sap.com/app-version"
+	FluentdAppComponent         = "fluentd"
 )
 
-// Service account names by SDI version
-var (
-	SDIServiceAccounts = map[string][]string{
-		"3.2": {
-			"diagnostics-fluentd",
-			"elasticsearch",
-			"mlf-deployment-api",
-			"pipeline-modeler",
-			"storagegateway",
-			"vsystem",
-		},
-		"3.3": {
-			"diagnostics-fluentd",
-			"elasticsearch",
-			"mlf-deployment-api",
-			"pipeline-modeler",
-			"storagegateway",
-			"vsystem",
-			"backup-agent",
-		},
-	}
-)
+// VRepObsoleteExportsClaimNames are the names of the exports volume claims of vsystem-vrep replaced by the
+// exports-mask volume.
+var VRepObsoleteExportsClaimNames = []string{"exports", "exports-volume"}
@@ -0,0 +1,178 @@
+package adjuster
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	configv1 "github.com/openshift/machine-config-operator/pkg/apis/machineconfiguration.openshift.io/v1"
+	sdiv1alpha1 "github.com/redhat-sap/sap-data-intelligence/observer-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// machineConfigDrift returns the differences of the existing MachineConfig from the desired one. The
+// ignition files are compared by their decoded contents and the systemd units by their contents and state.
+func machineConfigDrift(existing, desired *configv1.MachineConfig) ([]string, error) {
+	var desiredIgnition ignitionConfig
+	if err := json.Unmarshal(desired.Spec.Config.Raw, &desiredIgnition); err != nil {
+		return nil, fmt.Errorf("unable to parse ignition config of MachineConfig %s: %w", desired.Name, err)
+	}
+
+	drift := labelsDrift(existing.Labels, desired.Labels)
+	var existingIgnition ignitionConfig
+	if err := json.Unmarshal(existing.Spec.Config.Raw, &existingIgnition); err != nil {
+		return append(drift, "ignition config cannot be parsed"), nil
+	}
+
+	existingFiles := map[string]ignitionFile{}
+	for _, file := range existingIgnition.Storage.Files {
+		existingFiles[file.Path] = file
+	}
+	for _, file := range desiredIgnition.Storage.Files {
+		current, ok := existingFiles[file.Path]
+		delete(existingFiles, file.Path)
+		if !ok {
+			drift = append(drift, fmt.Sprintf("file %s is missing", file.Path))
+			continue
+		}
+		if !ignitionFileContentsEqual(current, file) {
+			drift = append(drift, fmt.Sprintf("file %s contents differ", file.Path))
+		}
+		if file.Mode != nil && (current.Mode == nil || *current.Mode != *file.Mode) {
+			drift = append(drift, fmt.Sprintf("file %s mode differs", file.Path))
+		}
+	}
+	for _, path := range sortedKeys(existingFiles) {
+		drift = append(drift, fmt.Sprintf("file %s is unexpected", path))
+	}
+
+	existingUnits := map[string]ignitionUnit{}
+	for _, unit := range existingIgnition.Systemd.Units {
+		existingUnits[unit.Name] = unit
+	}
+	for _, unit := range desiredIgnition.Systemd.Units {
+		current, ok := existingUnits[unit.Name]
+		delete(existingUnits, unit.Name)
+		if !ok {
+			drift = append(drift, fmt.Sprintf("unit %s is missing", unit.Name))
+			continue
+		}
+		if strings.TrimSpace(current.Contents) != strings.TrimSpace(unit.Contents) {
+			drift = append(drift, fmt.Sprintf("unit %s contents differ", unit.Name))
+		}
+		if isEnabled(current.Enabled) != isEnabled(unit.Enabled) {
+			drift = append(drift, fmt.Sprintf("unit %s enablement differs", unit.Name))
+		}
+	}
+	for _, name := range sortedKeys(existingUnits) {
+		drift = append(drift, fmt.Sprintf("unit %s is unexpected", name))
+	}
+
+	return drift, nil
+}
+
+func ignitionFileContentsEqual(a, b ignitionFile) bool {
+	if a.Contents.Source == b.Contents.Source {
+		return true
+	}
+	contentsA, errA := decodeDataURL(a.Contents.Source)
+	contentsB, errB := decodeDataURL(b.Contents.Source)
+	return errA == nil && errB == nil && contentsA == contentsB
+}
+
+func isEnabled(enabled *bool) bool {
+	return enabled != nil && *enabled
+}
+
+// machineConfigPoolDrift returns the differences of the selectors and labels of the existing
+// MachineConfigPool from the desired one.
+func machineConfigPoolDrift(existing, desired *configv1.MachineConfigPool) []string {
+	drift := labelsDrift(existing.Labels, desired.Labels)
+	if selectorString(existing.Spec.MachineConfigSelector) != selectorString(desired.Spec.MachineConfigSelector) {
+		drift = append(drift, "machineConfigSelector differs")
+	}
+	if selectorString(existing.Spec.NodeSelector) != selectorString(desired.Spec.NodeSelector) {
+		drift = append(drift, "nodeSelector differs")
+	}
+	return drift
+}
+
+// selectorString returns the canonical form of the label selector.
+func selectorString(selector *metav1.LabelSelector) string {
+	if selector == nil {
+		return ""
+	}
+	s, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		return selector.String()
+	}
+	return s.String()
+}
+
+// labelsDrift returns the desired labels missing from or differing in the existing labels.
+func labelsDrift(existing, desired map[string]string) []string {
+	return entriesDrift("label", existing, desired)
+}
+
+// annotationsDrift returns the desired annotations missing from or differing in the existing annotations.
+func annotationsDrift(existing, desired map[string]string) []string {
+	return entriesDrift("annotation", existing, desired)
+}
+
+func entriesDrift(kind string, existing, desired map[string]string) []string {
+	var drift []string
+	for _, key := range sortedKeys(desired) {
+		if value, ok := existing[key]; !ok || value != desired[key] {
+			drift = append(drift, fmt.Sprintf("%s %s differs", kind, key))
+		}
+	}
+	return drift
+}
+
+func sortedKeys[K ~string, V any](m map[K]V) []K {
+	keys := make([]K, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// recordDrift reports a drifted object as an event on the observer. The drift is also reported in the
+// status condition set by setDriftCondition.
+func (a *Adjuster) recordDrift(obs *sdiv1alpha1.SDIObserver, kind, name string, drift []string) {
+	msg := fmt.Sprintf("%s %s drifted (%s); corrected", kind, name, strings.Join(drift, ", "))
+	reason := sdiv1alpha1.ReasonDriftCorrected
+	if a.dryRun {
+		msg = fmt.Sprintf("%s %s drifted (%s); would be corrected", kind, name, strings.Join(drift, ", "))
+		reason = sdiv1alpha1.ReasonDriftDetected
+	}
+	a.logger.Info(msg)
+	a.drifts = append(a.drifts, msg)
+	if a.Recorder != nil && obs != nil {
+		a.Recorder.Event(obs, corev1.EventTypeWarning, reason, msg)
+	}
+}
+
+// setDriftCondition reports the drifts recorded since the last call in the given conditions.
+func (a *Adjuster) setDriftCondition(conditions *[]metav1.Condition) {
+	condition := metav1.Condition{
+		Type:    sdiv1alpha1.ConditionTypeConfigDrift,
+		Status:  metav1.ConditionFalse,
+		Reason:  sdiv1alpha1.ReasonNoDrift,
+		Message: "No drift detected",
+	}
+	if len(a.drifts) > 0 {
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = sdiv1alpha1.ReasonDriftCorrected
+		if a.dryRun {
+			condition.Reason = sdiv1alpha1.ReasonDriftDetected
+		}
+		condition.Message = strings.Join(a.drifts, "; ")
+	}
+	meta.SetStatusCondition(conditions, condition)
+	a.drifts = nil
+}
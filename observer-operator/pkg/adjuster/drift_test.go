@@ -0,0 +1,138 @@
+package adjuster
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr"
+	configv1 "github.com/openshift/machine-config-operator/pkg/apis/machineconfiguration.openshift.io/v1"
+	sdiv1alpha1 "github.com/redhat-sap/sap-data-intelligence/observer-operator/api/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestMachineConfigDrift(t *testing.T) {
+	desired, err := renderMachineConfig(&sdiv1alpha1.SDIObserver{})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// The same files encoded differently do not drift.
+	var ignition ignitionConfig
+	if err := json.Unmarshal(desired.Spec.Config.Raw, &ignition); err != nil {
+		t.Fatalf("Failed to parse ignition config: %v", err)
+	}
+	ignition.Storage.Files[0].Contents.Source = "data:,nfsd%0Anfsv4%0Aip_tables%0Aipt_REDIRECT%0Aipt_owner%0A"
+	existing := desired.DeepCopy()
+	existing.Spec.Config.Raw, _ = json.Marshal(ignition)
+	if drift, err := machineConfigDrift(existing, desired); err != nil || len(drift) != 0 {
+		t.Errorf("Expected no drift, got %v (%v)", drift, err)
+	}
+
+	ignition.Storage.Files[0].Contents.Source = encodeDataURL("nfsd\n")
+	ignition.Systemd.Units[0].Contents = "[Unit]\n"
+	ignition.Systemd.Units = append(ignition.Systemd.Units, ignitionUnit{Name: "extra.service"})
+	existing.Spec.Config.Raw, _ = json.Marshal(ignition)
+	existing.Labels = nil
+	drift, err := machineConfigDrift(existing, desired)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	expected := []string{
+		"label machineconfiguration.openshift.io/role differs",
+		"file " + sdiModulesLoadPath + " contents differ",
+		"unit sdi-modules-load.service contents differ",
+		"unit extra.service is unexpected",
+	}
+	if strings.Join(drift, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected drift %v, got %v", expected, drift)
+	}
+}
+
+func TestMachineConfigPoolDrift(t *testing.T) {
+	desired := loadAsset[*configv1.MachineConfigPool](t, machineConfigPoolAsset)
+
+	reordered := desired.DeepCopy()
+	values := reordered.Spec.MachineConfigSelector.MatchExpressions[0].Values
+	values[0], values[1] = values[1], values[0]
+	if drift := machineConfigPoolDrift(reordered, desired); len(drift) != 0 {
+		t.Errorf("Expected no drift, got %v", drift)
+	}
+
+	edited := desired.DeepCopy()
+	edited.Spec.NodeSelector = &metav1.LabelSelector{MatchLabels: map[string]string{"node-role.kubernetes.io/worker": ""}}
+	if drift := machineConfigPoolDrift(edited, desired); len(drift) != 1 || drift[0] != "nodeSelector differs" {
+		t.Errorf("Expected nodeSelector drift, got %v", drift)
+	}
+}
+
+func TestEnsureMachineConfig_CorrectsDrift(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := configv1.AddToScheme(scheme); err != nil {
+		t.Fatalf("Failed to add scheme: %v", err)
+	}
+	obs := &sdiv1alpha1.SDIObserver{Spec: sdiv1alpha1.SDIObserverSpec{NodeConfig: sdiv1alpha1.NodeConfigSpec{
+		ExtraKernelModules: []string{"br_netfilter"},
+	}}}
+	existing, err := renderMachineConfig(&sdiv1alpha1.SDIObserver{})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	pool := loadAsset[*configv1.MachineConfigPool](t, machineConfigPoolAsset)
+	pool.Spec.NodeSelector = nil
+
+	c := withServerSideApply(fake.NewClientBuilder().WithScheme(scheme).WithObjects(existing, pool)).Build()
+	recorder := record.NewFakeRecorder(10)
+	a := New("test-name", "sdi-observer", c, scheme, logr.Discard())
+	a.Recorder = recorder
+	ctx := context.Background()
+
+	if err := a.ensureMachineConfig(ctx, obs); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := a.ensureMachineConfigPool(ctx, obs); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	a.setDriftCondition(&obs.Status.SDINodeConfigStatus.Conditions)
+
+	got := &configv1.MachineConfig{}
+	if err := c.Get(ctx, client.ObjectKeyFromObject(existing), got); err != nil {
+		t.Fatalf("Failed to get MachineConfig: %v", err)
+	}
+	if files := ignitionFiles(t, got); !strings.Contains(files[sdiModulesLoadPath], "br_netfilter") {
+		t.Errorf("Expected MachineConfig to be updated, got %v", files)
+	}
+	if got.Labels[ManagedByLabelKey] != ManagedByLabelValue {
+		t.Errorf("Expected unlabeled MachineConfig to be labeled for the uninstall, got %v", got.Labels)
+	}
+	gotPool := &configv1.MachineConfigPool{}
+	if err := c.Get(ctx, client.ObjectKeyFromObject(pool), gotPool); err != nil {
+		t.Fatalf("Failed to get MachineConfigPool: %v", err)
+	}
+	if gotPool.Spec.NodeSelector == nil {
+		t.Error("Expected MachineConfigPool nodeSelector to be restored")
+	}
+
+	if len(recorder.Events) != 2 {
+		t.Errorf("Expected 2 drift events, got %d", len(recorder.Events))
+	}
+	condition := meta.FindStatusCondition(obs.Status.SDINodeConfigStatus.Conditions, sdiv1alpha1.ConditionTypeConfigDrift)
+	if condition == nil || condition.Status != metav1.ConditionTrue || condition.Reason != sdiv1alpha1.ReasonDriftCorrected {
+		t.Errorf("Expected drift condition, got %v", condition)
+	}
+
+	// Nothing drifts anymore.
+	if err := a.ensureMachineConfig(ctx, obs); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	a.setDriftCondition(&obs.Status.SDINodeConfigStatus.Conditions)
+	if condition := meta.FindStatusCondition(obs.Status.SDINodeConfigStatus.Conditions, sdiv1alpha1.ConditionTypeConfigDrift); condition.Status != metav1.ConditionFalse {
+		t.Errorf("Expected no drift, got %v", condition)
+	}
+}
@@ -0,0 +1,267 @@
+package adjuster
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	sdiv1alpha1 "github.com/redhat-sap/sap-data-intelligence/observer-operator/api/v1alpha1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+// In DryRun mode, the writes of the adjusters go through the planningClient. Each write is sent to the
+// server with the server-side dry run, so that it is still validated, and recorded in the plan when it
+// would change the object.
+
+const (
+	PlannedActionCreate = "Create"
+	PlannedActionUpdate = "Update"
+	PlannedActionPatch  = "Patch"
+	PlannedActionDelete = "Delete"
+
+	// maxPlannedPatchLength limits the size of the patch of a planned change kept in the status.
+	maxPlannedPatchLength = 1024
+
+	// redacted replaces the sensitive values of planned patches.
+	redacted = "REDACTED"
+)
+
+// EnableDryRun makes the adjuster plan the changes instead of making them.
+func (a *Adjuster) EnableDryRun() {
+	if a.dryRun {
+		return
+	}
+	a.dryRun = true
+	a.Client = &planningClient{Client: a.Client, adjuster: a}
+}
+
+// DryRun tells whether the adjuster only plans the changes.
+func (a *Adjuster) DryRun() bool {
+	return a.dryRun
+}
+
+// Plan returns the changes planned by the last call to Adjust in DryRun mode.
+func (a *Adjuster) Plan() []sdiv1alpha1.PlannedChange {
+	return a.plan
+}
+
+func (a *Adjuster) planChange(action string, obj client.Object, patch []byte) {
+	change := sdiv1alpha1.PlannedChange{
+		Step:      a.step,
+		Action:    action,
+		Namespace: obj.GetNamespace(),
+		Name:      obj.GetName(),
+		Patch:     string(patch),
+	}
+	if gvk, err := apiutil.GVKForObject(obj, a.Scheme); err == nil {
+		change.Kind = gvk.Kind
+	}
+	change.Patch = redactPatch(change.Kind, change.Patch)
+	if len(change.Patch) > maxPlannedPatchLength {
+		change.Patch = change.Patch[:maxPlannedPatchLength] + "..."
+	}
+	a.logger.Info("Planned change", "action", action, "kind", change.Kind, "namespace", change.Namespace, "name", change.Name)
+	a.plan = append(a.plan, change)
+}
+
+// planningClient records the writes to the cluster in the plan of the adjuster instead of making them.
+type planningClient struct {
+	client.Client
+	adjuster *Adjuster
+}
+
+func (c *planningClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	if err := c.Client.Create(ctx, obj, append(opts, client.DryRunAll)...); err != nil {
+		return err
+	}
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+	c.adjuster.planChange(PlannedActionCreate, obj, data)
+	return nil
+}
+
+func (c *planningClient) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+	current, err := c.current(ctx, obj)
+	if err != nil {
+		return err
+	}
+	data, err := client.MergeFrom(current).Data(obj)
+	if err != nil {
+		return err
+	}
+	if isEmptyPatch(data) {
+		return nil
+	}
+	if err := c.Client.Update(ctx, obj, append(opts, client.DryRunAll)...); err != nil {
+		return err
+	}
+	c.adjuster.planChange(PlannedActionUpdate, obj, data)
+	return nil
+}
+
+func (c *planningClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	data, err := patch.Data(obj)
+	if err != nil {
+		return err
+	}
+	action := PlannedActionPatch
+	if patch.Type() == types.ApplyPatchType {
+		// Report only the applied fields that differ from the existing object.
+		var found bool
+		if data, found, err = c.applyPatch(ctx, obj); err != nil {
+			return err
+		}
+		if !found {
+			action = PlannedActionCreate
+		}
+	}
+	if isEmptyPatch(data) {
+		return nil
+	}
+	if err := c.Client.Patch(ctx, obj, patch, append(opts, client.DryRunAll)...); err != nil {
+		return err
+	}
+	c.adjuster.planChange(action, obj, data)
+	return nil
+}
+
+func (c *planningClient) Delete(ctx context.Context, obj client.Object, opts ...client.DeleteOption) error {
+	if err := c.Client.Delete(ctx, obj, append(opts, client.DryRunAll)...); err != nil {
+		return err
+	}
+	c.adjuster.planChange(PlannedActionDelete, obj, nil)
+	return nil
+}
+
+func (c *planningClient) DeleteAllOf(ctx context.Context, obj client.Object, opts ...client.DeleteAllOfOption) error {
+	if err := c.Client.DeleteAllOf(ctx, obj, append(opts, client.DryRunAll)...); err != nil {
+		return err
+	}
+	c.adjuster.planChange(PlannedActionDelete, obj, nil)
+	return nil
+}
+
+func (c *planningClient) Status() client.SubResourceWriter {
+	return c.SubResource("status")
+}
+
+func (c *planningClient) SubResource(subResource string) client.SubResourceClient {
+	return &planningSubResourceClient{SubResourceClient: c.Client.SubResource(subResource), adjuster: c.adjuster}
+}
+
+// current returns the object as it exists in the cluster, or an empty object of the same kind.
+func (c *planningClient) current(ctx context.Context, obj client.Object) (client.Object, error) {
+	current := obj.DeepCopyObject().(client.Object)
+	if err := c.Client.Get(ctx, client.ObjectKeyFromObject(obj), current); client.IgnoreNotFound(err) != nil {
+		return nil, err
+	}
+	return current, nil
+}
+
+// applyPatch returns the merge patch from the existing object to the applied one, limited to the fields
+// set in the applied object, and whether the object exists.
+func (c *planningClient) applyPatch(ctx context.Context, obj client.Object) ([]byte, bool, error) {
+	applied, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return nil, false, fmt.Errorf("unable to plan the apply of %T, only unstructured objects are supported", obj)
+	}
+	current := &unstructured.Unstructured{}
+	current.SetGroupVersionKind(applied.GroupVersionKind())
+	err := c.Client.Get(ctx, client.ObjectKeyFromObject(applied), current)
+	if client.IgnoreNotFound(err) != nil {
+		return nil, false, err
+	}
+	existing := &unstructured.Unstructured{Object: project(current.Object, applied.Object)}
+	data, patchErr := client.MergeFrom(existing).Data(applied)
+	return data, err == nil, patchErr
+}
+
+// project returns the fields of the object which are set in the template.
+func project(obj, template map[string]interface{}) map[string]interface{} {
+	projected := map[string]interface{}{}
+	for key, value := range template {
+		current, ok := obj[key]
+		if !ok {
+			continue
+		}
+		nested, isMap := value.(map[string]interface{})
+		currentNested, currentIsMap := current.(map[string]interface{})
+		if isMap && currentIsMap {
+			projected[key] = project(currentNested, nested)
+			continue
+		}
+		projected[key] = current
+	}
+	return projected
+}
+
+// redactPatch hides the private keys and the secret data from the patch, which ends up in the status and
+// in events.
+func redactPatch(kind, patch string) string {
+	var paths [][]string
+	switch kind {
+	case "Secret":
+		paths = [][]string{{"data"}, {"stringData"}}
+	case "Route":
+		paths = [][]string{{"spec", "tls", "key"}}
+	default:
+		return patch
+	}
+	var content map[string]interface{}
+	if err := json.Unmarshal([]byte(patch), &content); err != nil {
+		return patch
+	}
+	for _, path := range paths {
+		if _, found, _ := unstructured.NestedFieldNoCopy(content, path...); found {
+			_ = unstructured.SetNestedField(content, redacted, path...)
+		}
+	}
+	data, err := json.Marshal(content)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+func isEmptyPatch(data []byte) bool {
+	return string(data) == "{}" || len(data) == 0
+}
+
+// planningSubResourceClient records the writes to subresources in the plan of the adjuster.
+type planningSubResourceClient struct {
+	client.SubResourceClient
+	adjuster *Adjuster
+}
+
+func (c *planningSubResourceClient) Create(ctx context.Context, obj client.Object, subResource client.Object, opts ...client.SubResourceCreateOption) error {
+	if err := c.SubResourceClient.Create(ctx, obj, subResource, append(opts, client.DryRunAll)...); err != nil {
+		return err
+	}
+	c.adjuster.planChange(PlannedActionCreate, obj, nil)
+	return nil
+}
+
+func (c *planningSubResourceClient) Update(ctx context.Context, obj client.Object, opts ...client.SubResourceUpdateOption) error {
+	if err := c.SubResourceClient.Update(ctx, obj, append(opts, client.DryRunAll)...); err != nil {
+		return err
+	}
+	c.adjuster.planChange(PlannedActionUpdate, obj, nil)
+	return nil
+}
+
+func (c *planningSubResourceClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.SubResourcePatchOption) error {
+	data, err := patch.Data(obj)
+	if err != nil {
+		return err
+	}
+	if err := c.SubResourceClient.Patch(ctx, obj, patch, append(opts, client.DryRunAll)...); err != nil {
+		return err
+	}
+	c.adjuster.planChange(PlannedActionPatch, obj, data)
+	return nil
+}
@@ -0,0 +1,100 @@
+package adjuster
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr"
+	sdiv1alpha1 "github.com/redhat-sap/sap-data-intelligence/observer-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestDryRun(t *testing.T) {
+	scheme := newNodeConfiguratorScheme(t)
+	namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "sdi", Annotations: map[string]string{"a": "b"}}}
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "vsystem-vrep-0", Namespace: "sdi"}}
+	c := withServerSideApply(fake.NewClientBuilder().WithScheme(scheme).WithObjects(namespace, pod)).Build()
+	a := New("test-name", "operators", c, scheme, logr.Discard())
+	a.EnableDryRun()
+	ctx := context.Background()
+	obs := &sdiv1alpha1.SDIObserver{ObjectMeta: metav1.ObjectMeta{Name: "sdi", Namespace: "operators", UID: "sdi-uid"}}
+
+	err := a.Run(
+		Step{Name: StepSDINamespaces, Action: func() error {
+			// Unchanged objects are not planned.
+			ns := &corev1.Namespace{}
+			if err := a.Client.Get(ctx, client.ObjectKeyFromObject(namespace), ns); err != nil {
+				return err
+			}
+			if err := a.Client.Update(ctx, ns); err != nil {
+				return err
+			}
+			ns.Annotations[AnnotationKey] = "node-role.kubernetes.io/sdi="
+			if err := a.Client.Update(ctx, ns); err != nil {
+				return err
+			}
+			return a.Client.Delete(ctx, pod)
+		}},
+		Step{Name: StepSDINetwork, Action: func() error {
+			return a.ensureRole("sdi", "sdi-anyuid", anyuidRoleAsset, obs, ctx)
+		}},
+	)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	var planned []string
+	for _, change := range a.Plan() {
+		planned = append(planned, strings.Join([]string{change.Step, change.Action, change.Kind, change.Namespace, change.Name}, "|"))
+	}
+	expected := []string{
+		"SDI namespaces|Update|Namespace||sdi",
+		"SDI namespaces|Delete|Pod|sdi|vsystem-vrep-0",
+		"SDI network|Create|Role|sdi|sdi-anyuid",
+	}
+	if strings.Join(planned, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected plan %v, got %v", expected, planned)
+	}
+	if patch := a.Plan()[0].Patch; !strings.Contains(patch, AnnotationKey) {
+		t.Errorf("Expected the patch to hold the node selector, got %s", patch)
+	}
+
+	// Nothing is changed.
+	ns := &corev1.Namespace{}
+	if err := c.Get(ctx, client.ObjectKeyFromObject(namespace), ns); err != nil {
+		t.Fatalf("Failed to get namespace: %v", err)
+	}
+	if _, ok := ns.Annotations[AnnotationKey]; ok {
+		t.Error("Expected the namespace to be left alone")
+	}
+	if err := c.Get(ctx, client.ObjectKeyFromObject(pod), &corev1.Pod{}); err != nil {
+		t.Errorf("Expected the pod to be left alone, got %v", err)
+	}
+	if err := c.Get(ctx, client.ObjectKey{Name: "sdi-anyuid", Namespace: "sdi"}, &rbacv1.Role{}); !apierrors.IsNotFound(err) {
+		t.Errorf("Expected the role not to be created, got %v", err)
+	}
+}
+
+func TestRedactPatch(t *testing.T) {
+	for kind, patch := range map[string]string{
+		"Secret": `{"data":{"tls.key":"a2V5"},"metadata":{"name":"tls"}}`,
+		"Route":  `{"spec":{"host":"vsystem.example.com","tls":{"key":"key","termination":"edge"}}}`,
+	} {
+		got := redactPatch(kind, patch)
+		if strings.Contains(got, `"key":"key"`) || strings.Contains(got, "a2V5") {
+			t.Errorf("%s: expected the sensitive values to be redacted, got %s", kind, got)
+		}
+		if !strings.Contains(got, redacted) {
+			t.Errorf("%s: expected a redacted value, got %s", kind, got)
+		}
+	}
+	if patch := `{"data":{"key":"value"}}`; redactPatch("ConfigMap", patch) != patch {
+		t.Error("Expected the patch of a ConfigMap to be kept")
+	}
+}
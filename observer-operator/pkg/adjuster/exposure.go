@@ -0,0 +1,362 @@
+package adjuster
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	routev1 "github.com/openshift/api/route/v1"
+	sdiv1alpha1 "github.com/redhat-sap/sap-data-intelligence/observer-operator/api/v1alpha1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// A managed route is described by an OpenShift Route built from its manifest and its spec. An exposure
+// backend translates the route into the object exposing the service, so that the same routes can be
+// managed on clusters without OpenShift Routes.
+
+// Kinds of the objects exposing the services.
+var (
+	RouteGVK     = routev1.GroupVersion.WithKind("Route")
+	IngressGVK   = networkingv1.SchemeGroupVersion.WithKind("Ingress")
+	HTTPRouteGVK = schema.GroupVersionKind{Group: GatewayAPIGroup, Version: "v1", Kind: "HTTPRoute"}
+	TLSRouteGVK  = schema.GroupVersionKind{Group: GatewayAPIGroup, Version: "v1alpha2", Kind: "TLSRoute"}
+)
+
+// ingressTerminationAnnotationKey tells the OpenShift ingress controller the TLS termination of the route
+// it creates for an Ingress.
+const ingressTerminationAnnotationKey = "route.openshift.io/termination"
+
+// exposureBackend exposes the service of a managed route.
+type exposureBackend interface {
+	// gvk is the kind of the objects exposing the services.
+	gvk() schema.GroupVersionKind
+	// desired translates the route into the object exposing its service.
+	desired(route *routev1.Route, spec sdiv1alpha1.ManagedRouteSpec) (client.Object, error)
+	// drift describes how the existing object differs from the desired one.
+	drift(existing, desired client.Object) []string
+	// retain copies into the desired object the fields of the existing object set by others.
+	retain(existing, desired client.Object)
+}
+
+var exposureBackends = map[sdiv1alpha1.ExposureBackend]exposureBackend{
+	sdiv1alpha1.ExposureBackendRoute:     routeBackend{},
+	sdiv1alpha1.ExposureBackendIngress:   ingressBackend{},
+	sdiv1alpha1.ExposureBackendHTTPRoute: gatewayBackend{kind: HTTPRouteGVK, termination: routev1.TLSTerminationEdge},
+	sdiv1alpha1.ExposureBackendTLSRoute:  gatewayBackend{kind: TLSRouteGVK, termination: routev1.TLSTerminationPassthrough},
+}
+
+// selectExposureBackend returns the backend requested by the spec, or the one detected from the APIs served
+// by the cluster. An OpenShift Route is preferred, then a Gateway API route if a gateway is referenced and
+// matches the termination, then an Ingress.
+func (a *Adjuster) selectExposureBackend(spec sdiv1alpha1.ManagedRouteSpec, termination routev1.TLSTerminationType) (sdiv1alpha1.ExposureBackend, error) {
+	if spec.Backend != "" && spec.Backend != sdiv1alpha1.ExposureBackendAuto {
+		backend, ok := exposureBackends[spec.Backend]
+		if !ok {
+			return "", fmt.Errorf("unsupported exposure backend: %s", spec.Backend)
+		}
+		served, err := a.serves(backend.gvk())
+		if err != nil {
+			return "", err
+		}
+		if !served {
+			return "", fmt.Errorf("the cluster does not serve the %s API", backend.gvk().GroupVersion())
+		}
+		return spec.Backend, nil
+	}
+
+	candidates := []sdiv1alpha1.ExposureBackend{sdiv1alpha1.ExposureBackendRoute}
+	if spec.GatewayRef != nil {
+		for _, name := range []sdiv1alpha1.ExposureBackend{sdiv1alpha1.ExposureBackendHTTPRoute, sdiv1alpha1.ExposureBackendTLSRoute} {
+			if exposureBackends[name].(gatewayBackend).termination == termination {
+				candidates = append(candidates, name)
+			}
+		}
+	}
+	if ingressSupports(termination) {
+		candidates = append(candidates, sdiv1alpha1.ExposureBackendIngress)
+	}
+	for _, name := range candidates {
+		served, err := a.serves(exposureBackends[name].gvk())
+		if err != nil {
+			return "", err
+		}
+		if served {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("the cluster serves none of the APIs exposing services with %s termination", termination)
+}
+
+// serves tells whether the cluster serves the kind.
+func (a *Adjuster) serves(gvk schema.GroupVersionKind) (bool, error) {
+	if _, err := a.Client.RESTMapper().RESTMapping(gvk.GroupKind(), gvk.Version); err != nil {
+		if meta.IsNoMatchError(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("unable to determine whether %s is served: %w", gvk.Kind, err)
+	}
+	return true, nil
+}
+
+// newExposureObject returns an empty object of the kind, unstructured if the kind is not registered.
+func (a *Adjuster) newExposureObject(gvk schema.GroupVersionKind) client.Object {
+	if typed, err := a.Scheme.New(gvk); err == nil {
+		if obj, ok := typed.(client.Object); ok {
+			obj.GetObjectKind().SetGroupVersionKind(gvk)
+			return obj
+		}
+	}
+	u := &unstructured.Unstructured{}
+	u.SetGroupVersionKind(gvk)
+	return u
+}
+
+// newExposureList returns an empty list of objects of the kind, unstructured if the kind is not registered.
+func (a *Adjuster) newExposureList(gvk schema.GroupVersionKind) client.ObjectList {
+	listGVK := gvk.GroupVersion().WithKind(gvk.Kind + "List")
+	if typed, err := a.Scheme.New(listGVK); err == nil {
+		if list, ok := typed.(client.ObjectList); ok {
+			list.GetObjectKind().SetGroupVersionKind(listGVK)
+			return list
+		}
+	}
+	u := &unstructured.UnstructuredList{}
+	u.SetGroupVersionKind(listGVK)
+	return u
+}
+
+// removeExposures deletes the objects of the served backends other than keep which expose the route.
+// Unless force is true, only the objects created by the observer are deleted, e.g. after a change of the
+// backend.
+func (a *Adjuster) removeExposures(ctx context.Context, ns, name string, keep sdiv1alpha1.ExposureBackend, obs *sdiv1alpha1.SDIObserver, force bool) error {
+	for _, backend := range sortedKeys(exposureBackends) {
+		if backend == keep {
+			continue
+		}
+		gvk := exposureBackends[backend].gvk()
+		if served, err := a.serves(gvk); err != nil || !served {
+			continue
+		}
+		obj := a.newExposureObject(gvk)
+		if err := a.Client.Get(ctx, client.ObjectKey{Name: name, Namespace: ns}, obj); err != nil {
+			if errors.IsNotFound(err) {
+				continue
+			}
+			return fmt.Errorf("unable to get %s %s: %w", gvk.Kind, name, err)
+		}
+		if !force && !isOwnedBy(obj, obs) {
+			continue
+		}
+		// An object taken over by the operator is given back unless the route is removed.
+		if !force {
+			if restored, err := a.restoreOriginal(ctx, obj); err != nil || restored {
+				if err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		a.logger.Info(fmt.Sprintf("Deleting %s %s", gvk.Kind, name))
+		if err := a.Client.Delete(ctx, obj); client.IgnoreNotFound(err) != nil {
+			return fmt.Errorf("unable to delete %s %s: %w", gvk.Kind, name, err)
+		}
+	}
+	return nil
+}
+
+// routeBackend exposes the services with OpenShift Routes.
+type routeBackend struct{}
+
+func (routeBackend) gvk() schema.GroupVersionKind {
+	return RouteGVK
+}
+
+func (routeBackend) desired(route *routev1.Route, _ sdiv1alpha1.ManagedRouteSpec) (client.Object, error) {
+	return route, nil
+}
+
+func (routeBackend) drift(existing, desired client.Object) []string {
+	return routeDrift(existing.(*routev1.Route), desired.(*routev1.Route))
+}
+
+func (routeBackend) retain(existing, desired client.Object) {
+	retainRouteHost(existing, desired)
+}
+
+// ingressBackend exposes the services with Ingresses. Ingresses terminate the TLS connections at the
+// ingress controller, so only the edge termination is supported; it is passed to the OpenShift ingress
+// controller in an annotation, other ingress controllers are configured with the annotations of the spec.
+type ingressBackend struct{}
+
+// ingressSupports tells whether the Ingress backend can honor the termination.
+func ingressSupports(termination routev1.TLSTerminationType) bool {
+	return termination == routev1.TLSTerminationEdge
+}
+
+func (ingressBackend) gvk() schema.GroupVersionKind {
+	return IngressGVK
+}
+
+func (ingressBackend) desired(route *routev1.Route, spec sdiv1alpha1.ManagedRouteSpec) (client.Object, error) {
+	if !ingressSupports(route.Spec.TLS.Termination) {
+		return nil, fmt.Errorf("ingress %s cannot honor the %s termination; use the %s termination or the %s or %s backend",
+			route.Name, route.Spec.TLS.Termination, routev1.TLSTerminationEdge, sdiv1alpha1.ExposureBackendRoute, sdiv1alpha1.ExposureBackendTLSRoute)
+	}
+	if route.Spec.Port == nil {
+		return nil, fmt.Errorf("ingress %s needs the port of service %s", route.Name, route.Spec.To.Name)
+	}
+	port := networkingv1.ServiceBackendPort{Name: route.Spec.Port.TargetPort.StrVal}
+	if route.Spec.Port.TargetPort.Type == intstr.Int {
+		port = networkingv1.ServiceBackendPort{Number: route.Spec.Port.TargetPort.IntVal}
+	}
+	pathType := networkingv1.PathTypePrefix
+	host := exposedHost(route)
+
+	ingress := &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        route.Name,
+			Namespace:   route.Namespace,
+			Labels:      route.Labels,
+			Annotations: map[string]string{ingressTerminationAnnotationKey: string(route.Spec.TLS.Termination)},
+		},
+		Spec: networkingv1.IngressSpec{
+			Rules: []networkingv1.IngressRule{{
+				Host: host,
+				IngressRuleValue: networkingv1.IngressRuleValue{HTTP: &networkingv1.HTTPIngressRuleValue{
+					Paths: []networkingv1.HTTPIngressPath{{
+						Path:     "/",
+						PathType: &pathType,
+						Backend: networkingv1.IngressBackend{Service: &networkingv1.IngressServiceBackend{
+							Name: route.Spec.To.Name,
+							Port: port,
+						}},
+					}},
+				}},
+			}},
+		},
+	}
+	ingress.SetGroupVersionKind(IngressGVK)
+	for key, value := range route.Annotations {
+		ingress.Annotations[key] = value
+	}
+	if spec.IngressClassName != "" {
+		ingress.Spec.IngressClassName = &spec.IngressClassName
+	}
+	if spec.CertificateSecretRef != nil {
+		tls := networkingv1.IngressTLS{SecretName: spec.CertificateSecretRef.Name}
+		if host != "" {
+			tls.Hosts = []string{host}
+		}
+		ingress.Spec.TLS = []networkingv1.IngressTLS{tls}
+	}
+	return ingress, nil
+}
+
+func (ingressBackend) drift(existing, desired client.Object) []string {
+	e, d := existing.(*networkingv1.Ingress), desired.(*networkingv1.Ingress)
+	drift := labelsDrift(e.Labels, d.Labels)
+	drift = append(drift, annotationsDrift(e.Annotations, d.Annotations)...)
+	if d.Spec.IngressClassName != nil && (e.Spec.IngressClassName == nil || *e.Spec.IngressClassName != *d.Spec.IngressClassName) {
+		drift = append(drift, "ingressClassName differs")
+	}
+	if !equality.Semantic.DeepEqual(e.Spec.Rules, d.Spec.Rules) {
+		drift = append(drift, "rules differ")
+	}
+	if !equality.Semantic.DeepEqual(e.Spec.TLS, d.Spec.TLS) {
+		drift = append(drift, "tls differs")
+	}
+	return drift
+}
+
+func (ingressBackend) retain(client.Object, client.Object) {}
+
+// gatewayBackend exposes the services with Gateway API routes attached to the gateway of the spec. The
+// certificate of the edge termination is configured on the gateway.
+type gatewayBackend struct {
+	kind        schema.GroupVersionKind
+	termination routev1.TLSTerminationType
+}
+
+func (b gatewayBackend) gvk() schema.GroupVersionKind {
+	return b.kind
+}
+
+func (b gatewayBackend) desired(route *routev1.Route, spec sdiv1alpha1.ManagedRouteSpec) (client.Object, error) {
+	switch {
+	case spec.GatewayRef == nil:
+		return nil, fmt.Errorf("%s %s needs a gatewayRef", b.kind.Kind, route.Name)
+	case route.Spec.TLS.Termination != b.termination:
+		return nil, fmt.Errorf("%s %s supports the %s termination only", b.kind.Kind, route.Name, b.termination)
+	case spec.CertificateSecretRef != nil:
+		return nil, fmt.Errorf("the certificate of %s %s is configured on gateway %s", b.kind.Kind, route.Name, spec.GatewayRef.Name)
+	case route.Spec.Port == nil || route.Spec.Port.TargetPort.Type != intstr.Int:
+		return nil, fmt.Errorf("%s %s needs the port number of service %s", b.kind.Kind, route.Name, route.Spec.To.Name)
+	}
+
+	parentRef := map[string]interface{}{"name": spec.GatewayRef.Name}
+	if spec.GatewayRef.Namespace != "" {
+		parentRef["namespace"] = spec.GatewayRef.Namespace
+	}
+	if spec.GatewayRef.SectionName != "" {
+		parentRef["sectionName"] = spec.GatewayRef.SectionName
+	}
+	content := map[string]interface{}{
+		"parentRefs": []interface{}{parentRef},
+		"rules": []interface{}{map[string]interface{}{
+			"backendRefs": []interface{}{map[string]interface{}{
+				"name": route.Spec.To.Name,
+				"port": int64(route.Spec.Port.TargetPort.IntVal),
+			}},
+		}},
+	}
+	if host := exposedHost(route); host != "" {
+		content["hostnames"] = []interface{}{host}
+	}
+
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{"spec": content}}
+	obj.SetGroupVersionKind(b.kind)
+	obj.SetName(route.Name)
+	obj.SetNamespace(route.Namespace)
+	obj.SetLabels(route.Labels)
+	obj.SetAnnotations(route.Annotations)
+	return obj, nil
+}
+
+func (b gatewayBackend) drift(existing, desired client.Object) []string {
+	e, d := existing.(*unstructured.Unstructured), desired.(*unstructured.Unstructured)
+	drift := labelsDrift(e.GetLabels(), d.GetLabels())
+	drift = append(drift, annotationsDrift(e.GetAnnotations(), d.GetAnnotations())...)
+	for _, field := range []string{"parentRefs", "hostnames", "rules"} {
+		desiredValue, found, _ := unstructured.NestedFieldNoCopy(d.Object, "spec", field)
+		if !found {
+			continue
+		}
+		// The fields defaulted by the server are ignored.
+		existingValue, _, _ := unstructured.NestedFieldNoCopy(e.Object, "spec", field)
+		if !equality.Semantic.DeepDerivative(desiredValue, existingValue) {
+			drift = append(drift, fmt.Sprintf("%s differ", field))
+		}
+	}
+	return drift
+}
+
+func (gatewayBackend) retain(client.Object, client.Object) {}
+
+// exposedHost returns the host of the route, as a wildcard host for the Subdomain wildcard policy.
+func exposedHost(route *routev1.Route) string {
+	host := route.Spec.Host
+	if route.Spec.WildcardPolicy == routev1.WildcardPolicySubdomain {
+		if _, domain, ok := strings.Cut(host, "."); ok {
+			return "*." + domain
+		}
+	}
+	return host
+}
@@ -0,0 +1,172 @@
+package adjuster
+
+import (
+	"context"
+	"testing"
+
+	routev1 "github.com/openshift/api/route/v1"
+	sdiv1alpha1 "github.com/redhat-sap/sap-data-intelligence/observer-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestSelectExposureBackend(t *testing.T) {
+	gateway := &sdiv1alpha1.GatewayReference{Name: "sdi"}
+	all := []schema.GroupVersionKind{RouteGVK, IngressGVK, HTTPRouteGVK, TLSRouteGVK}
+	vanilla := []schema.GroupVersionKind{IngressGVK, HTTPRouteGVK, TLSRouteGVK}
+
+	for _, tt := range []struct {
+		name        string
+		served      []schema.GroupVersionKind
+		spec        sdiv1alpha1.ManagedRouteSpec
+		termination routev1.TLSTerminationType
+		expected    sdiv1alpha1.ExposureBackend
+	}{
+		{name: "openshift", served: all, spec: sdiv1alpha1.ManagedRouteSpec{GatewayRef: gateway}, termination: routev1.TLSTerminationEdge, expected: sdiv1alpha1.ExposureBackendRoute},
+		{name: "requested", served: all, spec: sdiv1alpha1.ManagedRouteSpec{Backend: sdiv1alpha1.ExposureBackendIngress}, expected: sdiv1alpha1.ExposureBackendIngress},
+		{name: "edge gateway", served: vanilla, spec: sdiv1alpha1.ManagedRouteSpec{GatewayRef: gateway}, termination: routev1.TLSTerminationEdge, expected: sdiv1alpha1.ExposureBackendHTTPRoute},
+		{name: "passthrough gateway", served: vanilla, spec: sdiv1alpha1.ManagedRouteSpec{GatewayRef: gateway}, termination: routev1.TLSTerminationPassthrough, expected: sdiv1alpha1.ExposureBackendTLSRoute},
+		{name: "reencrypt gateway", served: vanilla, spec: sdiv1alpha1.ManagedRouteSpec{GatewayRef: gateway}, termination: routev1.TLSTerminationReencrypt},
+		{name: "no gateway", served: vanilla, termination: routev1.TLSTerminationEdge, expected: sdiv1alpha1.ExposureBackendIngress},
+		{name: "passthrough without gateway", served: vanilla, termination: routev1.TLSTerminationPassthrough},
+		{name: "not served", served: vanilla, spec: sdiv1alpha1.ManagedRouteSpec{Backend: sdiv1alpha1.ExposureBackendRoute}},
+		{name: "nothing served"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newExposureTestAdjuster(t, tt.served)
+			backend, err := a.selectExposureBackend(tt.spec, tt.termination)
+			if tt.expected == "" {
+				if err == nil {
+					t.Errorf("Expected an error, got backend %s", backend)
+				}
+				return
+			}
+			if err != nil || backend != tt.expected {
+				t.Errorf("Expected backend %s, got %s (%v)", tt.expected, backend, err)
+			}
+		})
+	}
+}
+
+func TestAdjustRoutes_Ingress(t *testing.T) {
+	obs := &sdiv1alpha1.SDIObserver{
+		ObjectMeta: metav1.ObjectMeta{Name: "sdi", Namespace: "operators"},
+		Spec: sdiv1alpha1.SDIObserverSpec{
+			SDINamespace:  "sdi",
+			SLCBNamespace: "sap-slcbridge",
+			Routes: []sdiv1alpha1.RouteSpec{{
+				Name:    "openapi",
+				Service: "openapi-gateway",
+				Port:    &intstr.IntOrString{Type: intstr.String, StrVal: "https"},
+				ManagedRouteSpec: sdiv1alpha1.ManagedRouteSpec{
+					ManagementState:      sdiv1alpha1.RouteManagementStateManaged,
+					Host:                 "openapi.example.com",
+					Termination:          sdiv1alpha1.RouteTerminationEdge,
+					CertificateSecretRef: &corev1.LocalObjectReference{Name: "corporate-tls"},
+					IngressClassName:     "nginx",
+				},
+			}},
+		},
+	}
+	a := newExposureTestAdjuster(t, []schema.GroupVersionKind{IngressGVK})
+	ctx := context.Background()
+
+	if err := a.AdjustRoutes("sdi", obs, ctx); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	ingress := &networkingv1.Ingress{}
+	if err := a.Client.Get(ctx, client.ObjectKey{Name: "openapi", Namespace: "sdi"}, ingress); err != nil {
+		t.Fatalf("Failed to get ingress: %v", err)
+	}
+	rule := ingress.Spec.Rules[0]
+	backend := rule.HTTP.Paths[0].Backend.Service
+	if rule.Host != "openapi.example.com" || backend.Name != "openapi-gateway" || backend.Port.Name != "https" {
+		t.Errorf("Expected the ingress to expose the openapi gateway, got %v", ingress.Spec.Rules)
+	}
+	if len(ingress.Spec.TLS) != 1 || ingress.Spec.TLS[0].SecretName != "corporate-tls" || *ingress.Spec.IngressClassName != "nginx" {
+		t.Errorf("Expected the ingress to serve the custom certificate, got %v", ingress.Spec)
+	}
+	if ingress.Annotations[ingressTerminationAnnotationKey] != string(routev1.TLSTerminationEdge) {
+		t.Errorf("Expected the termination annotation, got %v", ingress.Annotations)
+	}
+	if obs.Status.Routes[0].Backend != sdiv1alpha1.ExposureBackendIngress {
+		t.Errorf("Expected the Ingress backend in the status, got %v", obs.Status.Routes[0])
+	}
+
+	rule.HTTP.Paths[0].Backend.Service.Name = "other"
+	if err := a.Client.Update(ctx, ingress); err != nil {
+		t.Fatalf("Failed to update ingress: %v", err)
+	}
+	if err := a.AdjustRoutes("sdi", obs, ctx); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	condition := meta.FindStatusCondition(obs.Status.Routes[0].Conditions, sdiv1alpha1.ConditionTypeConfigDrift)
+	if condition == nil || condition.Status != metav1.ConditionTrue {
+		t.Errorf("Expected the drifted rules to be reported, got %v", condition)
+	}
+
+	// The destination CA of a reencrypt route cannot be passed to an Ingress.
+	obs.Spec.Routes[0].Termination = sdiv1alpha1.RouteTerminationReencrypt
+	obs.Spec.Routes[0].Backend = sdiv1alpha1.ExposureBackendIngress
+	if err := a.AdjustRoutes("sdi", obs, ctx); err == nil {
+		t.Errorf("Expected an error for the reencrypt termination")
+	}
+}
+
+func TestAdjustRoutes_HTTPRoute(t *testing.T) {
+	owned := &routev1.Route{ObjectMeta: metav1.ObjectMeta{
+		Name:        "openapi",
+		Namespace:   "sdi",
+		Annotations: map[string]string{OwnerAnnotationKey: "operators/sdi"},
+	}}
+	obs := &sdiv1alpha1.SDIObserver{
+		ObjectMeta: metav1.ObjectMeta{Name: "sdi", Namespace: "operators"},
+		Spec: sdiv1alpha1.SDIObserverSpec{
+			SDINamespace:  "sdi",
+			SLCBNamespace: "sap-slcbridge",
+			Routes: []sdiv1alpha1.RouteSpec{{
+				Name:    "openapi",
+				Service: "openapi-gateway",
+				Port:    &intstr.IntOrString{Type: intstr.Int, IntVal: 8080},
+				ManagedRouteSpec: sdiv1alpha1.ManagedRouteSpec{
+					ManagementState: sdiv1alpha1.RouteManagementStateManaged,
+					Backend:         sdiv1alpha1.ExposureBackendHTTPRoute,
+					Host:            "openapi.example.com",
+					Termination:     sdiv1alpha1.RouteTerminationEdge,
+					GatewayRef:      &sdiv1alpha1.GatewayReference{Name: "public", Namespace: "gateways"},
+				},
+			}},
+		},
+	}
+	a := newExposureTestAdjuster(t, []schema.GroupVersionKind{RouteGVK, HTTPRouteGVK}, owned)
+	ctx := context.Background()
+
+	if err := a.AdjustRoutes("sdi", obs, ctx); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	httpRoute := &unstructured.Unstructured{}
+	httpRoute.SetGroupVersionKind(HTTPRouteGVK)
+	if err := a.Client.Get(ctx, client.ObjectKey{Name: "openapi", Namespace: "sdi"}, httpRoute); err != nil {
+		t.Fatalf("Failed to get HTTPRoute: %v", err)
+	}
+	parentRefs, _, _ := unstructured.NestedSlice(httpRoute.Object, "spec", "parentRefs")
+	hostnames, _, _ := unstructured.NestedStringSlice(httpRoute.Object, "spec", "hostnames")
+	if len(parentRefs) != 1 || parentRefs[0].(map[string]interface{})["namespace"] != "gateways" || hostnames[0] != "openapi.example.com" {
+		t.Errorf("Expected the HTTPRoute to attach to the gateway, got %v", httpRoute.Object["spec"])
+	}
+	if err := a.Client.Get(ctx, client.ObjectKeyFromObject(owned), &routev1.Route{}); err == nil {
+		t.Error("Expected the route of the previous backend to be removed")
+	}
+
+	// A certificate cannot be served by a Gateway API route.
+	obs.Spec.Routes[0].CertificateSecretRef = &corev1.LocalObjectReference{Name: "corporate-tls"}
+	if err := a.AdjustRoutes("sdi", obs, ctx); err == nil {
+		t.Error("Expected an error for the certificate of an HTTPRoute")
+	}
+}
@@ -0,0 +1,195 @@
+package adjuster
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	sdiv1alpha1 "github.com/redhat-sap/sap-data-intelligence/observer-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	fluentdParseTypeJSON        = "json"
+	fluentdParseTypeRegexp      = "regexp"
+	fluentdParseTypeMultiFormat = "multi_format"
+
+	fluentdTextExpression = `/^(?<time>.+) (?<stream>stdout|stderr)( (?<logtag>.))? (?<log>.*)$/`
+	fluentdTextTimeFormat = `'%Y-%m-%dT%H:%M:%S.%N%:z'`
+	fluentdJSONTimeFormat = `'%Y-%m-%dT%H:%M:%S.%NZ'`
+)
+
+var (
+	fluentdParseTypeRe      = regexp.MustCompile(`^(\s*)@type(\s.*)?$`)
+	fluentdTimeFormatRe     = regexp.MustCompile(`^(\s*)time_format(\s.*)?$`)
+	fluentdLogtagExprRe     = regexp.MustCompile(`^\s+expression\s+/\^.*logtag`)
+	fluentdParseTypeValueRe = regexp.MustCompile(`^\s+@type\s*(\S+)`)
+)
+
+// AdjustSDIDiagnosticsFluentdConfig makes the diagnostics fluentd pods parse the log format used on the
+// nodes. Initially, SDI fluentd pods are configured to parse json while OpenShift 4 nodes log in text
+// format. The fluentd pods are restarted once the configuration is patched.
+func (a *Adjuster) AdjustSDIDiagnosticsFluentdConfig(ns string, obs *sdiv1alpha1.SDIObserver, ctx context.Context) error {
+	if ns == "" {
+		return fmt.Errorf("namespace cannot be empty")
+	}
+	if obs == nil {
+		return fmt.Errorf("SDIObserver cannot be nil")
+	}
+
+	cm := &corev1.ConfigMap{}
+	if err := a.Client.Get(ctx, client.ObjectKey{Name: DiagnosticFluentdSettingsName, Namespace: ns}, cm); err != nil {
+		return err
+	}
+
+	contents, ok := cm.Data[FluentdConfigKey]
+	if !ok || contents == "" {
+		return fmt.Errorf("failed to get contents of %s configuration file from configmap %s", FluentdConfigKey, DiagnosticFluentdSettingsName)
+	}
+
+	currentParseType := getFluentdParseType(contents)
+	if currentParseType == "" {
+		return fmt.Errorf("failed to determine the current log type parsing of fluentd pods")
+	}
+
+	format, err := a.resolveNodeLogFormat(obs, ctx)
+	if err != nil {
+		return err
+	}
+
+	if isFluentdParseTypeUpToDate(currentParseType, format) {
+		a.logger.Info(fmt.Sprintf("Fluentd pods are already configured to parse %s logs (%s), not patching", format, currentParseType))
+		return nil
+	}
+
+	a.logger.Info(fmt.Sprintf("Patching configmap %s to support %s logging format", DiagnosticFluentdSettingsName, format))
+	cm.Data[FluentdConfigKey] = patchFluentdParse(contents, format)
+	if err := a.Client.Update(ctx, cm); err != nil {
+		return fmt.Errorf("unable to update configmap %s: %w", DiagnosticFluentdSettingsName, err)
+	}
+
+	return a.restartFluentdPods(ns, ctx)
+}
+
+// resolveNodeLogFormat returns either json or text. In auto mode, json is chosen only if any of the SDI
+// nodes runs docker; CRI-O logs in text format.
+func (a *Adjuster) resolveNodeLogFormat(obs *sdiv1alpha1.SDIObserver, ctx context.Context) (sdiv1alpha1.NodeLogFormat, error) {
+	switch obs.Spec.NodeLogFormat {
+	case sdiv1alpha1.NodeLogFormatJSON, sdiv1alpha1.NodeLogFormatText:
+		return obs.Spec.NodeLogFormat, nil
+	case "", sdiv1alpha1.NodeLogFormatAuto:
+	default:
+		return "", fmt.Errorf("unsupported node log format: %s", obs.Spec.NodeLogFormat)
+	}
+
+	selector := labels.Everything()
+	if obs.Spec.SDINodeLabel != "" {
+		parsed, err := labels.Parse(obs.Spec.SDINodeLabel)
+		if err != nil {
+			return "", fmt.Errorf("unable to parse SDI node label %q: %w", obs.Spec.SDINodeLabel, err)
+		}
+		selector = parsed
+	}
+
+	nodes := &corev1.NodeList{}
+	if err := a.Client.List(ctx, nodes, client.MatchingLabelsSelector{Selector: selector}); err != nil {
+		return "", fmt.Errorf("unable to list nodes: %w", err)
+	}
+	for i := range nodes.Items {
+		if strings.HasPrefix(nodes.Items[i].Status.NodeInfo.ContainerRuntimeVersion, "docker://") {
+			return sdiv1alpha1.NodeLogFormatJSON, nil
+		}
+	}
+	return sdiv1alpha1.NodeLogFormatText, nil
+}
+
+func (a *Adjuster) restartFluentdPods(ns string, ctx context.Context) error {
+	pods := &corev1.PodList{}
+	if err := a.Client.List(ctx, pods, client.InNamespace(ns), client.MatchingLabels{AppComponentLabel: FluentdAppComponent}); err != nil {
+		return fmt.Errorf("unable to list fluentd pods: %w", err)
+	}
+	if len(pods.Items) == 0 {
+		return nil
+	}
+
+	a.logger.Info("Restarting fluentd pods")
+	for i := range pods.Items {
+		if err := a.Client.Delete(ctx, &pods.Items[i], client.GracePeriodSeconds(0)); client.IgnoreNotFound(err) != nil {
+			return fmt.Errorf("unable to delete fluentd pod %s: %w", pods.Items[i].Name, err)
+		}
+	}
+	return nil
+}
+
+// isFluentdParseTypeUpToDate tells whether the parse type can handle the node log format. The
+// multi_format type supports both json and text.
+func isFluentdParseTypeUpToDate(parseType string, format sdiv1alpha1.NodeLogFormat) bool {
+	switch parseType {
+	case fluentdParseTypeMultiFormat:
+		return true
+	case fluentdParseTypeJSON:
+		return format == sdiv1alpha1.NodeLogFormatJSON
+	case fluentdParseTypeRegexp:
+		return format == sdiv1alpha1.NodeLogFormatText
+	}
+	return false
+}
+
+// getFluentdParseType returns the @type of the first <parse> section in the fluentd configuration.
+func getFluentdParseType(contents string) string {
+	inParse := false
+	for _, line := range strings.Split(contents, "\n") {
+		switch {
+		case strings.Contains(line, "<parse>"):
+			inParse = true
+		case strings.Contains(line, "</parse>"):
+			inParse = false
+		case inParse:
+			if m := fluentdParseTypeValueRe.FindStringSubmatch(line); m != nil {
+				return m[1]
+			}
+		}
+	}
+	return ""
+}
+
+// patchFluentdParse rewrites all the <parse> sections of the fluentd configuration to parse the given
+// node log format.
+func patchFluentdParse(contents string, format sdiv1alpha1.NodeLogFormat) string {
+	lines := strings.Split(contents, "\n")
+	result := make([]string, 0, len(lines)+1)
+	inParse := false
+	for _, line := range lines {
+		if fluentdLogtagExprRe.MatchString(line) {
+			continue
+		}
+		if strings.Contains(line, "<parse>") {
+			inParse = true
+		}
+		if inParse {
+			if m := fluentdParseTypeRe.FindStringSubmatch(line); m != nil {
+				if format == sdiv1alpha1.NodeLogFormatText {
+					result = append(result, m[1]+"@type "+fluentdParseTypeRegexp, m[1]+"expression "+fluentdTextExpression)
+				} else {
+					result = append(result, m[1]+"@type "+fluentdParseTypeJSON)
+				}
+				continue
+			}
+			if m := fluentdTimeFormatRe.FindStringSubmatch(line); m != nil {
+				if format == sdiv1alpha1.NodeLogFormatText {
+					line = m[1] + "time_format " + fluentdTextTimeFormat
+				} else {
+					line = m[1] + "time_format " + fluentdJSONTimeFormat
+				}
+			}
+		}
+		if strings.Contains(line, "</parse>") {
+			inParse = false
+		}
+		result = append(result, line)
+	}
+	return strings.Join(result, "\n")
+}
@@ -0,0 +1,102 @@
+package adjuster
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr"
+	sdiv1alpha1 "github.com/redhat-sap/sap-data-intelligence/observer-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+const testFluentdJSONConfig = `<source>
+  @type tail
+  path /var/log/containers/*.log
+  <parse>
+    @type json
+    time_format '%Y-%m-%dT%H:%M:%S.%NZ'
+  </parse>
+</source>`
+
+func TestGetFluentdParseType(t *testing.T) {
+	tests := map[string]string{
+		testFluentdJSONConfig: fluentdParseTypeJSON,
+		patchFluentdParse(testFluentdJSONConfig, sdiv1alpha1.NodeLogFormatText): fluentdParseTypeRegexp,
+		"<parse>\n  @type multi_format\n</parse>":                               fluentdParseTypeMultiFormat,
+		"<source>\n  @type tail\n</source>":                                     "",
+	}
+	for contents, expected := range tests {
+		if got := getFluentdParseType(contents); got != expected {
+			t.Errorf("Expected parse type %q, got %q for:\n%s", expected, got, contents)
+		}
+	}
+}
+
+func TestPatchFluentdParse(t *testing.T) {
+	text := patchFluentdParse(testFluentdJSONConfig, sdiv1alpha1.NodeLogFormatText)
+	if !strings.Contains(text, "    @type regexp\n    expression "+fluentdTextExpression+"\n") {
+		t.Errorf("Expected regexp parse section, got:\n%s", text)
+	}
+	if !strings.Contains(text, "time_format "+fluentdTextTimeFormat) {
+		t.Errorf("Expected text time format, got:\n%s", text)
+	}
+	if !strings.Contains(text, "  @type tail\n") {
+		t.Errorf("Expected @type outside of the parse section to be kept, got:\n%s", text)
+	}
+
+	// Switching back to json must drop the logtag expression again.
+	if json := patchFluentdParse(text, sdiv1alpha1.NodeLogFormatJSON); json != testFluentdJSONConfig {
+		t.Errorf("Expected original json configuration, got:\n%s", json)
+	}
+}
+
+func TestAdjustSDIDiagnosticsFluentdConfig(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := corev1.AddToScheme(scheme); err != nil {
+		t.Fatalf("Failed to add scheme: %v", err)
+	}
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: DiagnosticFluentdSettingsName, Namespace: "sdi"},
+		Data:       map[string]string{FluentdConfigKey: testFluentdJSONConfig},
+	}
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+		Name:      "diagnostics-fluentd-abcde",
+		Namespace: "sdi",
+		Labels:    map[string]string{AppComponentLabel: FluentdAppComponent},
+	}}
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "worker-0", Labels: map[string]string{"node-role.kubernetes.io/sdi": ""}},
+		Status:     corev1.NodeStatus{NodeInfo: corev1.NodeSystemInfo{ContainerRuntimeVersion: "cri-o://1.27.1"}},
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(cm, pod, node).Build()
+	a := New("test-name", "test-namespace", c, scheme, logr.Discard())
+	obs := &sdiv1alpha1.SDIObserver{Spec: sdiv1alpha1.SDIObserverSpec{
+		SDINodeLabel:  "node-role.kubernetes.io/sdi=",
+		NodeLogFormat: sdiv1alpha1.NodeLogFormatAuto,
+	}}
+	ctx := context.Background()
+
+	if err := a.AdjustSDIDiagnosticsFluentdConfig("sdi", obs, ctx); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	got := &corev1.ConfigMap{}
+	if err := c.Get(ctx, client.ObjectKeyFromObject(cm), got); err != nil {
+		t.Fatalf("Failed to get configmap: %v", err)
+	}
+	if parseType := getFluentdParseType(got.Data[FluentdConfigKey]); parseType != fluentdParseTypeRegexp {
+		t.Errorf("Expected parse type %q, got %q", fluentdParseTypeRegexp, parseType)
+	}
+	pods := &corev1.PodList{}
+	if err := c.List(ctx, pods, client.InNamespace("sdi")); err != nil {
+		t.Fatalf("Failed to list pods: %v", err)
+	}
+	if len(pods.Items) != 0 {
+		t.Errorf("Expected fluentd pods to be restarted, got %d pods", len(pods.Items))
+	}
+}
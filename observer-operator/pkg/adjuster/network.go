@@ -9,149 +9,374 @@ import (
 	sdiv1alpha1 "github.com/redhat-sap/sap-data-intelligence/observer-operator/api/v1alpha1"
 	"github.com/redhat-sap/sap-data-intelligence/observer-operator/assets"
 	corev1 "k8s.io/api/core/v1"
-	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/intstr"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 const (
 	// These are configuration file names, not actual credentials
-	vsystemCaBundleSecretName = "ca-bundle.pem" // #nosec G101
+	vsystemCaBundleSecretName = VSystemCABundleSecretName
 	vsystemCaBundleSecretKey  = "ca-bundle.pem" // #nosec G101
+	// routeCACertificateKey holds the CA certificate of a custom route certificate
+	routeCACertificateKey = "ca.crt"
 )
 
-// AdjustRoute manages the route based on its management state.
-func (a *Adjuster) AdjustRoute(ns, name string, managementState sdiv1alpha1.RouteManagementState, routeFile, svcName string, obs *sdiv1alpha1.SDIObserver, ctx context.Context, handleCA bool) error {
-	route := &routev1.Route{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      name,
-			Namespace: ns,
-		},
+// managedRoute describes a route managed by the observer: one of the presets or one of the additional
+// routes of the spec.
+type managedRoute struct {
+	name      string
+	namespace string
+	// manifest is the asset the route is built from.
+	manifest string
+	// service and port override the target of the manifest if set.
+	service string
+	port    *intstr.IntOrString
+	spec    sdiv1alpha1.ManagedRouteSpec
+	// destinationCA makes a reencrypt route verify its service with the CA bundle of SDI in sdiNamespace.
+	destinationCA bool
+	sdiNamespace  string
+	status        *sdiv1alpha1.ManagedRouteStatus
+}
+
+// vsystemRoute returns the preset route of the vsystem service.
+func vsystemRoute(obs *sdiv1alpha1.SDIObserver) managedRoute {
+	return managedRoute{
+		name:          VSystemRouteName,
+		namespace:     obs.Spec.SDINamespace,
+		manifest:      "manifests/route-management/route-vsystem.yaml",
+		spec:          obs.Spec.SDIVSystemRoute,
+		destinationCA: true,
+		sdiNamespace:  obs.Spec.SDINamespace,
+		status:        &obs.Status.VSystemRouteStatus,
+	}
+}
+
+// slcbRoute returns the preset route of the SLC Bridge service.
+func slcbRoute(obs *sdiv1alpha1.SDIObserver) managedRoute {
+	return managedRoute{
+		name:      SLCBRouteName,
+		namespace: obs.Spec.SLCBNamespace,
+		manifest:  "manifests/route-management/route-sap-slcbridge.yaml",
+		spec:      obs.Spec.SLCBRoute,
+		status:    &obs.Status.SLCBRouteStatus,
+	}
+}
+
+// additionalRoute returns the route of an entry of spec.routes.
+func additionalRoute(obs *sdiv1alpha1.SDIObserver, spec sdiv1alpha1.RouteSpec, status *sdiv1alpha1.ManagedRouteStatus) managedRoute {
+	return managedRoute{
+		name:          spec.Name,
+		namespace:     RouteNamespace(obs, spec),
+		manifest:      "manifests/route-management/route.yaml",
+		service:       spec.Service,
+		port:          spec.Port,
+		spec:          spec.ManagedRouteSpec,
+		destinationCA: spec.DestinationCA != sdiv1alpha1.RouteDestinationCANone,
+		sdiNamespace:  obs.Spec.SDINamespace,
+		status:        status,
+	}
+}
+
+// RouteNamespace returns the namespace of an additional route, defaulting to the SDI namespace.
+func RouteNamespace(obs *sdiv1alpha1.SDIObserver, spec sdiv1alpha1.RouteSpec) string {
+	if spec.Namespace == "" {
+		return obs.Spec.SDINamespace
+	}
+	return spec.Namespace
+}
+
+// adjustRoute manages the route based on its management state. The drift corrected on a managed route is
+// reported in the ConfigDrift condition of its status.
+func (a *Adjuster) adjustRoute(r managedRoute, obs *sdiv1alpha1.SDIObserver, ctx context.Context) error {
+	if r.spec.ManagementState != sdiv1alpha1.RouteManagementStateManaged {
+		meta.RemoveStatusCondition(&r.status.Conditions, sdiv1alpha1.ConditionTypeConfigDrift)
+		meta.RemoveStatusCondition(&r.status.Conditions, sdiv1alpha1.ConditionTypeCertificateIssued)
+		r.status.ACME = nil
 	}
 
-	switch managementState {
+	switch r.spec.ManagementState {
 	case sdiv1alpha1.RouteManagementStateManaged:
-		return a.handleManagedRoute(ns, name, routeFile, svcName, route, obs, ctx, handleCA)
+		return a.handleManagedRoute(r, obs, ctx)
 	case sdiv1alpha1.RouteManagementStateUnmanaged:
-		a.logger.Info("Route is unmanaged; no action needed.")
-		return nil
+		a.logger.Info(fmt.Sprintf("Route %s is unmanaged; no action needed.", r.name))
+		return Skip(sdiv1alpha1.ReasonRouteUnmanaged, fmt.Sprintf("Route %s is unmanaged", r.name))
 	case sdiv1alpha1.RouteManagementStateRemoved:
-		return a.handleRemovedRoute(ns, name, route, obs, ctx)
+		return a.handleRemovedRoute(r, obs, ctx)
 	default:
-		return fmt.Errorf("unsupported Route Management State: %s", managementState)
+		return fmt.Errorf("unsupported Route Management State: %s", r.spec.ManagementState)
 	}
 }
 
-func (a *Adjuster) handleManagedRoute(ns, name, routeFile, svcName string, route *routev1.Route, _ *sdiv1alpha1.SDIObserver, ctx context.Context, handleCA bool) error {
-	create := false
-	err := a.Client.Get(ctx, client.ObjectKey{Name: name, Namespace: ns}, route)
+// handleManagedRoute applies the route of the manifest customized by the spec with its exposure backend and
+// reports the drift of the existing object. The objects of the route created with another backend are
+// removed. The certificate of a route with ACME is issued before the route is applied.
+func (a *Adjuster) handleManagedRoute(r managedRoute, obs *sdiv1alpha1.SDIObserver, ctx context.Context) error {
+	route, err := assets.LoadAs[*routev1.Route](r.manifest)
+	if err != nil {
+		return err
+	}
+	route.Namespace = r.namespace
+	route.Name = r.name
+	if r.service != "" {
+		route.Spec.To.Name = r.service
+	}
+	if r.port != nil {
+		route.Spec.Port = &routev1.RoutePort{TargetPort: *r.port}
+	}
 
-	switch {
-	case err != nil && errors.IsNotFound(err):
-		create = true
-		route = assets.GetRouteFromFile(routeFile)
-		route.Namespace = ns
-		route.Name = name
-		if handleCA {
-			if err := a.setRouteCAForNewRoute(ctx, ns, svcName, route); err != nil {
-				return err
-			}
-		}
-	case err != nil:
+	if err := a.customizeRoute(ctx, route, r.spec); err != nil {
+		return err
+	}
+	name, err := a.selectExposureBackend(r.spec, route.Spec.TLS.Termination)
+	if err != nil {
+		return fmt.Errorf("unable to expose route %s: %w", r.name, err)
+	}
+	r.status.Backend = name
+	backend := exposureBackends[name]
+	if err := validateACME(r, route.Spec.TLS.Termination, name); err != nil {
 		return err
-	case handleCA:
-		return a.updateExistingRouteCA(ctx, ns, name, route)
 	}
+	// A failed issuance does not prevent the route from being exposed with its current certificate.
+	issueErr := a.adjustACMECertificate(ctx, obs, r, route)
 
-	if create {
-		err = a.Client.Create(ctx, route)
-	} else {
-		if name == "sap-slcbridge" && route.Spec.To.Name == "slcbridgebase-service" {
-			a.logger.Info("SLCB route configuration is already correct. No action needed.")
-			return nil
+	// Only reencrypt routes may have a destination CA certificate.
+	route.Spec.TLS.DestinationCACertificate = ""
+	if name == sdiv1alpha1.ExposureBackendRoute && r.destinationCA && route.Spec.TLS.Termination == routev1.TLSTerminationReencrypt {
+		if err := a.setRouteCA(ctx, r.sdiNamespace, route); err != nil {
+			return err
 		}
-		err = a.Client.Update(ctx, route)
 	}
-
+	desired, err := backend.desired(route, r.spec)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	defer a.setDriftCondition(&r.status.Conditions)
+	if err := a.ensureResource(ctx, obs, managedResource{
+		desired:  desired,
+		existing: a.newExposureObject(backend.gvk()),
+		drift: func(existing, desired client.Object) ([]string, error) {
+			return backend.drift(existing, desired), nil
+		},
+		retain:   backend.retain,
+		preserve: true,
+	}); err != nil {
+		return err
+	}
+	if err := a.removeExposures(ctx, r.namespace, r.name, name, obs, false); err != nil {
+		return err
+	}
+	return issueErr
 }
 
-// setRouteCAForNewRoute sets the CA certificate for a new route
-func (a *Adjuster) setRouteCAForNewRoute(ctx context.Context, ns, svcName string, route *routev1.Route) error {
-	svc := &corev1.Service{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      svcName,
-			Namespace: ns,
-		},
+// retainRouteHost keeps the host generated by the router unless a host is desired.
+func retainRouteHost(existing, desired client.Object) {
+	if d := desired.(*routev1.Route); d.Spec.Host == "" {
+		d.Spec.Host = existing.(*routev1.Route).Spec.Host
 	}
+}
 
-	if err := a.Client.Get(ctx, types.NamespacedName{Namespace: ns, Name: svcName}, svc); err != nil && !errors.IsNotFound(err) {
-		return err
+// routeDrift returns the differences of the existing route from the desired one. Only the fields set in the
+// desired route are compared, the others are defaulted by the server or left to others.
+func routeDrift(existing, desired *routev1.Route) []string {
+	drift := labelsDrift(existing.Labels, desired.Labels)
+	drift = append(drift, annotationsDrift(existing.Annotations, desired.Annotations)...)
+	if desired.Spec.Host != "" && existing.Spec.Host != desired.Spec.Host {
+		drift = append(drift, "host differs")
+	}
+	if existing.Spec.To.Kind != desired.Spec.To.Kind || existing.Spec.To.Name != desired.Spec.To.Name {
+		drift = append(drift, "target service differs")
+	}
+	if desired.Spec.Port != nil && (existing.Spec.Port == nil || existing.Spec.Port.TargetPort != desired.Spec.Port.TargetPort) {
+		drift = append(drift, "target port differs")
+	}
+	if desired.Spec.WildcardPolicy != "" && existing.Spec.WildcardPolicy != desired.Spec.WildcardPolicy {
+		drift = append(drift, "wildcardPolicy differs")
 	}
 
-	caBundleSecret := &corev1.Secret{}
-	if err := a.Client.Get(ctx, types.NamespacedName{Namespace: ns, Name: vsystemCaBundleSecretName}, caBundleSecret); err != nil {
-		return err
+	if desired.Spec.TLS == nil {
+		return drift
 	}
+	if existing.Spec.TLS == nil {
+		return append(drift, "tls is missing")
+	}
+	e, d := existing.Spec.TLS, desired.Spec.TLS
+	for _, field := range []struct {
+		name              string
+		existing, desired string
+	}{
+		{"termination", string(e.Termination), string(d.Termination)},
+		{"insecureEdgeTerminationPolicy", string(e.InsecureEdgeTerminationPolicy), string(d.InsecureEdgeTerminationPolicy)},
+		{"certificate", e.Certificate, d.Certificate},
+		{"key", e.Key, d.Key},
+		{"caCertificate", e.CACertificate, d.CACertificate},
+		{"destinationCACertificate", e.DestinationCACertificate, d.DestinationCACertificate},
+	} {
+		if strings.TrimSpace(field.existing) != strings.TrimSpace(field.desired) {
+			drift = append(drift, fmt.Sprintf("tls %s differs", field.name))
+		}
+	}
+	return drift
+}
 
-	caBundle, err := getCertFromCaBundleSecret(caBundleSecret)
-	if err != nil {
-		return err
+// customizeRoute sets the host, TLS termination, certificate, annotations and wildcard policy of the spec
+// on the route.
+func (a *Adjuster) customizeRoute(ctx context.Context, route *routev1.Route, spec sdiv1alpha1.ManagedRouteSpec) error {
+	route.Spec.Host = spec.Host
+	if spec.Termination != "" {
+		route.Spec.TLS.Termination = routev1.TLSTerminationType(spec.Termination)
 	}
-	route.Spec.TLS.DestinationCACertificate = caBundle
+	if spec.WildcardPolicy != "" {
+		route.Spec.WildcardPolicy = routev1.WildcardPolicyType(spec.WildcardPolicy)
+	}
+	if route.Spec.WildcardPolicy == routev1.WildcardPolicySubdomain && route.Spec.Host == "" {
+		return fmt.Errorf("route %s with the %s wildcard policy needs a host", route.Name, routev1.WildcardPolicySubdomain)
+	}
+	for key, value := range spec.Annotations {
+		if route.Annotations == nil {
+			route.Annotations = map[string]string{}
+		}
+		route.Annotations[key] = value
+	}
+
+	if spec.CertificateSecretRef == nil {
+		return nil
+	}
+	if route.Spec.TLS.Termination == routev1.TLSTerminationPassthrough {
+		return fmt.Errorf("route %s with the %s termination cannot serve the certificate of secret %s",
+			route.Name, routev1.TLSTerminationPassthrough, spec.CertificateSecretRef.Name)
+	}
+	secret := &corev1.Secret{}
+	if err := a.Client.Get(ctx, types.NamespacedName{Namespace: route.Namespace, Name: spec.CertificateSecretRef.Name}, secret); err != nil {
+		return fmt.Errorf("unable to get certificate secret of route %s: %w", route.Name, err)
+	}
+	certificate, key := secret.Data[corev1.TLSCertKey], secret.Data[corev1.TLSPrivateKeyKey]
+	if len(certificate) == 0 || len(key) == 0 {
+		return fmt.Errorf("secret %s must hold the %s and %s keys", secret.Name, corev1.TLSCertKey, corev1.TLSPrivateKeyKey)
+	}
+	setRouteCertificate(route, secret)
 	return nil
 }
 
-// updateExistingRouteCA updates the CA certificate for an existing route
-func (a *Adjuster) updateExistingRouteCA(ctx context.Context, ns, name string, route *routev1.Route) error {
+// setRouteCA sets the CA bundle of SDI in the namespace as the destination CA certificate of the route.
+func (a *Adjuster) setRouteCA(ctx context.Context, ns string, route *routev1.Route) error {
 	caBundleSecret := &corev1.Secret{}
 	if err := a.Client.Get(ctx, types.NamespacedName{Namespace: ns, Name: vsystemCaBundleSecretName}, caBundleSecret); err != nil {
-		return err
+		return fmt.Errorf("unable to get CA bundle of service %s: %w", route.Spec.To.Name, err)
 	}
 
 	caBundle, err := getCertFromCaBundleSecret(caBundleSecret)
 	if err != nil {
 		return err
 	}
-
-	if route.Spec.TLS.DestinationCACertificate == caBundle {
-		a.logger.Info(fmt.Sprintf("Route %s destination CA certificate is unchanged", name))
-		return nil
-	}
-
 	route.Spec.TLS.DestinationCACertificate = caBundle
 	return nil
 }
 
-// handleRemovedRoute handles routes that are in a removed state.
-func (a *Adjuster) handleRemovedRoute(ns, name string, route *routev1.Route, _ *sdiv1alpha1.SDIObserver, ctx context.Context) error {
-	if err := a.Client.Get(ctx, client.ObjectKey{Name: name, Namespace: ns}, route); err != nil && errors.IsNotFound(err) {
-		a.logger.Info(fmt.Sprintf("Operand route does not exist: %s", err.Error()))
-		return nil
-	} else if err != nil {
-		return err
+// handleRemovedRoute deletes the objects exposing the route with any of the served backends.
+func (a *Adjuster) handleRemovedRoute(r managedRoute, obs *sdiv1alpha1.SDIObserver, ctx context.Context) error {
+	r.status.Backend = ""
+	return a.removeExposures(ctx, r.namespace, r.name, "", obs, true)
+}
+
+// AdjustSDIVsystemRoute adjusts the VSystem route.
+func (a *Adjuster) AdjustSDIVsystemRoute(ns string, obs *sdiv1alpha1.SDIObserver, ctx context.Context) error {
+	r := vsystemRoute(obs)
+	r.namespace, r.sdiNamespace = ns, ns
+	return a.adjustRoute(r, obs, ctx)
+}
+
+// AdjustSLCBRoute adjusts the SLCB route.
+func (a *Adjuster) AdjustSLCBRoute(ns string, obs *sdiv1alpha1.SDIObserver, ctx context.Context) error {
+	r := slcbRoute(obs)
+	r.namespace = ns
+	return a.adjustRoute(r, obs, ctx)
+}
+
+// AdjustRoutes adjusts the additional routes of the spec in the namespace and reports their outcome in
+// status.routes. An unmanaged route is not a failure.
+func (a *Adjuster) AdjustRoutes(ns string, obs *sdiv1alpha1.SDIObserver, ctx context.Context) error {
+	statuses := make([]sdiv1alpha1.RouteStatus, 0, len(obs.Status.Routes))
+	for _, status := range obs.Status.Routes {
+		// The routes of the other namespace are adjusted by their own step.
+		if status.Namespace != ns {
+			statuses = append(statuses, status)
+		}
 	}
 
-	if err := a.Client.Delete(ctx, route); err != nil {
-		return err
+	var errs []error
+	for _, spec := range obs.Spec.Routes {
+		if RouteNamespace(obs, spec) != ns {
+			continue
+		}
+		status := routeStatus(obs.Status.Routes, ns, spec.Name)
+		var result StepResult
+		if err := a.validateRoute(obs, spec); err != nil {
+			result = newStepResult("route "+spec.Name, err)
+			result.Reason = sdiv1alpha1.ReasonInvalidRoute
+		} else {
+			result = newStepResult("route "+spec.Name, a.adjustRoute(additionalRoute(obs, spec, &status.ManagedRouteStatus), obs, ctx))
+		}
+		setRouteReadyCondition(&status.Conditions, result)
+		statuses = append(statuses, status)
+		if result.Err != nil {
+			errs = append(errs, fmt.Errorf("unable to adjust route %s: %w", spec.Name, result.Err))
+		}
 	}
+	obs.Status.Routes = statuses
+	return utilerrors.NewAggregate(errs)
+}
 
+// validateRoute checks that the additional route is in a namespace of the observer and does not collide
+// with a preset or another route.
+func (a *Adjuster) validateRoute(obs *sdiv1alpha1.SDIObserver, spec sdiv1alpha1.RouteSpec) error {
+	ns := RouteNamespace(obs, spec)
+	if ns != obs.Spec.SDINamespace && ns != obs.Spec.SLCBNamespace {
+		return fmt.Errorf("route %s must be in namespace %s or %s", spec.Name, obs.Spec.SDINamespace, obs.Spec.SLCBNamespace)
+	}
+	for _, preset := range []managedRoute{vsystemRoute(obs), slcbRoute(obs)} {
+		if spec.Name == preset.name && ns == preset.namespace {
+			return fmt.Errorf("route %s is managed by its preset", spec.Name)
+		}
+	}
+	count := 0
+	for _, other := range obs.Spec.Routes {
+		if other.Name == spec.Name && RouteNamespace(obs, other) == ns {
+			count++
+		}
+	}
+	if count > 1 {
+		return fmt.Errorf("route %s is listed %d times", spec.Name, count)
+	}
 	return nil
 }
 
-// AdjustSDIVsystemRoute adjusts the VSystem route.
-func (a *Adjuster) AdjustSDIVsystemRoute(ns string, obs *sdiv1alpha1.SDIObserver, ctx context.Context) error {
-	return a.AdjustRoute(ns, "vsystem", obs.Spec.SDIVSystemRoute.ManagementState, "manifests/route-management/route-vsystem.yaml", "vsystem-service", obs, ctx, true)
+// routeStatus returns the current status of the additional route, or a new one.
+func routeStatus(statuses []sdiv1alpha1.RouteStatus, ns, name string) sdiv1alpha1.RouteStatus {
+	for _, status := range statuses {
+		if status.Namespace == ns && status.Name == name {
+			return status
+		}
+	}
+	return sdiv1alpha1.RouteStatus{Name: name, Namespace: ns}
 }
 
-// AdjustSLCBRoute adjusts the SLCB route.
-func (a *Adjuster) AdjustSLCBRoute(ns string, obs *sdiv1alpha1.SDIObserver, ctx context.Context) error {
-	return a.AdjustRoute(ns, "sap-slcbridge", obs.Spec.SLCBRoute.ManagementState, "manifests/route-management/route-sap-slcbridge.yaml", "slcb-service", obs, ctx, false)
+// setRouteReadyCondition reports the outcome of the adjustment of an additional route.
+func setRouteReadyCondition(conditions *[]metav1.Condition, result StepResult) {
+	status := metav1.ConditionTrue
+	if result.Outcome == OutcomeFailed || result.Outcome == OutcomeProgressing {
+		status = metav1.ConditionFalse
+	}
+	meta.SetStatusCondition(conditions, metav1.Condition{
+		Type:    sdiv1alpha1.ConditionTypeReady,
+		Status:  status,
+		Reason:  result.Reason,
+		Message: result.Message,
+	})
 }
 
 func getCertFromCaBundleSecret(secret *corev1.Secret) (string, error) {
@@ -0,0 +1,334 @@
+package adjuster
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr"
+	routev1 "github.com/openshift/api/route/v1"
+	sdiv1alpha1 "github.com/redhat-sap/sap-data-intelligence/observer-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+const testCABundle = "-----BEGIN CERTIFICATE-----\nvsystem\n-----END CERTIFICATE-----"
+
+func newRouteTestAdjuster(t *testing.T, objs ...client.Object) *Adjuster {
+	t.Helper()
+	return newExposureTestAdjuster(t, []schema.GroupVersionKind{RouteGVK, IngressGVK}, objs...)
+}
+
+// newExposureTestAdjuster returns an adjuster whose cluster serves the given kinds of the exposure backends.
+func newExposureTestAdjuster(t *testing.T, served []schema.GroupVersionKind, objs ...client.Object) *Adjuster {
+	t.Helper()
+	scheme := newNodeConfiguratorScheme(t)
+	if err := routev1.AddToScheme(scheme); err != nil {
+		t.Fatalf("Failed to add scheme: %v", err)
+	}
+	if err := networkingv1.AddToScheme(scheme); err != nil {
+		t.Fatalf("Failed to add scheme: %v", err)
+	}
+	for _, gvk := range []schema.GroupVersionKind{HTTPRouteGVK, TLSRouteGVK} {
+		scheme.AddKnownTypeWithName(gvk, &unstructured.Unstructured{})
+		scheme.AddKnownTypeWithName(gvk.GroupVersion().WithKind(gvk.Kind+"List"), &unstructured.UnstructuredList{})
+	}
+	mapper := meta.NewDefaultRESTMapper(nil)
+	for _, gvk := range served {
+		mapper.Add(gvk, meta.RESTScopeNamespace)
+	}
+	caBundle := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: VSystemCABundleSecretName, Namespace: "sdi"},
+		Data:       map[string][]byte{vsystemCaBundleSecretKey: []byte(testCABundle + "\n")},
+	}
+	certificate := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "corporate-tls", Namespace: "sdi"},
+		Type:       corev1.SecretTypeTLS,
+		Data: map[string][]byte{
+			corev1.TLSCertKey:       []byte("certificate\n"),
+			corev1.TLSPrivateKeyKey: []byte("key\n"),
+			routeCACertificateKey:   []byte("ca\n"),
+		},
+	}
+	c := withServerSideApply(fake.NewClientBuilder().WithScheme(scheme).WithRESTMapper(mapper).
+		WithObjects(append(objs, caBundle, certificate)...)).Build()
+	return New("test-name", "operators", c, scheme, logr.Discard())
+}
+
+func TestAdjustSDIVsystemRoute(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		spec     sdiv1alpha1.ManagedRouteSpec
+		validate func(t *testing.T, route *routev1.Route)
+	}{
+		{
+			name: "default",
+			spec: sdiv1alpha1.ManagedRouteSpec{ManagementState: sdiv1alpha1.RouteManagementStateManaged},
+			validate: func(t *testing.T, route *routev1.Route) {
+				if route.Spec.TLS.Termination != routev1.TLSTerminationReencrypt || route.Spec.TLS.DestinationCACertificate != testCABundle {
+					t.Errorf("Expected reencrypt route with the vsystem CA, got %v", route.Spec.TLS)
+				}
+				if route.Spec.Host != "" || route.Annotations["haproxy.router.openshift.io/timeout"] != "2m" {
+					t.Errorf("Expected the route of the manifest, got %v", route)
+				}
+			},
+		},
+		{
+			name: "customized",
+			spec: sdiv1alpha1.ManagedRouteSpec{
+				ManagementState:      sdiv1alpha1.RouteManagementStateManaged,
+				Host:                 "vsystem.apps.example.com",
+				Termination:          sdiv1alpha1.RouteTerminationEdge,
+				CertificateSecretRef: &corev1.LocalObjectReference{Name: "corporate-tls"},
+				Annotations:          map[string]string{"haproxy.router.openshift.io/timeout": "5m", "example.com/owner": "sdi"},
+				WildcardPolicy:       string(routev1.WildcardPolicySubdomain),
+			},
+			validate: func(t *testing.T, route *routev1.Route) {
+				tls := route.Spec.TLS
+				if tls.Termination != routev1.TLSTerminationEdge || tls.DestinationCACertificate != "" {
+					t.Errorf("Expected edge route without destination CA, got %v", tls)
+				}
+				if tls.Certificate != "certificate" || tls.Key != "key" || tls.CACertificate != "ca" {
+					t.Errorf("Expected the custom certificate, got %v", tls)
+				}
+				if route.Spec.Host != "vsystem.apps.example.com" || route.Spec.WildcardPolicy != routev1.WildcardPolicySubdomain {
+					t.Errorf("Expected custom host and wildcard policy, got %v", route.Spec)
+				}
+				if route.Annotations["haproxy.router.openshift.io/timeout"] != "5m" || route.Annotations["example.com/owner"] != "sdi" {
+					t.Errorf("Expected custom annotations, got %v", route.Annotations)
+				}
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newRouteTestAdjuster(t)
+			ctx := context.Background()
+			obs := &sdiv1alpha1.SDIObserver{Spec: sdiv1alpha1.SDIObserverSpec{SDIVSystemRoute: tt.spec}}
+
+			if err := a.AdjustSDIVsystemRoute("sdi", obs, ctx); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			route := &routev1.Route{}
+			if err := a.Client.Get(ctx, client.ObjectKey{Name: "vsystem", Namespace: "sdi"}, route); err != nil {
+				t.Fatalf("Failed to get route: %v", err)
+			}
+			if route.Labels[ManagedByLabelKey] != ManagedByLabelValue {
+				t.Errorf("Expected the route to be marked as managed, got %v", route.Labels)
+			}
+			tt.validate(t, route)
+		})
+	}
+}
+
+func TestAdjustSDIVsystemRoute_KeepsGeneratedHost(t *testing.T) {
+	existing := &routev1.Route{
+		ObjectMeta: metav1.ObjectMeta{Name: "vsystem", Namespace: "sdi"},
+		Spec:       routev1.RouteSpec{Host: "vsystem-sdi.apps.example.com"},
+	}
+	a := newRouteTestAdjuster(t, existing)
+	ctx := context.Background()
+	obs := &sdiv1alpha1.SDIObserver{Spec: sdiv1alpha1.SDIObserverSpec{
+		SDIVSystemRoute: sdiv1alpha1.ManagedRouteSpec{ManagementState: sdiv1alpha1.RouteManagementStateManaged},
+	}}
+
+	if err := a.AdjustSDIVsystemRoute("sdi", obs, ctx); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	route := &routev1.Route{}
+	if err := a.Client.Get(ctx, client.ObjectKeyFromObject(existing), route); err != nil {
+		t.Fatalf("Failed to get route: %v", err)
+	}
+	if route.Spec.Host != existing.Spec.Host {
+		t.Errorf("Expected host %s to be kept, got %s", existing.Spec.Host, route.Spec.Host)
+	}
+	if route.Spec.TLS == nil || route.Spec.TLS.DestinationCACertificate != testCABundle {
+		t.Errorf("Expected the destination CA to be set, got %v", route.Spec.TLS)
+	}
+}
+
+func TestAdjustRoute_InvalidCustomization(t *testing.T) {
+	a := newRouteTestAdjuster(t)
+	ctx := context.Background()
+
+	for name, spec := range map[string]sdiv1alpha1.ManagedRouteSpec{
+		"passthrough certificate": {
+			Termination:          sdiv1alpha1.RouteTerminationPassthrough,
+			CertificateSecretRef: &corev1.LocalObjectReference{Name: "corporate-tls"},
+		},
+		"missing certificate":    {CertificateSecretRef: &corev1.LocalObjectReference{Name: "missing"}},
+		"subdomain without host": {WildcardPolicy: string(routev1.WildcardPolicySubdomain)},
+	} {
+		spec.ManagementState = sdiv1alpha1.RouteManagementStateManaged
+		obs := &sdiv1alpha1.SDIObserver{Spec: sdiv1alpha1.SDIObserverSpec{SDIVSystemRoute: spec}}
+		if err := a.AdjustSDIVsystemRoute("sdi", obs, ctx); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+	if err := a.Client.Get(ctx, client.ObjectKey{Name: "vsystem", Namespace: "sdi"}, &routev1.Route{}); err == nil {
+		t.Error("Expected no route to be created")
+	}
+}
+
+func TestAdjustSDIVsystemRoute_CorrectsDrift(t *testing.T) {
+	existing := &routev1.Route{
+		ObjectMeta: metav1.ObjectMeta{Name: "vsystem", Namespace: "sdi"},
+		Spec: routev1.RouteSpec{
+			Host: "vsystem-sdi.apps.example.com",
+			To:   routev1.RouteTargetReference{Kind: "Service", Name: "other"},
+			Port: &routev1.RoutePort{TargetPort: intstr.FromString("http")},
+			TLS: &routev1.TLSConfig{
+				Termination:              routev1.TLSTerminationReencrypt,
+				DestinationCACertificate: "outdated",
+			},
+		},
+	}
+	a := newRouteTestAdjuster(t, existing)
+	recorder := record.NewFakeRecorder(10)
+	a.Recorder = recorder
+	ctx := context.Background()
+	obs := &sdiv1alpha1.SDIObserver{Spec: sdiv1alpha1.SDIObserverSpec{
+		SDIVSystemRoute: sdiv1alpha1.ManagedRouteSpec{ManagementState: sdiv1alpha1.RouteManagementStateManaged},
+	}}
+
+	if err := a.AdjustSDIVsystemRoute("sdi", obs, ctx); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	route := &routev1.Route{}
+	if err := a.Client.Get(ctx, client.ObjectKeyFromObject(existing), route); err != nil {
+		t.Fatalf("Failed to get route: %v", err)
+	}
+	if route.Spec.To.Name != "vsystem" || route.Spec.Port.TargetPort.String() != "vsystem" ||
+		route.Spec.TLS.DestinationCACertificate != testCABundle {
+		t.Errorf("Expected the route to be corrected, got %v", route.Spec)
+	}
+
+	condition := meta.FindStatusCondition(obs.Status.VSystemRouteStatus.Conditions, sdiv1alpha1.ConditionTypeConfigDrift)
+	if condition == nil || condition.Status != metav1.ConditionTrue || condition.Reason != sdiv1alpha1.ReasonDriftCorrected {
+		t.Fatalf("Expected the corrected drift to be reported, got %v", condition)
+	}
+	for _, diff := range []string{"target service differs", "target port differs", "tls destinationCACertificate differs"} {
+		if !strings.Contains(condition.Message, diff) {
+			t.Errorf("Expected %q in the drift, got %s", diff, condition.Message)
+		}
+	}
+	if len(recorder.Events) != 1 {
+		t.Errorf("Expected a drift event, got %d", len(recorder.Events))
+	}
+
+	// The corrected route does not drift anymore.
+	if err := a.AdjustSDIVsystemRoute("sdi", obs, ctx); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	condition = meta.FindStatusCondition(obs.Status.VSystemRouteStatus.Conditions, sdiv1alpha1.ConditionTypeConfigDrift)
+	if condition == nil || condition.Status != metav1.ConditionFalse {
+		t.Errorf("Expected no drift, got %v", condition)
+	}
+}
+
+func TestRouteDrift(t *testing.T) {
+	desired := &routev1.Route{
+		ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{"haproxy.router.openshift.io/timeout": "2m"}},
+		Spec: routev1.RouteSpec{
+			To:   routev1.RouteTargetReference{Kind: "Service", Name: "vsystem"},
+			Port: &routev1.RoutePort{TargetPort: intstr.FromString("vsystem")},
+			TLS:  &routev1.TLSConfig{Termination: routev1.TLSTerminationEdge, Key: "key"},
+		},
+	}
+
+	existing := desired.DeepCopy()
+	existing.Spec.Host = "generated.apps.example.com"
+	existing.Annotations["example.com/other"] = "kept"
+	if drift := routeDrift(existing, desired); len(drift) != 0 {
+		t.Errorf("Expected no drift for fields not managed, got %v", drift)
+	}
+
+	existing.Annotations["haproxy.router.openshift.io/timeout"] = "1m"
+	existing.Spec.TLS.Key = "other"
+	drift := routeDrift(existing, desired)
+	if strings.Join(drift, ", ") != "annotation haproxy.router.openshift.io/timeout differs, tls key differs" {
+		t.Errorf("Unexpected drift %v", drift)
+	}
+
+	existing.Spec.TLS = nil
+	if drift := routeDrift(existing, desired); drift[len(drift)-1] != "tls is missing" {
+		t.Errorf("Expected missing tls, got %v", drift)
+	}
+}
+
+func TestAdjustRoutes(t *testing.T) {
+	a := newRouteTestAdjuster(t)
+	ctx := context.Background()
+	port := intstr.FromString("https")
+	managed := sdiv1alpha1.ManagedRouteSpec{ManagementState: sdiv1alpha1.RouteManagementStateManaged}
+	obs := &sdiv1alpha1.SDIObserver{
+		Spec: sdiv1alpha1.SDIObserverSpec{
+			SDINamespace:  "sdi",
+			SLCBNamespace: "sap-slcbridge",
+			Routes: []sdiv1alpha1.RouteSpec{
+				{Name: "openapi", Service: "openapi-gateway", Port: &port, ManagedRouteSpec: managed},
+				{Name: "kafka", Service: "kafka", DestinationCA: sdiv1alpha1.RouteDestinationCANone, ManagedRouteSpec: managed},
+				{Name: "unmanaged", Service: "unmanaged", ManagedRouteSpec: sdiv1alpha1.ManagedRouteSpec{
+					ManagementState: sdiv1alpha1.RouteManagementStateUnmanaged,
+				}},
+				{Name: "vsystem", Service: "vsystem", ManagedRouteSpec: managed},
+				{Name: "slcb", Namespace: "sap-slcbridge", Service: "slcb", ManagedRouteSpec: managed},
+			},
+		},
+		Status: sdiv1alpha1.SDIObserverStatus{Routes: []sdiv1alpha1.RouteStatus{
+			{Name: "dropped", Namespace: "sdi"},
+			{Name: "slcb", Namespace: "sap-slcbridge"},
+		}},
+	}
+
+	err := a.AdjustRoutes("sdi", obs, ctx)
+	if err == nil || !strings.Contains(err.Error(), "vsystem is managed by its preset") {
+		t.Errorf("Expected the route colliding with the preset to fail, got %v", err)
+	}
+
+	openapi := &routev1.Route{}
+	if err := a.Client.Get(ctx, client.ObjectKey{Name: "openapi", Namespace: "sdi"}, openapi); err != nil {
+		t.Fatalf("Failed to get route: %v", err)
+	}
+	if openapi.Spec.To.Name != "openapi-gateway" || openapi.Spec.Port == nil || openapi.Spec.Port.TargetPort != port {
+		t.Errorf("Expected the route to target the openapi gateway, got %v", openapi.Spec)
+	}
+	if openapi.Spec.TLS.Termination != routev1.TLSTerminationReencrypt || openapi.Spec.TLS.DestinationCACertificate != testCABundle {
+		t.Errorf("Expected reencrypt route with the SDI CA, got %v", openapi.Spec.TLS)
+	}
+	kafka := &routev1.Route{}
+	if err := a.Client.Get(ctx, client.ObjectKey{Name: "kafka", Namespace: "sdi"}, kafka); err != nil {
+		t.Fatalf("Failed to get route: %v", err)
+	}
+	if kafka.Spec.Port != nil || kafka.Spec.TLS.DestinationCACertificate != "" {
+		t.Errorf("Expected route on any port without destination CA, got %v", kafka.Spec)
+	}
+
+	statuses := map[string]sdiv1alpha1.RouteStatus{}
+	for _, status := range obs.Status.Routes {
+		statuses[status.Namespace+"/"+status.Name] = status
+	}
+	if len(statuses) != 5 {
+		t.Errorf("Expected the statuses of the listed routes only, got %v", obs.Status.Routes)
+	}
+	for name, expected := range map[string]string{
+		"sdi/openapi":   sdiv1alpha1.ReasonSucceeded,
+		"sdi/unmanaged": sdiv1alpha1.ReasonRouteUnmanaged,
+		"sdi/vsystem":   sdiv1alpha1.ReasonInvalidRoute,
+	} {
+		ready := meta.FindStatusCondition(statuses[name].Conditions, sdiv1alpha1.ConditionTypeReady)
+		if ready == nil || ready.Reason != expected {
+			t.Errorf("Expected route %s to be ready with reason %s, got %v", name, expected, ready)
+		}
+	}
+	if len(statuses["sap-slcbridge/slcb"].Conditions) != 0 {
+		t.Errorf("Expected the route in the SLC Bridge namespace to be left to its step, got %v", statuses["sap-slcbridge/slcb"])
+	}
+}
@@ -2,7 +2,6 @@ package adjuster
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 
 	operatorv1 "github.com/openshift/api/config/v1"
@@ -10,7 +9,8 @@ import (
 	sdiv1alpha1 "github.com/redhat-sap/sap-data-intelligence/observer-operator/api/v1alpha1"
 	"github.com/redhat-sap/sap-data-intelligence/observer-operator/assets"
 	"k8s.io/apimachinery/pkg/api/errors"
-	ctrl "sigs.k8s.io/controller-runtime"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
@@ -24,21 +24,26 @@ func (a *Adjuster) AdjustSDINodes(obs *sdiv1alpha1.SDIObserver, ctx context.Cont
 		return err
 	}
 	a.logger.Info("ClusterOperator machine-config exists. Using MachineConfig and KubeletConfig.")
+	defer a.setDriftCondition(&obs.Status.SDINodeConfigStatus.Conditions)
 
-	if err := a.ensureMachineConfig(ctx); err != nil {
+	if err := a.ensureMachineConfig(ctx, obs); err != nil {
 		return err
 	}
-	if err := a.ensureKubeletConfig(ctx); err != nil {
+	if err := a.ensureKubeletConfig(ctx, obs); err != nil {
 		return err
 	}
 	if err := a.ensureObsoleteContainerRuntimeConfig(ctx); err != nil {
 		return err
 	}
-	if err := a.ensureMachineConfigPool(ctx); err != nil {
+	if err := a.ensureMachineConfigPool(ctx, obs); err != nil {
 		return err
 	}
 
-	return nil
+	// The rollout of planned changes cannot be tracked.
+	if a.dryRun {
+		return nil
+	}
+	return a.checkMachineConfigPoolRollout(ctx, obs)
 }
 
 func (a *Adjuster) checkClusterOperator(ctx context.Context, name string) error {
@@ -49,115 +54,56 @@ func (a *Adjuster) checkClusterOperator(ctx context.Context, name string) error
 }
 
 func (a *Adjuster) createDaemonSetResources(ctx context.Context, obs *sdiv1alpha1.SDIObserver) error {
-	assetsToCheck := []struct {
-		Name      string
-		Namespace string
-		GetAsset  func() client.Object
-	}{
-		{"sdi-node-configurator", obs.Namespace, assets.GetServiceAccountFromFile("manifests/node-configurator/serviceaccount.yaml")},
-		{"ocp-tools", obs.Namespace, assets.GetImageStreamFromFile("manifests/node-configurator/imagestream.yaml")},
-		{"sdi-node-configurator", obs.Namespace, assets.GetDaemonSetFromFile("manifests/node-configurator/daemonset.yaml")},
-		{"sdi-node-configurator", obs.Namespace, assets.GetRoleFromFile("manifests/node-configurator/role.yaml")},
-		{"sdi-node-configurator", obs.Namespace, assets.GetRoleBindingFromFile("manifests/node-configurator/rolebinding.yaml")},
-	}
+	defer a.setDriftCondition(&obs.Status.SDINodeConfigStatus.Conditions)
 
-	for _, asset := range assetsToCheck {
-		if err := a.ensureResource(ctx, obs, asset.Name, asset.Namespace, asset.GetAsset); err != nil {
-			return err
-		}
+	resources, err := renderNodeConfiguratorResources(obs)
+	if err != nil {
+		return err
 	}
-	return nil
-}
-
-func (a *Adjuster) ensureResource(ctx context.Context, obs *sdiv1alpha1.SDIObserver, name, namespace string, getAsset func() client.Object) error {
-	resource := getAsset()
-	resourceGVK := resource.GetObjectKind().GroupVersionKind().Kind
-	err := a.Client.Get(ctx, client.ObjectKey{Name: name, Namespace: namespace}, resource)
-	if err != nil && errors.IsNotFound(err) {
-		a.logger.Info(fmt.Sprintf("%s %s does not exist, creating it.", resourceGVK, name))
-		if err := a.Client.Create(ctx, resource); err != nil {
+	for _, resource := range resources {
+		if err := a.ensureResource(ctx, obs, resource); err != nil {
 			return err
 		}
-		if err := ctrl.SetControllerReference(obs, resource, a.Scheme); err != nil {
-			return err
-		}
-	} else if err != nil {
-		return err
 	}
-	return nil
-}
-
-func (a *Adjuster) ensureMachineConfig(ctx context.Context) error {
-	return a.ensureSpecificMachineConfig(ctx, "75-worker-sap-data-intelligence", assets.GetMachineConfigFromFile("manifests/machineconfiguration/machineconfig-sdi-load-kernel-modules.yaml"))
-}
-
-func (a *Adjuster) ensureKubeletConfig(ctx context.Context) error {
-	return a.ensureSpecificKubeletConfig(ctx, "sdi-pids-limit", assets.GetKubeletConfigFromFile("manifests/machineconfiguration/kubeletconfig-sdi-pid-limit.yaml"))
-}
-
-func (a *Adjuster) ensureSpecificMachineConfig(ctx context.Context, name string, getAsset func() client.Object) error {
-	config := &configv1.MachineConfig{}
-	err := a.Client.Get(ctx, client.ObjectKey{Name: name}, config)
-	if err != nil && errors.IsNotFound(err) {
-		a.logger.Info(fmt.Sprintf("%s %s does not exist, creating it.", config.GetObjectKind().GroupVersionKind().Kind, name))
-		if err := a.Client.Create(ctx, getAsset()); err != nil {
-			return fmt.Errorf("unable to create operand %s: %w", name, err)
-		}
-	} else if err != nil {
-		return fmt.Errorf("unable to get operand %s: %w", name, err)
+	// The rollout of planned changes cannot be tracked.
+	if a.dryRun {
+		return nil
 	}
-	return nil
-}
-
-// Define a struct to unmarshal the Kubelet configuration from the RawExtension
-type KubeletConfigData struct {
-	PodPidsLimit int32 `json:"podPidsLimit"`
+	return a.checkNodeConfiguratorRollout(ctx, obs)
 }
 
-// ensureSpecificKubeletConfig checks if the KubeletConfig exists and if it needs updating.
-func (a *Adjuster) ensureSpecificKubeletConfig(ctx context.Context, name string, getAsset func() client.Object) error {
-	desiredConfig := getAsset().(*configv1.KubeletConfig)
-
-	// Retrieve the existing KubeletConfig
-	existingConfig := &configv1.KubeletConfig{}
-	err := a.Client.Get(ctx, client.ObjectKey{Name: name}, existingConfig)
+// ensureMachineConfig applies the SDI MachineConfig rendered from the observer.
+func (a *Adjuster) ensureMachineConfig(ctx context.Context, obs *sdiv1alpha1.SDIObserver) error {
+	mc, err := renderMachineConfig(obs)
 	if err != nil {
-		if errors.IsNotFound(err) {
-			// If the KubeletConfig does not exist, create it
-			a.logger.Info(fmt.Sprintf("%s %s does not exist, creating it.", desiredConfig.GetObjectKind().GroupVersionKind().Kind, name))
-			if err := a.Client.Create(ctx, desiredConfig); err != nil {
-				return fmt.Errorf("unable to create operand %s: %w", name, err)
-			}
-			return nil
-		}
-		return fmt.Errorf("unable to get operand %s: %w", name, err)
-	}
-
-	// Unmarshal the existing KubeletConfig data
-	var existingConfigData KubeletConfigData
-	if err := json.Unmarshal(existingConfig.Spec.KubeletConfig.Raw, &existingConfigData); err != nil {
-		return fmt.Errorf("unable to unmarshal existing KubeletConfig data: %w", err)
-	}
-
-	// Unmarshal the desired KubeletConfig data
-	var desiredConfigData KubeletConfigData
-	if err := json.Unmarshal(desiredConfig.Spec.KubeletConfig.Raw, &desiredConfigData); err != nil {
-		return fmt.Errorf("unable to unmarshal desired KubeletConfig data: %w", err)
+		return err
 	}
+	return a.ensureResource(ctx, obs, managedResource{
+		desired:  mc,
+		existing: &configv1.MachineConfig{},
+		drift: func(existing, desired client.Object) ([]string, error) {
+			return machineConfigDrift(existing.(*configv1.MachineConfig), desired.(*configv1.MachineConfig))
+		},
+	})
+}
 
-	// Compare podPidsLimit values
-	if existingConfigData.PodPidsLimit != desiredConfigData.PodPidsLimit {
-		a.logger.Info(fmt.Sprintf("%s %s exists but podPidsLimit differs. Updating it.", existingConfig.GetObjectKind().GroupVersionKind().Kind, name))
-		existingConfig.Spec.KubeletConfig = desiredConfig.Spec.KubeletConfig
-
-		if err := a.Client.Update(ctx, existingConfig); err != nil {
-			return fmt.Errorf("unable to update operand %s: %w", name, err)
-		}
-	} else {
-		a.logger.Info(fmt.Sprintf("%s %s exists and podPidsLimit is up to date.", existingConfig.GetObjectKind().GroupVersionKind().Kind, name))
+// ensureKubeletConfig applies the SDI KubeletConfig rendered from the observer.
+func (a *Adjuster) ensureKubeletConfig(ctx context.Context, obs *sdiv1alpha1.SDIObserver) error {
+	kc, err := renderKubeletConfig(obs)
+	if err != nil {
+		return err
 	}
-
-	return nil
+	return a.ensureResource(ctx, obs, managedResource{
+		desired:  kc,
+		existing: &configv1.KubeletConfig{},
+		drift: func(existing, desired client.Object) ([]string, error) {
+			upToDate, err := kubeletConfigUpToDate(existing.(*configv1.KubeletConfig), desired.(*configv1.KubeletConfig))
+			if err != nil || upToDate {
+				return nil, err
+			}
+			return []string{"kubelet settings differ"}, nil
+		},
+	})
 }
 
 func (a *Adjuster) ensureObsoleteContainerRuntimeConfig(ctx context.Context) error {
@@ -179,18 +125,36 @@ func (a *Adjuster) ensureObsoleteContainerRuntimeConfig(ctx context.Context) err
 	return nil
 }
 
-func (a *Adjuster) ensureMachineConfigPool(ctx context.Context) error {
+// ensureMachineConfigPool applies the sdi MachineConfigPool. The pool is applied from the manifest as is,
+// so that the fields not set in it, like paused or maxUnavailable, are left to the cluster administrators.
+func (a *Adjuster) ensureMachineConfigPool(ctx context.Context, obs *sdiv1alpha1.SDIObserver) error {
+	pool, err := assets.LoadUnstructured(machineConfigPoolAsset)
+	if err != nil {
+		return err
+	}
+	existing := &unstructured.Unstructured{}
+	existing.SetGroupVersionKind(pool.GroupVersionKind())
+	return a.ensureResource(ctx, obs, managedResource{
+		desired:  pool,
+		existing: existing,
+		drift: func(existing, desired client.Object) ([]string, error) {
+			existingPool, err := toMachineConfigPool(existing)
+			if err != nil {
+				return nil, err
+			}
+			desiredPool, err := toMachineConfigPool(desired)
+			if err != nil {
+				return nil, err
+			}
+			return machineConfigPoolDrift(existingPool, desiredPool), nil
+		},
+	})
+}
+
+func toMachineConfigPool(obj client.Object) (*configv1.MachineConfigPool, error) {
 	pool := &configv1.MachineConfigPool{}
-	poolName := "sdi"
-	err := a.Client.Get(ctx, client.ObjectKey{Name: poolName}, pool)
-	if err != nil && errors.IsNotFound(err) {
-		a.logger.Info(fmt.Sprintf("MachineConfigPool %s does not exist, creating it.", poolName))
-		poolAsset := assets.GetMachineConfigPoolFromFile("manifests/machineconfiguration/machineconfigpool-sdi.yaml")
-		if err := a.Client.Create(ctx, poolAsset); err != nil {
-			return err
-		}
-	} else if err != nil {
-		return fmt.Errorf("unable to get operand machine config pool %s: %w", poolName, err)
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.(*unstructured.Unstructured).Object, pool); err != nil {
+		return nil, fmt.Errorf("unable to convert MachineConfigPool %s: %w", obj.GetName(), err)
 	}
-	return nil
+	return pool, nil
 }
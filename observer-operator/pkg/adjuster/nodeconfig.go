@@ -0,0 +1,271 @@
+package adjuster
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	configv1 "github.com/openshift/machine-config-operator/pkg/apis/machineconfiguration.openshift.io/v1"
+	sdiv1alpha1 "github.com/redhat-sap/sap-data-intelligence/observer-operator/api/v1alpha1"
+	"github.com/redhat-sap/sap-data-intelligence/observer-operator/assets"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// The node configuration is rendered from the embedded manifests and the nodeConfig section of the
+// SDIObserver. The manifests hold the settings required by SAP DI; the CR adds to them.
+
+// DefaultPodPidsLimit is the pods pids limit applied if none is set in the SDIObserver.
+const DefaultPodPidsLimit int64 = 16384
+
+const (
+	machineConfigAsset     = "manifests/machineconfiguration/machineconfig-sdi-load-kernel-modules.yaml"
+	kubeletConfigAsset     = "manifests/machineconfiguration/kubeletconfig-sdi-pid-limit.yaml"
+	machineConfigPoolAsset = "manifests/machineconfiguration/machineconfigpool-sdi.yaml"
+	nodeConfiguratorPath   = "manifests/node-configurator/daemonset.yaml"
+
+	sdiModulesLoadPath = "/etc/modules-load.d/sdi-dependencies.conf"
+	sdiSysctlPath      = "/etc/sysctl.d/99-sap-data-intelligence.conf"
+	sdiSysctlFileMode  = 420
+
+	nodeConfiguratorContainerName = "sdi-node-configurator"
+	kernelModulesEnvName          = "KERNEL_MODULES"
+	sysctlsEnvName                = "SYSCTLS"
+
+	podPidsLimitKey = "podPidsLimit"
+)
+
+// ignitionConfig is the subset of the ignition 2.2 config used by the SDI MachineConfig.
+type ignitionConfig struct {
+	Ignition map[string]interface{} `json:"ignition"`
+	Storage  ignitionStorage        `json:"storage,omitempty"`
+	Systemd  ignitionSystemd        `json:"systemd,omitempty"`
+}
+
+type ignitionStorage struct {
+	Files []ignitionFile `json:"files,omitempty"`
+}
+
+type ignitionFile struct {
+	Contents   ignitionFileContents `json:"contents"`
+	Filesystem string               `json:"filesystem,omitempty"`
+	Mode       *int                 `json:"mode,omitempty"`
+	Path       string               `json:"path"`
+}
+
+type ignitionFileContents struct {
+	Source       string                 `json:"source"`
+	Verification map[string]interface{} `json:"verification,omitempty"`
+}
+
+type ignitionSystemd struct {
+	Units []ignitionUnit `json:"units,omitempty"`
+}
+
+type ignitionUnit struct {
+	Contents string `json:"contents,omitempty"`
+	Enabled  *bool  `json:"enabled,omitempty"`
+	Name     string `json:"name"`
+}
+
+func podPidsLimit(obs *sdiv1alpha1.SDIObserver) int64 {
+	if obs.Spec.NodeConfig.PodPidsLimit > 0 {
+		return obs.Spec.NodeConfig.PodPidsLimit
+	}
+	return DefaultPodPidsLimit
+}
+
+// renderMachineConfig adds the extra kernel modules and sysctls of the observer to the SDI MachineConfig.
+func renderMachineConfig(obs *sdiv1alpha1.SDIObserver) (*configv1.MachineConfig, error) {
+	mc, err := assets.LoadAs[*configv1.MachineConfig](machineConfigAsset)
+	if err != nil {
+		return nil, err
+	}
+
+	var ignition ignitionConfig
+	if err := json.Unmarshal(mc.Spec.Config.Raw, &ignition); err != nil {
+		return nil, fmt.Errorf("unable to parse ignition config of MachineConfig %s: %w", mc.Name, err)
+	}
+
+	for i := range ignition.Storage.Files {
+		file := &ignition.Storage.Files[i]
+		if file.Path != sdiModulesLoadPath {
+			continue
+		}
+		contents, err := decodeDataURL(file.Contents.Source)
+		if err != nil {
+			return nil, fmt.Errorf("unable to decode %s: %w", file.Path, err)
+		}
+		modules := appendMissing(strings.Fields(contents), obs.Spec.NodeConfig.ExtraKernelModules)
+		file.Contents.Source = encodeDataURL(joinLines(modules))
+	}
+
+	if sysctls := sortedSysctls(obs.Spec.NodeConfig.ExtraSysctls, " = "); len(sysctls) > 0 {
+		mode := sdiSysctlFileMode
+		ignition.Storage.Files = append(ignition.Storage.Files, ignitionFile{
+			Contents:   ignitionFileContents{Source: encodeDataURL(joinLines(sysctls))},
+			Filesystem: "root",
+			Mode:       &mode,
+			Path:       sdiSysctlPath,
+		})
+	}
+
+	raw, err := json.Marshal(ignition)
+	if err != nil {
+		return nil, fmt.Errorf("unable to render ignition config of MachineConfig %s: %w", mc.Name, err)
+	}
+	mc.Spec.Config = runtime.RawExtension{Raw: raw}
+	return mc, nil
+}
+
+// renderKubeletConfig merges the kubelet tunables and the pods pids limit of the observer into the SDI
+// KubeletConfig.
+func renderKubeletConfig(obs *sdiv1alpha1.SDIObserver) (*configv1.KubeletConfig, error) {
+	kc, err := assets.LoadAs[*configv1.KubeletConfig](kubeletConfigAsset)
+	if err != nil {
+		return nil, err
+	}
+
+	settings, err := kubeletConfigSettings(kc)
+	if err != nil {
+		return nil, err
+	}
+	if tunables := obs.Spec.NodeConfig.KubeletTunables; tunables != nil && len(tunables.Raw) > 0 {
+		extra := map[string]interface{}{}
+		if err := json.Unmarshal(tunables.Raw, &extra); err != nil {
+			return nil, fmt.Errorf("unable to parse kubelet tunables: %w", err)
+		}
+		for key, value := range extra {
+			settings[key] = value
+		}
+	}
+	settings[podPidsLimitKey] = podPidsLimit(obs)
+
+	raw, err := json.Marshal(settings)
+	if err != nil {
+		return nil, fmt.Errorf("unable to render KubeletConfig %s: %w", kc.Name, err)
+	}
+	kc.Spec.KubeletConfig = &runtime.RawExtension{Raw: raw}
+	return kc, nil
+}
+
+// kubeletConfigSettings returns the kubelet settings held by the KubeletConfig.
+func kubeletConfigSettings(kc *configv1.KubeletConfig) (map[string]interface{}, error) {
+	settings := map[string]interface{}{}
+	if kc.Spec.KubeletConfig == nil || len(kc.Spec.KubeletConfig.Raw) == 0 {
+		return settings, nil
+	}
+	if err := json.Unmarshal(kc.Spec.KubeletConfig.Raw, &settings); err != nil {
+		return nil, fmt.Errorf("unable to unmarshal KubeletConfig %s data: %w", kc.Name, err)
+	}
+	return settings, nil
+}
+
+// kubeletConfigUpToDate tells whether the existing KubeletConfig holds exactly the desired kubelet settings.
+func kubeletConfigUpToDate(existing, desired *configv1.KubeletConfig) (bool, error) {
+	existingSettings, err := kubeletConfigSettings(existing)
+	if err != nil {
+		return false, err
+	}
+	desiredSettings, err := kubeletConfigSettings(desired)
+	if err != nil {
+		return false, err
+	}
+	return equality.Semantic.DeepEqual(existingSettings, desiredSettings), nil
+}
+
+// renderNodeConfiguratorDaemonSet passes the kernel modules and sysctls of the observer to the script of
+// the node-configurator and schedules it on the nodes labeled with the SDI node label.
+func renderNodeConfiguratorDaemonSet(obs *sdiv1alpha1.SDIObserver) (*appsv1.DaemonSet, error) {
+	ds, err := assets.LoadAs[*appsv1.DaemonSet](nodeConfiguratorPath)
+	if err != nil {
+		return nil, err
+	}
+	ds.Namespace = obs.Namespace
+
+	if obs.Spec.SDINodeLabel != "" {
+		nodeSelector, err := labels.ConvertSelectorToLabelsMap(obs.Spec.SDINodeLabel)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse SDI node label %q: %w", obs.Spec.SDINodeLabel, err)
+		}
+		ds.Spec.Template.Spec.NodeSelector = nodeSelector
+	}
+
+	for i := range ds.Spec.Template.Spec.InitContainers {
+		container := &ds.Spec.Template.Spec.InitContainers[i]
+		if container.Name != nodeConfiguratorContainerName {
+			continue
+		}
+		for j := range container.Env {
+			env := &container.Env[j]
+			switch env.Name {
+			case kernelModulesEnvName:
+				env.Value = joinLines(appendMissing(strings.Fields(env.Value), obs.Spec.NodeConfig.ExtraKernelModules))
+			case sysctlsEnvName:
+				env.Value = joinLines(sortedSysctls(obs.Spec.NodeConfig.ExtraSysctls, "="))
+			}
+		}
+	}
+	return ds, nil
+}
+
+// appendMissing appends the extra items not yet present in the list.
+func appendMissing(list, extra []string) []string {
+	present := make(map[string]bool, len(list))
+	for _, item := range list {
+		present[item] = true
+	}
+	for _, item := range extra {
+		if item = strings.TrimSpace(item); item != "" && !present[item] {
+			present[item] = true
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// sortedSysctls formats the sysctls as key-value pairs sorted by key.
+func sortedSysctls(sysctls map[string]string, separator string) []string {
+	keys := make([]string, 0, len(sysctls))
+	for key := range sysctls {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	lines := make([]string, 0, len(keys))
+	for _, key := range keys {
+		lines = append(lines, key+separator+sysctls[key])
+	}
+	return lines
+}
+
+func joinLines(lines []string) string {
+	if len(lines) == 0 {
+		return ""
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+func encodeDataURL(contents string) string {
+	return "data:text/plain;charset=utf-8;base64," + base64.StdEncoding.EncodeToString([]byte(contents))
+}
+
+func decodeDataURL(source string) (string, error) {
+	header, data, found := strings.Cut(source, ",")
+	if !found || !strings.HasPrefix(header, "data:") {
+		return "", fmt.Errorf("unsupported file source %q", source)
+	}
+	if strings.HasSuffix(header, ";base64") {
+		decoded, err := base64.StdEncoding.DecodeString(data)
+		if err != nil {
+			return "", err
+		}
+		return string(decoded), nil
+	}
+	return url.PathUnescape(data)
+}
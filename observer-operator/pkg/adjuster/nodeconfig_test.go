@@ -0,0 +1,146 @@
+package adjuster
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/go-logr/logr"
+	configv1 "github.com/openshift/machine-config-operator/pkg/apis/machineconfiguration.openshift.io/v1"
+	sdiv1alpha1 "github.com/redhat-sap/sap-data-intelligence/observer-operator/api/v1alpha1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func ignitionFiles(t *testing.T, mc *configv1.MachineConfig) map[string]string {
+	t.Helper()
+	var ignition ignitionConfig
+	if err := json.Unmarshal(mc.Spec.Config.Raw, &ignition); err != nil {
+		t.Fatalf("Failed to parse ignition config: %v", err)
+	}
+	files := map[string]string{}
+	for _, file := range ignition.Storage.Files {
+		contents, err := decodeDataURL(file.Contents.Source)
+		if err != nil {
+			t.Fatalf("Failed to decode %s: %v", file.Path, err)
+		}
+		files[file.Path] = contents
+	}
+	return files
+}
+
+func TestRenderMachineConfig(t *testing.T) {
+	defaultMC, err := renderMachineConfig(&sdiv1alpha1.SDIObserver{})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	assetMC := loadAsset[*configv1.MachineConfig](t, machineConfigAsset)
+	if got, want := ignitionFiles(t, defaultMC), ignitionFiles(t, assetMC); len(got) != 1 || got[sdiModulesLoadPath] != want[sdiModulesLoadPath] {
+		t.Errorf("Expected default rendering to match the asset, got %v", got)
+	}
+
+	obs := &sdiv1alpha1.SDIObserver{Spec: sdiv1alpha1.SDIObserverSpec{NodeConfig: sdiv1alpha1.NodeConfigSpec{
+		ExtraKernelModules: []string{"nfsd", "br_netfilter"},
+		ExtraSysctls:       map[string]string{"vm.max_map_count": "262144", "kernel.pid_max": "4194304"},
+	}}}
+	mc, err := renderMachineConfig(obs)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	files := ignitionFiles(t, mc)
+	if got, want := files[sdiModulesLoadPath], "nfsd\nnfsv4\nip_tables\nipt_REDIRECT\nipt_owner\nbr_netfilter\n"; got != want {
+		t.Errorf("Expected modules %q, got %q", want, got)
+	}
+	if got, want := files[sdiSysctlPath], "kernel.pid_max = 4194304\nvm.max_map_count = 262144\n"; got != want {
+		t.Errorf("Expected sysctls %q, got %q", want, got)
+	}
+}
+
+func TestRenderKubeletConfig(t *testing.T) {
+	obs := &sdiv1alpha1.SDIObserver{Spec: sdiv1alpha1.SDIObserverSpec{NodeConfig: sdiv1alpha1.NodeConfigSpec{
+		PodPidsLimit:    32768,
+		KubeletTunables: &runtime.RawExtension{Raw: []byte(`{"maxPods": 500, "podPidsLimit": 1}`)},
+	}}}
+	kc, err := renderKubeletConfig(obs)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	settings, err := kubeletConfigSettings(kc)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if settings[podPidsLimitKey] != float64(32768) || settings["maxPods"] != float64(500) {
+		t.Errorf("Unexpected kubelet settings: %v", settings)
+	}
+
+	defaultKC, err := renderKubeletConfig(&sdiv1alpha1.SDIObserver{})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if upToDate, _ := kubeletConfigUpToDate(defaultKC, loadAsset[*configv1.KubeletConfig](t, kubeletConfigAsset)); !upToDate {
+		t.Error("Expected default rendering to match the asset")
+	}
+	if upToDate, _ := kubeletConfigUpToDate(defaultKC, kc); upToDate {
+		t.Error("Expected kubelet settings to differ")
+	}
+}
+
+func TestEnsureKubeletConfig_Tunables(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := configv1.AddToScheme(scheme); err != nil {
+		t.Fatalf("Failed to add scheme: %v", err)
+	}
+	existing, err := renderKubeletConfig(&sdiv1alpha1.SDIObserver{})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	c := withServerSideApply(fake.NewClientBuilder().WithScheme(scheme).WithObjects(existing)).Build()
+	a := New("test-name", "sdi-observer", c, scheme, logr.Discard())
+	ctx := context.Background()
+
+	obs := &sdiv1alpha1.SDIObserver{Spec: sdiv1alpha1.SDIObserverSpec{NodeConfig: sdiv1alpha1.NodeConfigSpec{
+		KubeletTunables: &runtime.RawExtension{Raw: []byte(`{"maxPods": 500}`)},
+	}}}
+	if err := a.ensureKubeletConfig(ctx, obs); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	got := &configv1.KubeletConfig{}
+	if err := c.Get(ctx, client.ObjectKeyFromObject(existing), got); err != nil {
+		t.Fatalf("Failed to get KubeletConfig: %v", err)
+	}
+	settings, err := kubeletConfigSettings(got)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if settings["maxPods"] != float64(500) || settings[podPidsLimitKey] != float64(DefaultPodPidsLimit) {
+		t.Errorf("Expected KubeletConfig to be updated with the tunables, got %v", settings)
+	}
+}
+
+func TestRenderNodeConfiguratorDaemonSet(t *testing.T) {
+	obs := &sdiv1alpha1.SDIObserver{Spec: sdiv1alpha1.SDIObserverSpec{NodeConfig: sdiv1alpha1.NodeConfigSpec{
+		ExtraKernelModules: []string{"br_netfilter"},
+		ExtraSysctls:       map[string]string{"net.ipv4.ip_local_port_range": "32768 60999"},
+	}}}
+	ds, err := renderNodeConfiguratorDaemonSet(obs)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	env := map[string]string{}
+	for _, container := range ds.Spec.Template.Spec.InitContainers {
+		if container.Name == nodeConfiguratorContainerName {
+			for _, e := range container.Env {
+				env[e.Name] = e.Value
+			}
+		}
+	}
+	if got, want := env[kernelModulesEnvName], "nfsd\nnfsv4\nip_tables\nipt_REDIRECT\nipt_owner\niptable_nat\niptable_filter\nbr_netfilter\n"; got != want {
+		t.Errorf("Expected kernel modules %q, got %q", want, got)
+	}
+	if got, want := env[sysctlsEnvName], "net.ipv4.ip_local_port_range=32768 60999\n"; got != want {
+		t.Errorf("Expected sysctls %q, got %q", want, got)
+	}
+}
@@ -0,0 +1,256 @@
+package adjuster
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	imagev1 "github.com/openshift/api/image/v1"
+	sdiv1alpha1 "github.com/redhat-sap/sap-data-intelligence/observer-operator/api/v1alpha1"
+	"github.com/redhat-sap/sap-data-intelligence/observer-operator/assets"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// On clusters without the machine-config operator, the SDI nodes are configured by the node-configurator
+// DaemonSet. Its init container loads the kernel modules and sets the sysctls on each SDI node.
+
+const (
+	NodeConfiguratorName = "sdi-node-configurator"
+
+	podTemplateGenerationLabel = "pod-template-generation"
+
+	nodeStateDone     = "Done"
+	nodeStateWorking  = "Working"
+	nodeStateDegraded = "Degraded"
+)
+
+func renderNodeConfiguratorResources(obs *sdiv1alpha1.SDIObserver) ([]managedResource, error) {
+	ds, err := renderNodeConfiguratorDaemonSet(obs)
+	if err != nil {
+		return nil, err
+	}
+	sa, err := assets.LoadAs[*corev1.ServiceAccount]("manifests/node-configurator/serviceaccount.yaml")
+	if err != nil {
+		return nil, err
+	}
+	is, err := assets.LoadAs[*imagev1.ImageStream]("manifests/node-configurator/imagestream.yaml")
+	if err != nil {
+		return nil, err
+	}
+	role, err := assets.LoadAs[*rbacv1.Role]("manifests/node-configurator/role.yaml")
+	if err != nil {
+		return nil, err
+	}
+	rb, err := assets.LoadAs[*rbacv1.RoleBinding]("manifests/node-configurator/rolebinding.yaml")
+	if err != nil {
+		return nil, err
+	}
+	for i := range rb.Subjects {
+		rb.Subjects[i].Namespace = obs.Namespace
+	}
+
+	resources := []managedResource{
+		{desired: sa, existing: &corev1.ServiceAccount{}, drift: labelsDriftOf},
+		{desired: is, existing: &imagev1.ImageStream{}, drift: imageStreamDrift},
+		{desired: ds, existing: &appsv1.DaemonSet{}, drift: daemonSetDrift, retain: retainImages},
+		{desired: role, existing: &rbacv1.Role{}, drift: roleDrift},
+		{desired: rb, existing: &rbacv1.RoleBinding{}, drift: roleBindingDrift},
+	}
+	for _, resource := range resources {
+		resource.desired.SetNamespace(obs.Namespace)
+	}
+	return resources, nil
+}
+
+func labelsDriftOf(existing, desired client.Object) ([]string, error) {
+	return labelsDrift(existing.GetLabels(), desired.GetLabels()), nil
+}
+
+func imageStreamDrift(existing, desired client.Object) ([]string, error) {
+	e, d := existing.(*imagev1.ImageStream), desired.(*imagev1.ImageStream)
+	drift := labelsDrift(e.Labels, d.Labels)
+	if e.Spec.LookupPolicy != d.Spec.LookupPolicy {
+		drift = append(drift, "lookupPolicy differs")
+	}
+
+	// Compare only the tag sources; the other tag fields are defaulted by the server.
+	tagSources := func(tags []imagev1.TagReference) map[string]string {
+		sources := map[string]string{}
+		for _, tag := range tags {
+			if tag.From != nil {
+				sources[tag.Name] = tag.From.Kind + "/" + tag.From.Namespace + "/" + tag.From.Name
+			}
+		}
+		return sources
+	}
+	if !equality.Semantic.DeepEqual(tagSources(e.Spec.Tags), tagSources(d.Spec.Tags)) {
+		drift = append(drift, "tags differ")
+	}
+	return drift, nil
+}
+
+func daemonSetDrift(existing, desired client.Object) ([]string, error) {
+	e, d := existing.(*appsv1.DaemonSet), desired.(*appsv1.DaemonSet)
+	drift := labelsDrift(e.Labels, d.Labels)
+
+	existingSpec, desiredSpec := &e.Spec.Template.Spec, &d.Spec.Template.Spec
+	if !equality.Semantic.DeepEqual(existingSpec.NodeSelector, desiredSpec.NodeSelector) {
+		drift = append(drift, "nodeSelector differs")
+	}
+	drift = append(drift, containersDrift(existingSpec.InitContainers, desiredSpec.InitContainers)...)
+	drift = append(drift, containersDrift(existingSpec.Containers, desiredSpec.Containers)...)
+	return drift, nil
+}
+
+// retainImages keeps the images of the existing containers as they are resolved by the image trigger.
+func retainImages(existing, desired client.Object) {
+	e, d := existing.(*appsv1.DaemonSet), desired.(*appsv1.DaemonSet)
+	retain := func(existing, desired []corev1.Container) {
+		for i := range desired {
+			for _, container := range existing {
+				if container.Name == desired[i].Name && container.Image != "" {
+					desired[i].Image = container.Image
+				}
+			}
+		}
+	}
+	retain(e.Spec.Template.Spec.InitContainers, d.Spec.Template.Spec.InitContainers)
+	retain(e.Spec.Template.Spec.Containers, d.Spec.Template.Spec.Containers)
+}
+
+// containersDrift compares the commands and environment of the containers.
+func containersDrift(existing, desired []corev1.Container) []string {
+	var drift []string
+	for _, d := range desired {
+		found := false
+		for _, e := range existing {
+			if e.Name != d.Name {
+				continue
+			}
+			found = true
+			if !equality.Semantic.DeepEqual(e.Command, d.Command) {
+				drift = append(drift, fmt.Sprintf("container %s command differs", d.Name))
+			}
+			if !equality.Semantic.DeepEqual(e.Env, d.Env) {
+				drift = append(drift, fmt.Sprintf("container %s environment differs", d.Name))
+			}
+		}
+		if !found {
+			drift = append(drift, fmt.Sprintf("container %s is missing", d.Name))
+		}
+	}
+	return drift
+}
+
+func roleDrift(existing, desired client.Object) ([]string, error) {
+	e, d := existing.(*rbacv1.Role), desired.(*rbacv1.Role)
+	drift := labelsDrift(e.Labels, d.Labels)
+	if !equality.Semantic.DeepEqual(e.Rules, d.Rules) {
+		drift = append(drift, "rules differ")
+	}
+	return drift, nil
+}
+
+func roleBindingDrift(existing, desired client.Object) ([]string, error) {
+	e, d := existing.(*rbacv1.RoleBinding), desired.(*rbacv1.RoleBinding)
+	drift := labelsDrift(e.Labels, d.Labels)
+	if !equality.Semantic.DeepEqual(e.Subjects, d.Subjects) {
+		drift = append(drift, "subjects differ")
+	}
+	return drift, nil
+}
+
+// checkNodeConfiguratorRollout reports the outcome of the node-configurator on each SDI node in the
+// SDINodeConfigStatus. A progressing error is returned until the init container of the current pod
+// template succeeded on all the SDI nodes.
+func (a *Adjuster) checkNodeConfiguratorRollout(ctx context.Context, obs *sdiv1alpha1.SDIObserver) error {
+	ds := &appsv1.DaemonSet{}
+	if err := a.Client.Get(ctx, client.ObjectKey{Name: NodeConfiguratorName, Namespace: obs.Namespace}, ds); err != nil {
+		return fmt.Errorf("unable to get daemonset %s: %w", NodeConfiguratorName, err)
+	}
+
+	pods := &corev1.PodList{}
+	if err := a.Client.List(ctx, pods, client.InNamespace(obs.Namespace), client.MatchingLabels(ds.Spec.Selector.MatchLabels)); err != nil {
+		return fmt.Errorf("unable to list pods of daemonset %s: %w", NodeConfiguratorName, err)
+	}
+	sort.Slice(pods.Items, func(i, j int) bool {
+		return pods.Items[i].Spec.NodeName < pods.Items[j].Spec.NodeName
+	})
+
+	status := &obs.Status.SDINodeConfigStatus
+	status.RenderedConfig = ""
+	status.MachineCount = ds.Status.DesiredNumberScheduled
+	status.UpdatedMachineCount = 0
+	status.DegradedMachineCount = 0
+	status.Nodes = nil
+
+	var degraded []string
+	for i := range pods.Items {
+		state := nodeConfiguratorState(&pods.Items[i], ds.Generation)
+		switch state.State {
+		case nodeStateDone:
+			status.UpdatedMachineCount++
+		case nodeStateDegraded:
+			status.DegradedMachineCount++
+			degraded = append(degraded, fmt.Sprintf("node %s: %s", state.Name, state.Reason))
+		}
+		status.Nodes = append(status.Nodes, state)
+	}
+
+	switch {
+	case len(degraded) > 0:
+		return fmt.Errorf("daemonset %s failed: %s", NodeConfiguratorName, strings.Join(degraded, "; "))
+	case ds.Status.ObservedGeneration >= ds.Generation && ds.Status.DesiredNumberScheduled == 0:
+		return InProgress(sdiv1alpha1.ReasonNoSDINodes,
+			fmt.Sprintf("No node matches the node selector of daemonset %s", NodeConfiguratorName))
+	case ds.Status.ObservedGeneration < ds.Generation, status.UpdatedMachineCount < ds.Status.DesiredNumberScheduled:
+		return InProgress(sdiv1alpha1.ReasonNodesUpdating,
+			fmt.Sprintf("%d of %d SDI nodes configured by daemonset %s", status.UpdatedMachineCount, ds.Status.DesiredNumberScheduled, NodeConfiguratorName))
+	}
+
+	a.logger.Info(fmt.Sprintf("All %d SDI nodes configured by daemonset %s", ds.Status.DesiredNumberScheduled, NodeConfiguratorName))
+	return nil
+}
+
+// nodeConfiguratorState determines the configuration state of the node from the init container of the
+// node-configurator pod running on it.
+func nodeConfiguratorState(pod *corev1.Pod, generation int64) sdiv1alpha1.SDINodeState {
+	state := sdiv1alpha1.SDINodeState{Name: pod.Spec.NodeName, State: nodeStateWorking}
+	if state.Name == "" {
+		state.Name = pod.Name
+	}
+	if pod.Labels[podTemplateGenerationLabel] != strconv.FormatInt(generation, 10) {
+		state.Reason = "Waiting for the pod to be updated"
+		return state
+	}
+
+	for _, cs := range pod.Status.InitContainerStatuses {
+		if cs.Name != nodeConfiguratorContainerName {
+			continue
+		}
+		switch terminated := cs.State.Terminated; {
+		case terminated != nil && terminated.ExitCode == 0:
+			state.State = nodeStateDone
+		case terminated != nil:
+			state.State = nodeStateDegraded
+			state.Reason = terminationReason(terminated)
+		case cs.LastTerminationState.Terminated != nil && cs.LastTerminationState.Terminated.ExitCode != 0:
+			state.State = nodeStateDegraded
+			state.Reason = terminationReason(cs.LastTerminationState.Terminated)
+		}
+	}
+	return state
+}
+
+func terminationReason(terminated *corev1.ContainerStateTerminated) string {
+	if terminated.Message != "" {
+		return terminated.Message
+	}
+	return fmt.Sprintf("init container exited with code %d", terminated.ExitCode)
+}
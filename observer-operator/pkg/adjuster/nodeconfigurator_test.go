@@ -0,0 +1,240 @@
+package adjuster
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr"
+	imagev1 "github.com/openshift/api/image/v1"
+	sdiv1alpha1 "github.com/redhat-sap/sap-data-intelligence/observer-operator/api/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newNodeConfiguratorScheme(t *testing.T) *runtime.Scheme {
+	t.Helper()
+	scheme := runtime.NewScheme()
+	for _, add := range []func(*runtime.Scheme) error{
+		corev1.AddToScheme,
+		discoveryv1.AddToScheme,
+		appsv1.AddToScheme,
+		rbacv1.AddToScheme,
+		imagev1.AddToScheme,
+		sdiv1alpha1.AddToScheme,
+	} {
+		if err := add(scheme); err != nil {
+			t.Fatalf("Failed to add scheme: %v", err)
+		}
+	}
+	return scheme
+}
+
+func TestCreateDaemonSetResources(t *testing.T) {
+	scheme := newNodeConfiguratorScheme(t)
+	c := withServerSideApply(fake.NewClientBuilder().WithScheme(scheme)).Build()
+	recorder := record.NewFakeRecorder(10)
+	a := New("test-name", "operators", c, scheme, logr.Discard())
+	a.Recorder = recorder
+	ctx := context.Background()
+
+	obs := &sdiv1alpha1.SDIObserver{
+		ObjectMeta: metav1.ObjectMeta{Name: "sdi", Namespace: "operators"},
+		Spec:       sdiv1alpha1.SDIObserverSpec{SDINodeLabel: "workload=sdi"},
+	}
+	var progressing *ProgressingError
+	if err := a.createDaemonSetResources(ctx, obs); !errors.As(err, &progressing) || progressing.Reason != sdiv1alpha1.ReasonNoSDINodes {
+		t.Fatalf("Expected no SDI nodes to be reported, got %v", err)
+	}
+
+	ds := &appsv1.DaemonSet{}
+	if err := c.Get(ctx, client.ObjectKey{Name: NodeConfiguratorName, Namespace: "operators"}, ds); err != nil {
+		t.Fatalf("Failed to get daemonset: %v", err)
+	}
+	if got := ds.Spec.Template.Spec.NodeSelector; len(got) != 1 || got["workload"] != "sdi" {
+		t.Errorf("Expected node selector from the SDI node label, got %v", got)
+	}
+	rb := &rbacv1.RoleBinding{}
+	if err := c.Get(ctx, client.ObjectKey{Name: NodeConfiguratorName, Namespace: "operators"}, rb); err != nil {
+		t.Fatalf("Failed to get role binding: %v", err)
+	}
+	if rb.Subjects[0].Namespace != "operators" {
+		t.Errorf("Expected role binding subject in the observer namespace, got %s", rb.Subjects[0].Namespace)
+	}
+
+	// Revert a hand edit of the daemonset.
+	ds.Spec.Template.Spec.NodeSelector = map[string]string{"node-role.kubernetes.io/worker": ""}
+	if err := c.Update(ctx, ds); err != nil {
+		t.Fatalf("Failed to update daemonset: %v", err)
+	}
+	if err := a.createDaemonSetResources(ctx, obs); !errors.As(err, &progressing) {
+		t.Fatalf("Expected progressing error, got %v", err)
+	}
+	if err := c.Get(ctx, client.ObjectKeyFromObject(ds), ds); err != nil {
+		t.Fatalf("Failed to get daemonset: %v", err)
+	}
+	if got := ds.Spec.Template.Spec.NodeSelector; got["workload"] != "sdi" {
+		t.Errorf("Expected node selector to be corrected, got %v", got)
+	}
+	if len(recorder.Events) != 1 {
+		t.Fatalf("Expected 1 drift event, got %d", len(recorder.Events))
+	}
+	if event := <-recorder.Events; !strings.Contains(event, "DaemonSet "+NodeConfiguratorName) {
+		t.Errorf("Unexpected event %q", event)
+	}
+}
+
+func TestCreateDaemonSetResources_OwnerReferences(t *testing.T) {
+	scheme := newNodeConfiguratorScheme(t)
+	previous := &sdiv1alpha1.SDIObserver{ObjectMeta: metav1.ObjectMeta{Name: "previous", Namespace: "operators", UID: "previous-uid"}}
+	obs := &sdiv1alpha1.SDIObserver{ObjectMeta: metav1.ObjectMeta{Name: "sdi", Namespace: "operators", UID: "sdi-uid"}}
+
+	// The service account is still controlled by an observer no longer managing the node configuration.
+	sa := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: NodeConfiguratorName, Namespace: "operators"}}
+	if err := ctrl.SetControllerReference(previous, sa, scheme); err != nil {
+		t.Fatalf("Failed to set owner: %v", err)
+	}
+	c := withServerSideApply(fake.NewClientBuilder().WithScheme(scheme).WithObjects(sa)).Build()
+	a := New("test-name", "operators", c, scheme, logr.Discard())
+	a.Recorder = record.NewFakeRecorder(10)
+	ctx := context.Background()
+
+	var progressing *ProgressingError
+	if err := a.createDaemonSetResources(ctx, obs); !errors.As(err, &progressing) {
+		t.Fatalf("Expected progressing error, got %v", err)
+	}
+
+	resources, err := renderNodeConfiguratorResources(obs)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	for _, resource := range resources {
+		obj := resource.existing
+		if err := c.Get(ctx, client.ObjectKeyFromObject(resource.desired), obj); err != nil {
+			t.Fatalf("Failed to get %T: %v", obj, err)
+		}
+		if !metav1.IsControlledBy(obj, obs) || len(obj.GetOwnerReferences()) != 1 {
+			t.Errorf("Expected %T to be controlled by the observer only, got %v", obj, obj.GetOwnerReferences())
+		}
+		if !isOwnedBy(obj, obs) {
+			t.Errorf("Expected %T to be marked as owned by the observer", obj)
+		}
+	}
+}
+
+func newNodeConfiguratorPod(node, generation string, initState corev1.ContainerState) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      NodeConfiguratorName + "-" + node,
+			Namespace: "operators",
+			Labels: map[string]string{
+				"app":                      NodeConfiguratorName,
+				"daemonset":                NodeConfiguratorName,
+				podTemplateGenerationLabel: generation,
+			},
+		},
+		Spec: corev1.PodSpec{NodeName: node},
+		Status: corev1.PodStatus{InitContainerStatuses: []corev1.ContainerStatus{
+			{Name: nodeConfiguratorContainerName, State: initState},
+		}},
+	}
+}
+
+func TestCheckNodeConfiguratorRollout(t *testing.T) {
+	scheme := newNodeConfiguratorScheme(t)
+	obs := &sdiv1alpha1.SDIObserver{ObjectMeta: metav1.ObjectMeta{Name: "sdi", Namespace: "operators"}}
+	ds, err := renderNodeConfiguratorDaemonSet(obs)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	ds.Generation = 2
+	ds.Status = appsv1.DaemonSetStatus{ObservedGeneration: 2, DesiredNumberScheduled: 3}
+
+	done := corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 0}}
+	failed := corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 1}}
+	running := corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}
+
+	tests := []struct {
+		name     string
+		pods     []*corev1.Pod
+		reason   string
+		failed   bool
+		expected []string
+	}{
+		{
+			name: "configuring",
+			pods: []*corev1.Pod{
+				newNodeConfiguratorPod("node-c", "1", done),
+				newNodeConfiguratorPod("node-a", "2", done),
+				newNodeConfiguratorPod("node-b", "2", running),
+			},
+			reason:   sdiv1alpha1.ReasonNodesUpdating,
+			expected: []string{"node-a=Done", "node-b=Working", "node-c=Working"},
+		},
+		{
+			name: "failed",
+			pods: []*corev1.Pod{
+				newNodeConfiguratorPod("node-a", "2", done),
+				newNodeConfiguratorPod("node-b", "2", failed),
+				newNodeConfiguratorPod("node-c", "2", done),
+			},
+			failed:   true,
+			expected: []string{"node-a=Done", "node-b=Degraded", "node-c=Done"},
+		},
+		{
+			name: "done",
+			pods: []*corev1.Pod{
+				newNodeConfiguratorPod("node-a", "2", done),
+				newNodeConfiguratorPod("node-b", "2", done),
+				newNodeConfiguratorPod("node-c", "2", done),
+			},
+			expected: []string{"node-a=Done", "node-b=Done", "node-c=Done"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			builder := fake.NewClientBuilder().WithScheme(scheme).WithObjects(ds.DeepCopy())
+			for _, pod := range tt.pods {
+				builder = builder.WithObjects(pod)
+			}
+			a := New("test-name", "operators", builder.Build(), scheme, logr.Discard())
+			obs := obs.DeepCopy()
+
+			err := a.checkNodeConfiguratorRollout(context.Background(), obs)
+			var progressing *ProgressingError
+			switch {
+			case tt.failed:
+				if err == nil || errors.As(err, &progressing) || !strings.Contains(err.Error(), "node node-b") {
+					t.Errorf("Expected failure of node-b, got %v", err)
+				}
+			case tt.reason != "":
+				if !errors.As(err, &progressing) || progressing.Reason != tt.reason {
+					t.Errorf("Expected progressing with reason %s, got %v", tt.reason, err)
+				}
+			case err != nil:
+				t.Errorf("Expected no error, got %v", err)
+			}
+
+			var states []string
+			for _, node := range obs.Status.SDINodeConfigStatus.Nodes {
+				states = append(states, node.Name+"="+node.State)
+			}
+			if strings.Join(states, ",") != strings.Join(tt.expected, ",") {
+				t.Errorf("Expected node states %v, got %v", tt.expected, states)
+			}
+			if obs.Status.SDINodeConfigStatus.MachineCount != 3 {
+				t.Errorf("Expected 3 SDI nodes, got %d", obs.Status.SDINodeConfigStatus.MachineCount)
+			}
+		})
+	}
+}
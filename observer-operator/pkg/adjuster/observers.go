@@ -0,0 +1,93 @@
+package adjuster
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	sdiv1alpha1 "github.com/redhat-sap/sap-data-intelligence/observer-operator/api/v1alpha1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Several SDIObservers may run on the same cluster, one per SDI instance. The cluster-scoped objects
+// (the sdi MachineConfigPool, the KubeletConfig, the MachineConfig and the node-configurator) and the
+// shared datahub-system namespace are managed by a single observer only, so that the observers do not
+// fight over them. The owner is the oldest observer eligible for the job. An SDI instance is observed by a
+// single observer; further observers of its namespace are rejected. The SLC Bridge namespace may be shared
+// by several SDI instances, its route and node selector are managed by a single observer, as is the node
+// selector of the namespace shared by the observers. An observer in DryRun mode changes
+// nothing and thus owns nothing; it does not block an observer in Enforce mode created after it.
+
+// NodeConfigOwner returns the SDIObserver managing the SDI node configuration. Nil is returned if no
+// observer manages it.
+func (a *Adjuster) NodeConfigOwner(ctx context.Context) (*sdiv1alpha1.SDIObserver, error) {
+	return a.oldestObserver(ctx, func(obs *sdiv1alpha1.SDIObserver) bool {
+		return obs.Spec.ManageSDINodeConfig
+	})
+}
+
+// SharedNamespaceOwner returns the SDIObserver annotating the namespaces shared by all SDI instances.
+func (a *Adjuster) SharedNamespaceOwner(ctx context.Context) (*sdiv1alpha1.SDIObserver, error) {
+	return a.oldestObserver(ctx, func(*sdiv1alpha1.SDIObserver) bool {
+		return true
+	})
+}
+
+// SDINamespaceOwner returns the SDIObserver observing the SDI namespace. Nil is returned if no observer
+// observes it.
+func (a *Adjuster) SDINamespaceOwner(ns string, ctx context.Context) (*sdiv1alpha1.SDIObserver, error) {
+	return a.oldestObserver(ctx, func(obs *sdiv1alpha1.SDIObserver) bool {
+		return obs.Spec.SDINamespace == ns
+	})
+}
+
+// SLCBRouteOwner returns the SDIObserver managing the SLC Bridge route and the node selector of the
+// namespace. Nil is returned if no observer manages it.
+func (a *Adjuster) SLCBRouteOwner(ns string, ctx context.Context) (*sdiv1alpha1.SDIObserver, error) {
+	return a.oldestObserver(ctx, func(obs *sdiv1alpha1.SDIObserver) bool {
+		return obs.Spec.SLCBNamespace == ns
+	})
+}
+
+// ObserverNamespaceOwner returns the SDIObserver annotating the namespace of the observers. Nil is returned
+// if no observer lives in the namespace.
+func (a *Adjuster) ObserverNamespaceOwner(ns string, ctx context.Context) (*sdiv1alpha1.SDIObserver, error) {
+	return a.oldestObserver(ctx, func(obs *sdiv1alpha1.SDIObserver) bool {
+		return obs.Namespace == ns
+	})
+}
+
+// IsSameObserver tells whether both observers refer to the same resource.
+func IsSameObserver(a, b *sdiv1alpha1.SDIObserver) bool {
+	if a == nil || b == nil {
+		return false
+	}
+	return a.Namespace == b.Namespace && a.Name == b.Name
+}
+
+func (a *Adjuster) oldestObserver(ctx context.Context, eligible func(*sdiv1alpha1.SDIObserver) bool) (*sdiv1alpha1.SDIObserver, error) {
+	list := &sdiv1alpha1.SDIObserverList{}
+	if err := a.Client.List(ctx, list); err != nil {
+		return nil, fmt.Errorf("unable to list SDIObservers: %w", err)
+	}
+
+	var candidates []*sdiv1alpha1.SDIObserver
+	for i := range list.Items {
+		obs := &list.Items[i]
+		if obs.DeletionTimestamp == nil && obs.Spec.Mode != sdiv1alpha1.ObserverModeDryRun && eligible(obs) {
+			candidates = append(candidates, obs)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		ti, tj := candidates[i].CreationTimestamp, candidates[j].CreationTimestamp
+		if !ti.Equal(&tj) {
+			return ti.Before(&tj)
+		}
+		return client.ObjectKeyFromObject(candidates[i]).String() < client.ObjectKeyFromObject(candidates[j]).String()
+	})
+	return candidates[0], nil
+}
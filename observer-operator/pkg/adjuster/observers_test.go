@@ -0,0 +1,166 @@
+package adjuster
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	sdiv1alpha1 "github.com/redhat-sap/sap-data-intelligence/observer-operator/api/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newObserver(name, sdiNamespace string, created time.Time, manageNodes bool) *sdiv1alpha1.SDIObserver {
+	return &sdiv1alpha1.SDIObserver{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              name,
+			Namespace:         "sdi-observer",
+			CreationTimestamp: metav1.NewTime(created),
+		},
+		Spec: sdiv1alpha1.SDIObserverSpec{
+			SDINamespace:        sdiNamespace,
+			SLCBNamespace:       "sap-slcbridge",
+			ManageSDINodeConfig: manageNodes,
+		},
+	}
+}
+
+func TestNodeConfigOwner(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := sdiv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatalf("Failed to add scheme: %v", err)
+	}
+	now := time.Now().Truncate(time.Second)
+	dev := newObserver("dev", "sdi-dev", now.Add(-2*time.Hour), false)
+	qa := newObserver("qa", "sdi-qa", now.Add(-time.Hour), true)
+	prod := newObserver("prod", "sdi-prod", now, true)
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(dev, qa, prod).Build()
+	a := New("test-name", "sdi-observer", c, scheme, logr.Discard())
+	ctx := context.Background()
+
+	owner, err := a.NodeConfigOwner(ctx)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !IsSameObserver(owner, qa) {
+		t.Errorf("Expected qa to own the node config, got %v", owner)
+	}
+
+	owner, err = a.SharedNamespaceOwner(ctx)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !IsSameObserver(owner, dev) {
+		t.Errorf("Expected dev to own the shared namespaces, got %v", owner)
+	}
+}
+
+func TestNodeConfigOwner_DryRun(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := sdiv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatalf("Failed to add scheme: %v", err)
+	}
+	now := time.Now().Truncate(time.Second)
+	planned := newObserver("planned", "sdi", now.Add(-time.Hour), true)
+	planned.Spec.Mode = sdiv1alpha1.ObserverModeDryRun
+	prod := newObserver("prod", "sdi", now, true)
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(planned, prod).Build()
+	a := New("test-name", "sdi-observer", c, scheme, logr.Discard())
+	ctx := context.Background()
+
+	// The older observer in DryRun mode does not block the observer in Enforce mode.
+	for name, ownerOf := range map[string]func(context.Context) (*sdiv1alpha1.SDIObserver, error){
+		"node config":       a.NodeConfigOwner,
+		"shared namespaces": a.SharedNamespaceOwner,
+		"SDI namespace": func(ctx context.Context) (*sdiv1alpha1.SDIObserver, error) {
+			return a.SDINamespaceOwner("sdi", ctx)
+		},
+	} {
+		owner, err := ownerOf(ctx)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if !IsSameObserver(owner, prod) {
+			t.Errorf("Expected prod to own the %s, got %v", name, owner)
+		}
+	}
+}
+
+func TestSDINamespaceOwner(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := sdiv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatalf("Failed to add scheme: %v", err)
+	}
+	now := time.Now().Truncate(time.Second)
+	dev := newObserver("dev", "sdi-dev", now.Add(-2*time.Hour), false)
+	qa := newObserver("qa", "sdi-qa", now.Add(-time.Hour), false)
+	duplicate := newObserver("duplicate", "sdi-qa", now, false)
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(dev, qa, duplicate).Build()
+	a := New("test-name", "sdi-observer", c, scheme, logr.Discard())
+	ctx := context.Background()
+
+	owner, err := a.SDINamespaceOwner("sdi-qa", ctx)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !IsSameObserver(owner, qa) {
+		t.Errorf("Expected qa to observe the sdi-qa namespace, got %v", owner)
+	}
+
+	// The SLC Bridge namespace is shared by all the observers.
+	owner, err = a.SLCBRouteOwner("sap-slcbridge", ctx)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !IsSameObserver(owner, dev) {
+		t.Errorf("Expected dev to own the SLCB route, got %v", owner)
+	}
+}
+
+func TestAdjustSDIDataHub_AllInstances(t *testing.T) {
+	scheme := runtime.NewScheme()
+	gvk := schema.GroupVersionKind{Group: DataHubAPIGroup, Version: DataHubAPIVersion, Kind: DataHubKind}
+	scheme.AddKnownTypeWithName(gvk, &unstructured.Unstructured{})
+	scheme.AddKnownTypeWithName(gvk.GroupVersion().WithKind(DataHubKind+"List"), &unstructured.UnstructuredList{})
+
+	newDataHub := func(name string, vRep map[string]interface{}) *unstructured.Unstructured {
+		obj := &unstructured.Unstructured{Object: map[string]interface{}{
+			"spec": map[string]interface{}{"vsystem": map[string]interface{}{"vRep": vRep}},
+		}}
+		obj.SetGroupVersionKind(gvk)
+		obj.SetName(name)
+		obj.SetNamespace("sdi")
+		return obj
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		newDataHub("default", map[string]interface{}{}),
+		newDataHub("custom", map[string]interface{}{}),
+	).Build()
+	a := New("test-name", "sdi-observer", c, scheme, logr.Discard())
+	ctx := context.Background()
+
+	if err := a.adjustSDIDataHub("sdi", &sdiv1alpha1.SDIObserver{}, ctx); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	for _, name := range []string{"default", "custom"} {
+		got := &unstructured.Unstructured{}
+		got.SetGroupVersionKind(gvk)
+		if err := c.Get(ctx, client.ObjectKey{Name: name, Namespace: "sdi"}, got); err != nil {
+			t.Fatalf("Failed to get DataHub %s: %v", name, err)
+		}
+		exportsMask, _, _ := unstructured.NestedBool(got.Object, "spec", "vsystem", "vRep", "exportsMask")
+		if !exportsMask {
+			t.Errorf("Expected DataHub %s to be patched", name)
+		}
+	}
+
+	if err := a.adjustSDIDataHub("empty", &sdiv1alpha1.SDIObserver{}, ctx); !IsNotFound(err) {
+		t.Errorf("Expected not found error for a namespace without DataHub, got %v", err)
+	}
+}
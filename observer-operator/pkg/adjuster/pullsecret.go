@@ -0,0 +1,236 @@
+package adjuster
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	sdiv1alpha1 "github.com/redhat-sap/sap-data-intelligence/observer-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// pullSecretAction tells whether a secret shall be linked to or unlinked from a service account.
+type pullSecretAction string
+
+const (
+	pullSecretLink   pullSecretAction = "link"
+	pullSecretUnlink pullSecretAction = "unlink"
+)
+
+// AdjustSDIRegistryPullSecret links the SDI registry pull secrets with the default service account in
+// the SDI namespace.
+//
+// Some SDI backup jobs (e.g. default-*-backup-hana) run under the default service account which does
+// not have any image pull secret set. As a result, their images cannot be pulled from a registry
+// requiring authentication. The pull secret is created by SLC Bridge and is usually called
+// "slp-docker-registry-pull-secret". It can be overridden in the optional VoraCluster resource.
+func (a *Adjuster) AdjustSDIRegistryPullSecret(ns string, obs *sdiv1alpha1.SDIObserver, ctx context.Context) error {
+	if ns == "" {
+		return fmt.Errorf("namespace cannot be empty")
+	}
+	if obs == nil {
+		return fmt.Errorf("SDIObserver cannot be nil")
+	}
+
+	secrets, err := a.desiredPullSecrets(ns, ctx)
+	if err != nil {
+		a.setPullSecretCondition(obs, metav1.ConditionFalse, sdiv1alpha1.ReasonFailed, err.Error())
+		return err
+	}
+
+	linked, err := a.managePullSecrets(ns, DefaultServiceAccountName, secrets, ctx)
+	if err != nil {
+		a.setPullSecretCondition(obs, metav1.ConditionFalse, sdiv1alpha1.ReasonFailed, err.Error())
+		return err
+	}
+
+	if len(linked) == 0 {
+		a.setPullSecretCondition(obs, metav1.ConditionFalse, sdiv1alpha1.ReasonPullSecretNotFound,
+			fmt.Sprintf("No registry pull secret found in namespace %s", ns))
+		return nil
+	}
+	a.setPullSecretCondition(obs, metav1.ConditionTrue, sdiv1alpha1.ReasonPullSecretLinked,
+		fmt.Sprintf("Service account %s is linked with pull secrets: %s", DefaultServiceAccountName, strings.Join(linked, ", ")))
+	return nil
+}
+
+// desiredPullSecrets determines which secrets shall be linked to or unlinked from the default service
+// account. The secret configured in the VoraCluster always wins over the SLC Bridge one.
+func (a *Adjuster) desiredPullSecrets(ns string, ctx context.Context) (map[string]pullSecretAction, error) {
+	secrets := map[string]pullSecretAction{}
+
+	vcSecret, err := a.getVoraClusterPullSecret(ns, ctx)
+	if err != nil {
+		return nil, err
+	}
+	if vcSecret != "" {
+		secrets[vcSecret] = pullSecretLink
+	}
+
+	if _, ok := secrets[SLPDockerRegistryPullSecretName]; ok {
+		return secrets, nil
+	}
+
+	secret := &corev1.Secret{}
+	err = a.Client.Get(ctx, client.ObjectKey{Name: SLPDockerRegistryPullSecretName, Namespace: ns}, secret)
+	switch {
+	case err == nil:
+		secrets[SLPDockerRegistryPullSecretName] = pullSecretLink
+	case errors.IsNotFound(err):
+		secrets[SLPDockerRegistryPullSecretName] = pullSecretUnlink
+	default:
+		return nil, fmt.Errorf("unable to get secret %s: %w", SLPDockerRegistryPullSecretName, err)
+	}
+	return secrets, nil
+}
+
+// getVoraClusterPullSecret returns the image pull secret configured in the VoraCluster resource. An empty
+// string is returned if the resource or its CRD does not exist.
+func (a *Adjuster) getVoraClusterPullSecret(ns string, ctx context.Context) (string, error) {
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(schema.GroupVersionKind{
+		Group:   VoraClusterAPIGroup,
+		Version: VoraClusterAPIVersion,
+		Kind:    VoraClusterKind,
+	})
+
+	if err := a.Client.Get(ctx, client.ObjectKey{Name: VoraClusterName, Namespace: ns}, obj); err != nil {
+		if errors.IsNotFound(err) || meta.IsNoMatchError(err) {
+			a.logger.V(1).Info("VoraCluster does not exist; using the default pull secret", "namespace", ns)
+			return "", nil
+		}
+		return "", fmt.Errorf("unable to get VoraCluster %s: %w", VoraClusterName, err)
+	}
+
+	secret, _, err := unstructured.NestedString(obj.Object, "spec", "docker", "imagePullSecret")
+	if err != nil {
+		return "", fmt.Errorf("unable to read VoraCluster image pull secret: %w", err)
+	}
+	return secret, nil
+}
+
+// managePullSecrets links and unlinks the given secrets with the service account for image pulls. It
+// returns the sorted names of the secrets linked after the adjustment.
+func (a *Adjuster) managePullSecrets(ns, saName string, secrets map[string]pullSecretAction, ctx context.Context) ([]string, error) {
+	sa := &corev1.ServiceAccount{}
+	if err := a.Client.Get(ctx, client.ObjectKey{Name: saName, Namespace: ns}, sa); err != nil {
+		return nil, fmt.Errorf("unable to get service account %s: %w", saName, err)
+	}
+
+	// The secrets linked by the operator are recorded to be unlinked on cleanup.
+	recorded := linkedPullSecrets(sa)
+	updated := false
+	var linked []string
+	for name, action := range secrets {
+		present := isPullSecretLinked(sa, name)
+		switch {
+		case present && action == pullSecretLink:
+			a.logger.Info(fmt.Sprintf("Secret %s already linked with the %s service account for image pulls", name, saName))
+			linked = append(linked, name)
+		case present && action == pullSecretUnlink:
+			a.logger.Info(fmt.Sprintf("Unlinking secret %s from the %s service account", name, saName))
+			sa.ImagePullSecrets = removePullSecret(sa.ImagePullSecrets, name)
+			delete(recorded, name)
+			updated = true
+		case !present && action == pullSecretLink:
+			a.logger.Info(fmt.Sprintf("Linking secret %s to the %s service account", name, saName))
+			sa.ImagePullSecrets = append(sa.ImagePullSecrets, corev1.LocalObjectReference{Name: name})
+			recorded[name] = struct{}{}
+			linked = append(linked, name)
+			updated = true
+		}
+	}
+
+	if updated {
+		setLinkedPullSecrets(sa, recorded)
+		if err := a.Client.Update(ctx, sa); err != nil {
+			return nil, fmt.Errorf("unable to update service account %s: %w", saName, err)
+		}
+	}
+
+	sort.Strings(linked)
+	return linked, nil
+}
+
+func (a *Adjuster) setPullSecretCondition(obs *sdiv1alpha1.SDIObserver, status metav1.ConditionStatus, reason, message string) {
+	meta.SetStatusCondition(&obs.Status.Conditions, metav1.Condition{
+		Type:    sdiv1alpha1.ConditionTypeRegistryPullSecret,
+		Status:  status,
+		Reason:  reason,
+		Message: message,
+	})
+}
+
+// UnlinkSDIRegistryPullSecrets unlinks the pull secrets linked by the operator from the default service
+// account in the SDI namespace. The secrets linked by others are kept.
+func (a *Adjuster) UnlinkSDIRegistryPullSecrets(ns string, ctx context.Context) error {
+	sa := &corev1.ServiceAccount{}
+	if err := a.Client.Get(ctx, client.ObjectKey{Name: DefaultServiceAccountName, Namespace: ns}, sa); err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("unable to get service account %s: %w", DefaultServiceAccountName, err)
+	}
+	if _, ok := sa.Annotations[LinkedPullSecretsAnnotationKey]; !ok {
+		return nil
+	}
+
+	for name := range linkedPullSecrets(sa) {
+		a.logger.Info(fmt.Sprintf("Unlinking secret %s from the %s service account", name, DefaultServiceAccountName))
+		sa.ImagePullSecrets = removePullSecret(sa.ImagePullSecrets, name)
+	}
+	delete(sa.Annotations, LinkedPullSecretsAnnotationKey)
+	if err := a.Client.Update(ctx, sa); err != nil {
+		return fmt.Errorf("unable to update service account %s: %w", DefaultServiceAccountName, err)
+	}
+	return nil
+}
+
+// linkedPullSecrets returns the pull secrets linked with the service account by the operator.
+func linkedPullSecrets(sa *corev1.ServiceAccount) map[string]struct{} {
+	recorded := map[string]struct{}{}
+	for _, name := range strings.Split(sa.Annotations[LinkedPullSecretsAnnotationKey], ",") {
+		if name != "" {
+			recorded[name] = struct{}{}
+		}
+	}
+	return recorded
+}
+
+// setLinkedPullSecrets records the pull secrets linked with the service account by the operator.
+func setLinkedPullSecrets(sa *corev1.ServiceAccount, recorded map[string]struct{}) {
+	if len(recorded) == 0 {
+		delete(sa.Annotations, LinkedPullSecretsAnnotationKey)
+		return
+	}
+	if sa.Annotations == nil {
+		sa.Annotations = map[string]string{}
+	}
+	sa.Annotations[LinkedPullSecretsAnnotationKey] = strings.Join(sortedKeys(recorded), ",")
+}
+
+func isPullSecretLinked(sa *corev1.ServiceAccount, name string) bool {
+	for i := range sa.ImagePullSecrets {
+		if sa.ImagePullSecrets[i].Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func removePullSecret(refs []corev1.LocalObjectReference, name string) []corev1.LocalObjectReference {
+	result := make([]corev1.LocalObjectReference, 0, len(refs))
+	for _, ref := range refs {
+		if ref.Name != name {
+			result = append(result, ref)
+		}
+	}
+	return result
+}
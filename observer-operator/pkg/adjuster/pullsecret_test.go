@@ -0,0 +1,135 @@
+package adjuster
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-logr/logr"
+	sdiv1alpha1 "github.com/redhat-sap/sap-data-intelligence/observer-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newPullSecretTestAdjuster(t *testing.T, objs ...client.Object) *Adjuster {
+	t.Helper()
+	scheme := runtime.NewScheme()
+	if err := corev1.AddToScheme(scheme); err != nil {
+		t.Fatalf("Failed to add scheme: %v", err)
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build()
+	return New("test-name", "test-namespace", c, scheme, logr.Discard())
+}
+
+func TestAdjustSDIRegistryPullSecret_Link(t *testing.T) {
+	sa := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: DefaultServiceAccountName, Namespace: "sdi"}}
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: SLPDockerRegistryPullSecretName, Namespace: "sdi"}}
+	a := newPullSecretTestAdjuster(t, sa, secret)
+	obs := &sdiv1alpha1.SDIObserver{}
+
+	if err := a.AdjustSDIRegistryPullSecret("sdi", obs, context.Background()); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	got := &corev1.ServiceAccount{}
+	if err := a.Client.Get(context.Background(), client.ObjectKeyFromObject(sa), got); err != nil {
+		t.Fatalf("Failed to get service account: %v", err)
+	}
+	if !isPullSecretLinked(got, SLPDockerRegistryPullSecretName) {
+		t.Errorf("Expected secret %s to be linked, got %v", SLPDockerRegistryPullSecretName, got.ImagePullSecrets)
+	}
+	if !meta.IsStatusConditionTrue(obs.Status.Conditions, sdiv1alpha1.ConditionTypeRegistryPullSecret) {
+		t.Errorf("Expected condition %s to be true", sdiv1alpha1.ConditionTypeRegistryPullSecret)
+	}
+	if got.Annotations[LinkedPullSecretsAnnotationKey] != SLPDockerRegistryPullSecretName {
+		t.Errorf("Expected the link to be recorded, got %v", got.Annotations)
+	}
+
+	// A second run must not link the secret twice.
+	if err := a.AdjustSDIRegistryPullSecret("sdi", obs, context.Background()); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := a.Client.Get(context.Background(), client.ObjectKeyFromObject(sa), got); err != nil {
+		t.Fatalf("Failed to get service account: %v", err)
+	}
+	if len(got.ImagePullSecrets) != 1 {
+		t.Errorf("Expected exactly one pull secret, got %v", got.ImagePullSecrets)
+	}
+}
+
+func TestAdjustSDIRegistryPullSecret_Unlink(t *testing.T) {
+	sa := &corev1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{Name: DefaultServiceAccountName, Namespace: "sdi"},
+		ImagePullSecrets: []corev1.LocalObjectReference{
+			{Name: "other"},
+			{Name: SLPDockerRegistryPullSecretName},
+		},
+	}
+	a := newPullSecretTestAdjuster(t, sa)
+	obs := &sdiv1alpha1.SDIObserver{}
+
+	if err := a.AdjustSDIRegistryPullSecret("sdi", obs, context.Background()); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	got := &corev1.ServiceAccount{}
+	if err := a.Client.Get(context.Background(), client.ObjectKeyFromObject(sa), got); err != nil {
+		t.Fatalf("Failed to get service account: %v", err)
+	}
+	if isPullSecretLinked(got, SLPDockerRegistryPullSecretName) {
+		t.Errorf("Expected secret %s to be unlinked", SLPDockerRegistryPullSecretName)
+	}
+	if !isPullSecretLinked(got, "other") {
+		t.Error("Expected unrelated pull secret to be kept")
+	}
+	cond := meta.FindStatusCondition(obs.Status.Conditions, sdiv1alpha1.ConditionTypeRegistryPullSecret)
+	if cond == nil || cond.Reason != sdiv1alpha1.ReasonPullSecretNotFound {
+		t.Errorf("Expected condition with reason %s, got %v", sdiv1alpha1.ReasonPullSecretNotFound, cond)
+	}
+}
+
+func TestAdjustSDIRegistryPullSecret_MissingServiceAccount(t *testing.T) {
+	a := newPullSecretTestAdjuster(t)
+	obs := &sdiv1alpha1.SDIObserver{}
+
+	if err := a.AdjustSDIRegistryPullSecret("sdi", obs, context.Background()); err == nil {
+		t.Error("Expected error for missing service account, got nil")
+	}
+	if !meta.IsStatusConditionFalse(obs.Status.Conditions, sdiv1alpha1.ConditionTypeRegistryPullSecret) {
+		t.Errorf("Expected condition %s to be false", sdiv1alpha1.ConditionTypeRegistryPullSecret)
+	}
+}
+
+func TestUnlinkSDIRegistryPullSecrets(t *testing.T) {
+	sa := &corev1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        DefaultServiceAccountName,
+			Namespace:   "sdi",
+			Annotations: map[string]string{LinkedPullSecretsAnnotationKey: SLPDockerRegistryPullSecretName},
+		},
+		ImagePullSecrets: []corev1.LocalObjectReference{
+			{Name: "other"},
+			{Name: SLPDockerRegistryPullSecretName},
+		},
+	}
+	a := newPullSecretTestAdjuster(t, sa)
+	ctx := context.Background()
+
+	if err := a.UnlinkSDIRegistryPullSecrets("sdi", ctx); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	got := &corev1.ServiceAccount{}
+	if err := a.Client.Get(ctx, client.ObjectKeyFromObject(sa), got); err != nil {
+		t.Fatalf("Failed to get service account: %v", err)
+	}
+	// The secrets linked by others are kept.
+	if len(got.ImagePullSecrets) != 1 || got.ImagePullSecrets[0].Name != "other" {
+		t.Errorf("Expected only the secret linked by the operator to be unlinked, got %v", got.ImagePullSecrets)
+	}
+	if _, ok := got.Annotations[LinkedPullSecretsAnnotationKey]; ok {
+		t.Error("Expected the record of the links to be removed")
+	}
+}
@@ -0,0 +1,183 @@
+package adjuster
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	sdiv1alpha1 "github.com/redhat-sap/sap-data-intelligence/observer-operator/api/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// On OCP 4.8, a StatefulSet may keep deploying a broken revision as a pod even though a newer and correct
+// revision is available. The pods of the outdated revisions are deleted so that the new revision can be
+// deployed: first gracefully and, if a pod of the same outdated revision is still there on a later pass,
+// forcefully. The graceful deletions are recorded in an annotation of the StatefulSet so that the
+// escalation survives restarts of the operator.
+
+// gracefulDeletion records the graceful deletion of an outdated pod of a StatefulSet.
+type gracefulDeletion struct {
+	Pod      string      `json:"pod"`
+	Revision string      `json:"revision"`
+	Time     metav1.Time `json:"time"`
+}
+
+// PruneStaleStatefulSetRevisions deletes the outdated pods of the given StatefulSets in the SDI namespace
+// which are stuck on an outdated revision. StatefulSets which do not exist are ignored.
+func (a *Adjuster) PruneStaleStatefulSetRevisions(ns string, names []string, _ *sdiv1alpha1.SDIObserver, ctx context.Context) error {
+	var errs []error
+	for _, name := range names {
+		ss := &appsv1.StatefulSet{}
+		if err := a.Client.Get(ctx, client.ObjectKey{Name: name, Namespace: ns}, ss); err != nil {
+			if errors.IsNotFound(err) {
+				a.logger.Info(fmt.Sprintf("StatefulSet %s does not exist; nothing to prune", name))
+				continue
+			}
+			errs = append(errs, fmt.Errorf("unable to get statefulset %s: %w", name, err))
+			continue
+		}
+		if err := a.pruneStatefulSetOldRevision(ctx, ss, time.Now()); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// pruneStatefulSetOldRevision deletes the pods of the outdated revisions of the StatefulSet unless a pod of
+// the update revision exists already. A pod gracefully deleted at least gracefulDeletionEscalationPeriod
+// ago and still running the same outdated revision is deleted forcefully.
+func (a *Adjuster) pruneStatefulSetOldRevision(ctx context.Context, ss *appsv1.StatefulSet, now time.Time) error {
+	updateRevision := ss.Status.UpdateRevision
+	if updateRevision == "" || updateRevision == ss.Status.CurrentRevision {
+		a.logger.Info(fmt.Sprintf("StatefulSet %s current revision matches update revision", ss.Name))
+		return a.recordGracefulDeletions(ctx, ss, nil)
+	}
+
+	selector, err := metav1.LabelSelectorAsSelector(ss.Spec.Selector)
+	if err != nil {
+		return fmt.Errorf("unable to determine the pod selector of statefulset %s: %w", ss.Name, err)
+	}
+	if selector.Empty() {
+		return fmt.Errorf("statefulset %s selects all the pods, not deleting any", ss.Name)
+	}
+
+	updated, err := a.statefulSetPods(ctx, ss, selector, selection.Equals)
+	if err != nil {
+		return err
+	}
+	if len(updated) > 0 {
+		a.logger.Info(fmt.Sprintf("Pods for the updated revision of StatefulSet %s exist; no action needed", ss.Name))
+		return nil
+	}
+
+	outdated, err := a.statefulSetPods(ctx, ss, selector, selection.NotEquals)
+	if err != nil {
+		return err
+	}
+	if len(outdated) == 0 {
+		a.logger.Info(fmt.Sprintf("No outdated pods of StatefulSet %s found", ss.Name))
+		return nil
+	}
+
+	attempted, err := gracefulDeletionsOf(ss)
+	if err != nil {
+		a.logger.Info(fmt.Sprintf("Ignoring invalid annotation %s of StatefulSet %s: %v", GracefulDeletionsAnnotationKey, ss.Name, err))
+	}
+	var deletions []gracefulDeletion
+	for i := range outdated {
+		pod := &outdated[i]
+		revision := pod.Labels[ControllerRevisionHashLabel]
+		previous := findGracefulDeletion(attempted, pod.Name, revision)
+		switch {
+		case previous == nil:
+			a.logger.Info(fmt.Sprintf("Deleting pod %s with outdated revision %s of StatefulSet %s", pod.Name, revision, ss.Name))
+			if err := a.Client.Delete(ctx, pod, client.GracePeriodSeconds(StaleRevisionGracePeriodSeconds)); client.IgnoreNotFound(err) != nil {
+				return fmt.Errorf("unable to delete operand pod: %w", err)
+			}
+			deletions = append(deletions, gracefulDeletion{Pod: pod.Name, Revision: revision, Time: metav1.NewTime(now)})
+		case now.Sub(previous.Time.Time) < gracefulDeletionEscalationPeriod:
+			a.logger.Info(fmt.Sprintf("Waiting for the graceful deletion of pod %s of StatefulSet %s", pod.Name, ss.Name))
+			deletions = append(deletions, *previous)
+		default:
+			a.logger.Info(fmt.Sprintf("Force deleting pod %s with outdated revision %s of StatefulSet %s", pod.Name, revision, ss.Name))
+			if err := a.Client.Delete(ctx, pod, client.GracePeriodSeconds(0)); client.IgnoreNotFound(err) != nil {
+				return fmt.Errorf("unable to force delete operand pod: %w", err)
+			}
+		}
+	}
+	return a.recordGracefulDeletions(ctx, ss, deletions)
+}
+
+// statefulSetPods returns the pods of the StatefulSet whose revision matches the update revision with the
+// given operator.
+func (a *Adjuster) statefulSetPods(ctx context.Context, ss *appsv1.StatefulSet, selector labels.Selector, op selection.Operator) ([]corev1.Pod, error) {
+	revision, err := labels.NewRequirement(ControllerRevisionHashLabel, op, []string{ss.Status.UpdateRevision})
+	if err != nil {
+		return nil, err
+	}
+	pods := &corev1.PodList{}
+	if err := a.Client.List(ctx, pods, client.InNamespace(ss.Namespace),
+		client.MatchingLabelsSelector{Selector: selector.Add(*revision)}); err != nil {
+		return nil, fmt.Errorf("unable to get operand pod list: %w", err)
+	}
+	return pods.Items, nil
+}
+
+func gracefulDeletionsOf(ss *appsv1.StatefulSet) ([]gracefulDeletion, error) {
+	value, ok := ss.Annotations[GracefulDeletionsAnnotationKey]
+	if !ok {
+		return nil, nil
+	}
+	var deletions []gracefulDeletion
+	if err := json.Unmarshal([]byte(value), &deletions); err != nil {
+		return nil, err
+	}
+	return deletions, nil
+}
+
+func findGracefulDeletion(deletions []gracefulDeletion, pod, revision string) *gracefulDeletion {
+	for i := range deletions {
+		if deletions[i].Pod == pod && deletions[i].Revision == revision {
+			return &deletions[i]
+		}
+	}
+	return nil
+}
+
+// recordGracefulDeletions stores the pending graceful deletions in the annotation of the StatefulSet. The
+// annotation is removed when there are none.
+func (a *Adjuster) recordGracefulDeletions(ctx context.Context, ss *appsv1.StatefulSet, deletions []gracefulDeletion) error {
+	current, hasCurrent := ss.Annotations[GracefulDeletionsAnnotationKey]
+	if len(deletions) == 0 && !hasCurrent {
+		return nil
+	}
+
+	patch := client.MergeFrom(ss.DeepCopy())
+	if len(deletions) == 0 {
+		delete(ss.Annotations, GracefulDeletionsAnnotationKey)
+	} else {
+		data, err := json.Marshal(deletions)
+		if err != nil {
+			return err
+		}
+		if string(data) == current {
+			return nil
+		}
+		if ss.Annotations == nil {
+			ss.Annotations = map[string]string{}
+		}
+		ss.Annotations[GracefulDeletionsAnnotationKey] = string(data)
+	}
+	if err := a.Client.Patch(ctx, ss, patch); err != nil {
+		return fmt.Errorf("unable to record the pod deletions of statefulset %s: %w", ss.Name, err)
+	}
+	return nil
+}
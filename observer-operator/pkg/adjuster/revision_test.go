@@ -0,0 +1,138 @@
+package adjuster
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	sdiv1alpha1 "github.com/redhat-sap/sap-data-intelligence/observer-operator/api/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+func newRevisionPod(name, app, revision string) *corev1.Pod {
+	return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+		Name:      name,
+		Namespace: "sdi",
+		Labels:    map[string]string{"app": app, ControllerRevisionHashLabel: revision},
+	}}
+}
+
+func TestPruneStatefulSetOldRevision(t *testing.T) {
+	ss := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "hana", Namespace: "sdi"},
+		Spec: appsv1.StatefulSetSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "hana"}},
+		},
+		Status: appsv1.StatefulSetStatus{CurrentRevision: "hana-old", UpdateRevision: "hana-new"},
+	}
+	scheme := runtime.NewScheme()
+	for _, add := range []func(*runtime.Scheme) error{corev1.AddToScheme, appsv1.AddToScheme} {
+		if err := add(scheme); err != nil {
+			t.Fatalf("Failed to add scheme: %v", err)
+		}
+	}
+	// deletions maps the deleted pods to their grace period.
+	deletions := map[string]int64{}
+	c := fake.NewClientBuilder().WithScheme(scheme).
+		WithObjects(ss, newRevisionPod("hana-0", "hana", "hana-old"), newRevisionPod("other-0", "other", "other-old")).
+		WithInterceptorFuncs(interceptor.Funcs{
+			Delete: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.DeleteOption) error {
+				options := (&client.DeleteOptions{}).ApplyOptions(opts)
+				deletions[obj.GetName()] = *options.GracePeriodSeconds
+				return c.Delete(ctx, obj, opts...)
+			},
+		}).Build()
+	a := New("test-name", "operators", c, scheme, logr.Discard())
+	ctx := context.Background()
+	now := time.Now()
+
+	prune := func(at time.Time) *appsv1.StatefulSet {
+		t.Helper()
+		current := &appsv1.StatefulSet{}
+		if err := c.Get(ctx, client.ObjectKeyFromObject(ss), current); err != nil {
+			t.Fatalf("Failed to get statefulset: %v", err)
+		}
+		if err := a.pruneStatefulSetOldRevision(ctx, current, at); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if err := c.Get(ctx, client.ObjectKeyFromObject(ss), current); err != nil {
+			t.Fatalf("Failed to get statefulset: %v", err)
+		}
+		return current
+	}
+
+	// The outdated pod is deleted gracefully first and the attempt is recorded.
+	got := prune(now)
+	if period, ok := deletions["hana-0"]; !ok || period != StaleRevisionGracePeriodSeconds {
+		t.Errorf("Expected graceful deletion of hana-0, got %v", deletions)
+	}
+	if _, ok := got.Annotations[GracefulDeletionsAnnotationKey]; !ok {
+		t.Error("Expected the graceful deletion to be recorded")
+	}
+
+	// The pod comes back with the same outdated revision; it is given time to terminate.
+	if err := c.Create(ctx, newRevisionPod("hana-0", "hana", "hana-old")); err != nil {
+		t.Fatalf("Failed to create pod: %v", err)
+	}
+	delete(deletions, "hana-0")
+	prune(now.Add(time.Second))
+	if len(deletions) != 0 {
+		t.Errorf("Expected no deletion within the escalation period, got %v", deletions)
+	}
+
+	// Then it is deleted forcefully.
+	got = prune(now.Add(gracefulDeletionEscalationPeriod))
+	if period, ok := deletions["hana-0"]; !ok || period != 0 {
+		t.Errorf("Expected forced deletion of hana-0, got %v", deletions)
+	}
+	if _, ok := got.Annotations[GracefulDeletionsAnnotationKey]; ok {
+		t.Errorf("Expected the graceful deletion to be forgotten, got %v", got.Annotations)
+	}
+	if _, ok := deletions["other-0"]; ok {
+		t.Error("Expected the pods of other statefulsets to be left alone")
+	}
+
+	// Nothing is deleted once a pod of the update revision exists.
+	if err := c.Create(ctx, newRevisionPod("hana-1", "hana", "hana-new")); err != nil {
+		t.Fatalf("Failed to create pod: %v", err)
+	}
+	if err := c.Create(ctx, newRevisionPod("hana-0", "hana", "hana-old")); err != nil {
+		t.Fatalf("Failed to create pod: %v", err)
+	}
+	delete(deletions, "hana-0")
+	prune(now)
+	if len(deletions) != 0 {
+		t.Errorf("Expected no deletion while the update revision is rolled out, got %v", deletions)
+	}
+}
+
+func TestPruneStaleStatefulSetRevisions_Settled(t *testing.T) {
+	settled := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        VSystemVrepStsName,
+			Namespace:   "sdi",
+			Annotations: map[string]string{GracefulDeletionsAnnotationKey: `[{"pod":"vsystem-vrep-0","revision":"old","time":null}]`},
+		},
+		Status: appsv1.StatefulSetStatus{CurrentRevision: "new", UpdateRevision: "new"},
+	}
+	a := newSDIConfigTestAdjuster(t, settled)
+	ctx := context.Background()
+
+	if err := a.PruneStaleStatefulSetRevisions("sdi", []string{VSystemVrepStsName, "missing"}, &sdiv1alpha1.SDIObserver{}, ctx); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	got := &appsv1.StatefulSet{}
+	if err := a.Client.Get(ctx, client.ObjectKeyFromObject(settled), got); err != nil {
+		t.Fatalf("Failed to get statefulset: %v", err)
+	}
+	if _, ok := got.Annotations[GracefulDeletionsAnnotationKey]; ok {
+		t.Errorf("Expected the graceful deletions to be cleared once settled, got %v", got.Annotations)
+	}
+}
@@ -0,0 +1,134 @@
+package adjuster
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	configv1 "github.com/openshift/machine-config-operator/pkg/apis/machineconfiguration.openshift.io/v1"
+	sdiv1alpha1 "github.com/redhat-sap/sap-data-intelligence/observer-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Node annotations maintained by the machine config daemon
+const (
+	mcdCurrentConfigAnnotation = "machineconfiguration.openshift.io/currentConfig"
+	mcdDesiredConfigAnnotation = "machineconfiguration.openshift.io/desiredConfig"
+	mcdStateAnnotation         = "machineconfiguration.openshift.io/state"
+	mcdReasonAnnotation        = "machineconfiguration.openshift.io/reason"
+
+	mcdStateDegraded = "Degraded"
+)
+
+// checkMachineConfigPoolRollout reports the rollout of the SDI node configuration to the nodes of the sdi
+// MachineConfigPool in the SDINodeConfigStatus. A progressing error is returned until all the nodes run
+// the rendered config containing the SDI MachineConfig.
+func (a *Adjuster) checkMachineConfigPoolRollout(ctx context.Context, obs *sdiv1alpha1.SDIObserver) error {
+	pool := &configv1.MachineConfigPool{}
+	if err := a.Client.Get(ctx, client.ObjectKey{Name: SDIMachineConfigPoolName}, pool); err != nil {
+		return fmt.Errorf("unable to get operand machine config pool %s: %w", SDIMachineConfigPoolName, err)
+	}
+
+	nodes, err := a.poolNodes(ctx, pool)
+	if err != nil {
+		return err
+	}
+
+	status := &obs.Status.SDINodeConfigStatus
+	status.RenderedConfig = pool.Spec.Configuration.Name
+	status.MachineCount = pool.Status.MachineCount
+	status.UpdatedMachineCount = pool.Status.UpdatedMachineCount
+	status.DegradedMachineCount = pool.Status.DegradedMachineCount
+	status.Nodes = nodeStates(nodes)
+
+	if degraded := poolDegradation(pool, status.Nodes); len(degraded) > 0 {
+		return fmt.Errorf("machine config pool %s is degraded: %s", pool.Name, strings.Join(degraded, "; "))
+	}
+
+	switch {
+	case !renderedConfigIncludes(pool, SDIMachineConfigName):
+		return InProgress(sdiv1alpha1.ReasonNodeConfigRendering,
+			fmt.Sprintf("Waiting for MachineConfigPool %s to render MachineConfig %s", pool.Name, SDIMachineConfigName))
+	case len(nodes) == 0:
+		return InProgress(sdiv1alpha1.ReasonNoSDINodes,
+			fmt.Sprintf("No node matches the node selector of MachineConfigPool %s", pool.Name))
+	case pool.Status.ObservedGeneration < pool.Generation,
+		pool.Status.Configuration.Name != pool.Spec.Configuration.Name,
+		pool.Status.UpdatedMachineCount < pool.Status.MachineCount,
+		configv1.IsMachineConfigPoolConditionTrue(pool.Status.Conditions, configv1.MachineConfigPoolUpdating):
+		return InProgress(sdiv1alpha1.ReasonNodesUpdating,
+			fmt.Sprintf("%d of %d SDI nodes updated to %s", pool.Status.UpdatedMachineCount, pool.Status.MachineCount, pool.Spec.Configuration.Name))
+	}
+
+	a.logger.Info(fmt.Sprintf("All %d SDI nodes run %s", pool.Status.MachineCount, pool.Spec.Configuration.Name))
+	return nil
+}
+
+// poolNodes returns the nodes selected by the MachineConfigPool sorted by name.
+func (a *Adjuster) poolNodes(ctx context.Context, pool *configv1.MachineConfigPool) ([]corev1.Node, error) {
+	if pool.Spec.NodeSelector == nil {
+		return nil, nil
+	}
+	selector, err := metav1.LabelSelectorAsSelector(pool.Spec.NodeSelector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid node selector of machine config pool %s: %w", pool.Name, err)
+	}
+
+	nodes := &corev1.NodeList{}
+	if err := a.Client.List(ctx, nodes, client.MatchingLabelsSelector{Selector: selector}); err != nil {
+		return nil, fmt.Errorf("unable to list nodes of machine config pool %s: %w", pool.Name, err)
+	}
+	sort.Slice(nodes.Items, func(i, j int) bool {
+		return nodes.Items[i].Name < nodes.Items[j].Name
+	})
+	return nodes.Items, nil
+}
+
+func nodeStates(nodes []corev1.Node) []sdiv1alpha1.SDINodeState {
+	states := make([]sdiv1alpha1.SDINodeState, 0, len(nodes))
+	for _, node := range nodes {
+		states = append(states, sdiv1alpha1.SDINodeState{
+			Name:          node.Name,
+			CurrentConfig: node.Annotations[mcdCurrentConfigAnnotation],
+			DesiredConfig: node.Annotations[mcdDesiredConfigAnnotation],
+			State:         node.Annotations[mcdStateAnnotation],
+			Reason:        node.Annotations[mcdReasonAnnotation],
+		})
+	}
+	return states
+}
+
+// poolDegradation returns the reasons why the pool is degraded.
+func poolDegradation(pool *configv1.MachineConfigPool, nodes []sdiv1alpha1.SDINodeState) []string {
+	var degraded []string
+	for _, condType := range []configv1.MachineConfigPoolConditionType{
+		configv1.MachineConfigPoolRenderDegraded,
+		configv1.MachineConfigPoolNodeDegraded,
+	} {
+		if cond := configv1.GetMachineConfigPoolCondition(pool.Status, condType); cond != nil && cond.Status == corev1.ConditionTrue {
+			degraded = append(degraded, fmt.Sprintf("%s: %s", condType, cond.Message))
+		}
+	}
+	for _, node := range nodes {
+		if node.State == mcdStateDegraded {
+			degraded = append(degraded, fmt.Sprintf("node %s: %s", node.Name, node.Reason))
+		}
+	}
+	if len(degraded) == 0 && pool.Status.DegradedMachineCount > 0 {
+		degraded = append(degraded, fmt.Sprintf("%d SDI nodes are degraded", pool.Status.DegradedMachineCount))
+	}
+	return degraded
+}
+
+// renderedConfigIncludes tells whether the rendered config of the pool is generated from the MachineConfig.
+func renderedConfigIncludes(pool *configv1.MachineConfigPool, name string) bool {
+	for _, source := range pool.Spec.Configuration.Source {
+		if source.Name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,147 @@
+package adjuster
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr"
+	configv1 "github.com/openshift/machine-config-operator/pkg/apis/machineconfiguration.openshift.io/v1"
+	sdiv1alpha1 "github.com/redhat-sap/sap-data-intelligence/observer-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newSDINode(name, current, desired, state string) *corev1.Node {
+	return &corev1.Node{ObjectMeta: metav1.ObjectMeta{
+		Name:   name,
+		Labels: map[string]string{"node-role.kubernetes.io/sdi": ""},
+		Annotations: map[string]string{
+			mcdCurrentConfigAnnotation: current,
+			mcdDesiredConfigAnnotation: desired,
+			mcdStateAnnotation:         state,
+		},
+	}}
+}
+
+func newRolloutPool(t *testing.T, rendered, current string, machines, updated int32) *configv1.MachineConfigPool {
+	pool := loadAsset[*configv1.MachineConfigPool](t, machineConfigPoolAsset)
+	pool.Spec.Configuration.Name = rendered
+	pool.Spec.Configuration.Source = []corev1.ObjectReference{{Name: SDIMachineConfigName}}
+	pool.Status.Configuration.Name = current
+	pool.Status.MachineCount = machines
+	pool.Status.UpdatedMachineCount = updated
+	return pool
+}
+
+func TestCheckMachineConfigPoolRollout(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := corev1.AddToScheme(scheme); err != nil {
+		t.Fatalf("Failed to add scheme: %v", err)
+	}
+	if err := configv1.AddToScheme(scheme); err != nil {
+		t.Fatalf("Failed to add scheme: %v", err)
+	}
+
+	unrendered := newRolloutPool(t, "rendered-sdi-1", "rendered-sdi-1", 1, 1)
+	unrendered.Spec.Configuration.Source = nil
+	degraded := newRolloutPool(t, "rendered-sdi-2", "rendered-sdi-1", 2, 1)
+	degraded.Status.DegradedMachineCount = 1
+
+	tests := []struct {
+		name     string
+		pool     *configv1.MachineConfigPool
+		nodes    []*corev1.Node
+		reason   string
+		failed   bool
+		expected []sdiv1alpha1.SDINodeState
+	}{
+		{
+			name:   "not rendered yet",
+			pool:   unrendered,
+			nodes:  []*corev1.Node{newSDINode("node-a", "rendered-sdi-1", "rendered-sdi-1", "Done")},
+			reason: sdiv1alpha1.ReasonNodeConfigRendering,
+		},
+		{
+			name:   "no SDI nodes",
+			pool:   newRolloutPool(t, "rendered-sdi-1", "rendered-sdi-1", 0, 0),
+			reason: sdiv1alpha1.ReasonNoSDINodes,
+		},
+		{
+			name: "updating",
+			pool: newRolloutPool(t, "rendered-sdi-2", "rendered-sdi-1", 2, 1),
+			nodes: []*corev1.Node{
+				newSDINode("node-b", "rendered-sdi-1", "rendered-sdi-2", "Working"),
+				newSDINode("node-a", "rendered-sdi-2", "rendered-sdi-2", "Done"),
+			},
+			reason: sdiv1alpha1.ReasonNodesUpdating,
+			expected: []sdiv1alpha1.SDINodeState{
+				{Name: "node-a", CurrentConfig: "rendered-sdi-2", DesiredConfig: "rendered-sdi-2", State: "Done"},
+				{Name: "node-b", CurrentConfig: "rendered-sdi-1", DesiredConfig: "rendered-sdi-2", State: "Working"},
+			},
+		},
+		{
+			name: "degraded",
+			pool: degraded,
+			nodes: []*corev1.Node{
+				newSDINode("node-a", "rendered-sdi-2", "rendered-sdi-2", "Done"),
+				newSDINode("node-b", "rendered-sdi-1", "rendered-sdi-2", "Degraded"),
+			},
+			failed: true,
+		},
+		{
+			name:  "done",
+			pool:  newRolloutPool(t, "rendered-sdi-2", "rendered-sdi-2", 1, 1),
+			nodes: []*corev1.Node{newSDINode("node-a", "rendered-sdi-2", "rendered-sdi-2", "Done")},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			builder := fake.NewClientBuilder().WithScheme(scheme).WithObjects(tt.pool)
+			for _, node := range tt.nodes {
+				builder = builder.WithObjects(node)
+			}
+			a := New("test-name", "sdi-observer", builder.Build(), scheme, logr.Discard())
+			obs := &sdiv1alpha1.SDIObserver{}
+
+			err := a.checkMachineConfigPoolRollout(context.Background(), obs)
+			var progressing *ProgressingError
+			switch {
+			case tt.failed:
+				if err == nil || errors.As(err, &progressing) || !strings.Contains(err.Error(), "node node-b") {
+					t.Errorf("Expected degraded error, got %v", err)
+				}
+			case tt.reason != "":
+				if !errors.As(err, &progressing) || progressing.Reason != tt.reason {
+					t.Errorf("Expected progressing with reason %s, got %v", tt.reason, err)
+				}
+			case err != nil:
+				t.Errorf("Expected no error, got %v", err)
+			}
+
+			status := obs.Status.SDINodeConfigStatus
+			if status.RenderedConfig != tt.pool.Spec.Configuration.Name || status.MachineCount != tt.pool.Status.MachineCount {
+				t.Errorf("Unexpected status %+v", status)
+			}
+			if tt.expected != nil && !equalNodeStates(status.Nodes, tt.expected) {
+				t.Errorf("Expected nodes %+v, got %+v", tt.expected, status.Nodes)
+			}
+		})
+	}
+}
+
+func equalNodeStates(a, b []sdiv1alpha1.SDINodeState) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
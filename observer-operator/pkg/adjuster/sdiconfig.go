@@ -2,20 +2,24 @@ package adjuster
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
-	"reflect"
+	"slices"
+	"strings"
 
 	sdiv1alpha1 "github.com/redhat-sap/sap-data-intelligence/observer-operator/api/v1alpha1"
 	"github.com/redhat-sap/sap-data-intelligence/observer-operator/assets"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
-	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/utils/ptr"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
@@ -28,27 +32,48 @@ func (a *Adjuster) adjustSDIDataHub(ns string, obs *sdiv1alpha1.SDIObserver, ctx
 		return fmt.Errorf("SDIObserver cannot be nil")
 	}
 
-	obj := &unstructured.Unstructured{}
-	obj.SetName("default")
-	obj.SetNamespace(ns)
-	obj.SetGroupVersionKind(schema.GroupVersionKind{
+	dataHubs, err := a.listDataHubs(ns, ctx)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for i := range dataHubs {
+		if err := a.patchDataHubVRep(&dataHubs[i], ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// listDataHubs returns the DataHub resources in the SDI namespace. A NotFound error is returned if there
+// is none.
+func (a *Adjuster) listDataHubs(ns string, ctx context.Context) ([]unstructured.Unstructured, error) {
+	list := &unstructured.UnstructuredList{}
+	list.SetGroupVersionKind(schema.GroupVersionKind{
 		Group:   DataHubAPIGroup,
 		Version: DataHubAPIVersion,
-		Kind:    DataHubKind,
+		Kind:    DataHubKind + "List",
 	})
 
-	if err := a.Client.Get(ctx, client.ObjectKeyFromObject(obj), obj); err != nil {
-		return fmt.Errorf("failed to get DataHub object: %w", err)
+	if err := a.Client.List(ctx, list, client.InNamespace(ns)); err != nil {
+		return nil, fmt.Errorf("failed to list DataHub objects: %w", err)
 	}
+	if len(list.Items) == 0 {
+		return nil, errors.NewNotFound(schema.GroupResource{Group: DataHubAPIGroup, Resource: "datahubs"}, ns)
+	}
+	return list.Items, nil
+}
 
+func (a *Adjuster) patchDataHubVRep(obj *unstructured.Unstructured, ctx context.Context) error {
 	spec, ok := obj.Object["spec"].(map[string]interface{})
 	if !ok {
-		return fmt.Errorf("DataHub spec is not a map")
+		return fmt.Errorf("DataHub %s spec is not a map", obj.GetName())
 	}
 
 	vsystem, ok := spec["vsystem"].(map[string]interface{})
 	if !ok {
-		return fmt.Errorf("DataHub vsystem is not a map")
+		return fmt.Errorf("DataHub %s vsystem is not a map", obj.GetName())
 	}
 
 	vRep, ok := vsystem["vRep"].(map[string]interface{})
@@ -59,13 +84,13 @@ func (a *Adjuster) adjustSDIDataHub(ns string, obs *sdiv1alpha1.SDIObserver, ctx
 	}
 
 	if len(vRep) == 0 {
-		a.logger.Info("Patching DataHub vRep to set exportsMask to true", "namespace", ns)
+		a.logger.Info("Patching DataHub vRep to set exportsMask to true", "namespace", obj.GetNamespace(), "name", obj.GetName())
 		vRep["exportsMask"] = true
 		if err := a.Client.Update(ctx, obj); err != nil {
 			return err
 		}
 	} else {
-		a.logger.Info("DataHub vRep is already patched")
+		a.logger.Info(fmt.Sprintf("DataHub %s vRep is already patched", obj.GetName()))
 	}
 	return nil
 }
@@ -91,6 +116,9 @@ func (a *Adjuster) AdjustSDIDiagnosticsFluentdDaemonsetContainerPrivilege(ns str
 	updated := false
 	for i := range ds.Spec.Template.Spec.Containers {
 		if ds.Spec.Template.Spec.Containers[i].Name == DiagnosticFluentdName {
+			if ds.Spec.Template.Spec.Containers[i].SecurityContext == nil {
+				ds.Spec.Template.Spec.Containers[i].SecurityContext = &corev1.SecurityContext{}
+			}
 			if ds.Spec.Template.Spec.Containers[i].SecurityContext.Privileged == nil || !*ds.Spec.Template.Spec.Containers[i].SecurityContext.Privileged {
 				ds.Spec.Template.Spec.Containers[i].SecurityContext.Privileged = ptr.To(true)
 				updated = true
@@ -101,131 +129,258 @@ func (a *Adjuster) AdjustSDIDiagnosticsFluentdDaemonsetContainerPrivilege(ns str
 
 	if updated {
 		a.logger.Info("Patching daemonset with privileged security context")
-		if err := a.Client.Update(ctx, ds); err != nil {
-			return err
-		}
 	} else {
 		a.logger.Info(fmt.Sprintf("Daemonset %s is already using privileged security context", DiagnosticFluentdName))
 	}
-	return nil
-}
 
-func (a *Adjuster) AdjustSDIVSystemVrepStatefulSets(ns string, obs *sdiv1alpha1.SDIObserver, ctx context.Context) error {
-	ss := &appsv1.StatefulSet{}
-	if err := a.Client.Get(ctx, client.ObjectKey{Name: VSystemVrepStsName, Namespace: ns}, ss); err != nil {
-		return err
+	// fluentd already mounts /var/log/containers and /var/log/pods host paths, thus remove any
+	// /var/lib/docker volumes
+	if pruneFluentdDockerVolumes(&ds.Spec.Template.Spec) {
+		a.logger.Info(fmt.Sprintf("Removing %s volumes and /var/lib/docker hostPath volumes from daemonset %s", FluentdDockerVolumeName, DiagnosticFluentdName))
+		updated = true
+	} else {
+		a.logger.Info(fmt.Sprintf("Daemonset %s does not have any references to /var/lib/docker host path", DiagnosticFluentdName))
 	}
 
-	volumePatched := a.isVolumePatched(ss)
-	volumeMountPatched := a.isVolumeMountPatched(ss)
-
-	if volumePatched && volumeMountPatched {
-		a.logger.Info(fmt.Sprintf("StatefulSet %s volumes and mounts are already patched", VSystemVrepStsName))
-		return a.pruneStatefulSetOldRevision(ns, obs, ctx)
+	if updated {
+		if err := a.Client.Update(ctx, ds); err != nil {
+			return err
+		}
 	}
-
-	return a.patchStatefulSet(ss, ns, obs, ctx, volumePatched, volumeMountPatched)
+	return nil
 }
 
-// isVolumePatched checks if the required volume is already present in the StatefulSet
-func (a *Adjuster) isVolumePatched(ss *appsv1.StatefulSet) bool {
-	for i := range ss.Spec.Template.Spec.Volumes {
-		if ss.Spec.Template.Spec.Volumes[i].Name == VolumeName {
-			return true
-		}
+// isFluentdDockerVolume tells whether the volume refers to the docker host directory.
+func isFluentdDockerVolume(v *corev1.Volume) bool {
+	if v.Name == FluentdDockerVolumeName {
+		return true
 	}
-	return false
+	return v.HostPath != nil && strings.HasPrefix(v.HostPath.Path, FluentdDockerHostPath)
 }
 
-// isVolumeMountPatched checks if the required volume mount is already present in the StatefulSet
-func (a *Adjuster) isVolumeMountPatched(ss *appsv1.StatefulSet) bool {
-	for i := range ss.Spec.Template.Spec.Containers {
-		if ss.Spec.Template.Spec.Containers[i].Name == VSystemVrepStsName {
-			for j := range ss.Spec.Template.Spec.Containers[i].VolumeMounts {
-				if ss.Spec.Template.Spec.Containers[i].VolumeMounts[j].Name == VolumeName {
-					return true
+// pruneFluentdDockerVolumes removes the docker volumes and their mounts from the pod spec. It returns
+// true if the spec has been modified.
+func pruneFluentdDockerVolumes(spec *corev1.PodSpec) bool {
+	toDelete := map[string]struct{}{FluentdDockerVolumeName: {}}
+	volumes := make([]corev1.Volume, 0, len(spec.Volumes))
+	for i := range spec.Volumes {
+		if isFluentdDockerVolume(&spec.Volumes[i]) {
+			toDelete[spec.Volumes[i].Name] = struct{}{}
+			continue
+		}
+		volumes = append(volumes, spec.Volumes[i])
+	}
+	pruned := len(volumes) != len(spec.Volumes)
+	spec.Volumes = volumes
+
+	pruneMounts := func(containers []corev1.Container) {
+		for i := range containers {
+			mounts := make([]corev1.VolumeMount, 0, len(containers[i].VolumeMounts))
+			for _, vm := range containers[i].VolumeMounts {
+				if _, ok := toDelete[vm.Name]; ok {
+					pruned = true
+					continue
 				}
+				mounts = append(mounts, vm)
 			}
-			break
+			containers[i].VolumeMounts = mounts
 		}
 	}
-	return false
+	pruneMounts(spec.Containers)
+	pruneMounts(spec.InitContainers)
+
+	return pruned
 }
 
-// patchStatefulSet applies the required volume and volume mount patches to the StatefulSet
-func (a *Adjuster) patchStatefulSet(ss *appsv1.StatefulSet, ns string, obs *sdiv1alpha1.SDIObserver, ctx context.Context, volumePatched, volumeMountPatched bool) error {
-	if !volumePatched {
-		a.logger.Info(fmt.Sprintf("Patching StatefulSet %s with new volume", VSystemVrepStsName))
-		ss.Spec.Template.Spec.Volumes = append(ss.Spec.Template.Spec.Volumes, corev1.Volume{
-			Name: VolumeName,
-			VolumeSource: corev1.VolumeSource{
-				EmptyDir: &corev1.EmptyDirVolumeSource{},
-			},
-		})
-	}
-
-	if !volumeMountPatched {
-		a.logger.Info(fmt.Sprintf("Patching StatefulSet %s with new volume mount", VSystemVrepStsName))
-		for i := range ss.Spec.Template.Spec.Containers {
-			if ss.Spec.Template.Spec.Containers[i].Name == VSystemVrepStsName {
-				ss.Spec.Template.Spec.Containers[i].VolumeMounts = append(ss.Spec.Template.Spec.Containers[i].VolumeMounts, corev1.VolumeMount{
-					Name:      VolumeName,
-					MountPath: "/exports",
-				})
-				break
-			}
+// AdjustSDIVSystemVrepStatefulSets replaces the exports volume of the vsystem-vrep StatefulSet with the
+// exports-mask emptyDir. The persistent exports volume of older SDI releases is migrated away; as the
+// volumeClaimTemplates cannot be changed, the StatefulSet is then recreated while its pods are kept.
+func (a *Adjuster) AdjustSDIVSystemVrepStatefulSets(ns string, obs *sdiv1alpha1.SDIObserver, ctx context.Context) error {
+	ss := &appsv1.StatefulSet{}
+	if err := a.Client.Get(ctx, client.ObjectKey{Name: VSystemVrepStsName, Namespace: ns}, ss); err != nil {
+		if !errors.IsNotFound(err) {
+			return err
+		}
+		// The StatefulSet may have been deleted by a previous pass to be recreated.
+		recreated, recreateErr := a.recreateSavedStatefulSet(ctx, obs, ns, VSystemVrepStsName)
+		if recreateErr != nil {
+			return recreateErr
 		}
+		if !recreated {
+			return err
+		}
+		return a.adjustSDIDataHub(ns, obs, ctx)
+	}
+	if ss.DeletionTimestamp != nil {
+		return InProgress(sdiv1alpha1.ReasonStatefulSetRecreating,
+			fmt.Sprintf("Waiting for StatefulSet %s to be deleted", VSystemVrepStsName))
 	}
 
-	if err := a.Client.Update(ctx, ss); err != nil {
-		return fmt.Errorf("unable to update operand statefulset: %w", err)
+	migrated := ss.DeepCopy()
+	claimsMigrated := migrateVRepExportsVolume(migrated)
+	if equality.Semantic.DeepEqual(ss.Spec, migrated.Spec) {
+		a.logger.Info(fmt.Sprintf("StatefulSet %s volumes and mounts are already patched", VSystemVrepStsName))
+		return a.deleteSavedStatefulSet(ctx, obs, VSystemVrepStsName)
 	}
 
-	if err := a.adjustSDIDataHub(ns, obs, ctx); err != nil {
-		return err
+	if claimsMigrated {
+		if err := a.recreateStatefulSet(ctx, obs, migrated); err != nil {
+			return err
+		}
+	} else {
+		a.logger.Info(fmt.Sprintf("Patching StatefulSet %s with %s volume", VSystemVrepStsName, VolumeName))
+		if err := a.Client.Update(ctx, migrated); err != nil {
+			return fmt.Errorf("unable to update operand statefulset: %w", err)
+		}
 	}
 
-	return a.pruneStatefulSetOldRevision(ns, obs, ctx)
+	return a.adjustSDIDataHub(ns, obs, ctx)
 }
 
-func (a *Adjuster) pruneStatefulSetOldRevision(ns string, _ *sdiv1alpha1.SDIObserver, ctx context.Context) error {
-	ss := &appsv1.StatefulSet{}
-	if err := a.Client.Get(ctx, client.ObjectKey{Name: VSystemVrepStsName, Namespace: ns}, ss); err != nil {
-		return err
+// migrateVRepExportsVolume mounts the exports-mask emptyDir on /exports in the vsystem-vrep container and
+// in every container which mounted the obsolete exports volume there. The obsolete volume claims of the
+// default size are removed; claims resized by the administrator are kept. It returns true if the
+// volumeClaimTemplates have been modified.
+func migrateVRepExportsVolume(ss *appsv1.StatefulSet) bool {
+	claims := make([]corev1.PersistentVolumeClaim, 0, len(ss.Spec.VolumeClaimTemplates))
+	for _, claim := range ss.Spec.VolumeClaimTemplates {
+		if isObsoleteVRepExportsClaim(&claim) {
+			continue
+		}
+		claims = append(claims, claim)
+	}
+	claimsMigrated := len(claims) != len(ss.Spec.VolumeClaimTemplates)
+	if claimsMigrated {
+		ss.Spec.VolumeClaimTemplates = claims
+	}
+
+	spec := &ss.Spec.Template.Spec
+	exportsVolume := corev1.Volume{
+		Name:         VolumeName,
+		VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+	}
+	if i := slices.IndexFunc(spec.Volumes, func(v corev1.Volume) bool { return v.Name == VolumeName }); i < 0 {
+		spec.Volumes = append(spec.Volumes, exportsVolume)
+	} else if spec.Volumes[i].EmptyDir == nil {
+		spec.Volumes[i] = exportsVolume
+	}
+
+	// The exports-mask volume replaces the first mount on /exports, other mounts there are removed.
+	exportsMount := corev1.VolumeMount{Name: VolumeName, MountPath: VRepExportsMountPath}
+	mountExports := func(containers []corev1.Container) {
+		for i := range containers {
+			mounts := make([]corev1.VolumeMount, 0, len(containers[i].VolumeMounts)+1)
+			mounted := false
+			for _, vm := range containers[i].VolumeMounts {
+				if vm.MountPath != VRepExportsMountPath {
+					mounts = append(mounts, vm)
+				} else if !mounted {
+					mounts = append(mounts, exportsMount)
+					mounted = true
+				}
+			}
+			if !mounted && containers[i].Name == VSystemVrepStsName {
+				mounts = append(mounts, exportsMount)
+			}
+			containers[i].VolumeMounts = mounts
+		}
 	}
+	mountExports(spec.Containers)
+	mountExports(spec.InitContainers)
 
-	if ss.Status.UpdateRevision == ss.Status.CurrentRevision {
-		a.logger.Info(fmt.Sprintf("StatefulSet %s current revision matches update revision", VSystemVrepStsName))
-		return nil
+	return claimsMigrated
+}
+
+// isObsoleteVRepExportsClaim tells whether the claim is the persistent exports volume of older SDI releases.
+func isObsoleteVRepExportsClaim(claim *corev1.PersistentVolumeClaim) bool {
+	if !slices.Contains(VRepObsoleteExportsClaimNames, claim.Name) {
+		return false
 	}
+	size, ok := claim.Spec.Resources.Requests[corev1.ResourceStorage]
+	return ok && size.Cmp(resource.MustParse(VRepObsoleteExportsClaimSize)) == 0
+}
 
-	updateRevisionPodList := &corev1.PodList{}
-	updateRevisionSelector := labels.SelectorFromSet(labels.Set{ControllerRevisionHashLabel: ss.Status.UpdateRevision})
+// savedStatefulSetName returns the name of the ConfigMap keeping the StatefulSet being recreated on behalf
+// of the observer.
+func savedStatefulSetName(obs *sdiv1alpha1.SDIObserver, name string) string {
+	return fmt.Sprintf("%s-%s-recreated", obs.Name, name)
+}
 
-	if err := a.Client.List(ctx, updateRevisionPodList, client.InNamespace(ns), client.MatchingLabelsSelector{Selector: updateRevisionSelector}); err != nil {
+// recreateStatefulSet replaces the StatefulSet with the given one. The given StatefulSet is saved in a
+// ConfigMap of the observer namespace before the existing one is deleted without its pods, so that it is
+// created by a later pass once the deletion is complete, even after a restart of the operator. The pods
+// are adopted by the new StatefulSet and rolled out to its revision.
+func (a *Adjuster) recreateStatefulSet(ctx context.Context, obs *sdiv1alpha1.SDIObserver, ss *appsv1.StatefulSet) error {
+	recreated := &appsv1.StatefulSet{
+		TypeMeta: metav1.TypeMeta{APIVersion: appsv1.SchemeGroupVersion.String(), Kind: "StatefulSet"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            ss.Name,
+			Namespace:       ss.Namespace,
+			Labels:          ss.Labels,
+			Annotations:     ss.Annotations,
+			OwnerReferences: ss.OwnerReferences,
+		},
+		Spec: ss.Spec,
+	}
+	data, err := json.Marshal(recreated)
+	if err != nil {
 		return err
 	}
+	saved := &corev1.ConfigMap{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+		ObjectMeta: metav1.ObjectMeta{Name: savedStatefulSetName(obs, ss.Name), Namespace: obs.Namespace},
+		Data:       map[string]string{savedStatefulSetKey: string(data)},
+	}
+	if _, err := a.apply(ctx, obs, saved); err != nil {
+		return fmt.Errorf("unable to save operand statefulset: %w", err)
+	}
 
-	if len(updateRevisionPodList.Items) > 0 {
-		a.logger.Info("Pods for the updated revision exist; no action needed")
+	a.logger.Info(fmt.Sprintf("Recreating StatefulSet %s without the obsolete volume claims", ss.Name))
+	if err := a.Client.Delete(ctx, ss, client.PropagationPolicy(metav1.DeletePropagationOrphan),
+		client.Preconditions{UID: &ss.UID, ResourceVersion: &ss.ResourceVersion}); err != nil {
+		return fmt.Errorf("unable to delete operand statefulset: %w", err)
+	}
+	if a.dryRun {
+		// The StatefulSet still exists, the dry run of its creation would fail.
+		a.planChange(PlannedActionCreate, recreated, data)
 		return nil
 	}
+	return InProgress(sdiv1alpha1.ReasonStatefulSetRecreating,
+		fmt.Sprintf("Waiting for StatefulSet %s to be deleted before recreating it", ss.Name))
+}
 
-	a.logger.Info("Cleaning up pods from outdated revisions")
-	podList := &corev1.PodList{}
-	if err := a.Client.List(ctx, podList, client.InNamespace(ns), client.MatchingLabels(ss.Spec.Selector.MatchLabels)); err != nil {
-		return fmt.Errorf("unable to get operand pod list: %w", err)
+// recreateSavedStatefulSet creates the StatefulSet saved by recreateStatefulSet, if any, and tells whether
+// it has been created.
+func (a *Adjuster) recreateSavedStatefulSet(ctx context.Context, obs *sdiv1alpha1.SDIObserver, ns, name string) (bool, error) {
+	saved := &corev1.ConfigMap{}
+	if err := a.Client.Get(ctx, client.ObjectKey{Name: savedStatefulSetName(obs, name), Namespace: obs.Namespace}, saved); err != nil {
+		if errors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("unable to get saved operand statefulset: %w", err)
+	}
+	recreated := &appsv1.StatefulSet{}
+	if err := json.Unmarshal([]byte(saved.Data[savedStatefulSetKey]), recreated); err != nil {
+		return false, fmt.Errorf("unable to decode saved operand statefulset: %w", err)
+	}
+	// The SDI namespace of the observer may have changed since the StatefulSet was saved.
+	if recreated.Namespace != ns {
+		return false, a.deleteSavedStatefulSet(ctx, obs, name)
 	}
 
-	for i := range podList.Items {
-		if podList.Items[i].Labels[ControllerRevisionHashLabel] != ss.Status.UpdateRevision {
-			a.logger.Info(fmt.Sprintf("Deleting pod %s with outdated revision", podList.Items[i].Name))
-			if err := a.Client.Delete(ctx, &podList.Items[i], client.GracePeriodSeconds(DefaultGracePeriodSeconds)); err != nil {
-				return fmt.Errorf("unable to delete operand pod: %w", err)
-			}
-		}
+	a.logger.Info(fmt.Sprintf("Creating StatefulSet %s without the obsolete volume claims", name))
+	if err := a.Client.Create(ctx, recreated); err != nil && !errors.IsAlreadyExists(err) {
+		return false, fmt.Errorf("unable to recreate operand statefulset: %w", err)
 	}
+	return true, a.deleteSavedStatefulSet(ctx, obs, name)
+}
 
+// deleteSavedStatefulSet deletes the StatefulSet saved by recreateStatefulSet once it has been recreated.
+func (a *Adjuster) deleteSavedStatefulSet(ctx context.Context, obs *sdiv1alpha1.SDIObserver, name string) error {
+	saved := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: savedStatefulSetName(obs, name), Namespace: obs.Namespace}}
+	if err := a.Client.Delete(ctx, saved); client.IgnoreNotFound(err) != nil {
+		return fmt.Errorf("unable to delete saved operand statefulset: %w", err)
+	}
 	return nil
 }
 
@@ -239,8 +394,15 @@ func (a *Adjuster) AdjustNamespaceAnnotation(ns, nodeSelector string, ctx contex
 		namespace.Annotations = map[string]string{}
 	}
 
-	if currentSelector := namespace.Annotations[AnnotationKey]; currentSelector != nodeSelector {
+	if currentSelector, ok := namespace.Annotations[AnnotationKey]; !ok || currentSelector != nodeSelector {
 		a.logger.Info("Updating namespace annotation")
+		// Remember the original node selector so that it can be restored on uninstall.
+		if _, managed := namespace.Annotations[NodeSelectorManagedAnnotationKey]; !managed {
+			namespace.Annotations[NodeSelectorManagedAnnotationKey] = "true"
+			if ok {
+				namespace.Annotations[OriginalNodeSelectorAnnotationKey] = currentSelector
+			}
+		}
 		namespace.Annotations[AnnotationKey] = nodeSelector
 		if err := a.Client.Update(ctx, namespace); err != nil {
 			return fmt.Errorf("unable to update namespace annotation: %w", err)
@@ -251,7 +413,8 @@ func (a *Adjuster) AdjustNamespaceAnnotation(ns, nodeSelector string, ctx contex
 	return nil
 }
 
-func (a *Adjuster) AdjustSDIRbac(ns string, _ *sdiv1alpha1.SDIObserver, ctx context.Context) error {
+// AdjustSDIRbac grants the SDI service accounts of the profile the privileges needed by SDI.
+func (a *Adjuster) AdjustSDIRbac(ns string, profile SDIProfile, obs *sdiv1alpha1.SDIObserver, ctx context.Context) error {
 	// Define role and role binding names
 	const (
 		privilegedRoleName        = "sdi-privileged"
@@ -261,18 +424,24 @@ func (a *Adjuster) AdjustSDIRbac(ns string, _ *sdiv1alpha1.SDIObserver, ctx cont
 	)
 
 	// Ensure roles exist
-	if err := a.ensureRole(ns, privilegedRoleName, a.getPrivilegedRole(), ctx); err != nil {
+	if err := a.ensureRole(ns, privilegedRoleName, privilegedRoleAsset, obs, ctx); err != nil {
 		return fmt.Errorf("unable to ensure privileged role: %w", err)
 	}
-	if err := a.ensureRole(ns, anyuidRoleName, a.getAnyuidRole(), ctx); err != nil {
+	if err := a.ensureRole(ns, anyuidRoleName, anyuidRoleAsset, obs, ctx); err != nil {
 		return fmt.Errorf("unable to ensure anyuid role: %w", err)
 	}
 
 	// Ensure role bindings exist
-	if err := a.ensureRoleBinding(ns, privilegedRoleBindingName, a.getPrivilegedRoleBinding(), ctx); err != nil {
+	if err := a.ensureRoleBinding(ns, privilegedRoleBindingName, privilegedRoleBindingAsset, profile.privilegedSubjects(ns), obs, ctx); err != nil {
 		return fmt.Errorf("unable to ensure privileged role binding: %w", err)
 	}
-	if err := a.ensureRoleBinding(ns, anyuidRoleBindingName, a.getAnyuidRoleBinding(), ctx); err != nil {
+	if err := a.ensureRoleBinding(ns, anyuidRoleBindingName, anyuidRoleBindingAsset, []rbacv1.Subject{
+		{
+			Kind:     rbacv1.GroupKind,
+			Name:     "system:serviceaccounts:" + ns,
+			APIGroup: rbacv1.GroupName,
+		},
+	}, obs, ctx); err != nil {
 		return fmt.Errorf("unable to ensure anyuid role binding: %w", err)
 	}
 
@@ -280,138 +449,38 @@ func (a *Adjuster) AdjustSDIRbac(ns string, _ *sdiv1alpha1.SDIObserver, ctx cont
 	return nil
 }
 
-func (a *Adjuster) ensureRole(ns, name string, getRoleFunc func() client.Object, ctx context.Context) error {
-	role := getRoleFunc().(*rbacv1.Role)
+func (a *Adjuster) ensureRole(ns, name, manifest string, obs *sdiv1alpha1.SDIObserver, ctx context.Context) error {
+	role, err := assets.LoadAs[*rbacv1.Role](manifest)
+	if err != nil {
+		return err
+	}
 	role.Name = name
 	role.Namespace = ns
 
-	if err := a.Client.Get(ctx, client.ObjectKeyFromObject(role), role); err != nil {
-		if errors.IsNotFound(err) {
-			a.logger.Info(fmt.Sprintf("Creating role %s", name))
-			if err := a.Client.Create(ctx, role); err != nil {
-				return fmt.Errorf("unable to create role %s: %w", name, err)
-			}
-		} else {
-			return fmt.Errorf("unable to get role %s: %w", name, err)
-		}
+	if _, err := a.apply(ctx, obs, role); err != nil {
+		return fmt.Errorf("unable to apply role %s: %w", name, err)
 	}
 	return nil
 }
 
-func (a *Adjuster) ensureRoleBinding(ns, name string, getRoleBindingFunc func() client.Object, ctx context.Context) error {
-	desiredRoleBinding := getRoleBindingFunc().(*rbacv1.RoleBinding)
+func (a *Adjuster) ensureRoleBinding(ns, name, manifest string, subjects []rbacv1.Subject, obs *sdiv1alpha1.SDIObserver, ctx context.Context) error {
+	desiredRoleBinding, err := assets.LoadAs[*rbacv1.RoleBinding](manifest)
+	if err != nil {
+		return err
+	}
 	desiredRoleBinding.Name = name
 	desiredRoleBinding.Namespace = ns
+	desiredRoleBinding.Subjects = subjects
 
-	// Modify the subjects based on the role binding name
-	switch name {
-	case "sdi-privileged":
-		desiredRoleBinding.Subjects = []rbacv1.Subject{
-			{
-				Kind:      "ServiceAccount",
-				Name:      "default",
-				Namespace: ns,
-			},
-			{
-				Kind:      "ServiceAccount",
-				Name:      "mlf-deployment-api",
-				Namespace: ns,
-			},
-			{
-				Kind:      "ServiceAccount",
-				Name:      "vora-vflow-server",
-				Namespace: ns,
-			},
-			{
-				Kind:      "ServiceAccount",
-				Name:      "vora-vsystem-" + ns,
-				Namespace: ns,
-			},
-			{
-				Kind:      "ServiceAccount",
-				Name:      "vora-vsystem-" + ns + "-vrep",
-				Namespace: ns,
-			},
-
-			// SDI 3.2 compatibility
-			{
-				Kind:      "ServiceAccount",
-				Name:      ns + "-elasticsearch",
-				Namespace: ns,
-			},
-			{
-				Kind:      "ServiceAccount",
-				Name:      ns + "-fluentd",
-				Namespace: ns,
-			},
-
-			// SDI 3.3
-			{
-				Kind:      "ServiceAccount",
-				Name:      "diagnostics-elasticsearch",
-				Namespace: ns,
-			},
-			{
-				Kind:      "ServiceAccount",
-				Name:      "diagnostics-fluentd",
-				Namespace: ns,
-			},
-
-			// SDI 3.3 SDI restore hana serviceaccount
-			{
-				Kind:      "ServiceAccount",
-				Name:      "hana-service-account",
-				Namespace: ns,
-			},
-		}
-	case "sdi-anyuid":
-		desiredRoleBinding.Subjects = []rbacv1.Subject{
-			{
-				Kind:     "Group",
-				Name:     "system:serviceaccounts:" + ns,
-				APIGroup: "rbac.authorization.k8s.io",
-			},
-		}
-	default:
-		return fmt.Errorf("unknown role binding name: %s", name)
-	}
-
-	// Check if the role binding already exists
-	existingRoleBinding := &rbacv1.RoleBinding{}
-	if err := a.Client.Get(ctx, client.ObjectKeyFromObject(desiredRoleBinding), existingRoleBinding); err != nil {
-		if errors.IsNotFound(err) {
-			a.logger.Info(fmt.Sprintf("Creating role binding %s", name))
-			if err := a.Client.Create(ctx, desiredRoleBinding); err != nil {
-				return fmt.Errorf("unable to create role binding %s: %w", name, err)
-			}
-		} else {
-			return fmt.Errorf("unable to get role binding %s: %w", name, err)
-		}
-	} else {
-		// Compare using reflect.DeepEqual
-		if !reflect.DeepEqual(existingRoleBinding.Subjects, desiredRoleBinding.Subjects) {
-			a.logger.Info(fmt.Sprintf("Updating role binding %s", name))
-			// Update the existing role binding with the desired subjects
-			existingRoleBinding.Subjects = desiredRoleBinding.Subjects
-			if err := a.Client.Update(ctx, existingRoleBinding); err != nil {
-				return fmt.Errorf("unable to update role binding %s: %w", name, err)
-			}
-		}
+	if _, err := a.apply(ctx, obs, desiredRoleBinding); err != nil {
+		return fmt.Errorf("unable to apply role binding %s: %w", name, err)
 	}
 	return nil
 }
-func (a *Adjuster) getPrivilegedRole() func() client.Object {
-	return assets.GetRoleFromFile("manifests/role-rolebinding-config-for-sdi/privileged-role.yaml")
-}
 
-func (a *Adjuster) getAnyuidRole() func() client.Object {
-	return assets.GetRoleFromFile("manifests/role-rolebinding-config-for-sdi/anyuid-role.yaml")
-}
-
-func (a *Adjuster) getPrivilegedRoleBinding() func() client.Object {
-	return assets.GetRoleBindingFromFile("manifests/role-rolebinding-config-for-sdi/privileged-rolebinding.yaml")
-}
-
-func (a *Adjuster) getAnyuidRoleBinding() func() client.Object {
-	return assets.GetRoleBindingFromFile("manifests/role-rolebinding-config-for-sdi/anyuid-rolebinding.yaml")
-}
+const (
+	privilegedRoleAsset        = "manifests/role-rolebinding-config-for-sdi/privileged-role.yaml"
+	anyuidRoleAsset            = "manifests/role-rolebinding-config-for-sdi/anyuid-role.yaml"
+	privilegedRoleBindingAsset = "manifests/role-rolebinding-config-for-sdi/privileged-rolebinding.yaml"
+	anyuidRoleBindingAsset     = "manifests/role-rolebinding-config-for-sdi/anyuid-rolebinding.yaml"
+)
@@ -0,0 +1,328 @@
+package adjuster
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/go-logr/logr"
+	sdiv1alpha1 "github.com/redhat-sap/sap-data-intelligence/observer-operator/api/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newSDIConfigTestAdjuster(t *testing.T, objs ...client.Object) *Adjuster {
+	t.Helper()
+	scheme := runtime.NewScheme()
+	if err := corev1.AddToScheme(scheme); err != nil {
+		t.Fatalf("Failed to add scheme: %v", err)
+	}
+	if err := appsv1.AddToScheme(scheme); err != nil {
+		t.Fatalf("Failed to add scheme: %v", err)
+	}
+	if err := sdiv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatalf("Failed to add scheme: %v", err)
+	}
+	c := withServerSideApply(fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...)).Build()
+	return New("test-name", "test-namespace", c, scheme, logr.Discard())
+}
+
+func newFluentdDaemonSet(volumes []corev1.Volume, mounts []corev1.VolumeMount, initMounts []corev1.VolumeMount) *appsv1.DaemonSet {
+	return &appsv1.DaemonSet{
+		ObjectMeta: metav1.ObjectMeta{Name: DiagnosticFluentdName, Namespace: "sdi"},
+		Spec: appsv1.DaemonSetSpec{
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					InitContainers: []corev1.Container{{Name: "init", VolumeMounts: initMounts}},
+					Containers: []corev1.Container{{
+						Name:            DiagnosticFluentdName,
+						SecurityContext: &corev1.SecurityContext{Privileged: ptr.To(true)},
+						VolumeMounts:    mounts,
+					}},
+					Volumes: volumes,
+				},
+			},
+		},
+	}
+}
+
+func hostPathVolume(name, path string) corev1.Volume {
+	return corev1.Volume{
+		Name:         name,
+		VolumeSource: corev1.VolumeSource{HostPath: &corev1.HostPathVolumeSource{Path: path}},
+	}
+}
+
+func TestAdjustSDIDiagnosticsFluentdDaemonset_PruneDockerVolumes(t *testing.T) {
+	ds := newFluentdDaemonSet(
+		[]corev1.Volume{
+			hostPathVolume("varlog", "/var/log"),
+			hostPathVolume(FluentdDockerVolumeName, "/var/lib/docker/containers"),
+			hostPathVolume("dockerroot", "/var/lib/docker"),
+		},
+		[]corev1.VolumeMount{
+			{Name: "varlog", MountPath: "/var/log"},
+			{Name: FluentdDockerVolumeName, MountPath: "/var/lib/docker/containers"},
+		},
+		[]corev1.VolumeMount{{Name: "dockerroot", MountPath: "/docker"}},
+	)
+	a := newSDIConfigTestAdjuster(t, ds)
+	ctx := context.Background()
+
+	if err := a.AdjustSDIDiagnosticsFluentdDaemonsetContainerPrivilege("sdi", &sdiv1alpha1.SDIObserver{}, ctx); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	got := &appsv1.DaemonSet{}
+	if err := a.Client.Get(ctx, client.ObjectKeyFromObject(ds), got); err != nil {
+		t.Fatalf("Failed to get daemonset: %v", err)
+	}
+	spec := got.Spec.Template.Spec
+	if len(spec.Volumes) != 1 || spec.Volumes[0].Name != "varlog" {
+		t.Errorf("Expected only the varlog volume to be kept, got %v", spec.Volumes)
+	}
+	if len(spec.Containers[0].VolumeMounts) != 1 || spec.Containers[0].VolumeMounts[0].Name != "varlog" {
+		t.Errorf("Expected only the varlog mount to be kept, got %v", spec.Containers[0].VolumeMounts)
+	}
+	if len(spec.InitContainers[0].VolumeMounts) != 0 {
+		t.Errorf("Expected init container mounts to be pruned, got %v", spec.InitContainers[0].VolumeMounts)
+	}
+
+	// The adjustment must be idempotent.
+	resourceVersion := got.ResourceVersion
+	if err := a.AdjustSDIDiagnosticsFluentdDaemonsetContainerPrivilege("sdi", &sdiv1alpha1.SDIObserver{}, ctx); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := a.Client.Get(ctx, client.ObjectKeyFromObject(ds), got); err != nil {
+		t.Fatalf("Failed to get daemonset: %v", err)
+	}
+	if got.ResourceVersion != resourceVersion {
+		t.Error("Expected no update of an already pruned daemonset")
+	}
+}
+
+func TestAdjustSDIDiagnosticsFluentdDaemonset_Privileged(t *testing.T) {
+	ds := newFluentdDaemonSet(nil, nil, nil)
+	ds.Spec.Template.Spec.Containers[0].SecurityContext = nil
+	a := newSDIConfigTestAdjuster(t, ds)
+	ctx := context.Background()
+
+	if err := a.AdjustSDIDiagnosticsFluentdDaemonsetContainerPrivilege("sdi", &sdiv1alpha1.SDIObserver{}, ctx); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	got := &appsv1.DaemonSet{}
+	if err := a.Client.Get(ctx, client.ObjectKeyFromObject(ds), got); err != nil {
+		t.Fatalf("Failed to get daemonset: %v", err)
+	}
+	sc := got.Spec.Template.Spec.Containers[0].SecurityContext
+	if sc == nil || sc.Privileged == nil || !*sc.Privileged {
+		t.Errorf("Expected privileged container, got %v", sc)
+	}
+}
+
+func TestPruneFluentdDockerVolumes_NothingToPrune(t *testing.T) {
+	spec := &corev1.PodSpec{
+		Containers: []corev1.Container{{Name: DiagnosticFluentdName, VolumeMounts: []corev1.VolumeMount{{Name: "varlog"}}}},
+		Volumes:    []corev1.Volume{hostPathVolume("varlog", "/var/log")},
+	}
+	if pruneFluentdDockerVolumes(spec) {
+		t.Error("Expected no pruning for a spec without docker volumes")
+	}
+}
+
+func newVRepStatefulSet(claims []corev1.PersistentVolumeClaim, volumes []corev1.Volume, mounts, initMounts []corev1.VolumeMount) *appsv1.StatefulSet {
+	return &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: VSystemVrepStsName, Namespace: "sdi", UID: "vrep-uid"},
+		Spec: appsv1.StatefulSetSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "vsystem-vrep"}},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": "vsystem-vrep"}},
+				Spec: corev1.PodSpec{
+					InitContainers: []corev1.Container{{Name: "init", VolumeMounts: initMounts}},
+					Containers:     []corev1.Container{{Name: VSystemVrepStsName, VolumeMounts: mounts}},
+					Volumes:        volumes,
+				},
+			},
+			VolumeClaimTemplates: claims,
+		},
+	}
+}
+
+func exportsClaim(name, size string) corev1.PersistentVolumeClaim {
+	return corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			Resources: corev1.VolumeResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse(size)},
+			},
+		},
+	}
+}
+
+func TestAdjustSDIVSystemVrepStatefulSets(t *testing.T) {
+	exportsMask := corev1.Volume{Name: VolumeName, VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}}
+	dataMount := corev1.VolumeMount{Name: "data", MountPath: "/data"}
+	exportsMount := func(name string) corev1.VolumeMount {
+		return corev1.VolumeMount{Name: name, MountPath: VRepExportsMountPath}
+	}
+
+	for _, tt := range []struct {
+		name       string
+		ss         *appsv1.StatefulSet
+		claims     []string
+		initMounts []corev1.VolumeMount
+		updated    bool
+		recreated  bool
+	}{
+		{
+			name:    "unpatched",
+			ss:      newVRepStatefulSet(nil, nil, []corev1.VolumeMount{dataMount}, nil),
+			updated: true,
+		},
+		{
+			name: "patched",
+			ss:   newVRepStatefulSet(nil, []corev1.Volume{exportsMask}, []corev1.VolumeMount{dataMount, exportsMount(VolumeName)}, nil),
+		},
+		{
+			name: "obsolete claims",
+			ss: newVRepStatefulSet(
+				[]corev1.PersistentVolumeClaim{exportsClaim("data", "10Gi"), exportsClaim("exports", "500Mi"), exportsClaim("exports-volume", "500Mi")},
+				nil,
+				[]corev1.VolumeMount{dataMount, exportsMount("exports")},
+				[]corev1.VolumeMount{exportsMount("exports-volume"), dataMount}),
+			claims:     []string{"data"},
+			initMounts: []corev1.VolumeMount{exportsMount(VolumeName), dataMount},
+			updated:    true,
+			recreated:  true,
+		},
+		{
+			name: "resized obsolete claim",
+			ss: newVRepStatefulSet(
+				[]corev1.PersistentVolumeClaim{exportsClaim("exports", "1Gi")},
+				nil,
+				[]corev1.VolumeMount{exportsMount("exports")},
+				nil),
+			claims:  []string{"exports"},
+			updated: true,
+		},
+		{
+			name: "persistent exports-mask volume",
+			ss: newVRepStatefulSet(nil,
+				[]corev1.Volume{{Name: VolumeName, VolumeSource: corev1.VolumeSource{PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: "exports"}}}},
+				[]corev1.VolumeMount{exportsMount(VolumeName), exportsMount("exports")},
+				nil),
+			updated: true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			scheme := runtime.NewScheme()
+			for _, add := range []func(*runtime.Scheme) error{corev1.AddToScheme, appsv1.AddToScheme, sdiv1alpha1.AddToScheme} {
+				if err := add(scheme); err != nil {
+					t.Fatalf("Failed to add scheme: %v", err)
+				}
+			}
+			dataHub := newDataHubWithVersion("3.3.0", "")
+			if err := unstructured.SetNestedMap(dataHub.Object, map[string]interface{}{}, "spec", "vsystem"); err != nil {
+				t.Fatalf("Failed to set vsystem: %v", err)
+			}
+			scheme.AddKnownTypeWithName(dataHub.GroupVersionKind(), &unstructured.Unstructured{})
+			scheme.AddKnownTypeWithName(dataHub.GroupVersionKind().GroupVersion().WithKind(DataHubKind+"List"), &unstructured.UnstructuredList{})
+			c := withServerSideApply(fake.NewClientBuilder().WithScheme(scheme).WithObjects(tt.ss, dataHub)).Build()
+			a := New("test-name", "test-namespace", c, scheme, logr.Discard())
+			ctx := context.Background()
+			obs := &sdiv1alpha1.SDIObserver{ObjectMeta: metav1.ObjectMeta{Name: "sdi", Namespace: "operators"}}
+
+			existing := &appsv1.StatefulSet{}
+			if err := c.Get(ctx, client.ObjectKeyFromObject(tt.ss), existing); err != nil {
+				t.Fatalf("Failed to get statefulset: %v", err)
+			}
+			// The StatefulSet being recreated is created by the pass following its deletion.
+			err := a.AdjustSDIVSystemVrepStatefulSets("sdi", obs, ctx)
+			var progressing *ProgressingError
+			if tt.recreated {
+				if !errors.As(err, &progressing) || progressing.Reason != sdiv1alpha1.ReasonStatefulSetRecreating {
+					t.Fatalf("Expected the recreation to be in progress, got %v", err)
+				}
+				saved := client.ObjectKey{Name: savedStatefulSetName(obs, VSystemVrepStsName), Namespace: "operators"}
+				if err := c.Get(ctx, saved, &corev1.ConfigMap{}); err != nil {
+					t.Fatalf("Expected the statefulset to be saved, got %v", err)
+				}
+				err = a.AdjustSDIVSystemVrepStatefulSets("sdi", obs, ctx)
+				if err := c.Get(ctx, saved, &corev1.ConfigMap{}); !apierrors.IsNotFound(err) {
+					t.Errorf("Expected the saved statefulset to be removed, got %v", err)
+				}
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+
+			got := &appsv1.StatefulSet{}
+			if err := c.Get(ctx, client.ObjectKeyFromObject(tt.ss), got); err != nil {
+				t.Fatalf("Failed to get statefulset: %v", err)
+			}
+			if updated := got.ResourceVersion != existing.ResourceVersion; updated != tt.updated {
+				t.Errorf("Expected updated %v, got %v", tt.updated, updated)
+			}
+			if recreated := got.UID != existing.UID; recreated != tt.recreated {
+				t.Errorf("Expected recreated %v, got %v", tt.recreated, recreated)
+			}
+
+			var claims []string
+			for _, claim := range got.Spec.VolumeClaimTemplates {
+				claims = append(claims, claim.Name)
+			}
+			if !slices.Equal(claims, tt.claims) {
+				t.Errorf("Expected claims %v, got %v", tt.claims, claims)
+			}
+			spec := got.Spec.Template.Spec
+			if volumes := spec.Volumes; len(volumes) != 1 || volumes[0].Name != VolumeName || volumes[0].EmptyDir == nil {
+				t.Errorf("Expected the exports-mask emptyDir volume, got %v", volumes)
+			}
+			var exports []string
+			for _, vm := range spec.Containers[0].VolumeMounts {
+				if vm.MountPath == VRepExportsMountPath {
+					exports = append(exports, vm.Name)
+				}
+			}
+			if !slices.Equal(exports, []string{VolumeName}) {
+				t.Errorf("Expected exports-mask to be mounted once on /exports, got %v", spec.Containers[0].VolumeMounts)
+			}
+			if initMounts := spec.InitContainers[0].VolumeMounts; !equality.Semantic.DeepEqual(initMounts, tt.initMounts) {
+				t.Errorf("Expected init container mounts %v, got %v", tt.initMounts, initMounts)
+			}
+		})
+	}
+}
+
+func TestAdjustSDIVSystemVrepStatefulSets_DryRunRecreate(t *testing.T) {
+	ss := newVRepStatefulSet([]corev1.PersistentVolumeClaim{exportsClaim("exports", "500Mi")}, nil, nil, nil)
+	a := newSDIConfigTestAdjuster(t, ss)
+	a.EnableDryRun()
+	ctx := context.Background()
+
+	obs := &sdiv1alpha1.SDIObserver{ObjectMeta: metav1.ObjectMeta{Name: "sdi", Namespace: "operators"}}
+	if err := a.recreateStatefulSet(ctx, obs, ss); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	var actions []string
+	for _, change := range a.Plan() {
+		actions = append(actions, change.Action+" "+change.Kind)
+	}
+	if expected := []string{"Create ConfigMap", "Delete StatefulSet", "Create StatefulSet"}; !slices.Equal(actions, expected) {
+		t.Errorf("Expected plan %v, got %v", expected, actions)
+	}
+	if err := a.Client.Get(ctx, client.ObjectKeyFromObject(ss), &appsv1.StatefulSet{}); err != nil {
+		t.Errorf("Expected the statefulset to be kept, got %v", err)
+	}
+}
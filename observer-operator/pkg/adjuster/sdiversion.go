@@ -0,0 +1,185 @@
+package adjuster
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	sdiv1alpha1 "github.com/redhat-sap/sap-data-intelligence/observer-operator/api/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// SDIProfile describes the adjustments needed by a release of SDI. The releases differ in the service
+// accounts of their workloads. The diagnostics fluentd and vsystem-vrep patches are needed by all of them
+// and are applied once the release is known to be supported.
+type SDIProfile struct {
+	// Version is the major.minor version of the SDI release.
+	Version string
+	// PrivilegedServiceAccounts are the service accounts allowed to run privileged pods. The NamespacePlaceholder
+	// is replaced with the SDI namespace.
+	PrivilegedServiceAccounts []string
+}
+
+// NamespacePlaceholder is replaced with the SDI namespace in the service account names of a profile.
+const NamespacePlaceholder = "${NAMESPACE}"
+
+// SDIProfiles are the SDI releases supported by the operator, keyed by their major.minor version.
+var SDIProfiles = map[string]SDIProfile{
+	"3.2": {
+		Version: "3.2",
+		PrivilegedServiceAccounts: []string{
+			"default",
+			"diagnostics-fluentd",
+			"elasticsearch",
+			"mlf-deployment-api",
+			"pipeline-modeler",
+			"storagegateway",
+			"vora-vflow-server",
+			"vora-vsystem-" + NamespacePlaceholder,
+			"vora-vsystem-" + NamespacePlaceholder + "-vrep",
+			"vsystem",
+			// The diagnostics service accounts are prefixed with the namespace up to SDI 3.2.
+			NamespacePlaceholder + "-elasticsearch",
+			NamespacePlaceholder + "-fluentd",
+		},
+	},
+	"3.3": {
+		Version: "3.3",
+		PrivilegedServiceAccounts: []string{
+			"default",
+			"diagnostics-fluentd",
+			"elasticsearch",
+			"mlf-deployment-api",
+			"pipeline-modeler",
+			"storagegateway",
+			"vora-vflow-server",
+			"vora-vsystem-" + NamespacePlaceholder,
+			"vora-vsystem-" + NamespacePlaceholder + "-vrep",
+			"vsystem",
+			"diagnostics-elasticsearch",
+			// Backup and restore of HANA
+			"backup-agent",
+			"hana-service-account",
+		},
+	},
+}
+
+// installProfile is used until the version of SDI is known, i.e. before and during its installation. The
+// service accounts of all the supported releases are granted the privileges the installation needs and the
+// SDI workloads are patched as soon as they show up.
+func installProfile() SDIProfile {
+	var profile SDIProfile
+	seen := map[string]struct{}{}
+	for _, version := range sortedKeys(SDIProfiles) {
+		for _, sa := range SDIProfiles[version].PrivilegedServiceAccounts {
+			if _, ok := seen[sa]; !ok {
+				seen[sa] = struct{}{}
+				profile.PrivilegedServiceAccounts = append(profile.PrivilegedServiceAccounts, sa)
+			}
+		}
+	}
+	return profile
+}
+
+// SupportedSDIVersions returns the major.minor versions of the supported SDI releases.
+func SupportedSDIVersions() []string {
+	return sortedKeys(SDIProfiles)
+}
+
+// privilegedSubjects returns the subjects of the privileged role binding in the SDI namespace.
+func (p SDIProfile) privilegedSubjects(ns string) []rbacv1.Subject {
+	subjects := make([]rbacv1.Subject, 0, len(p.PrivilegedServiceAccounts))
+	for _, sa := range p.PrivilegedServiceAccounts {
+		subjects = append(subjects, rbacv1.Subject{
+			Kind:      rbacv1.ServiceAccountKind,
+			Name:      strings.ReplaceAll(sa, NamespacePlaceholder, ns),
+			Namespace: ns,
+		})
+	}
+	return subjects
+}
+
+var sdiVersionPattern = regexp.MustCompile(`^v?(\d+)\.(\d+)`)
+
+// majorMinor returns the major.minor part of the version, or an empty string if it is not a version.
+func majorMinor(version string) string {
+	m := sdiVersionPattern.FindStringSubmatch(strings.TrimSpace(version))
+	if m == nil {
+		return ""
+	}
+	return m[1] + "." + m[2]
+}
+
+// SDIProfile detects the version of SDI installed in the namespace, reports it in the SDIConfigStatus and
+// returns the matching profile. The install profile is returned while SDI is not installed. An unsupported
+// error is returned for an unsupported version so that SDI is not half-patched.
+func (a *Adjuster) SDIProfile(ns string, obs *sdiv1alpha1.SDIObserver, ctx context.Context) (SDIProfile, error) {
+	version, err := a.detectSDIVersion(ns, ctx)
+	if err != nil {
+		return SDIProfile{}, err
+	}
+	obs.Status.SDIConfigStatus.DetectedVersion = version
+	if version == "" {
+		a.logger.Info(fmt.Sprintf("SDI version in namespace %s is not known yet; using the installation profile", ns))
+		return installProfile(), nil
+	}
+
+	profile, ok := SDIProfiles[majorMinor(version)]
+	if !ok {
+		return SDIProfile{}, Unsupported(sdiv1alpha1.ReasonUnsupportedSDIVersion,
+			fmt.Sprintf("SDI version %s is not supported, supported versions are %s", version, strings.Join(SupportedSDIVersions(), ", ")))
+	}
+	a.logger.Info(fmt.Sprintf("Detected SDI version %s in namespace %s", version, ns))
+	return profile, nil
+}
+
+// detectSDIVersion returns the version of SDI installed in the namespace, or an empty string if it is not
+// known. The version is read from the DataHub resource, falling back to the app-version label of the SDI
+// workloads.
+func (a *Adjuster) detectSDIVersion(ns string, ctx context.Context) (string, error) {
+	dataHubs, err := a.listDataHubs(ns, ctx)
+	if err != nil && !errors.IsNotFound(err) && !meta.IsNoMatchError(err) {
+		return "", err
+	}
+	for i := range dataHubs {
+		if version := dataHubVersion(&dataHubs[i]); version != "" {
+			return version, nil
+		}
+	}
+
+	for _, workload := range []client.Object{
+		&appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Name: VSystemVrepStsName, Namespace: ns}},
+		&appsv1.DaemonSet{ObjectMeta: metav1.ObjectMeta{Name: DiagnosticFluentdName, Namespace: ns}},
+	} {
+		if err := a.Client.Get(ctx, client.ObjectKeyFromObject(workload), workload); err != nil {
+			if errors.IsNotFound(err) {
+				continue
+			}
+			return "", fmt.Errorf("unable to get %s: %w", workload.GetName(), err)
+		}
+		if version := workload.GetLabels()[AppVersionLabel]; version != "" {
+			return version, nil
+		}
+	}
+	return "", nil
+}
+
+// dataHubVersion returns the version of the DataHub resource from its app-version label or its spec.
+func dataHubVersion(dataHub *unstructured.Unstructured) string {
+	if version := dataHub.GetLabels()[AppVersionLabel]; version != "" {
+		return version
+	}
+	for _, field := range [][]string{{"status", "version"}, {"spec", "version"}} {
+		if version, found, err := unstructured.NestedString(dataHub.Object, field...); err == nil && found && version != "" {
+			return version
+		}
+	}
+	return ""
+}
@@ -0,0 +1,153 @@
+package adjuster
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/go-logr/logr"
+	sdiv1alpha1 "github.com/redhat-sap/sap-data-intelligence/observer-operator/api/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newDataHubWithVersion(labelVersion, specVersion string) *unstructured.Unstructured {
+	dataHub := &unstructured.Unstructured{Object: map[string]interface{}{
+		"spec": map[string]interface{}{"version": specVersion},
+	}}
+	dataHub.SetGroupVersionKind(schema.GroupVersionKind{Group: DataHubAPIGroup, Version: DataHubAPIVersion, Kind: DataHubKind})
+	dataHub.SetName("default")
+	dataHub.SetNamespace("sdi")
+	if labelVersion != "" {
+		dataHub.SetLabels(map[string]string{AppVersionLabel: labelVersion})
+	}
+	return dataHub
+}
+
+func TestSDIProfile(t *testing.T) {
+	vrep := func(version string) *appsv1.StatefulSet {
+		return &appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{
+			Name:      VSystemVrepStsName,
+			Namespace: "sdi",
+			Labels:    map[string]string{AppVersionLabel: version},
+		}}
+	}
+
+	for _, tt := range []struct {
+		name        string
+		objs        []client.Object
+		version     string
+		profile     string
+		unsupported bool
+	}{
+		{name: "not installed", profile: ""},
+		{name: "DataHub label", objs: []client.Object{newDataHubWithVersion("3.3.37", "3.2.1")}, version: "3.3.37", profile: "3.3"},
+		{name: "DataHub spec", objs: []client.Object{newDataHubWithVersion("", "3.2.20")}, version: "3.2.20", profile: "3.2"},
+		{name: "workload label", objs: []client.Object{vrep("v3.3.5")}, version: "v3.3.5", profile: "3.3"},
+		{name: "unsupported", objs: []client.Object{vrep("3.4.0")}, version: "3.4.0", unsupported: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			scheme := newNodeConfiguratorScheme(t)
+			gvk := schema.GroupVersionKind{Group: DataHubAPIGroup, Version: DataHubAPIVersion, Kind: DataHubKind}
+			scheme.AddKnownTypeWithName(gvk, &unstructured.Unstructured{})
+			scheme.AddKnownTypeWithName(gvk.GroupVersion().WithKind(DataHubKind+"List"), &unstructured.UnstructuredList{})
+			c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(tt.objs...).Build()
+			a := New("test-name", "operators", c, scheme, logr.Discard())
+			obs := &sdiv1alpha1.SDIObserver{}
+
+			profile, err := a.SDIProfile("sdi", obs, context.Background())
+			var unsupported *UnsupportedError
+			switch {
+			case tt.unsupported:
+				if !errors.As(err, &unsupported) || unsupported.Reason != sdiv1alpha1.ReasonUnsupportedSDIVersion {
+					t.Errorf("Expected unsupported version to be reported, got %v", err)
+				}
+			case err != nil:
+				t.Fatalf("Expected no error, got %v", err)
+			case profile.Version != tt.profile:
+				t.Errorf("Expected profile %q, got %q", tt.profile, profile.Version)
+			}
+			if got := obs.Status.SDIConfigStatus.DetectedVersion; got != tt.version {
+				t.Errorf("Expected detected version %q, got %q", tt.version, got)
+			}
+		})
+	}
+}
+
+func TestInstallProfile(t *testing.T) {
+	profile := installProfile()
+	subjects := map[string]bool{}
+	for _, subject := range profile.privilegedSubjects("sdi") {
+		if subjects[subject.Name] {
+			t.Errorf("Expected subject %s once", subject.Name)
+		}
+		subjects[subject.Name] = true
+	}
+	for _, version := range SupportedSDIVersions() {
+		for _, subject := range SDIProfiles[version].privilegedSubjects("sdi") {
+			if !subjects[subject.Name] {
+				t.Errorf("Expected subject %s of SDI %s in the install profile", subject.Name, version)
+			}
+		}
+	}
+}
+
+func TestAdjustSDIRbac_ProfileSubjects(t *testing.T) {
+	scheme := newNodeConfiguratorScheme(t)
+	c := withServerSideApply(fake.NewClientBuilder().WithScheme(scheme)).Build()
+	a := New("test-name", "operators", c, scheme, logr.Discard())
+	ctx := context.Background()
+	obs := &sdiv1alpha1.SDIObserver{ObjectMeta: metav1.ObjectMeta{Name: "sdi", Namespace: "operators", UID: "sdi-uid"}}
+
+	if err := a.AdjustSDIRbac("sdi", SDIProfiles["3.2"], obs, ctx); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	binding := &rbacv1.RoleBinding{}
+	if err := c.Get(ctx, client.ObjectKey{Name: "sdi-privileged", Namespace: "sdi"}, binding); err != nil {
+		t.Fatalf("Failed to get role binding: %v", err)
+	}
+	names := map[string]bool{}
+	for _, subject := range binding.Subjects {
+		names[subject.Name] = true
+		if subject.Kind != rbacv1.ServiceAccountKind || subject.Namespace != "sdi" {
+			t.Errorf("Expected a service account in namespace sdi, got %v", subject)
+		}
+	}
+	if !names["sdi-fluentd"] || !names["vora-vsystem-sdi-vrep"] || !names["storagegateway"] || names["backup-agent"] {
+		t.Errorf("Expected the SDI 3.2 service accounts, got %v", binding.Subjects)
+	}
+}
+
+func TestSDIProfiles_VersionDifferences(t *testing.T) {
+	privileged := func(version string) map[string]bool {
+		names := map[string]bool{}
+		for _, subject := range SDIProfiles[version].privilegedSubjects("sdi") {
+			names[subject.Name] = true
+		}
+		return names
+	}
+	sdi32, sdi33 := privileged("3.2"), privileged("3.3")
+
+	// The service accounts common to the releases.
+	for _, sa := range []string{"vsystem", "storagegateway", "elasticsearch", "diagnostics-fluentd", "vora-vsystem-sdi"} {
+		if !sdi32[sa] || !sdi33[sa] {
+			t.Errorf("Expected %s to be privileged in both releases", sa)
+		}
+	}
+	// The diagnostics service accounts are renamed and the HANA backups are introduced in SDI 3.3.
+	for _, sa := range []string{"sdi-fluentd", "sdi-elasticsearch"} {
+		if !sdi32[sa] || sdi33[sa] {
+			t.Errorf("Expected %s to be privileged in SDI 3.2 only", sa)
+		}
+	}
+	for _, sa := range []string{"diagnostics-elasticsearch", "backup-agent", "hana-service-account"} {
+		if sdi32[sa] || !sdi33[sa] {
+			t.Errorf("Expected %s to be privileged in SDI 3.3 only", sa)
+		}
+	}
+}
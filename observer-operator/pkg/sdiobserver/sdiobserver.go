@@ -12,6 +12,8 @@ import (
 // SDIObserver encapsulates operations to adjust SDIObserver resources.
 type SDIObserver struct {
 	obs *sdiv1alpha1.SDIObserver
+	// profile is the profile of the SDI version detected by DetectSDIVersion; nil if it is not supported.
+	profile *adjuster.SDIProfile
 }
 
 // New creates a new SDIObserver instance.
@@ -23,7 +25,17 @@ func New(obs *sdiv1alpha1.SDIObserver) *SDIObserver {
 func (so *SDIObserver) AdjustNodes(a *adjuster.Adjuster, ctx context.Context) error {
 	if !so.obs.Spec.ManageSDINodeConfig {
 		a.Logger().V(0).Info("Node config is unmanaged; skipping adjustment.")
-		return nil
+		return adjuster.Skip(sdiv1alpha1.ReasonNodeConfigUnmanaged, "Node config is unmanaged")
+	}
+
+	owner, err := a.NodeConfigOwner(ctx)
+	if err != nil {
+		return err
+	}
+	if owner != nil && !adjuster.IsSameObserver(owner, so.obs) {
+		a.Logger().V(0).Info("Node config is managed by another SDIObserver; skipping adjustment.", "owner", owner.Namespace+"/"+owner.Name)
+		return adjuster.Skip(sdiv1alpha1.ReasonNodeConfigOwnedByOther,
+			fmt.Sprintf("Node config is managed by SDIObserver %s/%s", owner.Namespace, owner.Name))
 	}
 
 	a.Logger().V(0).Info("Adjusting SDI nodes.")
@@ -41,55 +53,201 @@ func (so *SDIObserver) AdjustStorage(a *adjuster.Adjuster, _ context.Context) er
 	return nil
 }
 
-// AdjustSDIConfig adjusts SDI configuration components such as namespaces, RBAC, and daemon sets.
-func (so *SDIObserver) AdjustSDIConfig(a *adjuster.Adjuster, ctx context.Context) error {
-	a.Logger().V(0).Info("Adjusting SDI configuration.")
+// DetectSDIVersion detects the SDI version and selects the profile of the version-specific adjustments.
+func (so *SDIObserver) DetectSDIVersion(a *adjuster.Adjuster, ctx context.Context) error {
+	so.profile = nil
+	profile, err := a.SDIProfile(so.obs.Spec.SDINamespace, so.obs, ctx)
+	if err != nil {
+		return err
+	}
+	so.profile = &profile
+	return nil
+}
+
+// versionProfile returns the profile selected by DetectSDIVersion. The adjustments depending on it are
+// reported as unsupported for an unsupported SDI version, which is left untouched.
+func (so *SDIObserver) versionProfile() (adjuster.SDIProfile, error) {
+	if so.profile == nil {
+		return adjuster.SDIProfile{}, adjuster.Unsupported(sdiv1alpha1.ReasonUnsupportedSDIVersion,
+			fmt.Sprintf("SDI version %s is not supported", so.obs.Status.SDIConfigStatus.DetectedVersion))
+	}
+	return *so.profile, nil
+}
 
-	for _, ns := range []string{a.Namespace, so.obs.Spec.SDINamespace, so.obs.Spec.SLCBNamespace, adjuster.DataHubSystemNamespace} {
-		if err := a.AdjustNamespaceAnnotation(ns, so.obs.Spec.SDINodeLabel, ctx); err != nil {
+// AdjustSDINamespaces sets the node selector of the SDI and SLC Bridge namespaces.
+func (so *SDIObserver) AdjustSDINamespaces(a *adjuster.Adjuster, ctx context.Context) error {
+	a.Logger().V(0).Info("Adjusting SDI namespaces.")
+
+	// The namespace of the observers, the SLC Bridge namespace and the datahub-system namespace may be
+	// shared with other SDI instances; their node selector is set by their owner only, so that observers
+	// with different node labels do not overwrite each other.
+	namespaces := []string{so.obs.Spec.SDINamespace}
+	for _, shared := range []struct {
+		ns    string
+		owner func() (*sdiv1alpha1.SDIObserver, error)
+	}{
+		{a.Namespace, func() (*sdiv1alpha1.SDIObserver, error) { return a.ObserverNamespaceOwner(a.Namespace, ctx) }},
+		{so.obs.Spec.SLCBNamespace, func() (*sdiv1alpha1.SDIObserver, error) {
+			return a.SLCBRouteOwner(so.obs.Spec.SLCBNamespace, ctx)
+		}},
+		{adjuster.DataHubSystemNamespace, func() (*sdiv1alpha1.SDIObserver, error) { return a.SharedNamespaceOwner(ctx) }},
+	} {
+		owner, err := shared.owner()
+		if err != nil {
 			return err
 		}
+		if owner != nil && !adjuster.IsSameObserver(owner, so.obs) {
+			a.Logger().V(0).Info(fmt.Sprintf("Node selector of namespace %s is managed by another SDIObserver; skipping it.", shared.ns),
+				"owner", owner.Namespace+"/"+owner.Name)
+			continue
+		}
+		namespaces = append(namespaces, shared.ns)
+	}
+
+	var errs []error
+	for _, ns := range namespaces {
+		if err := a.AdjustNamespaceAnnotation(ns, so.obs.Spec.SDINodeLabel, ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return utilerrors.NewAggregate(errs)
+	}
+	a.Logger().Info("Successfully adjusted SDI namespaces.")
+	return nil
+}
+
+// AdjustSDIRbac grants the SDI service accounts of the detected version their privileges.
+func (so *SDIObserver) AdjustSDIRbac(a *adjuster.Adjuster, ctx context.Context) error {
+	profile, err := so.versionProfile()
+	if err != nil {
+		return err
+	}
+	a.Logger().V(0).Info("Adjusting SDI RBAC.")
+	if err := a.AdjustSDIRbac(so.obs.Spec.SDINamespace, profile, so.obs, ctx); err != nil {
+		return err
 	}
-	if err := a.AdjustSDIRbac(so.obs.Spec.SDINamespace, so.obs, ctx); err != nil {
+	a.Logger().Info("Successfully adjusted SDI RBAC.")
+	return nil
+}
+
+// AdjustSDIDiagnostics patches the diagnostics fluentd DaemonSet and configuration of a supported SDI
+// version.
+func (so *SDIObserver) AdjustSDIDiagnostics(a *adjuster.Adjuster, ctx context.Context) error {
+	if _, err := so.versionProfile(); err != nil {
 		return err
 	}
+	a.Logger().V(0).Info("Adjusting SDI diagnostics.")
 
 	var errs []error
-
 	if err := a.AdjustSDIDiagnosticsFluentdDaemonsetContainerPrivilege(so.obs.Spec.SDINamespace, so.obs, ctx); err != nil {
 		errs = append(errs, err)
 	}
-	if err := a.AdjustSDIVSystemVrepStatefulSets(so.obs.Spec.SDINamespace, so.obs, ctx); err != nil {
+	if err := a.AdjustSDIDiagnosticsFluentdConfig(so.obs.Spec.SDINamespace, so.obs, ctx); err != nil {
 		errs = append(errs, err)
 	}
-
 	if len(errs) > 0 {
 		return utilerrors.NewAggregate(errs)
 	}
+	a.Logger().Info("Successfully adjusted SDI diagnostics.")
+	return nil
+}
 
-	a.Logger().Info("Successfully adjusted SDI configuration.")
-
+// AdjustSDIVRep patches the vsystem-vrep StatefulSet of a supported SDI version.
+func (so *SDIObserver) AdjustSDIVRep(a *adjuster.Adjuster, ctx context.Context) error {
+	if _, err := so.versionProfile(); err != nil {
+		return err
+	}
+	a.Logger().V(0).Info("Adjusting SDI vsystem-vrep.")
+	if err := a.AdjustSDIVSystemVrepStatefulSets(so.obs.Spec.SDINamespace, so.obs, ctx); err != nil {
+		return err
+	}
+	a.Logger().Info("Successfully adjusted SDI vsystem-vrep.")
 	return nil
 }
 
-// AdjustSLCBNetwork adjusts the SLCB network configuration.
+// PruneSDIStatefulSets deletes the pods of the configured StatefulSets stuck on an outdated revision.
+func (so *SDIObserver) PruneSDIStatefulSets(a *adjuster.Adjuster, ctx context.Context) error {
+	return a.PruneStaleStatefulSetRevisions(so.obs.Spec.SDINamespace, so.obs.Spec.PruneStatefulSets, so.obs, ctx)
+}
+
+// AdjustSDIPullSecret links the SDI registry pull secret with the default service account.
+func (so *SDIObserver) AdjustSDIPullSecret(a *adjuster.Adjuster, ctx context.Context) error {
+	return a.AdjustSDIRegistryPullSecret(so.obs.Spec.SDINamespace, so.obs, ctx)
+}
+
+// AdjustSLCBNetwork adjusts the SLCB network configuration: the SLCB route and the additional routes in
+// the SLCB namespace.
 func (so *SDIObserver) AdjustSLCBNetwork(a *adjuster.Adjuster, ctx context.Context) error {
-	a.Logger().V(0).Info("Adjusting SLCB route.")
+	a.Logger().V(0).Info("Adjusting SLCB routes.")
 
-	if err := a.AdjustSLCBRoute(so.obs.Spec.SLCBNamespace, so.obs, ctx); err != nil {
+	// The SLC Bridge namespace may be shared with other SDI instances; its route is managed once.
+	owner, err := a.SLCBRouteOwner(so.obs.Spec.SLCBNamespace, ctx)
+	if err != nil {
+		return err
+	}
+	var presetErr error
+	if owner != nil && !adjuster.IsSameObserver(owner, so.obs) {
+		a.Logger().V(0).Info("SLCB route is managed by another SDIObserver; skipping adjustment.", "owner", owner.Namespace+"/"+owner.Name)
+		presetErr = adjuster.Skip(sdiv1alpha1.ReasonSLCBRouteOwnedByOther,
+			fmt.Sprintf("SLCB route is managed by SDIObserver %s/%s", owner.Namespace, owner.Name))
+	} else {
+		presetErr = a.AdjustSLCBRoute(so.obs.Spec.SLCBNamespace, so.obs, ctx)
+	}
+	routesErr := a.AdjustRoutes(so.obs.Spec.SLCBNamespace, so.obs, ctx)
+	if err := networkError(presetErr, routesErr); err != nil {
 		return err
 	}
-	a.Logger().Info("Successfully adjusted SLCB route.")
+	a.Logger().Info("Successfully adjusted SLCB routes.")
 	return nil
 }
 
-// AdjustSDINetwork adjusts the SDI network configuration.
+// AdjustSDINetwork adjusts the SDI network configuration: the vsystem route and the additional routes in
+// the SDI namespace.
 func (so *SDIObserver) AdjustSDINetwork(a *adjuster.Adjuster, ctx context.Context) error {
-	a.Logger().V(0).Info("Adjusting SDI route.")
+	a.Logger().V(0).Info("Adjusting SDI routes.")
+
+	presetErr := a.AdjustSDIVsystemRoute(so.obs.Spec.SDINamespace, so.obs, ctx)
+	if presetErr != nil {
+		presetErr = fmt.Errorf("failed to adjust SDI VSystem route: %w", presetErr)
+	}
+	routesErr := a.AdjustRoutes(so.obs.Spec.SDINamespace, so.obs, ctx)
+	if err := networkError(presetErr, routesErr); err != nil {
+		return err
+	}
+	a.Logger().Info("Successfully adjusted SDI routes.")
+	return nil
+}
+
+// AdjustCABundle propagates the configured CA certificates to the cluster image configuration and to SDI.
+func (so *SDIObserver) AdjustCABundle(a *adjuster.Adjuster, ctx context.Context) error {
+	a.Logger().V(0).Info("Adjusting CA bundle.")
+	if err := a.AdjustCABundle(so.obs, ctx); err != nil {
+		return err
+	}
+	a.Logger().Info("Successfully adjusted CA bundle.")
+	return nil
+}
 
-	if err := a.AdjustSDIVsystemRoute(so.obs.Spec.SDINamespace, so.obs, ctx); err != nil {
-		return fmt.Errorf("failed to adjust SDI VSystem route: %w", err)
+// CheckCertificates reports the expiry of the certificates handled by the operator and verifies the
+// certificate chain of vsystem.
+func (so *SDIObserver) CheckCertificates(a *adjuster.Adjuster, ctx context.Context) error {
+	a.Logger().V(0).Info("Checking certificates.")
+	if err := a.CheckCertificates(so.obs, ctx); err != nil {
+		return err
 	}
-	a.Logger().Info("Successfully adjusted SDI route.")
+	a.Logger().Info("Successfully checked certificates.")
 	return nil
 }
+
+// networkError combines the outcome of a preset route with the one of the additional routes. A skipped
+// preset is reported as such only if the additional routes succeeded.
+func networkError(presetErr, routesErr error) error {
+	switch {
+	case routesErr == nil:
+		return presetErr
+	case presetErr == nil:
+		return routesErr
+	}
+	return utilerrors.NewAggregate([]error{presetErr, routesErr})
+}
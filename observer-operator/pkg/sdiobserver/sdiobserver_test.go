@@ -1,10 +1,19 @@
 package sdiobserver
 
 import (
+	"context"
+	"errors"
 	"testing"
+	"time"
 
+	"github.com/go-logr/logr"
 	sdiv1alpha1 "github.com/redhat-sap/sap-data-intelligence/observer-operator/api/v1alpha1"
+	"github.com/redhat-sap/sap-data-intelligence/observer-operator/pkg/adjuster"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 )
 
 func TestNew(t *testing.T) {
@@ -69,5 +78,71 @@ func TestSDIObserver_AdjustNodes_Unmanaged(t *testing.T) {
 	}
 }
 
+func TestSDIObserver_VersionSpecificStepsUnsupportedForUnsupportedVersion(t *testing.T) {
+	obs := &sdiv1alpha1.SDIObserver{Spec: sdiv1alpha1.SDIObserverSpec{SDINamespace: "sdi"}}
+	obs.Status.SDIConfigStatus.DetectedVersion = "2.9.0"
+	sdiObserver := New(obs)
+
+	var unsupported *adjuster.UnsupportedError
+	if err := sdiObserver.AdjustSDIVRep(nil, context.Background()); !errors.As(err, &unsupported) ||
+		unsupported.Reason != sdiv1alpha1.ReasonUnsupportedSDIVersion {
+		t.Errorf("Expected the vrep adjustment to be unsupported for an unsupported version, got %v", err)
+	}
+}
+
+func TestSDIObserver_AdjustSDINamespaces_SharedNamespaces(t *testing.T) {
+	scheme := runtime.NewScheme()
+	for _, add := range []func(*runtime.Scheme) error{corev1.AddToScheme, sdiv1alpha1.AddToScheme} {
+		if err := add(scheme); err != nil {
+			t.Fatalf("Failed to add scheme: %v", err)
+		}
+	}
+	now := time.Now().Truncate(time.Second)
+	newObs := func(name, label string, created time.Time) *sdiv1alpha1.SDIObserver {
+		return &sdiv1alpha1.SDIObserver{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "sdi-observer", CreationTimestamp: metav1.NewTime(created)},
+			Spec: sdiv1alpha1.SDIObserverSpec{
+				SDINamespace:  "sdi-" + name,
+				SLCBNamespace: "sap-slcbridge",
+				SDINodeLabel:  label,
+			},
+		}
+	}
+	dev := newObs("dev", "node-role.kubernetes.io/sdi-dev=", now.Add(-time.Hour))
+	prod := newObs("prod", "node-role.kubernetes.io/sdi-prod=", now)
+	objs := []client.Object{dev, prod}
+	for _, ns := range []string{"sdi-observer", "sdi-dev", "sdi-prod", "sap-slcbridge", adjuster.DataHubSystemNamespace} {
+		objs = append(objs, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: ns}})
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build()
+	ctx := context.Background()
+
+	// Whatever the order of the reconciliations, the shared namespaces keep the node label of the owner.
+	for i := 0; i < 2; i++ {
+		for _, obs := range []*sdiv1alpha1.SDIObserver{dev, prod} {
+			a := adjuster.New(obs.Name, obs.Namespace, c, scheme, logr.Discard())
+			if err := New(obs).AdjustSDINamespaces(a, ctx); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+		}
+	}
+
+	for ns, label := range map[string]string{
+		"sdi-observer":                  dev.Spec.SDINodeLabel,
+		"sap-slcbridge":                 dev.Spec.SDINodeLabel,
+		adjuster.DataHubSystemNamespace: dev.Spec.SDINodeLabel,
+		"sdi-dev":                       dev.Spec.SDINodeLabel,
+		"sdi-prod":                      prod.Spec.SDINodeLabel,
+	} {
+		namespace := &corev1.Namespace{}
+		if err := c.Get(ctx, client.ObjectKey{Name: ns}, namespace); err != nil {
+			t.Fatalf("Failed to get namespace %s: %v", ns, err)
+		}
+		if got := namespace.Annotations[adjuster.AnnotationKey]; got != label {
+			t.Errorf("Expected node selector %q of namespace %s, got %q", label, ns, got)
+		}
+	}
+}
+
 // Note: More comprehensive tests with mock adjusters can be added
 // in integration tests where we can properly mock the adjuster interface